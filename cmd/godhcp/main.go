@@ -32,9 +32,18 @@ const banner = `
 var (
 	configFile = flag.String("config", "example-config.yaml", "Path to configuration file")
 	version    = flag.Bool("version", false, "Print version and exit")
+	storageOpt = flag.String("storage", "", "Override database.driver (postgres, bolt or memory)")
 )
 
 func main() {
+	// Subcommands take their own flags
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "plan" {
+		os.Exit(runPlan(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	if *version {
@@ -45,7 +54,7 @@ func main() {
 	fmt.Print(banner)
 
 	// Load configuration
-	cfg, err := config.Load(*configFile)
+	cfg, err := config.LoadWithDriver(*configFile, *storageOpt)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
 		os.Exit(1)
@@ -68,30 +77,26 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Ensure database exists and run migrations
-	logger.Info().Msg("Initializing database")
-	if err := storage.EnsureDatabase(ctx, cfg.Database.Connection); err != nil {
-		logger.Fatal().Err(err).Msg("Failed to initialize database")
-	}
+	// Initialize metrics
+	m := metrics.New()
+	logger.Info().Msg("Initialized Prometheus metrics")
 
-	// Connect to database
-	logger.Info().Msg("Connecting to database")
-	store, err := storage.New(ctx, storage.Config{
-		ConnectionString: cfg.Database.Connection,
-		MaxConnections:   cfg.Database.MaxConnections,
-		MinConnections:   cfg.Database.MinConnections,
-	})
+	// Open the configured storage backend
+	store, err := openStore(ctx, cfg)
 	if err != nil {
-		logger.Fatal().Err(err).Msg("Failed to connect to database")
+		logger.Fatal().Err(err).Msg("Failed to open database")
+	}
+	if cfg.Database.BatchWrites {
+		// Renewals are written behind; Close flushes them before the database closes
+		store = storage.NewBatchedStore(store, cfg.Database.BatchInterval, m)
+		logger.Info().
+			Dur("interval", cfg.Database.BatchInterval).
+			Msg("Batching lease renewals")
 	}
 	defer store.Close()
 
 	logger.Info().Msg("Database connection established")
 
-	// Initialize metrics
-	_ = metrics.New()
-	logger.Info().Msg("Initialized Prometheus metrics")
-
 	// Initialize event broadcaster for activity log
 	broadcaster := events.NewBroadcaster()
 	broadcaster.Start(ctx)
@@ -101,6 +106,7 @@ func main() {
 	var gitPoller *gitops.Poller
 	var syncService *gitops.SyncService
 	var expiryWorker *dhcp.ExpiryWorker
+	var quarantineWorker *dhcp.QuarantineWorker
 
 	if cfg.Git.Enabled {
 		logger.Info().
@@ -118,9 +124,18 @@ func main() {
 		}
 
 		// Add authentication if configured
-		if cfg.Git.Auth.Type == "token" && cfg.Git.Auth.Token != "" {
-			repoConfig.Username = "git"
-			repoConfig.Password = cfg.Git.Auth.Token
+		switch cfg.Git.Auth.Type {
+		case "token":
+			if cfg.Git.Auth.Token != "" {
+				repoConfig.Username = "git"
+				repoConfig.Password = cfg.Git.Auth.Token
+			}
+		case "ssh":
+			repoConfig.PrivateKeyPath = cfg.Git.Auth.SSHKeyPath
+			repoConfig.PrivateKeyPass = cfg.Git.Auth.SSHKeyPassphrase
+			repoConfig.SSHAgent = cfg.Git.Auth.SSHAgent
+			repoConfig.SSHUser = cfg.Git.Auth.SSHUser
+			repoConfig.KnownHostsPath = cfg.Git.Auth.KnownHosts
 		}
 
 		repo := gitops.NewRepository(repoConfig)
@@ -140,9 +155,12 @@ func main() {
 
 		// If GitOps is disabled, sync reservations from local config
 		logger.Info().Msg("Syncing reservations from config to database")
-		if err := syncReservations(ctx, store, cfg); err != nil {
+		if err := gitops.SyncReservations(ctx, store, cfg.Subnets); err != nil {
 			logger.Warn().Err(err).Msg("Failed to sync reservations")
 		}
+		if err := gitops.RecordActiveConfig(ctx, store, "local", cfg.Subnets); err != nil {
+			logger.Warn().Err(err).Msg("Failed to record active configuration")
+		}
 	}
 
 	// Create DHCP server
@@ -164,6 +182,7 @@ func main() {
 			Port:    cfg.Observability.WebPort,
 			Enabled: cfg.Observability.WebEnabled,
 			WebAuth: &cfg.Observability.WebAuth,
+			Webhook: &cfg.Git.Webhook,
 		}, store, gitPoller, broadcaster, cfg)
 
 		if err := apiServer.Start(ctx); err != nil {
@@ -203,6 +222,12 @@ func main() {
 		logger.Fatal().Err(err).Msg("Failed to start lease expiry worker")
 	}
 
+	// Start declined address quarantine worker
+	quarantineWorker = dhcp.NewQuarantineWorker(store, m, time.Minute)
+	if err := quarantineWorker.Start(ctx); err != nil {
+		logger.Fatal().Err(err).Msg("Failed to start quarantine worker")
+	}
+
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -230,6 +255,13 @@ func main() {
 		}
 	}
 
+	// Stop declined address quarantine worker
+	if quarantineWorker != nil {
+		if err := quarantineWorker.Stop(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("Error stopping quarantine worker")
+		}
+	}
+
 	// Stop DHCP server
 	if dhcpServer != nil {
 		if err := dhcpServer.Stop(shutdownCtx); err != nil {
@@ -247,103 +279,40 @@ func main() {
 	logger.Info().Msg("Server stopped. Goodbye!")
 }
 
-// syncReservations syncs reservations from config to database
-// This is a simple implementation for Phase 1
-// Phase 2 will use GitOps for configuration management
-func syncReservations(ctx context.Context, store *storage.Store, cfg *config.Config) error {
-	// Get existing reservations
-	existing, err := store.GetAllReservations(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get existing reservations: %w", err)
-	}
-
-	// Build map of existing reservations by MAC
-	existingMap := make(map[string]*storage.Reservation)
-	for _, res := range existing {
-		existingMap[res.MAC.String()] = res
-	}
-
-	// Sync reservations from config
-	for _, subnetCfg := range cfg.Subnets {
-		_, network, _ := config.ParseCIDR(subnetCfg.Network)
-
-		for _, resCfg := range subnetCfg.Reservations {
-			mac, _ := config.ParseMAC(resCfg.MAC)
-			ip := config.ParseIP(resCfg.IP)
-
-			// Extract boot options if present
-			var tftpServer, bootFilename string
-			if resCfg.Boot != nil {
-				tftpServer = resCfg.Boot.TFTPServer
-				bootFilename = resCfg.Boot.Filename
-			}
+// openStore opens the storage backend selected by database.driver
+func openStore(ctx context.Context, cfg *config.Config) (storage.Backend, error) {
+	switch cfg.Database.Driver {
+	case storage.DriverBolt:
+		logger.Info().
+			Str("path", cfg.Database.Path).
+			Msg("Opening embedded database")
+		store, err := storage.OpenEmbedded(cfg.Database.Path)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
 
-			// Check if reservation exists
-			if existingRes, found := existingMap[mac.String()]; found {
-				// Update if changed
-				if !existingRes.IP.Equal(ip) || existingRes.Hostname != resCfg.Hostname ||
-					existingRes.Description != resCfg.Description ||
-					existingRes.TFTPServer != tftpServer || existingRes.BootFilename != bootFilename {
-					existingRes.IP = ip
-					existingRes.Hostname = resCfg.Hostname
-					existingRes.Subnet = network
-					existingRes.Description = resCfg.Description
-					existingRes.TFTPServer = tftpServer
-					existingRes.BootFilename = bootFilename
-
-					if err := store.UpdateReservation(ctx, existingRes); err != nil {
-						logger.Error().
-							Err(err).
-							Str("mac", mac.String()).
-							Msg("Failed to update reservation")
-					} else {
-						logger.Info().
-							Str("mac", mac.String()).
-							Str("ip", ip.String()).
-							Msg("Updated reservation")
-					}
-				}
-				delete(existingMap, mac.String())
-			} else {
-				// Create new reservation
-				newRes := &storage.Reservation{
-					MAC:          mac,
-					IP:           ip,
-					Hostname:     resCfg.Hostname,
-					Subnet:       network,
-					Description:  resCfg.Description,
-					TFTPServer:   tftpServer,
-					BootFilename: bootFilename,
-				}
+	case storage.DriverMemory:
+		logger.Warn().Msg("Using in-memory storage; leases and reservations are lost on exit")
+		return storage.NewMemoryStore(), nil
 
-				if err := store.CreateReservation(ctx, newRes); err != nil {
-					logger.Error().
-						Err(err).
-						Str("mac", mac.String()).
-						Msg("Failed to create reservation")
-				} else {
-					logger.Info().
-						Str("mac", mac.String()).
-						Str("ip", ip.String()).
-						Msg("Created reservation")
-				}
-			}
+	default:
+		// Ensure database exists and run migrations
+		logger.Info().Msg("Initializing database")
+		if err := storage.EnsureDatabase(ctx, cfg.Database.Connection); err != nil {
+			return nil, fmt.Errorf("failed to initialize database: %w", err)
 		}
-	}
 
-	// Delete reservations that are no longer in config
-	for _, res := range existingMap {
-		if err := store.DeleteReservation(ctx, res.ID); err != nil {
-			logger.Error().
-				Err(err).
-				Str("mac", res.MAC.String()).
-				Msg("Failed to delete reservation")
-		} else {
-			logger.Info().
-				Str("mac", res.MAC.String()).
-				Msg("Deleted reservation")
+		// Connect to database
+		logger.Info().Msg("Connecting to database")
+		store, err := storage.New(ctx, storage.Config{
+			ConnectionString: cfg.Database.Connection,
+			MaxConnections:   cfg.Database.MaxConnections,
+			MinConnections:   cfg.Database.MinConnections,
+		})
+		if err != nil {
+			return nil, err
 		}
+		return store, nil
 	}
-
-	return nil
 }
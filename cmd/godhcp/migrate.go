@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+const migrateUsage = `Usage: godhcp migrate <status|up|down> [-config file] [-steps n]
+
+  status  List migrations and whether they are applied
+  up      Apply all pending migrations
+  down    Revert the last -steps applied migrations (default 1)
+`
+
+// runMigrate implements "godhcp migrate" and returns the process exit code
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+	configPath := fs.String("config", "example-config.yaml", "Path to configuration file")
+	steps := fs.Int("steps", 1, "Number of migrations to revert with down")
+
+	// Flags may come before or after the action
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	action := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	if cfg.Database.Driver != storage.DriverPostgres {
+		fmt.Fprintf(os.Stderr, "Migrations only apply to the postgres driver (database.driver is %s)\n", cfg.Database.Driver)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	migrator, err := storage.OpenMigrator(ctx, cfg.Database.Connection)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer migrator.Close(ctx)
+
+	switch action {
+	case "status":
+		err = printMigrationStatus(ctx, migrator)
+	case "up":
+		var applied []*storage.Migration
+		applied, err = migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("Applied %s\n", m)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+	case "down":
+		if *steps < 1 {
+			fmt.Fprintln(os.Stderr, "-steps must be at least 1")
+			return 2
+		}
+		var reverted []*storage.Migration
+		reverted, err = migrator.Down(ctx, *steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %s\n", m)
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// printMigrationStatus writes one line per migration
+// Returns an error if any applied script has drifted, so the command exits non-zero.
+func printMigrationStatus(ctx context.Context, migrator *storage.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+	drifted := 0
+	for _, s := range statuses {
+		state := "pending"
+		switch {
+		case s.Unknown:
+			state = "unknown"
+		case s.Drifted:
+			state = "drifted"
+			drifted++
+		case s.Applied:
+			state = "applied"
+		}
+
+		appliedAt := "-"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	w.Flush()
+
+	if drifted > 0 {
+		return fmt.Errorf("%d applied migration(s) changed since they were applied", drifted)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/gitops"
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+const planUsage = `Usage: godhcp plan [-config file] [-file proposed.yaml] [-json]
+
+Show what applying a configuration would change, without changing anything.
+Changes are relative to the configuration the server last applied.
+
+  -config  Server configuration file (default example-config.yaml)
+  -file    Proposed subnets file, as kept in the GitOps repository; required
+           when git is enabled, otherwise the subnets in -config are used
+  -json    Print the plan as JSON
+
+Exit status is 0 if the plan is safe to apply, 3 if it removes subnets or
+reservations or orphans active leases, 2 on a usage error, and 1 on any
+other error.
+`
+
+// planDestructiveExit is the exit code for a plan with destructive changes
+const planDestructiveExit = 3
+
+// runPlan implements "godhcp plan" and returns the process exit code
+func runPlan(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, planUsage) }
+	configPath := fs.String("config", "example-config.yaml", "Path to configuration file")
+	proposedPath := fs.String("file", "", "Path to the proposed subnets file")
+	asJSON := fs.Bool("json", false, "Print the plan as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	if cfg.Git.Enabled && *proposedPath == "" {
+		fmt.Fprintln(os.Stderr, "-file is required when git is enabled")
+		return 2
+	}
+
+	// Only warnings, e.g. subnets without pools, are worth showing here
+	if err := logger.Setup(logger.Config{Level: "warn", Format: "text"}); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to setup logger: %v\n", err)
+		return 1
+	}
+
+	proposed := cfg.Subnets
+	if *proposedPath != "" {
+		data, err := os.ReadFile(*proposedPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read proposed configuration: %v\n", err)
+			return 1
+		}
+		newConfig, err := gitops.ParseConfig(cfg, data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *proposedPath, err)
+			return 1
+		}
+		proposed = newConfig.Subnets
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	store, err := openPlanStore(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	current, active, err := gitops.ActiveSubnets(ctx, store)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if active == nil {
+		fmt.Fprintln(os.Stderr, "Warning: the server has not recorded an applied configuration; every subnet is shown as added")
+	}
+
+	plan, err := gitops.BuildPlan(ctx, store, current, proposed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(plan)
+	} else {
+		printPlan(os.Stdout, plan, active)
+	}
+
+	if plan.Destructive {
+		return planDestructiveExit
+	}
+	return 0
+}
+
+// openPlanStore opens the configured database without creating it or running migrations
+// An embedded database is locked while the server runs; use the API to plan against it.
+func openPlanStore(ctx context.Context, cfg *config.Config) (storage.Backend, error) {
+	switch cfg.Database.Driver {
+	case storage.DriverBolt:
+		store, err := storage.OpenEmbedded(cfg.Database.Path)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+
+	case storage.DriverMemory:
+		return nil, errors.New("the memory driver keeps no state to plan against")
+
+	default:
+		store, err := storage.New(ctx, storage.Config{
+			ConnectionString: cfg.Database.Connection,
+			MaxConnections:   2,
+			MinConnections:   1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+}
+
+// printPlan writes a plan as a diff: + added, - removed, ~ changed, ! orphaned
+func printPlan(w io.Writer, plan *gitops.Plan, active *storage.ActiveConfig) {
+	if active != nil {
+		fmt.Fprintf(w, "Comparing with the configuration applied %s (commit %s)\n\n",
+			active.AppliedAt.Local().Format(time.RFC3339), active.CommitHash)
+	}
+
+	if !plan.HasChanges() && len(plan.OrphanedLeases) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+
+	if len(plan.Subnets) > 0 {
+		fmt.Fprintln(w, "Subnets:")
+		for _, change := range plan.Subnets {
+			fmt.Fprintf(w, "  %s %s\n", changeMarker(change.Action), change.Network)
+			for _, field := range change.Fields {
+				printField(w, "      ", field)
+			}
+			for _, pool := range change.PoolsAdded {
+				fmt.Fprintf(w, "      + pool %s\n", pool)
+			}
+			for _, pool := range change.PoolsRemoved {
+				fmt.Fprintf(w, "      - pool %s\n", pool)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(plan.Reservations) > 0 {
+		fmt.Fprintln(w, "Reservations:")
+		for _, change := range plan.Reservations {
+			fmt.Fprintf(w, "  %s %s %s %s\n", changeMarker(change.Action), change.Key, change.IP, change.Hostname)
+			for _, field := range change.Fields {
+				printField(w, "      ", field)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(plan.OrphanedLeases) > 0 {
+		fmt.Fprintln(w, "Orphaned leases:")
+		for _, lease := range plan.OrphanedLeases {
+			fmt.Fprintf(w, "  ! %s %s %s (%s, expires %s)\n", lease.IP, lease.MAC, lease.Hostname,
+				lease.Reason, lease.ExpiresAt.Local().Format(time.RFC3339))
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "%d subnet change(s), %d reservation change(s), %d orphaned lease(s)\n",
+		len(plan.Subnets), len(plan.Reservations), len(plan.OrphanedLeases))
+	if plan.Destructive {
+		fmt.Fprintln(w, "This plan is destructive")
+	}
+}
+
+func printField(w io.Writer, indent string, field gitops.FieldChange) {
+	switch {
+	case field.Old == "":
+		fmt.Fprintf(w, "%s+ %s: %s\n", indent, field.Field, field.New)
+	case field.New == "":
+		fmt.Fprintf(w, "%s- %s: %s\n", indent, field.Field, field.Old)
+	default:
+		fmt.Fprintf(w, "%s~ %s: %s -> %s\n", indent, field.Field, field.Old, field.New)
+	}
+}
+
+func changeMarker(action string) string {
+	switch action {
+	case gitops.ChangeAdd:
+		return "+"
+	case gitops.ChangeDelete:
+		return "-"
+	default:
+		return "~"
+	}
+}
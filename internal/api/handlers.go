@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"io"
 	"io/fs"
+	"math"
+	"math/big"
 	"net"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/sashakarcz/irondhcp/internal/config"
 	"github.com/sashakarcz/irondhcp/internal/events"
 	"github.com/sashakarcz/irondhcp/internal/logger"
 	"github.com/sashakarcz/irondhcp/internal/storage"
@@ -133,18 +136,7 @@ func (s *Server) handleDashboardStats(w http.ResponseWriter, r *http.Request) {
 	totalAvailableIPs := 0
 	if s.config != nil {
 		for _, subnet := range s.config.Subnets {
-			for _, pool := range subnet.Pools {
-				// Calculate IPs in range (inclusive)
-				startIP := net.ParseIP(pool.RangeStart)
-				endIP := net.ParseIP(pool.RangeEnd)
-				if startIP != nil && endIP != nil {
-					start := ipToInt(startIP)
-					end := ipToInt(endIP)
-					if end >= start {
-						totalAvailableIPs += int(end - start + 1)
-					}
-				}
-			}
+			totalAvailableIPs += poolCapacity(subnet.Pools)
 		}
 	}
 
@@ -176,6 +168,11 @@ type LeaseResponse struct {
 	State       string `json:"state"`
 	ClientID    string `json:"client_id"`
 	VendorClass string `json:"vendor_class"`
+	CircuitID   string `json:"circuit_id,omitempty"` // Relay agent circuit-id (option 82)
+	RemoteID    string `json:"remote_id,omitempty"`  // Relay agent remote-id (option 82)
+	DUID        string `json:"duid,omitempty"`       // DHCPv6 only
+	IAID        uint32 `json:"iaid,omitempty"`       // DHCPv6 only
+	Prefix      string `json:"prefix,omitempty"`     // Delegated prefix (DHCPv6 IA_PD only)
 }
 
 // handleLeases handles lease listing requests
@@ -218,21 +215,80 @@ func (s *Server) handleLeases(w http.ResponseWriter, r *http.Request) {
 			State:       string(lease.State),
 			ClientID:    lease.ClientID,
 			VendorClass: lease.VendorClass,
+			CircuitID:   lease.CircuitID,
+			RemoteID:    lease.RemoteID,
+		})
+	}
+
+	// Add DHCPv6 leases
+	leasesV6, err := s.store.GetAllLeasesV6(ctx)
+	if err != nil {
+		http.Error(w, "Failed to get DHCPv6 leases", http.StatusInternalServerError)
+		return
+	}
+
+	for _, lease := range leasesV6 {
+		var mac string
+		if lease.MAC != nil {
+			mac = lease.MAC.String()
+		}
+
+		response = append(response, LeaseResponse{
+			ID:        lease.ID,
+			IP:        lease.IP.String(),
+			MAC:       mac,
+			Hostname:  lease.Hostname,
+			Subnet:    lease.Subnet.String(),
+			IssuedAt:  lease.IssuedAt.Format(time.RFC3339),
+			ExpiresAt: lease.ExpiresAt.Format(time.RFC3339),
+			LastSeen:  lease.LastSeen.Format(time.RFC3339),
+			State:     string(lease.State),
+			DUID:      lease.DUID,
+			IAID:      lease.IAID,
+		})
+	}
+
+	// Add DHCPv6 prefix delegations
+	prefixes, err := s.store.GetAllDelegatedPrefixes(ctx)
+	if err != nil {
+		http.Error(w, "Failed to get delegated prefixes", http.StatusInternalServerError)
+		return
+	}
+
+	for _, p := range prefixes {
+		response = append(response, LeaseResponse{
+			ID:        p.ID,
+			IP:        p.Prefix.IP.String(),
+			Hostname:  p.Hostname,
+			Subnet:    p.Subnet.String(),
+			IssuedAt:  p.IssuedAt.Format(time.RFC3339),
+			ExpiresAt: p.ExpiresAt.Format(time.RFC3339),
+			LastSeen:  p.LastSeen.Format(time.RFC3339),
+			State:     string(p.State),
+			DUID:      p.DUID,
+			IAID:      p.IAID,
+			Prefix:    p.Prefix.String(),
 		})
 	}
 
 	// Add static leases (reservations) that don't have active dynamic leases
-	// Create a map of active lease MACs for quick lookup
+	// Create maps of active lease MACs and IPs for quick lookup
 	activeMacs := make(map[string]bool)
+	activeIPs := make(map[string]bool)
 	for _, lease := range leases {
 		activeMacs[lease.MAC.String()] = true
+		activeIPs[lease.IP.String()] = true
 	}
 
 	// Add reservations that don't have active leases
 	zeroTime := time.Time{}.Format(time.RFC3339)
 	for _, res := range reservations {
 		// Skip if this MAC already has an active lease
-		if activeMacs[res.MAC.String()] {
+		if res.MAC != nil && activeMacs[res.MAC.String()] {
+			continue
+		}
+		// Relay agent reservations have no MAC; skip if the reserved IP is leased
+		if res.MAC == nil && activeIPs[res.IP.String()] {
 			continue
 		}
 
@@ -248,6 +304,51 @@ func (s *Server) handleLeases(w http.ResponseWriter, r *http.Request) {
 			State:       "static",
 			ClientID:    "",
 			VendorClass: "",
+			CircuitID:   res.CircuitID,
+			RemoteID:    res.RemoteID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeclinedLeaseResponse represents a quarantined address for API responses
+type DeclinedLeaseResponse struct {
+	IP               string `json:"ip"`
+	MAC              string `json:"mac"`
+	Subnet           string `json:"subnet"`
+	DeclinedBy       string `json:"declined_by"` // Declining client's MAC, or "ping_check"
+	DeclinedAt       string `json:"declined_at"`
+	QuarantinedUntil string `json:"quarantined_until"`
+	ServerID         string `json:"server_id,omitempty"`
+}
+
+// handleDeclinedLeases lists addresses held in quarantine after a conflict
+func (s *Server) handleDeclinedLeases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	declined, err := s.store.GetDeclinedAddresses(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to get declined addresses", http.StatusInternalServerError)
+		return
+	}
+
+	// Convert to response format (initialize as empty array, not nil)
+	response := make([]DeclinedLeaseResponse, 0)
+	for _, addr := range declined {
+		response = append(response, DeclinedLeaseResponse{
+			IP:               addr.IP.String(),
+			MAC:              addr.MAC.String(),
+			Subnet:           addr.Subnet.String(),
+			DeclinedBy:       addr.DeclinedBy,
+			DeclinedAt:       addr.DeclinedAt.Format(time.RFC3339),
+			QuarantinedUntil: addr.QuarantinedUntil.Format(time.RFC3339),
+			ServerID:         addr.AllocatedBy,
 		})
 	}
 
@@ -303,7 +404,13 @@ func (s *Server) handleSubnets(w http.ResponseWriter, r *http.Request) {
 			}
 
 			ones, bits := network.Mask.Size()
-			totalIPs := 1 << uint(bits-ones) - 2 // Subtract network and broadcast addresses
+			var totalIPs int
+			if subnet.IsIPv6() {
+				// IPv6 prefixes are far larger than any pool, so size by the pools instead
+				totalIPs = poolCapacity(subnet.Pools)
+			} else {
+				totalIPs = 1<<uint(bits-ones) - 2 // Subtract network and broadcast addresses
+			}
 
 			// Get statistics for this subnet if available
 			activeLeases := int64(0)
@@ -336,14 +443,17 @@ func (s *Server) handleSubnets(w http.ResponseWriter, r *http.Request) {
 
 // ReservationResponse represents a reservation for API responses
 type ReservationResponse struct {
-	ID           int64  `json:"id"`
-	MAC          string `json:"mac"`
-	IP           string `json:"ip"`
-	Hostname     string `json:"hostname"`
-	Subnet       string `json:"subnet"`
-	Description  string `json:"description"`
-	TFTPServer   string `json:"tftp_server,omitempty"`
-	BootFilename string `json:"boot_filename,omitempty"`
+	ID           int64              `json:"id"`
+	MAC          string             `json:"mac"`
+	CircuitID    string             `json:"circuit_id,omitempty"`
+	RemoteID     string             `json:"remote_id,omitempty"`
+	IP           string             `json:"ip"`
+	Hostname     string             `json:"hostname"`
+	Subnet       string             `json:"subnet"`
+	Description  string             `json:"description"`
+	TFTPServer   string             `json:"tftp_server,omitempty"`
+	BootFilename string             `json:"boot_filename,omitempty"`
+	BootRules    []storage.BootRule `json:"boot_rules,omitempty"`
 }
 
 // handleReservations handles reservation listing requests
@@ -368,12 +478,15 @@ func (s *Server) handleReservations(w http.ResponseWriter, r *http.Request) {
 		response = append(response, ReservationResponse{
 			ID:           res.ID,
 			MAC:          res.MAC.String(),
+			CircuitID:    res.CircuitID,
+			RemoteID:     res.RemoteID,
 			IP:           res.IP.String(),
 			Hostname:     res.Hostname,
 			Subnet:       res.Subnet.String(),
 			Description:  res.Description,
 			TFTPServer:   res.TFTPServer,
 			BootFilename: res.BootFilename,
+			BootRules:    res.BootRules,
 		})
 	}
 
@@ -460,11 +573,27 @@ func (s *Server) handleActivityStream(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// ipToInt converts an IPv4 address to uint32
-func ipToInt(ip net.IP) uint32 {
-	ip = ip.To4()
-	if ip == nil {
-		return 0
+// poolCapacity returns the number of addresses in a set of pools (inclusive ranges)
+// IPv6 ranges are capped so that a single huge pool doesn't overflow the total
+func poolCapacity(pools []config.PoolConfig) int {
+	total := big.NewInt(0)
+	for _, pool := range pools {
+		startIP := net.ParseIP(pool.RangeStart)
+		endIP := net.ParseIP(pool.RangeEnd)
+		if startIP == nil || endIP == nil {
+			continue
+		}
+
+		start := new(big.Int).SetBytes(startIP.To16())
+		end := new(big.Int).SetBytes(endIP.To16())
+		if end.Cmp(start) >= 0 {
+			total.Add(total, new(big.Int).Sub(end, start))
+			total.Add(total, big.NewInt(1))
+		}
+	}
+
+	if !total.IsInt64() || total.Int64() > math.MaxInt32 {
+		return math.MaxInt32
 	}
-	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	return int(total.Int64())
 }
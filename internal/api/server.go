@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -17,7 +18,7 @@ import (
 
 // Server provides HTTP API and health check endpoints
 type Server struct {
-	store       *storage.Store
+	store       storage.Backend
 	poller      *gitops.Poller
 	broadcaster *events.Broadcaster
 	authManager *AuthManager
@@ -25,6 +26,9 @@ type Server struct {
 	port        int
 	config      *config.Config
 	startTime   time.Time
+
+	webhook       *syncDebouncer // nil unless git.webhook.secret is set
+	webhookSecret string
 }
 
 // Config holds API server configuration
@@ -32,11 +36,12 @@ type Config struct {
 	Port    int
 	Enabled bool
 	WebAuth *config.WebAuth
+	Webhook *config.GitWebhook // Push webhook settings; nil disables the endpoint
 }
 
 // New creates a new API server
-func New(cfg Config, store *storage.Store, poller *gitops.Poller, broadcaster *events.Broadcaster, dhcpConfig *config.Config) *Server {
-	return &Server{
+func New(cfg Config, store storage.Backend, poller *gitops.Poller, broadcaster *events.Broadcaster, dhcpConfig *config.Config) *Server {
+	s := &Server{
 		store:       store,
 		poller:      poller,
 		broadcaster: broadcaster,
@@ -45,6 +50,13 @@ func New(cfg Config, store *storage.Store, poller *gitops.Poller, broadcaster *e
 		config:      dhcpConfig,
 		startTime:   time.Now(),
 	}
+
+	if cfg.Webhook != nil && cfg.Webhook.Secret != "" && poller != nil {
+		s.webhookSecret = cfg.Webhook.Secret
+		s.webhook = newSyncDebouncer(cfg.Webhook.Debounce, s.webhookSync)
+	}
+
+	return s
 }
 
 // UpdateConfig updates the server's config (called when GitOps applies new config)
@@ -61,14 +73,21 @@ func (s *Server) Start(ctx context.Context) error {
 	mux.HandleFunc("/api/v1/health", s.handleHealth)
 	mux.HandleFunc("/health", s.handleHealth) // Alias for Docker healthcheck
 
+	// Git push webhook (authenticated by its signature)
+	mux.HandleFunc("/api/v1/git/webhook", s.handleGitWebhook)
+
 	// Protected endpoints (require auth if enabled)
 	mux.HandleFunc("/api/v1/dashboard/stats", s.AuthMiddleware(s.handleDashboardStats))
 	mux.HandleFunc("/api/v1/leases", s.AuthMiddleware(s.handleLeases))
+	mux.HandleFunc("/api/v1/leases/declined", s.AuthMiddleware(s.handleDeclinedLeases))
 	mux.HandleFunc("/api/v1/subnets", s.AuthMiddleware(s.handleSubnets))
 	mux.HandleFunc("/api/v1/reservations", s.AuthMiddleware(s.handleReservations))
 	mux.HandleFunc("/api/v1/git/sync", s.AuthMiddleware(s.handleGitSync))
 	mux.HandleFunc("/api/v1/git/status", s.AuthMiddleware(s.handleGitStatus))
 	mux.HandleFunc("/api/v1/git/logs", s.AuthMiddleware(s.handleGitLogs))
+	mux.HandleFunc("/api/v1/git/rollback", s.AuthMiddleware(s.handleGitRollback))
+	mux.HandleFunc("/api/v1/git/unpin", s.AuthMiddleware(s.handleGitUnpin))
+	mux.HandleFunc("/api/v1/git/plan", s.AuthMiddleware(s.handleGitPlan))
 	mux.HandleFunc("/api/v1/activity/stream", s.AuthMiddleware(s.handleActivityStream))
 
 	// Metrics endpoint
@@ -103,6 +122,10 @@ func (s *Server) Start(ctx context.Context) error {
 func (s *Server) Stop(ctx context.Context) error {
 	logger.Info().Msg("Stopping API server")
 
+	if s.webhook != nil {
+		s.webhook.Stop()
+	}
+
 	if s.httpServer == nil {
 		return nil
 	}
@@ -130,6 +153,7 @@ type HealthResponse struct {
 // DatabaseHealth represents database health status
 type DatabaseHealth struct {
 	Status      string `json:"status"`
+	Driver      string `json:"driver"`
 	Connections int    `json:"connections"`
 	MaxConns    int32  `json:"max_conns"`
 }
@@ -167,8 +191,9 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	stats := s.store.Stats()
 	health.Database = DatabaseHealth{
 		Status:      "healthy",
-		Connections: int(stats.AcquiredConns()),
-		MaxConns:    stats.MaxConns(),
+		Driver:      s.store.Driver(),
+		Connections: int(stats.AcquiredConns),
+		MaxConns:    stats.MaxConns,
 	}
 
 	// Return healthy response
@@ -190,6 +215,7 @@ type GitSyncResponse struct {
 	CommitMessage  string                 `json:"commit_message,omitempty"`
 	HasChanges     bool                   `json:"has_changes"`
 	ChangesApplied map[string]interface{} `json:"changes_applied,omitempty"`
+	PinnedCommit   string                 `json:"pinned_commit,omitempty"`
 }
 
 // GitStatusResponse represents git repository status
@@ -200,6 +226,7 @@ type GitStatusResponse struct {
 	CommitTime     time.Time `json:"commit_time,omitempty"`
 	LastSyncTime   time.Time `json:"last_sync_time,omitempty"`
 	LastSyncStatus string    `json:"last_sync_status,omitempty"`
+	PinnedCommit   string    `json:"pinned_commit,omitempty"` // Set after a rollback until unpinned
 }
 
 // handleGitSync handles manual git sync trigger requests
@@ -233,13 +260,19 @@ func (s *Server) handleGitSync(w http.ResponseWriter, r *http.Request) {
 
 	// Trigger sync
 	ctx := r.Context()
-	result, err := s.poller.TriggerSync(ctx, req.TriggeredBy)
+	result, err := s.poller.TriggerSync(ctx, storage.GitSyncTriggerManual, req.TriggeredBy)
+	writeSyncResult(w, result, err, "Sync")
+}
+
+// writeSyncResult writes the outcome of a sync, rollback or unpin
+// operation names the action in error messages, e.g. "Rollback failed: ...".
+func writeSyncResult(w http.ResponseWriter, result *gitops.SyncResult, err error, operation string) {
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(GitSyncResponse{
 			Success: false,
-			Message: fmt.Sprintf("Sync failed: %v", err),
+			Message: fmt.Sprintf("%s failed: %v", operation, err),
 		})
 		return
 	}
@@ -248,6 +281,7 @@ func (s *Server) handleGitSync(w http.ResponseWriter, r *http.Request) {
 		Success:        result.Success,
 		HasChanges:     result.HasChanges,
 		ChangesApplied: result.ChangesApplied,
+		PinnedCommit:   result.PinnedCommit,
 	}
 
 	if result.CommitInfo != nil {
@@ -256,7 +290,7 @@ func (s *Server) handleGitSync(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if result.Success {
-		response.Message = "Sync completed successfully"
+		response.Message = operation + " completed successfully"
 	} else {
 		response.Message = result.ErrorMessage
 	}
@@ -279,13 +313,18 @@ func (s *Server) handleGitStatus(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
+	var pinned string
+	if s.poller != nil {
+		pinned = s.poller.PinnedCommit()
+	}
+
 	// Get last successful sync
 	lastSync, err := s.store.GetLastSuccessfulSync(ctx)
 	if err != nil {
 		// No sync found yet
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(GitStatusResponse{})
+		json.NewEncoder(w).Encode(GitStatusResponse{PinnedCommit: pinned})
 		return
 	}
 
@@ -294,6 +333,7 @@ func (s *Server) handleGitStatus(w http.ResponseWriter, r *http.Request) {
 		CommitMessage:  lastSync.CommitMessage,
 		CommitAuthor:   lastSync.CommitAuthor,
 		LastSyncStatus: string(lastSync.Status),
+		PinnedCommit:   pinned,
 	}
 
 	if lastSync.CommitTimestamp != nil {
@@ -309,6 +349,152 @@ func (s *Server) handleGitStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// GitRollbackRequest represents a git rollback request
+type GitRollbackRequest struct {
+	Commit      string `json:"commit"`
+	TriggeredBy string `json:"triggered_by"`
+}
+
+// handleGitRollback applies the config from an earlier commit and pins the server to it
+func (s *Server) handleGitRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req GitRollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Commit == "" {
+		http.Error(w, "commit is required", http.StatusBadRequest)
+		return
+	}
+	if req.TriggeredBy == "" {
+		req.TriggeredBy = "api"
+	}
+
+	if s.poller == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(GitSyncResponse{
+			Success: false,
+			Message: "GitOps is not enabled",
+		})
+		return
+	}
+
+	result, err := s.poller.Rollback(r.Context(), req.Commit, req.TriggeredBy)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, gitops.ErrCommitNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, gitops.ErrInvalidConfig):
+			status = http.StatusBadRequest
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(GitSyncResponse{
+			Success: false,
+			Message: fmt.Sprintf("Rollback failed: %v", err),
+		})
+		return
+	}
+	writeSyncResult(w, result, nil, "Rollback")
+}
+
+// handleGitUnpin releases a rollback pin and syncs the head of the branch
+func (s *Server) handleGitUnpin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The body is optional
+	var req GitSyncRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.TriggeredBy == "" {
+		req.TriggeredBy = "api"
+	}
+
+	if s.poller == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(GitSyncResponse{
+			Success: false,
+			Message: "GitOps is not enabled",
+		})
+		return
+	}
+
+	result, err := s.poller.Unpin(r.Context(), req.TriggeredBy)
+	writeSyncResult(w, result, err, "Unpin")
+}
+
+// GitPlanRequest represents a git plan request
+// Config, if set, is a proposed config file; otherwise the file is read at Commit,
+// or at the head of the branch when Commit is empty.
+type GitPlanRequest struct {
+	Commit string `json:"commit"`
+	Config string `json:"config"`
+}
+
+// handleGitPlan reports what a sync would change without applying it
+func (s *Server) handleGitPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The body is optional
+	var req GitPlanRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.poller == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(GitSyncResponse{
+			Success: false,
+			Message: "GitOps is not enabled",
+		})
+		return
+	}
+
+	var data []byte
+	if req.Config != "" {
+		data = []byte(req.Config)
+	}
+
+	plan, err := s.poller.Plan(r.Context(), req.Commit, data)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gitops.ErrInvalidConfig) {
+			status = http.StatusUnprocessableEntity
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(GitSyncResponse{
+			Success: false,
+			Message: fmt.Sprintf("Plan failed: %v", err),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(plan)
+}
+
 // GitLogEntry represents a git sync log entry
 type GitLogEntry struct {
 	ID              int64                  `json:"id"`
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// maxWebhookBody bounds the push payload read from the forge
+const maxWebhookBody = 10 << 20
+
+// errBadSignature is returned when a webhook is not signed with the configured secret
+var errBadSignature = errors.New("invalid webhook signature")
+
+// webhookPush is the part of a push event used to decide whether to sync
+type webhookPush struct {
+	Provider string   // github, gitlab or gitea
+	Ref      string   // e.g. refs/heads/main
+	After    string   // Commit the branch now points at
+	Pusher   string   // Account that pushed
+	Files    []string // Paths added, modified or removed by the pushed commits
+	Complete bool     // Files covers every pushed commit
+}
+
+// pushPayload decodes the fields GitHub, GitLab and Gitea push events share
+type pushPayload struct {
+	Ref    string `json:"ref"`
+	After  string `json:"after"`
+	Pusher struct {
+		Name     string `json:"name"`     // GitHub
+		Login    string `json:"login"`    // Gitea
+		Username string `json:"username"` // Gitea
+	} `json:"pusher"`
+	UserUsername      string `json:"user_username"`       // GitLab
+	TotalCommitsCount int    `json:"total_commits_count"` // GitLab
+	Commits           []struct {
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+}
+
+// parseWebhook authenticates a push webhook and decodes it
+// GitHub and Gitea sign the body with HMAC-SHA256; GitLab sends the secret as a
+// token. A nil push with a nil error is an event other than a push, e.g. a ping.
+func parseWebhook(r *http.Request, body []byte, secret string) (*webhookPush, error) {
+	var provider, event string
+	switch {
+	case r.Header.Get("X-Gitea-Event") != "":
+		provider, event = "gitea", r.Header.Get("X-Gitea-Event")
+		if !validHMAC(secret, body, r.Header.Get("X-Gitea-Signature")) {
+			return nil, errBadSignature
+		}
+	case r.Header.Get("X-GitHub-Event") != "":
+		provider, event = "github", r.Header.Get("X-GitHub-Event")
+		signature, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok || !validHMAC(secret, body, signature) {
+			return nil, errBadSignature
+		}
+	case r.Header.Get("X-Gitlab-Event") != "":
+		provider, event = "gitlab", r.Header.Get("X-Gitlab-Event")
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return nil, errBadSignature
+		}
+	default:
+		return nil, fmt.Errorf("unrecognized webhook sender")
+	}
+
+	if event != "push" && event != "Push Hook" {
+		return nil, nil
+	}
+
+	var payload pushPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid push payload: %w", err)
+	}
+
+	push := &webhookPush{
+		Provider: provider,
+		Ref:      payload.Ref,
+		After:    payload.After,
+		Complete: len(payload.Commits) > 0 && payload.TotalCommitsCount <= len(payload.Commits),
+	}
+	for _, name := range []string{payload.Pusher.Login, payload.Pusher.Username, payload.Pusher.Name, payload.UserUsername} {
+		if name != "" {
+			push.Pusher = name
+			break
+		}
+	}
+	for _, commit := range payload.Commits {
+		push.Files = append(push.Files, commit.Added...)
+		push.Files = append(push.Files, commit.Modified...)
+		push.Files = append(push.Files, commit.Removed...)
+	}
+
+	return push, nil
+}
+
+// validHMAC checks a hex HMAC-SHA256 signature of body
+func validHMAC(secret string, body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// ignoreReason explains why a push does not need a sync, or returns "" if it does
+// Pushes whose file list is missing or truncated are synced to be safe.
+func (p *webhookPush) ignoreReason(branch, configPath string) string {
+	if p.Ref != "refs/heads/"+branch {
+		return fmt.Sprintf("push to %s, not branch %s", p.Ref, branch)
+	}
+	if !p.Complete {
+		return ""
+	}
+
+	want := path.Clean(configPath)
+	for _, file := range p.Files {
+		if path.Clean(file) == want {
+			return ""
+		}
+	}
+	return fmt.Sprintf("push does not touch %s", configPath)
+}
+
+// syncDebouncer coalesces bursts of pushes into one sync
+// Each push restarts the quiet period; the sync records every pusher in the burst.
+type syncDebouncer struct {
+	delay   time.Duration
+	trigger func(pushers string)
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pushers []string
+}
+
+func newSyncDebouncer(delay time.Duration, trigger func(pushers string)) *syncDebouncer {
+	return &syncDebouncer{delay: delay, trigger: trigger}
+}
+
+// Push schedules a sync after the quiet period
+func (d *syncDebouncer) Push(pusher string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	known := false
+	for _, p := range d.pushers {
+		known = known || p == pusher
+	}
+	if !known {
+		d.pushers = append(d.pushers, pusher)
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.delay, d.fire)
+}
+
+// fire runs the pending sync
+func (d *syncDebouncer) fire() {
+	d.mu.Lock()
+	if len(d.pushers) == 0 {
+		// A Push raced with the previous fire, which already took its pushers
+		d.mu.Unlock()
+		return
+	}
+	pushers := strings.Join(d.pushers, ", ")
+	d.pushers = nil
+	d.timer = nil
+	d.mu.Unlock()
+
+	d.trigger(pushers)
+}
+
+// Stop drops any pending sync
+func (d *syncDebouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.pushers = nil
+}
+
+// WebhookResponse represents a git webhook response
+type WebhookResponse struct {
+	Status string `json:"status"` // queued or ignored
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleGitWebhook handles push webhooks from GitHub, GitLab and Gitea
+// The sync runs in the background once pushes stop arriving for the debounce period.
+func (s *Server) handleGitWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.webhook == nil || s.poller == nil {
+		http.Error(w, "Git webhook is not enabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	push, err := parseWebhook(r, body, s.webhookSecret)
+	if errors.Is(err, errBadSignature) {
+		logger.Warn().
+			Str("remote", r.RemoteAddr).
+			Msg("Rejected Git webhook with invalid signature")
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := WebhookResponse{Status: "queued"}
+	if push == nil {
+		response = WebhookResponse{Status: "ignored", Reason: "not a push event"}
+	} else if reason := push.ignoreReason(s.config.Git.Branch, s.config.Git.ConfigPath); reason != "" {
+		response = WebhookResponse{Status: "ignored", Reason: reason}
+	} else {
+		logger.Info().
+			Str("provider", push.Provider).
+			Str("ref", push.Ref).
+			Str("commit", push.After).
+			Str("pusher", push.Pusher).
+			Msg("Git push received, scheduling sync")
+		s.webhook.Push(push.Pusher)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status == "queued" {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// webhookSync runs the sync for a debounced burst of pushes
+func (s *Server) webhookSync(pushers string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Git.SyncTimeout)
+	defer cancel()
+
+	if _, err := s.poller.TriggerSync(ctx, storage.GitSyncTriggerWebhook, pushers); err != nil {
+		logger.Error().Err(err).Msg("Git sync triggered by webhook failed")
+	}
+}
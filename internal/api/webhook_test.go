@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "s3cret"
+
+const githubPush = `{
+	"ref": "refs/heads/main",
+	"after": "0123abcd",
+	"pusher": {"name": "octocat"},
+	"commits": [
+		{"added": [], "modified": ["README.md"], "removed": []},
+		{"added": [], "modified": ["dhcp.yaml"], "removed": []}
+	]
+}`
+
+const gitlabPush = `{
+	"ref": "refs/heads/main",
+	"after": "0123abcd",
+	"user_username": "jdoe",
+	"total_commits_count": 30,
+	"commits": [{"added": [], "modified": ["README.md"], "removed": []}]
+}`
+
+func sign(body string) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseWebhookVerifiesSignatures(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr error
+	}{
+		{"github", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(githubPush)}, nil},
+		{"github bad signature", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign("other")}, errBadSignature},
+		{"github unsigned", map[string]string{"X-GitHub-Event": "push"}, errBadSignature},
+		{"gitea", map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": sign(githubPush)}, nil},
+		{"gitea bad signature", map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": "zz"}, errBadSignature},
+		{"gitlab", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": testWebhookSecret}, nil},
+		{"gitlab bad token", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "guess"}, errBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/v1/git/webhook", bytes.NewBufferString(githubPush))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			push, err := parseWebhook(r, []byte(githubPush), testWebhookSecret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (push == nil || push.Pusher != "octocat") {
+				t.Errorf("push = %+v, want pusher octocat", push)
+			}
+		})
+	}
+}
+
+func TestParseWebhookIgnoresOtherEvents(t *testing.T) {
+	body := `{"zen": "Keep it logically awesome."}`
+	r := httptest.NewRequest("POST", "/api/v1/git/webhook", bytes.NewBufferString(body))
+	r.Header.Set("X-GitHub-Event", "ping")
+	r.Header.Set("X-Hub-Signature-256", "sha256="+sign(body))
+
+	push, err := parseWebhook(r, []byte(body), testWebhookSecret)
+	if err != nil || push != nil {
+		t.Errorf("parseWebhook(ping) = %+v, %v; want nil, nil", push, err)
+	}
+}
+
+func TestWebhookPushFiltering(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/v1/git/webhook", nil)
+	r.Header.Set("X-GitHub-Event", "push")
+	r.Header.Set("X-Hub-Signature-256", "sha256="+sign(githubPush))
+	push, err := parseWebhook(r, []byte(githubPush), testWebhookSecret)
+	if err != nil {
+		t.Fatalf("parseWebhook: %v", err)
+	}
+
+	if reason := push.ignoreReason("main", "./dhcp.yaml"); reason != "" {
+		t.Errorf("push touching dhcp.yaml ignored: %s", reason)
+	}
+	if reason := push.ignoreReason("main", "config/dhcp.yaml"); reason == "" {
+		t.Error("push not touching config/dhcp.yaml was not ignored")
+	}
+	if reason := push.ignoreReason("production", "dhcp.yaml"); reason == "" {
+		t.Error("push to another branch was not ignored")
+	}
+
+	// GitLab only lists the last 20 commits, so a longer push is always synced
+	r = httptest.NewRequest("POST", "/api/v1/git/webhook", nil)
+	r.Header.Set("X-Gitlab-Event", "Push Hook")
+	r.Header.Set("X-Gitlab-Token", testWebhookSecret)
+	push, err = parseWebhook(r, []byte(gitlabPush), testWebhookSecret)
+	if err != nil {
+		t.Fatalf("parseWebhook: %v", err)
+	}
+	if push.Pusher != "jdoe" {
+		t.Errorf("pusher = %q, want jdoe", push.Pusher)
+	}
+	if reason := push.ignoreReason("main", "dhcp.yaml"); reason != "" {
+		t.Errorf("truncated push ignored: %s", reason)
+	}
+}
+
+func TestSyncDebouncerCoalescesBursts(t *testing.T) {
+	var mu sync.Mutex
+	var syncs []string
+	done := make(chan struct{}, 10)
+	d := newSyncDebouncer(20*time.Millisecond, func(pushers string) {
+		mu.Lock()
+		syncs = append(syncs, pushers)
+		mu.Unlock()
+		done <- struct{}{}
+	})
+	defer d.Stop()
+
+	d.Push("alice")
+	d.Push("bob")
+	d.Push("alice")
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("debounced sync never ran")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(syncs) != 1 || syncs[0] != "alice, bob" {
+		t.Errorf("syncs = %q, want one sync by \"alice, bob\"", syncs)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/sashakarcz/irondhcp/internal/options"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,6 +19,7 @@ type Config struct {
 	Observability ObservabilityConfig `yaml:"observability"`
 	Git           GitConfig           `yaml:"git"`
 	Subnets       []SubnetConfig      `yaml:"subnets"`
+	ClientClasses []ClientClassConfig `yaml:"client_classes,omitempty"`
 }
 
 // ServerConfig holds server-specific settings
@@ -23,6 +27,30 @@ type ServerConfig struct {
 	Interfaces []InterfaceConfig `yaml:"interfaces"`
 	ServerID   string            `yaml:"server_id,omitempty"`
 	Cluster    ClusterConfig     `yaml:"cluster,omitempty"`
+	PingCheck  PingCheckConfig   `yaml:"ping_check,omitempty"`
+	Failover   FailoverConfig    `yaml:"failover,omitempty"`
+}
+
+// PingCheckConfig holds conflict detection settings for fresh offers
+// Addresses that answer the probe are marked declined for the quarantine period
+type PingCheckConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Method     string        `yaml:"method,omitempty"`     // icmp or arp
+	Timeout    time.Duration `yaml:"timeout,omitempty"`    // How long to wait for a reply
+	Quarantine time.Duration `yaml:"quarantine,omitempty"` // How long a conflicting address is skipped
+}
+
+// FailoverConfig holds peer-to-peer failover settings for two nodes that do not share a database
+// Clients are split between the peers by an RFC 3074 hash and leases are replicated over TCP
+type FailoverConfig struct {
+	Enabled            bool          `yaml:"enabled"`
+	Role               string        `yaml:"role,omitempty"`                 // primary or secondary
+	Listen             string        `yaml:"listen,omitempty"`               // Address the partner connects to, e.g. ":647"
+	Peer               string        `yaml:"peer,omitempty"`                 // Partner address, e.g. "10.0.0.2:647"
+	SharedSecret       string        `yaml:"shared_secret,omitempty"`        // Must match on both peers
+	Split              *int          `yaml:"split,omitempty"`                // Hash buckets (of 256) served by the primary; 0 leaves every client to the secondary
+	HeartbeatInterval  time.Duration `yaml:"heartbeat_interval,omitempty"`   // How often to send keepalives
+	PartnerDownTimeout time.Duration `yaml:"partner_down_timeout,omitempty"` // Silence before taking over the whole pool
 }
 
 // ClusterConfig holds HA cluster settings
@@ -33,13 +61,16 @@ type ClusterConfig struct {
 
 // InterfaceConfig specifies which network interfaces to listen on
 type InterfaceConfig struct {
-	Name string `yaml:"name"`
-	IPv4 bool   `yaml:"ipv4"`
-	IPv6 bool   `yaml:"ipv6"`
+	Name             string `yaml:"name"`
+	IPv4             bool   `yaml:"ipv4"`
+	IPv6             bool   `yaml:"ipv6"`
+	ServerIdentifier string `yaml:"server_identifier,omitempty"` // Option 54; defaults to the interface address
 }
 
-// DatabaseConfig holds PostgreSQL connection settings
+// DatabaseConfig holds storage backend settings
 type DatabaseConfig struct {
+	Driver         string        `yaml:"driver,omitempty"` // postgres (default), bolt or memory
+	Path           string        `yaml:"path,omitempty"`   // Database file for the bolt driver
 	Connection     string        `yaml:"connection"`
 	MaxConnections int32         `yaml:"max_connections"`
 	MinConnections int32         `yaml:"min_connections"`
@@ -76,13 +107,24 @@ type GitConfig struct {
 	SyncTimeout          time.Duration `yaml:"sync_timeout,omitempty"`
 	ValidateBeforeSync   bool          `yaml:"validate_before_sync,omitempty"`
 	ConfigPath           string        `yaml:"config_path,omitempty"`
+	Webhook              GitWebhook    `yaml:"webhook,omitempty"`
+}
+
+// GitWebhook holds settings for the push webhook at /api/v1/git/webhook
+type GitWebhook struct {
+	Secret   string        `yaml:"secret,omitempty"`   // HMAC secret (GitHub, Gitea) or token (GitLab); empty disables the endpoint
+	Debounce time.Duration `yaml:"debounce,omitempty"` // Quiet period before a burst of pushes is synced
 }
 
 // GitAuth holds Git authentication settings
 type GitAuth struct {
-	Type       string `yaml:"type"` // token, ssh, none
-	Token      string `yaml:"token,omitempty"`
-	SSHKeyPath string `yaml:"ssh_key_path,omitempty"`
+	Type             string `yaml:"type"` // token, ssh, none
+	Token            string `yaml:"token,omitempty"`
+	SSHKeyPath       string `yaml:"ssh_key_path,omitempty"`
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase,omitempty"`
+	SSHAgent         bool   `yaml:"ssh_agent,omitempty"`   // Use the keys in $SSH_AUTH_SOCK instead of ssh_key_path
+	SSHUser          string `yaml:"ssh_user,omitempty"`    // Defaults to the user in url, then "git"
+	KnownHosts       string `yaml:"known_hosts,omitempty"` // Pinned host keys; defaults to ~/.ssh/known_hosts
 }
 
 // SubnetConfig defines a DHCP subnet
@@ -90,19 +132,39 @@ type SubnetConfig struct {
 	Network           string              `yaml:"network"`
 	Description       string              `yaml:"description"`
 	Gateway           string              `yaml:"gateway"`
+	ServerIdentifier  string              `yaml:"server_identifier,omitempty"` // Option 54; defaults to the listening interface address
+	NextServer        string              `yaml:"next_server,omitempty"`       // siaddr for network boot
+	SharedNetwork     string              `yaml:"shared_network,omitempty"`    // Subnets with the same name share one L2 segment
 	DNSServers        []string            `yaml:"dns_servers"`
 	LeaseDuration     time.Duration       `yaml:"lease_duration"`
+	MinLeaseDuration  time.Duration       `yaml:"min_lease_duration,omitempty"` // Lower bound for client-requested lease times
 	MaxLeaseDuration  time.Duration       `yaml:"max_lease_duration"`
-	Options           map[string]string   `yaml:"options,omitempty"`
+	RenewalRatio      float64             `yaml:"renewal_ratio,omitempty"`      // T1 (option 58) as a fraction of the lease time
+	RebindingRatio    float64             `yaml:"rebinding_ratio,omitempty"`    // T2 (option 59) as a fraction of the lease time
+	DeclineQuarantine time.Duration       `yaml:"decline_quarantine,omitempty"` // How long a declined address is kept out of the pool
+	Options           map[string]string   `yaml:"options,omitempty"`            // By name (ntp_servers) or code (42)
 	Boot              *BootConfig         `yaml:"boot,omitempty"`
 	Pools             []PoolConfig        `yaml:"pools"`
+	PrefixPools       []PrefixPoolConfig  `yaml:"prefix_pools,omitempty"` // DHCPv6 IA_PD
 	Reservations      []ReservationConfig `yaml:"reservations,omitempty"`
 }
 
 // BootConfig defines PXE/iPXE boot settings
+// Rules are evaluated in order and the first match wins; TFTPServer and
+// Filename are the defaults when no rule matches
 type BootConfig struct {
-	TFTPServer string `yaml:"tftp_server,omitempty"` // DHCP option 66
-	Filename   string `yaml:"filename,omitempty"`    // DHCP option 67
+	TFTPServer string           `yaml:"tftp_server,omitempty"` // DHCP option 66
+	Filename   string           `yaml:"filename,omitempty"`    // DHCP option 67
+	Rules      []BootRuleConfig `yaml:"rules,omitempty"`
+}
+
+// BootRuleConfig selects boot settings by client architecture or user class
+type BootRuleConfig struct {
+	Arch       []string `yaml:"arch,omitempty"`        // Option 93 types, by number or name
+	UserClass  string   `yaml:"user_class,omitempty"`  // e.g. "iPXE" for already-chainloaded clients
+	HTTPBoot   bool     `yaml:"http_boot,omitempty"`   // Match UEFI HTTP boot clients (vendor class "HTTPClient")
+	TFTPServer string   `yaml:"tftp_server,omitempty"` // Ignored for HTTP boot
+	Filename   string   `yaml:"filename"`              // Boot file, or URL for HTTP boot
 }
 
 // PoolConfig defines a dynamic IP pool
@@ -110,12 +172,45 @@ type PoolConfig struct {
 	RangeStart  string `yaml:"range_start"`
 	RangeEnd    string `yaml:"range_end"`
 	Description string `yaml:"description"`
+	ClientClass string `yaml:"client_class,omitempty"` // Only serve members of this class
+	Strategy    string `yaml:"strategy,omitempty"`     // random (default), sequential, hashed or lru
+}
+
+// ClientClassConfig defines a named class of clients
+// A client belongs to the class when every configured match criterion matches
+type ClientClassConfig struct {
+	Name           string            `yaml:"name"`
+	Match          ClassMatchConfig  `yaml:"match"`
+	LeaseDuration  time.Duration     `yaml:"lease_duration,omitempty"`  // Overrides the subnet lease duration
+	RenewalRatio   float64           `yaml:"renewal_ratio,omitempty"`   // Overrides the subnet T1 ratio
+	RebindingRatio float64           `yaml:"rebinding_ratio,omitempty"` // Overrides the subnet T2 ratio
+	Options        map[string]string `yaml:"options,omitempty"`         // Added to or overriding subnet options
+}
+
+// ClassMatchConfig holds the match criteria for a client class
+type ClassMatchConfig struct {
+	VendorClass string   `yaml:"vendor_class,omitempty"` // Substring of option 60
+	UserClass   string   `yaml:"user_class,omitempty"`   // Exact option 77 value
+	MACPrefix   string   `yaml:"mac_prefix,omitempty"`   // e.g. "00:50:56" (OUI)
+	Arch        []string `yaml:"arch,omitempty"`         // Option 93 types, by number or name
+	CircuitID   string   `yaml:"circuit_id,omitempty"`   // Option 82 sub-option 1
+	RemoteID    string   `yaml:"remote_id,omitempty"`    // Option 82 sub-option 2
+}
+
+// PrefixPoolConfig defines a DHCPv6 prefix delegation pool
+// Prefix is carved into delegated_length-sized prefixes (e.g. /56s out of a /48)
+type PrefixPoolConfig struct {
+	Prefix          string `yaml:"prefix"`
+	DelegatedLength int    `yaml:"delegated_length"`
+	Description     string `yaml:"description"`
 }
 
 // ReservationConfig defines a static IP reservation
 type ReservationConfig struct {
 	Hostname    string      `yaml:"hostname"`
-	MAC         string      `yaml:"mac"`
+	MAC         string      `yaml:"mac,omitempty"`
+	CircuitID   string      `yaml:"circuit_id,omitempty"` // Match on relay agent circuit-id instead of MAC
+	RemoteID    string      `yaml:"remote_id,omitempty"`  // Optionally restrict circuit_id to one relay agent
 	IP          string      `yaml:"ip"`
 	Description string      `yaml:"description,omitempty"`
 	Boot        *BootConfig `yaml:"boot,omitempty"` // Per-host boot override
@@ -123,6 +218,12 @@ type ReservationConfig struct {
 
 // Load reads and parses a YAML configuration file
 func Load(path string) (*Config, error) {
+	return LoadWithDriver(path, "")
+}
+
+// LoadWithDriver is Load with database.driver replaced by driver when it is not empty
+// The override is applied before validation, so a memory lab needs no connection string
+func LoadWithDriver(path, driver string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -135,6 +236,9 @@ func Load(path string) (*Config, error) {
 	if err := yaml.Unmarshal([]byte(expanded), &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
 	}
+	if driver != "" {
+		cfg.Database.Driver = driver
+	}
 
 	// Set defaults
 	cfg.setDefaults()
@@ -150,6 +254,12 @@ func Load(path string) (*Config, error) {
 // setDefaults sets default values for optional fields
 func (c *Config) setDefaults() {
 	// Database defaults
+	if c.Database.Driver == "" {
+		c.Database.Driver = "postgres"
+	}
+	if c.Database.Driver == "bolt" && c.Database.Path == "" {
+		c.Database.Path = "/var/lib/irondhcp/irondhcp.db"
+	}
 	if c.Database.MaxConnections == 0 {
 		c.Database.MaxConnections = 20
 	}
@@ -160,6 +270,32 @@ func (c *Config) setDefaults() {
 		c.Database.BatchInterval = time.Second
 	}
 
+	// Ping check defaults
+	if c.Server.PingCheck.Method == "" {
+		c.Server.PingCheck.Method = "icmp"
+	}
+	if c.Server.PingCheck.Timeout == 0 {
+		c.Server.PingCheck.Timeout = 500 * time.Millisecond
+	}
+	if c.Server.PingCheck.Quarantine == 0 {
+		c.Server.PingCheck.Quarantine = time.Hour
+	}
+
+	// Failover defaults
+	if c.Server.Failover.Listen == "" {
+		c.Server.Failover.Listen = ":647"
+	}
+	if c.Server.Failover.Split == nil {
+		split := 128
+		c.Server.Failover.Split = &split
+	}
+	if c.Server.Failover.HeartbeatInterval == 0 {
+		c.Server.Failover.HeartbeatInterval = 5 * time.Second
+	}
+	if c.Server.Failover.PartnerDownTimeout == 0 {
+		c.Server.Failover.PartnerDownTimeout = time.Hour
+	}
+
 	// Observability defaults
 	if c.Observability.MetricsPort == 0 {
 		c.Observability.MetricsPort = 9090
@@ -191,15 +327,43 @@ func (c *Config) setDefaults() {
 		if c.Git.ConfigPath == "" {
 			c.Git.ConfigPath = "dhcp.yaml"
 		}
+		if c.Git.Webhook.Debounce == 0 {
+			c.Git.Webhook.Debounce = 5 * time.Second
+		}
 	}
 
-	// Subnet defaults
+	c.SetSubnetDefaults()
+}
+
+// SetSubnetDefaults sets default values for optional subnet fields
+// Subnets read from elsewhere, such as a GitOps repository, need them as much as
+// those in the config file.
+func (c *Config) SetSubnetDefaults() {
 	for i := range c.Subnets {
 		if c.Subnets[i].LeaseDuration == 0 {
 			c.Subnets[i].LeaseDuration = 24 * time.Hour
 		}
 		if c.Subnets[i].MaxLeaseDuration == 0 {
-			c.Subnets[i].MaxLeaseDuration = 168 * time.Hour // 7 days
+			// 7 days, or longer so a long lease_duration alone stays valid
+			c.Subnets[i].MaxLeaseDuration = 168 * time.Hour
+			if c.Subnets[i].LeaseDuration > c.Subnets[i].MaxLeaseDuration {
+				c.Subnets[i].MaxLeaseDuration = c.Subnets[i].LeaseDuration
+			}
+		}
+		if c.Subnets[i].MinLeaseDuration == 0 {
+			c.Subnets[i].MinLeaseDuration = time.Hour
+			if c.Subnets[i].LeaseDuration < time.Hour {
+				c.Subnets[i].MinLeaseDuration = c.Subnets[i].LeaseDuration
+			}
+		}
+		if c.Subnets[i].RenewalRatio == 0 {
+			c.Subnets[i].RenewalRatio = 0.5 // RFC 2131 section 4.4.5
+		}
+		if c.Subnets[i].RebindingRatio == 0 {
+			c.Subnets[i].RebindingRatio = 0.875
+		}
+		if c.Subnets[i].DeclineQuarantine == 0 {
+			c.Subnets[i].DeclineQuarantine = 24 * time.Hour
 		}
 	}
 }
@@ -218,17 +382,36 @@ func (c *Config) Validate() error {
 		if !iface.IPv4 && !iface.IPv6 {
 			return fmt.Errorf("interface %s: at least one of ipv4 or ipv6 must be enabled", iface.Name)
 		}
-		if iface.IPv6 {
-			return fmt.Errorf("interface %s: IPv6 is not yet supported", iface.Name)
+		if iface.ServerIdentifier != "" && net.ParseIP(iface.ServerIdentifier).To4() == nil {
+			return fmt.Errorf("interface %s: invalid server_identifier '%s'", iface.Name, iface.ServerIdentifier)
 		}
 	}
 
 	// server_id can be any string identifier (e.g., "dhcp-01", "dhcp-02")
 	// No validation needed
 
+	if c.Server.PingCheck.Method != "icmp" && c.Server.PingCheck.Method != "arp" {
+		return fmt.Errorf("server.ping_check.method must be one of: icmp, arp")
+	}
+
+	if c.Server.Failover.Enabled {
+		if err := validateFailover(&c.Server.Failover); err != nil {
+			return err
+		}
+	}
+
 	// Validate database config
-	if c.Database.Connection == "" {
-		return fmt.Errorf("database connection string is required")
+	switch c.Database.Driver {
+	case "postgres":
+		if c.Database.Connection == "" {
+			return fmt.Errorf("database connection string is required")
+		}
+	case "bolt", "memory":
+	default:
+		return fmt.Errorf("database.driver must be one of: postgres, bolt, memory")
+	}
+	if c.Database.BatchWrites && c.Database.BatchInterval < 0 {
+		return fmt.Errorf("database.batch_interval must be positive")
 	}
 	if c.Database.MaxConnections < c.Database.MinConnections {
 		return fmt.Errorf("max_connections must be >= min_connections")
@@ -253,6 +436,17 @@ func (c *Config) Validate() error {
 		if c.Git.Auth.Type != "" && c.Git.Auth.Type != "token" && c.Git.Auth.Type != "ssh" && c.Git.Auth.Type != "none" {
 			return fmt.Errorf("git.auth.type must be one of: token, ssh, none")
 		}
+		if c.Git.Auth.Type == "ssh" {
+			if c.Git.Auth.SSHKeyPath == "" && !c.Git.Auth.SSHAgent {
+				return fmt.Errorf("git.auth.ssh_key_path or git.auth.ssh_agent is required for ssh auth")
+			}
+			if c.Git.Auth.SSHKeyPath != "" && c.Git.Auth.SSHAgent {
+				return fmt.Errorf("git.auth.ssh_key_path and git.auth.ssh_agent are mutually exclusive")
+			}
+		}
+		if c.Git.Webhook.Debounce < 0 {
+			return fmt.Errorf("git.webhook.debounce cannot be negative")
+		}
 	}
 
 	// Validate subnets
@@ -261,12 +455,37 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("at least one subnet must be configured (or enable GitOps)")
 	}
 
+	return c.ValidateSubnets()
+}
+
+// ValidateSubnets checks the subnets and client classes, including that pools only name defined classes
+func (c *Config) ValidateSubnets() error {
 	for i, subnet := range c.Subnets {
 		if err := validateSubnet(&subnet, i); err != nil {
 			return err
 		}
 	}
 
+	// Validate client classes
+	classes := make(map[string]bool)
+	for i, class := range c.ClientClasses {
+		if err := validateClientClass(&class, i); err != nil {
+			return err
+		}
+		if classes[class.Name] {
+			return fmt.Errorf("client class %d: duplicate name '%s'", i, class.Name)
+		}
+		classes[class.Name] = true
+	}
+
+	for i, subnet := range c.Subnets {
+		for j, pool := range subnet.Pools {
+			if pool.ClientClass != "" && !classes[pool.ClientClass] {
+				return fmt.Errorf("subnet %d, pool %d: unknown client_class '%s'", i, j, pool.ClientClass)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -279,12 +498,32 @@ func validateSubnet(subnet *SubnetConfig, index int) error {
 	}
 
 	// Validate gateway
-	gateway := net.ParseIP(subnet.Gateway)
-	if gateway == nil {
-		return fmt.Errorf("subnet %d: invalid gateway IP '%s'", index, subnet.Gateway)
+	// DHCPv6 has no router option (clients learn routes from RAs), so the
+	// gateway is optional for IPv6 subnets
+	if subnet.Gateway != "" || !subnet.IsIPv6() {
+		gateway := net.ParseIP(subnet.Gateway)
+		if gateway == nil {
+			return fmt.Errorf("subnet %d: invalid gateway IP '%s'", index, subnet.Gateway)
+		}
+		if !network.Contains(gateway) {
+			return fmt.Errorf("subnet %d: gateway %s is not in network %s", index, subnet.Gateway, subnet.Network)
+		}
+	}
+
+	// Validate server identifier and next server
+	if subnet.ServerIdentifier != "" && net.ParseIP(subnet.ServerIdentifier).To4() == nil {
+		return fmt.Errorf("subnet %d: invalid server_identifier '%s'", index, subnet.ServerIdentifier)
 	}
-	if !network.Contains(gateway) {
-		return fmt.Errorf("subnet %d: gateway %s is not in network %s", index, subnet.Gateway, subnet.Network)
+	if subnet.NextServer != "" && net.ParseIP(subnet.NextServer).To4() == nil {
+		return fmt.Errorf("subnet %d: invalid next_server '%s'", index, subnet.NextServer)
+	}
+
+	// Validate lease time bounds
+	if subnet.MinLeaseDuration > subnet.LeaseDuration || subnet.LeaseDuration > subnet.MaxLeaseDuration {
+		return fmt.Errorf("subnet %d: lease_duration must be between min_lease_duration and max_lease_duration", index)
+	}
+	if err := validateRenewalRatios(subnet.RenewalRatio, subnet.RebindingRatio); err != nil {
+		return fmt.Errorf("subnet %d: %w", index, err)
 	}
 
 	// Validate DNS servers
@@ -294,8 +533,20 @@ func validateSubnet(subnet *SubnetConfig, index int) error {
 		}
 	}
 
+	// Validate DHCP options
+	// DHCPv6 subnets only use domain_name (sent as the domain search list)
+	if subnet.IsIPv6() {
+		for key := range subnet.Options {
+			if key != "domain_name" {
+				return fmt.Errorf("subnet %d: option '%s' is not supported on IPv6 subnets", index, key)
+			}
+		}
+	} else if _, err := options.Parse(subnet.Options); err != nil {
+		return fmt.Errorf("subnet %d: invalid options: %w", index, err)
+	}
+
 	// Validate pools
-	if len(subnet.Pools) == 0 {
+	if len(subnet.Pools) == 0 && len(subnet.PrefixPools) == 0 {
 		return fmt.Errorf("subnet %d: at least one pool must be configured", index)
 	}
 
@@ -305,6 +556,28 @@ func validateSubnet(subnet *SubnetConfig, index int) error {
 		}
 	}
 
+	if subnet.SharedNetwork != "" && subnet.IsIPv6() {
+		return fmt.Errorf("subnet %d: shared_network is only supported on IPv4 subnets", index)
+	}
+
+	// Validate prefix delegation pools
+	if len(subnet.PrefixPools) > 0 && !subnet.IsIPv6() {
+		return fmt.Errorf("subnet %d: prefix_pools are only supported on IPv6 subnets", index)
+	}
+
+	for j, pool := range subnet.PrefixPools {
+		if err := validatePrefixPool(&pool, index, j); err != nil {
+			return err
+		}
+	}
+
+	// Validate boot rules
+	if subnet.Boot != nil {
+		if err := validateBoot(subnet.Boot); err != nil {
+			return fmt.Errorf("subnet %d: %w", index, err)
+		}
+	}
+
 	// Validate reservations
 	for j, reservation := range subnet.Reservations {
 		if err := validateReservation(&reservation, network, index, j); err != nil {
@@ -315,6 +588,40 @@ func validateSubnet(subnet *SubnetConfig, index int) error {
 	return nil
 }
 
+// validateFailover validates the peer-to-peer failover settings
+func validateFailover(failover *FailoverConfig) error {
+	if failover.Role != "primary" && failover.Role != "secondary" {
+		return fmt.Errorf("server.failover.role must be one of: primary, secondary")
+	}
+	if failover.Peer == "" {
+		return fmt.Errorf("server.failover.peer is required")
+	}
+	if _, _, err := net.SplitHostPort(failover.Peer); err != nil {
+		return fmt.Errorf("server.failover.peer: %w", err)
+	}
+	if _, _, err := net.SplitHostPort(failover.Listen); err != nil {
+		return fmt.Errorf("server.failover.listen: %w", err)
+	}
+	if failover.SharedSecret == "" {
+		return fmt.Errorf("server.failover.shared_secret is required")
+	}
+	if failover.Split != nil && (*failover.Split < 0 || *failover.Split > 256) {
+		return fmt.Errorf("server.failover.split must be between 0 and 256")
+	}
+	if failover.PartnerDownTimeout <= failover.HeartbeatInterval {
+		return fmt.Errorf("server.failover.partner_down_timeout must be longer than heartbeat_interval")
+	}
+	return nil
+}
+
+// validateRenewalRatios checks that T1 comes before T2 and both before the lease expires
+func validateRenewalRatios(renewal, rebinding float64) error {
+	if renewal <= 0 || renewal >= rebinding || rebinding >= 1 {
+		return fmt.Errorf("renewal_ratio and rebinding_ratio must satisfy 0 < renewal_ratio < rebinding_ratio < 1")
+	}
+	return nil
+}
+
 // validatePool validates a single pool configuration
 func validatePool(pool *PoolConfig, network *net.IPNet, subnetIdx, poolIdx int) error {
 	start := net.ParseIP(pool.RangeStart)
@@ -340,6 +647,98 @@ func validatePool(pool *PoolConfig, network *net.IPNet, subnetIdx, poolIdx int)
 		return fmt.Errorf("subnet %d, pool %d: range_start must be <= range_end", subnetIdx, poolIdx)
 	}
 
+	switch pool.Strategy {
+	case "", "random", "sequential", "hashed", "lru":
+	default:
+		return fmt.Errorf("subnet %d, pool %d: strategy must be one of: random, sequential, hashed, lru", subnetIdx, poolIdx)
+	}
+	if pool.Strategy != "" && start.To4() == nil {
+		return fmt.Errorf("subnet %d, pool %d: strategy is only supported on IPv4 pools", subnetIdx, poolIdx)
+	}
+
+	return nil
+}
+
+// validatePrefixPool validates a single prefix delegation pool configuration
+func validatePrefixPool(pool *PrefixPoolConfig, subnetIdx, poolIdx int) error {
+	ip, prefix, err := net.ParseCIDR(pool.Prefix)
+	if err != nil {
+		return fmt.Errorf("subnet %d, prefix pool %d: invalid prefix '%s': %w", subnetIdx, poolIdx, pool.Prefix, err)
+	}
+	if ip.To4() != nil {
+		return fmt.Errorf("subnet %d, prefix pool %d: prefix %s is not an IPv6 prefix", subnetIdx, poolIdx, pool.Prefix)
+	}
+
+	// Delegated prefixes must be longer than the pool prefix and no longer than /64
+	ones, _ := prefix.Mask.Size()
+	if pool.DelegatedLength <= ones || pool.DelegatedLength > 64 {
+		return fmt.Errorf("subnet %d, prefix pool %d: delegated_length must be between /%d and /64, got %d",
+			subnetIdx, poolIdx, ones+1, pool.DelegatedLength)
+	}
+
+	return nil
+}
+
+// validateBoot validates boot settings and rules
+func validateBoot(boot *BootConfig) error {
+	for i, rule := range boot.Rules {
+		if len(rule.Arch) == 0 && rule.UserClass == "" && !rule.HTTPBoot {
+			return fmt.Errorf("boot rule %d: at least one of arch, user_class or http_boot is required", i)
+		}
+		if rule.Filename == "" {
+			return fmt.Errorf("boot rule %d: filename is required", i)
+		}
+		for _, arch := range rule.Arch {
+			if _, err := ParseArch(arch); err != nil {
+				return fmt.Errorf("boot rule %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateClientClass validates a single client class configuration
+func validateClientClass(class *ClientClassConfig, index int) error {
+	if class.Name == "" {
+		return fmt.Errorf("client class %d: name is required", index)
+	}
+
+	match := class.Match
+	if match.VendorClass == "" && match.UserClass == "" && match.MACPrefix == "" &&
+		len(match.Arch) == 0 && match.CircuitID == "" && match.RemoteID == "" {
+		return fmt.Errorf("client class '%s': at least one match criterion is required", class.Name)
+	}
+
+	if match.MACPrefix != "" {
+		if _, err := ParseMACPrefix(match.MACPrefix); err != nil {
+			return fmt.Errorf("client class '%s': %w", class.Name, err)
+		}
+	}
+
+	for _, arch := range match.Arch {
+		if _, err := ParseArch(arch); err != nil {
+			return fmt.Errorf("client class '%s': %w", class.Name, err)
+		}
+	}
+
+	if class.LeaseDuration < 0 {
+		return fmt.Errorf("client class '%s': lease_duration must not be negative", class.Name)
+	}
+
+	if class.RenewalRatio != 0 || class.RebindingRatio != 0 {
+		if class.RenewalRatio == 0 || class.RebindingRatio == 0 {
+			return fmt.Errorf("client class '%s': renewal_ratio and rebinding_ratio must be set together", class.Name)
+		}
+		if err := validateRenewalRatios(class.RenewalRatio, class.RebindingRatio); err != nil {
+			return fmt.Errorf("client class '%s': %w", class.Name, err)
+		}
+	}
+
+	if _, err := options.Parse(class.Options); err != nil {
+		return fmt.Errorf("client class '%s': invalid options: %w", class.Name, err)
+	}
+
 	return nil
 }
 
@@ -349,9 +748,19 @@ func validateReservation(reservation *ReservationConfig, network *net.IPNet, sub
 		return fmt.Errorf("subnet %d, reservation %d: hostname is required", subnetIdx, resIdx)
 	}
 
+	// A reservation is keyed on a MAC address, a relay agent circuit-id, or both
+	if reservation.MAC == "" && reservation.CircuitID == "" {
+		return fmt.Errorf("subnet %d, reservation %d: mac or circuit_id is required", subnetIdx, resIdx)
+	}
+	if reservation.RemoteID != "" && reservation.CircuitID == "" {
+		return fmt.Errorf("subnet %d, reservation %d: remote_id requires circuit_id", subnetIdx, resIdx)
+	}
+
 	// Validate MAC address
-	if _, err := net.ParseMAC(reservation.MAC); err != nil {
-		return fmt.Errorf("subnet %d, reservation %d: invalid MAC address '%s': %w", subnetIdx, resIdx, reservation.MAC, err)
+	if reservation.MAC != "" {
+		if _, err := net.ParseMAC(reservation.MAC); err != nil {
+			return fmt.Errorf("subnet %d, reservation %d: invalid MAC address '%s': %w", subnetIdx, resIdx, reservation.MAC, err)
+		}
 	}
 
 	// Validate IP address
@@ -363,13 +772,72 @@ func validateReservation(reservation *ReservationConfig, network *net.IPNet, sub
 		return fmt.Errorf("subnet %d, reservation %d: IP %s is not in network %s", subnetIdx, resIdx, reservation.IP, network.String())
 	}
 
+	if reservation.Boot != nil {
+		if err := validateBoot(reservation.Boot); err != nil {
+			return fmt.Errorf("subnet %d, reservation %d: %w", subnetIdx, resIdx, err)
+		}
+	}
+
 	return nil
 }
 
+// IsIPv6 returns true if the subnet network is an IPv6 prefix (served by DHCPv6)
+func (s *SubnetConfig) IsIPv6() bool {
+	ip, _, err := net.ParseCIDR(s.Network)
+	return err == nil && ip.To4() == nil
+}
+
+// ParseMACPrefix parses a MAC address prefix such as an OUI ("00:50:56")
+func ParseMACPrefix(prefix string) ([]byte, error) {
+	parts := strings.FieldsFunc(prefix, func(r rune) bool { return r == ':' || r == '-' })
+	if len(parts) == 0 || len(parts) > 6 {
+		return nil, fmt.Errorf("invalid MAC prefix '%s'", prefix)
+	}
+
+	result := make([]byte, len(parts))
+	for i, part := range parts {
+		b, err := strconv.ParseUint(part, 16, 8)
+		if err != nil || len(part) > 2 {
+			return nil, fmt.Errorf("invalid MAC prefix '%s'", prefix)
+		}
+		result[i] = byte(b)
+	}
+
+	return result, nil
+}
+
+// archNames maps well-known client architecture names to option 93 values (RFC 4578, IANA)
+var archNames = map[string]uint16{
+	"bios":            0,
+	"efi-ia32":        6,
+	"efi-bc":          7,
+	"efi-x86_64":      9,
+	"efi-arm32":       10,
+	"efi-arm64":       11,
+	"efi-ia32-http":   15,
+	"efi-x86_64-http": 16,
+	"efi-arm32-http":  18,
+	"efi-arm64-http":  19,
+}
+
+// ParseArch parses a client system architecture by number or well-known name
+func ParseArch(arch string) (uint16, error) {
+	if value, ok := archNames[strings.ToLower(arch)]; ok {
+		return value, nil
+	}
+
+	value, err := strconv.ParseUint(arch, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid client architecture '%s'", arch)
+	}
+
+	return uint16(value), nil
+}
+
 // compareIPs compares two IP addresses, returning -1 if a < b, 0 if a == b, 1 if a > b
 func compareIPs(a, b net.IP) int {
-	a = a.To4()
-	b = b.To4()
+	a = a.To16()
+	b = b.To16()
 	for i := 0; i < len(a); i++ {
 		if a[i] < b[i] {
 			return -1
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadTestConfig writes a config with the given subnets section and loads it
+func loadTestConfig(t *testing.T, subnets string) (*Config, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `server:
+  interfaces:
+    - name: eth0
+      ipv4: true
+database:
+  driver: memory
+` + subnets
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return Load(path)
+}
+
+func TestLeaseDurationBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		lease   string
+		max     string
+		wantMax time.Duration
+		wantErr bool
+	}{
+		{"defaults", "", "", 168 * time.Hour, false},
+		{"long lease without max", "720h", "", 720 * time.Hour, false},
+		{"long lease within max", "720h", "1000h", 1000 * time.Hour, false},
+		{"lease over explicit max", "720h", "168h", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subnet := `subnets:
+  - network: 192.168.1.0/24
+    gateway: 192.168.1.1
+    pools:
+      - range_start: 192.168.1.100
+        range_end: 192.168.1.200
+`
+			if tt.lease != "" {
+				subnet += "    lease_duration: " + tt.lease + "\n"
+			}
+			if tt.max != "" {
+				subnet += "    max_lease_duration: " + tt.max + "\n"
+			}
+
+			cfg, err := loadTestConfig(t, subnet)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected lease_duration over max_lease_duration to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if got := cfg.Subnets[0].MaxLeaseDuration; got != tt.wantMax {
+				t.Errorf("max_lease_duration = %s, want %s", got, tt.wantMax)
+			}
+		})
+	}
+}
@@ -2,34 +2,54 @@ package dhcp
 
 import (
 	"context"
-	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash/fnv"
-	"math/rand"
 	"net"
+	"sync"
 	"time"
 	"unicode/utf8"
 
+	"github.com/sashakarcz/irondhcp/internal/failover"
 	"github.com/sashakarcz/irondhcp/internal/logger"
 	"github.com/sashakarcz/irondhcp/internal/storage"
 )
 
+// errAddressInUse is returned when a candidate address is leased, reserved or answers a probe
+var errAddressInUse = errors.New("IP in use")
+
+// errPoolExhausted is returned when a pool, or every pool for a request, has no address to offer
+var errPoolExhausted = errors.New("pool exhausted")
+
 // Allocator handles IP address allocation using LRU algorithm
 type Allocator struct {
-	store    *storage.Store
+	store    storage.Backend
 	cache    *storage.LeaseCache
 	serverID string // Server ID for tracking allocations in HA deployments
 	useCache bool   // Whether to use read-only cache (optional optimization)
+
+	// Conflict detection (optional, see EnableConflictDetection)
+	conflicts   ConflictDetector
+	quarantine  time.Duration
+	broadcaster Broadcaster
+
+	// Peer-to-peer failover (optional, see EnableFailover)
+	failover *failover.Peer
+
+	// Free-address bitmaps per pool (see pool_index.go)
+	poolsMu sync.Mutex
+	pools   map[string]*poolIndex
 }
 
 // NewAllocator creates a new IP allocator
-func NewAllocator(store *storage.Store, cacheSize int, serverID string, useCache bool) *Allocator {
+func NewAllocator(store storage.Backend, cacheSize int, serverID string, useCache bool) *Allocator {
 	return &Allocator{
 		store:    store,
 		cache:    storage.NewLeaseCache(cacheSize),
 		serverID: serverID,
 		useCache: useCache,
+		pools:    make(map[string]*poolIndex),
 	}
 }
 
@@ -63,7 +83,7 @@ func sanitizeUTF8(s string) string {
 // AllocateIP allocates an IP address for a client using LRU algorithm
 // Priority:
 // 1. Check for existing active lease for this MAC
-// 2. Check for static reservation for this MAC
+// 2. Check for static reservation for this MAC or relay agent port
 // 3. Allocate from pool (LRU: expired leases first, then never-used IPs)
 func (a *Allocator) AllocateIP(ctx context.Context, req *AllocationRequest) (*storage.Lease, error) {
 	// Step 1: Always check database first (source of truth for HA deployments)
@@ -81,11 +101,11 @@ func (a *Allocator) AllocateIP(ctx context.Context, req *AllocationRequest) (*st
 	}
 
 	// Step 2: Check for static reservation
-	reservation, err := a.store.GetReservationByMAC(ctx, req.MAC)
+	reservation, err := a.FindReservation(ctx, req.MAC, req.CircuitID, req.RemoteID, req.Subnet)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check reservation: %w", err)
 	}
-	if reservation != nil && reservation.Subnet.String() == req.Subnet.String() {
+	if reservation != nil {
 		// Create lease for reserved IP
 		return a.createLeaseForReservation(ctx, req, reservation)
 	}
@@ -104,46 +124,103 @@ func (a *Allocator) AllocateIP(ctx context.Context, req *AllocationRequest) (*st
 			Msg("Trying pool")
 
 		lease, err := a.allocateFromPool(ctx, req, pool)
-		if err != nil {
+		if errors.Is(err, errPoolExhausted) || errors.Is(err, errAddressInUse) {
 			logger.Debug().
 				Err(err).
 				Int("pool_index", i).
 				Msg("Pool allocation failed")
 			continue // Try next pool
 		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate from pool %s-%s: %w", pool.RangeStart, pool.RangeEnd, err)
+		}
 		if lease != nil {
 			return lease, nil
 		}
 	}
 
-	return nil, fmt.Errorf("no available IPs in any pool")
+	return nil, fmt.Errorf("%w: no available IPs in any pool", errPoolExhausted)
+}
+
+// ClaimRequestedIP leases exactly ip to the client, for a DHCPREQUEST whose offer is gone
+// Returns nil if the client holds another address or reservation, or if ip is outside
+// its pools, owned by a failover partner or taken; nothing else is allocated instead.
+func (a *Allocator) ClaimRequestedIP(ctx context.Context, req *AllocationRequest, ip net.IP) (*storage.Lease, error) {
+	lease, err := a.store.GetLeaseByMAC(ctx, req.MAC, req.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing lease: %w", err)
+	}
+	if lease != nil && lease.IsActive() && !lease.IP.Equal(ip) {
+		return nil, nil
+	}
+
+	reservation, err := a.FindReservation(ctx, req.MAC, req.CircuitID, req.RemoteID, req.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check reservation: %w", err)
+	}
+	if reservation != nil {
+		if !reservation.IP.Equal(ip) {
+			return nil, nil
+		}
+		return a.createLeaseForReservation(ctx, req, reservation)
+	}
+
+	if !a.ownsAddress(ip) {
+		return nil, nil
+	}
+	for _, pool := range req.Pools {
+		idx, err := a.poolIndex(ctx, req.Subnet, pool)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pool index: %w", err)
+		}
+		if idx.offset(ip) < 0 {
+			continue
+		}
+
+		lease, err := a.claimAddress(ctx, req, ip)
+		if errors.Is(err, errAddressInUse) {
+			idx.markUsed(ip)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		idx.markUsed(ip)
+		return lease, nil
+	}
+
+	return nil, nil
 }
 
-// allocateFromPool attempts to allocate an IP from a specific pool
+// allocateFromPool attempts to allocate an IP from a specific pool using the pool's strategy
 func (a *Allocator) allocateFromPool(ctx context.Context, req *AllocationRequest, pool *PoolConfig) (*storage.Lease, error) {
-	rangeStart := net.ParseIP(pool.RangeStart).To4()
-	rangeEnd := net.ParseIP(pool.RangeEnd).To4()
+	strategy := strategyFor(pool.Strategy)
 
 	logger.Debug().
 		Str("range_start", pool.RangeStart).
 		Str("range_end", pool.RangeEnd).
-		Str("range_start_parsed", fmt.Sprintf("%v", rangeStart)).
-		Str("range_end_parsed", fmt.Sprintf("%v", rangeEnd)).
-		Msg("*** NEW BUILD *** Parsing pool range")
-
-	logger.Debug().Msg("CHECKPOINT A: After parsing pool range")
+		Str("strategy", strategy.Name()).
+		Msg("Allocating from pool")
 
-	// First, try to find expired leases in this pool (LRU)
-	logger.Debug().
-		Msg("Checking for expired leases in pool")
+	lease, err := strategy.Allocate(ctx, a, req, pool)
+	if err != nil {
+		return nil, err
+	}
+	if lease == nil {
+		return nil, fmt.Errorf("%w: no available IPs", errPoolExhausted)
+	}
+	return lease, nil
+}
 
-	logger.Debug().Msg("CHECKPOINT B: Before calling GetExpiredLeases")
+// reuseExpiredLease claims the least recently used expired, released or reclaimed address in the pool
+// Returns nil if the pool has none this node can take; taken addresses are skipped
+// and any other failure, such as a database error, is returned.
+func (a *Allocator) reuseExpiredLease(ctx context.Context, req *AllocationRequest, pool *PoolConfig) (*storage.Lease, error) {
+	rangeStart := net.ParseIP(pool.RangeStart).To4()
+	rangeEnd := net.ParseIP(pool.RangeEnd).To4()
 
 	expiredLeases, err := a.store.GetExpiredLeases(ctx, req.Subnet, rangeStart, rangeEnd, 10)
 	if err != nil {
-		logger.Debug().
-			Err(err).
-			Msg("Error getting expired leases")
 		return nil, fmt.Errorf("failed to get expired leases: %w", err)
 	}
 
@@ -151,214 +228,177 @@ func (a *Allocator) allocateFromPool(ctx context.Context, req *AllocationRequest
 		Int("expired_count", len(expiredLeases)).
 		Msg("Retrieved expired leases")
 
-	// Try to claim an expired lease with advisory lock
 	for _, expired := range expiredLeases {
-		lockKey := getAdvisoryLockKey(expired.IP, req.Subnet)
-		err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
-			// Check if IP is still available
-			existing, err := a.store.GetLeaseByIP(ctx, expired.IP, req.Subnet)
-			if err != nil {
-				return err
-			}
-			if existing != nil && existing.State == storage.LeaseStateActive && existing.ExpiresAt.After(time.Now()) {
-				// Someone else claimed it
-				return fmt.Errorf("IP already claimed")
-			}
-
-			// Check if IP is reserved
-			reservation, err := a.store.GetReservationByIP(ctx, expired.IP, req.Subnet)
-			if err != nil {
-				return err
-			}
-			if reservation != nil && reservation.MAC.String() != req.MAC.String() {
-				// Reserved for someone else
-				return fmt.Errorf("IP is reserved")
-			}
-
-			// Create new lease
-			lease := &storage.Lease{
-				IP:          expired.IP,
-				MAC:         req.MAC,
-				Hostname:    sanitizeUTF8(req.Hostname),
-				Subnet:      req.Subnet,
-				IssuedAt:    time.Now(),
-				ExpiresAt:   time.Now().Add(req.LeaseDuration),
-				LastSeen:    time.Now(),
-				State:       storage.LeaseStateActive,
-				ClientID:    sanitizeUTF8(req.ClientID),
-				VendorClass: sanitizeUTF8(req.VendorClass),
-				UserClass:   sanitizeUTF8(req.UserClass),
-				AllocatedBy: a.serverID, // Track which server allocated this lease
-			}
-
-			if err := a.store.CreateLease(ctx, lease); err != nil {
-				return fmt.Errorf("failed to create lease: %w", err)
-			}
-
-			// Optionally update read-only cache after database confirmation
-			if a.useCache {
-				a.cache.Put(lease)
-			}
-
-			return nil
-		})
+		// With a failover partner each node only recycles its own half of the pool
+		if !a.ownsAddress(expired.IP) {
+			continue
+		}
 
+		lease, err := a.claimAddress(ctx, req, expired.IP)
 		if err == nil {
-			// Successfully allocated
-			expiredLeases[0].MAC = req.MAC
-			expiredLeases[0].Hostname = sanitizeUTF8(req.Hostname)
-			expiredLeases[0].IssuedAt = time.Now()
-			expiredLeases[0].ExpiresAt = time.Now().Add(req.LeaseDuration)
-			expiredLeases[0].LastSeen = time.Now()
-			expiredLeases[0].State = storage.LeaseStateActive
-			expiredLeases[0].ClientID = sanitizeUTF8(req.ClientID)
-			expiredLeases[0].VendorClass = sanitizeUTF8(req.VendorClass)
-			expiredLeases[0].UserClass = sanitizeUTF8(req.UserClass)
-
-			return expiredLeases[0], nil
+			return lease, nil
 		}
+		if !errors.Is(err, errAddressInUse) {
+			return nil, err
+		}
+
+		logger.Debug().
+			Err(err).
+			Str("ip", expired.IP.String()).
+			Msg("Failed to reuse expired lease, trying next")
 	}
 
-	// If no expired leases, try to find a never-used IP
-	return a.findNeverUsedIP(ctx, req, pool)
+	return nil, nil
 }
 
-// findNeverUsedIP searches for an IP that has never been allocated
-// Uses randomized selection to reduce lock contention in active/active deployments
-func (a *Allocator) findNeverUsedIP(ctx context.Context, req *AllocationRequest, pool *PoolConfig) (*storage.Lease, error) {
-	logger.Debug().
-		Str("range_start", pool.RangeStart).
-		Str("range_end", pool.RangeEnd).
-		Msg("findNeverUsedIP called")
+// findNeverUsedIP claims an address that has never been allocated
+// pick chooses each candidate from the pool's free-address bitmap; the strategies
+// start it at a random, hashed or fixed position. The bitmap can lag behind other
+// servers, so each candidate is still checked under the advisory lock; addresses
+// found taken stay marked in the bitmap. Any other failure, such as a database
+// error, frees the candidate again and is returned. Returns nil if the pool has
+// no free address.
+func (a *Allocator) findNeverUsedIP(ctx context.Context, req *AllocationRequest, pool *PoolConfig, pick func(*poolIndex) (net.IP, bool)) (*storage.Lease, error) {
+	idx, err := a.poolIndex(ctx, req.Subnet, pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pool index: %w", err)
+	}
 
-	rangeStart := net.ParseIP(pool.RangeStart).To4()
-	rangeEnd := net.ParseIP(pool.RangeEnd).To4()
+	rebuilt := false
+	for {
+		ip, ok := pick(idx)
+		if !ok {
+			// Rows deleted since the last rebuild may have freed addresses
+			if rebuilt || time.Since(idx.builtAt) < poolIndexMinAge {
+				return nil, nil
+			}
+			if idx, err = a.rebuildPoolIndex(ctx, req.Subnet, pool); err != nil {
+				return nil, fmt.Errorf("failed to rebuild pool index: %w", err)
+			}
+			rebuilt = true
+			continue
+		}
 
-	// Calculate IP range
-	startInt := binary.BigEndian.Uint32(rangeStart)
-	endInt := binary.BigEndian.Uint32(rangeEnd)
+		lease, err := a.claimAddress(ctx, req, ip)
+		if err == nil {
+			return lease, nil
+		}
+		if !errors.Is(err, errAddressInUse) {
+			// The address may still be free; only a taken address stays marked
+			idx.release(ip)
+			return nil, err
+		}
 
-	// Generate list of all IPs in range
-	var ips []net.IP
-	for ipInt := startInt; ipInt <= endInt; ipInt++ {
-		ip := make(net.IP, 4)
-		binary.BigEndian.PutUint32(ip, ipInt)
-		ips = append(ips, ip)
+		logger.Debug().
+			Err(err).
+			Str("ip", ip.String()).
+			Msg("Failed to allocate this IP, trying next")
 	}
+}
 
-	logger.Debug().
-		Int("total_ips", len(ips)).
-		Uint32("start_int", startInt).
-		Uint32("end_int", endInt).
-		Msg("Generated IP list for pool")
-
-	// Shuffle to randomize order (reduces contention between servers)
-	// Multiple servers will try different IPs first, reducing conflicts
-	rand.Shuffle(len(ips), func(i, j int) {
-		ips[i], ips[j] = ips[j], ips[i]
-	})
+// claimAddress leases ip to the client while holding the address's advisory lock
+// The address must have no lease, or one that may be handed out again (see leaseReusable).
+func (a *Allocator) claimAddress(ctx context.Context, req *AllocationRequest, ip net.IP) (*storage.Lease, error) {
+	// Rule out taken addresses and probe before locking, so a slow probe does not
+	// hold the lock and a pooled database connection
+	if _, err := a.addressAvailable(ctx, req, ip, time.Now()); err != nil {
+		return nil, err
+	}
+	conflict, conflictMAC := a.probeConflict(ctx, req, ip)
 
-	logger.Debug().
-		Int("total_ips_after_shuffle", len(ips)).
-		Msg("Starting IP allocation attempts")
+	lockKey := getAdvisoryLockKey(ip, req.Subnet)
+	var lease *storage.Lease
 
-	// Try random IPs until one succeeds
-	for _, ip := range ips {
-		logger.Debug().
-			Str("ip", ip.String()).
-			Msg("Trying IP from pool")
-
-		lockKey := getAdvisoryLockKey(ip, req.Subnet)
-		var lease *storage.Lease
-		err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
-			// Check if IP is already in use
-			existing, err := a.store.GetLeaseByIP(ctx, ip, req.Subnet)
-			if err != nil {
-				logger.Debug().
-					Err(err).
-					Str("ip", ip.String()).
-					Msg("Error checking existing lease")
-				return err
-			}
-			if existing != nil {
-				logger.Debug().
-					Str("ip", ip.String()).
-					Str("existing_mac", existing.MAC.String()).
-					Msg("IP already has active lease")
-				return fmt.Errorf("IP in use")
-			}
+	err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
+		// Another server may have claimed the address while it was probed
+		now := time.Now()
+		existing, err := a.addressAvailable(ctx, req, ip, now)
+		if err != nil {
+			return err
+		}
+		if conflict {
+			return a.quarantineConflict(ctx, req, ip, conflictMAC)
+		}
 
-			// Check if IP is reserved
-			reservation, err := a.store.GetReservationByIP(ctx, ip, req.Subnet)
-			if err != nil {
-				logger.Debug().
-					Err(err).
-					Str("ip", ip.String()).
-					Msg("Error checking reservation")
-				return err
-			}
-			if reservation != nil && reservation.MAC.String() != req.MAC.String() {
-				logger.Debug().
-					Str("ip", ip.String()).
-					Str("reserved_for", reservation.MAC.String()).
-					Str("requested_by", req.MAC.String()).
-					Msg("IP reserved for different MAC")
-				return fmt.Errorf("IP is reserved")
-			}
+		lease = &storage.Lease{
+			IP:          ip,
+			MAC:         req.MAC,
+			Hostname:    sanitizeUTF8(req.Hostname),
+			Subnet:      req.Subnet,
+			IssuedAt:    now,
+			ExpiresAt:   now.Add(req.LeaseDuration),
+			LastSeen:    now,
+			State:       storage.LeaseStateActive,
+			ClientID:    sanitizeUTF8(req.ClientID),
+			VendorClass: sanitizeUTF8(req.VendorClass),
+			UserClass:   sanitizeUTF8(req.UserClass),
+			CircuitID:   req.CircuitID,
+			RemoteID:    req.RemoteID,
+			AllocatedBy: a.serverID, // Track which server allocated this lease
+		}
 
-			// Create new lease
-			lease = &storage.Lease{
-				IP:          ip,
-				MAC:         req.MAC,
-				Hostname:    sanitizeUTF8(req.Hostname),
-				Subnet:      req.Subnet,
-				IssuedAt:    time.Now(),
-				ExpiresAt:   time.Now().Add(req.LeaseDuration),
-				LastSeen:    time.Now(),
-				State:       storage.LeaseStateActive,
-				ClientID:    sanitizeUTF8(req.ClientID),
-				VendorClass: sanitizeUTF8(req.VendorClass),
-				UserClass:   sanitizeUTF8(req.UserClass),
-				AllocatedBy: a.serverID, // Track which server allocated this lease
+		if existing != nil {
+			// Reuse the expired, released or quarantined row for this IP
+			lease.ID = existing.ID
+			if err := a.store.UpdateLease(ctx, lease); err != nil {
+				return fmt.Errorf("failed to update lease: %w", err)
 			}
+		} else if err := a.store.CreateLease(ctx, lease); err != nil {
+			return fmt.Errorf("failed to create lease: %w", err)
+		}
 
-			logger.Debug().
-				Str("ip", ip.String()).
-				Str("mac", req.MAC.String()).
-				Msg("Attempting to create lease")
+		logger.Info().
+			Str("ip", ip.String()).
+			Str("mac", req.MAC.String()).
+			Msg("Successfully created lease")
 
-			if err := a.store.CreateLease(ctx, lease); err != nil {
-				logger.Debug().
-					Err(err).
-					Str("ip", ip.String()).
-					Msg("Failed to create lease in database")
-				return fmt.Errorf("failed to create lease: %w", err)
-			}
+		// Optionally update read-only cache after database confirmation
+		if a.useCache {
+			a.cache.Put(lease)
+		}
+		a.replicate(lease)
 
-			logger.Info().
-				Str("ip", ip.String()).
-				Str("mac", req.MAC.String()).
-				Msg("Successfully created lease")
+		return nil
+	})
 
-			// Optionally update read-only cache after database confirmation
-			if a.useCache {
-				a.cache.Put(lease)
-			}
+	if err != nil {
+		return nil, err
+	}
 
-			return nil
-		})
+	return lease, nil
+}
 
-		if err == nil && lease != nil {
-			return lease, nil
-		}
+// addressAvailable checks that ip may be leased to the client and returns its existing lease, if any
+func (a *Allocator) addressAvailable(ctx context.Context, req *AllocationRequest, ip net.IP, now time.Time) (*storage.Lease, error) {
+	existing, err := a.store.GetLeaseByIP(ctx, ip, req.Subnet)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && !leaseReusable(existing, now) {
+		return nil, fmt.Errorf("%w by %s", errAddressInUse, existing.MAC)
+	}
 
-		logger.Debug().
-			Err(err).
-			Str("ip", ip.String()).
-			Msg("Failed to allocate this IP, trying next")
+	reservation, err := a.store.GetReservationByIP(ctx, ip, req.Subnet)
+	if err != nil {
+		return nil, err
+	}
+	if reservation != nil && reservation.MAC.String() != req.MAC.String() {
+		// Reserved for someone else
+		return nil, fmt.Errorf("%w: reserved", errAddressInUse)
 	}
 
-	return nil, fmt.Errorf("pool exhausted: no available IPs")
+	return existing, nil
+}
+
+// leaseReusable reports whether an address's lease may be handed to a new client
+// Active leases and quarantined declines are kept until they expire.
+func leaseReusable(lease *storage.Lease, now time.Time) bool {
+	switch lease.State {
+	case storage.LeaseStateExpired, storage.LeaseStateReleased:
+		return true
+	default:
+		return lease.ExpiresAt.Before(now)
+	}
 }
 
 // createLeaseForReservation creates a lease for a reserved IP
@@ -387,6 +427,8 @@ func (a *Allocator) createLeaseForReservation(ctx context.Context, req *Allocati
 			existing.ClientID = sanitizeUTF8(req.ClientID)
 			existing.VendorClass = sanitizeUTF8(req.VendorClass)
 			existing.UserClass = sanitizeUTF8(req.UserClass)
+			existing.CircuitID = req.CircuitID
+			existing.RemoteID = req.RemoteID
 			existing.AllocatedBy = a.serverID // Track which server allocated this lease
 
 			if err := a.store.UpdateLease(ctx, existing); err != nil {
@@ -408,6 +450,8 @@ func (a *Allocator) createLeaseForReservation(ctx context.Context, req *Allocati
 				ClientID:    sanitizeUTF8(req.ClientID),
 				VendorClass: sanitizeUTF8(req.VendorClass),
 				UserClass:   sanitizeUTF8(req.UserClass),
+				CircuitID:   req.CircuitID,
+				RemoteID:    req.RemoteID,
 				AllocatedBy: a.serverID, // Track which server allocated this lease
 			}
 
@@ -420,6 +464,7 @@ func (a *Allocator) createLeaseForReservation(ctx context.Context, req *Allocati
 		if a.useCache {
 			a.cache.Put(lease)
 		}
+		a.replicate(lease)
 
 		return nil
 	})
@@ -431,6 +476,24 @@ func (a *Allocator) createLeaseForReservation(ctx context.Context, req *Allocati
 	return lease, nil
 }
 
+// FindReservation returns the reservation for a client in the subnet
+// A reservation for the client's MAC takes precedence over one for its relay agent port
+func (a *Allocator) FindReservation(ctx context.Context, mac net.HardwareAddr, circuitID, remoteID string, subnet *net.IPNet) (*storage.Reservation, error) {
+	reservation, err := a.store.GetReservationByMAC(ctx, mac)
+	if err != nil {
+		return nil, err
+	}
+	if reservation != nil && reservation.Subnet.String() == subnet.String() {
+		return reservation, nil
+	}
+
+	if circuitID == "" {
+		return nil, nil
+	}
+
+	return a.store.GetReservationByRelayAgent(ctx, circuitID, remoteID, subnet)
+}
+
 // RenewLease renews an existing lease
 func (a *Allocator) RenewLease(ctx context.Context, mac net.HardwareAddr, ip net.IP, subnet *net.IPNet, duration time.Duration) error {
 	lockKey := getAdvisoryLockKey(ip, subnet)
@@ -451,13 +514,15 @@ func (a *Allocator) RenewLease(ctx context.Context, mac net.HardwareAddr, ip net
 		if err := a.store.RenewLease(ctx, lease.ID, expiresAt); err != nil {
 			return err
 		}
+		lease.ExpiresAt = expiresAt
+		lease.LastSeen = time.Now()
+		lease.State = storage.LeaseStateActive
 
 		// Optionally update read-only cache after database confirmation
 		if a.useCache {
-			lease.ExpiresAt = expiresAt
-			lease.LastSeen = time.Now()
 			a.cache.Put(lease)
 		}
+		a.replicate(lease)
 
 		return nil
 	})
@@ -471,18 +536,21 @@ func (a *Allocator) ReleaseLease(ctx context.Context, ip net.IP, subnet *net.IPN
 
 	// Remove from cache
 	a.cache.RemoveByIP(ip)
+	a.replicateIP(ctx, ip, subnet)
 
 	return nil
 }
 
-// DeclineLease marks a lease as declined (IP conflict)
-func (a *Allocator) DeclineLease(ctx context.Context, ip net.IP, subnet *net.IPNet) error {
-	if err := a.store.DeclineLease(ctx, ip, subnet); err != nil {
+// DeclineLease marks a lease as declined (IP conflict) and quarantines the address
+// It returns storage.ErrLeaseHeldByOther if the address is actively leased to another client.
+func (a *Allocator) DeclineLease(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, quarantine time.Duration) error {
+	if err := a.store.DeclineLease(ctx, ip, subnet, mac, time.Now().Add(quarantine), a.serverID); err != nil {
 		return err
 	}
 
 	// Remove from cache
 	a.cache.RemoveByIP(ip)
+	a.replicateIP(ctx, ip, subnet)
 
 	return nil
 }
@@ -494,20 +562,26 @@ func (a *Allocator) GetCacheStats() storage.CacheStats {
 
 // AllocationRequest contains parameters for IP allocation
 type AllocationRequest struct {
-	MAC           net.HardwareAddr
-	Hostname      string
-	Subnet        *net.IPNet
-	Pools         []*PoolConfig
-	LeaseDuration time.Duration
-	ClientID      string
-	VendorClass   string
-	UserClass     string
+	MAC                net.HardwareAddr
+	Hostname           string
+	Subnet             *net.IPNet
+	Pools              []*PoolConfig
+	LeaseDuration      time.Duration
+	RequestedLeaseTime time.Duration // Option 51 from the client, zero if not requested
+	ClientID           string
+	VendorClass        string
+	UserClass          string
+	CircuitID          string // Relay agent circuit-id (option 82), formatted
+	RemoteID           string // Relay agent remote-id (option 82), formatted
+	Interface          string // Interface the request arrived on, empty if unbound
 }
 
 // PoolConfig represents a DHCP pool configuration
 type PoolConfig struct {
-	RangeStart string
-	RangeEnd   string
+	RangeStart  string
+	RangeEnd    string
+	ClientClass string // Empty means the pool serves any client
+	Strategy    string // Allocation strategy name; empty selects StrategyRandom
 }
 
 // getAdvisoryLockKey generates a lock key for an IP and subnet
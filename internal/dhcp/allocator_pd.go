@@ -0,0 +1,243 @@
+package dhcp
+
+import (
+	"context"
+	crand "crypto/rand"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// PrefixPoolConfig represents a DHCPv6 prefix delegation pool
+type PrefixPoolConfig struct {
+	Prefix          *net.IPNet
+	DelegatedLength int
+}
+
+// PrefixAllocationRequest contains parameters for DHCPv6 IA_PD allocation
+type PrefixAllocationRequest struct {
+	DUID          string // Hex-encoded client DUID
+	IAID          uint32
+	Hostname      string
+	Subnet        *net.IPNet // Link the requesting router was found on
+	Pools         []*PrefixPoolConfig
+	LeaseDuration time.Duration
+}
+
+// AllocatePrefix delegates a prefix to a requesting router
+// Priority:
+// 1. Check for existing active delegation for this DUID/IAID
+// 2. Allocate from pool (LRU: expired delegations first, then random never-used prefixes)
+func (a *Allocator) AllocatePrefix(ctx context.Context, req *PrefixAllocationRequest) (*storage.DelegatedPrefix, error) {
+	for _, pool := range req.Pools {
+		existing, err := a.store.GetDelegatedPrefixByDUID(ctx, req.DUID, req.IAID, pool.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing delegation: %w", err)
+		}
+		if existing != nil && existing.IsActive() {
+			return existing, nil
+		}
+	}
+
+	for i, pool := range req.Pools {
+		prefix, err := a.allocateFromPrefixPool(ctx, req, pool)
+		if err != nil {
+			logger.Debug().
+				Err(err).
+				Int("pool_index", i).
+				Msg("Prefix pool allocation failed")
+			continue // Try next pool
+		}
+		if prefix != nil {
+			return prefix, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no available prefixes in any pool")
+}
+
+// allocateFromPrefixPool attempts to delegate a prefix from a specific pool
+func (a *Allocator) allocateFromPrefixPool(ctx context.Context, req *PrefixAllocationRequest, pool *PrefixPoolConfig) (*storage.DelegatedPrefix, error) {
+	// First, try to reuse expired delegations in this pool (LRU)
+	expiredPrefixes, err := a.store.GetExpiredDelegatedPrefixes(ctx, pool.Prefix, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired delegations: %w", err)
+	}
+
+	for _, expired := range expiredPrefixes {
+		lockKey := getAdvisoryLockKey(expired.Prefix.IP, pool.Prefix)
+		var delegation *storage.DelegatedPrefix
+		err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
+			existing, err := a.store.GetDelegatedPrefix(ctx, expired.Prefix)
+			if err != nil {
+				return err
+			}
+			if existing == nil || existing.IsActive() {
+				// Someone else claimed it
+				return fmt.Errorf("prefix already claimed")
+			}
+
+			now := time.Now()
+			existing.DUID = req.DUID
+			existing.IAID = req.IAID
+			existing.Hostname = sanitizeUTF8(req.Hostname)
+			existing.Subnet = req.Subnet
+			existing.IssuedAt = now
+			existing.ExpiresAt = now.Add(req.LeaseDuration)
+			existing.LastSeen = now
+			existing.State = storage.LeaseStateActive
+			existing.AllocatedBy = a.serverID
+
+			if err := a.store.UpdateDelegatedPrefix(ctx, existing); err != nil {
+				return fmt.Errorf("failed to update delegation: %w", err)
+			}
+
+			delegation = existing
+			return nil
+		})
+
+		if err == nil && delegation != nil {
+			return delegation, nil
+		}
+	}
+
+	// If no expired delegations, try to find a never-used prefix
+	return a.findNeverUsedPrefix(ctx, req, pool)
+}
+
+// findNeverUsedPrefix searches for a prefix in the pool that has never been delegated
+// Small pools are walked in random order; large pools are sampled randomly
+func (a *Allocator) findNeverUsedPrefix(ctx context.Context, req *PrefixAllocationRequest, pool *PrefixPoolConfig) (*storage.DelegatedPrefix, error) {
+	ones, bits := pool.Prefix.Mask.Size()
+	start := new(big.Int).SetBytes(pool.Prefix.IP.To16())
+	step := new(big.Int).Lsh(big.NewInt(1), uint(bits-pool.DelegatedLength))
+	count := new(big.Int).Lsh(big.NewInt(1), uint(pool.DelegatedLength-ones))
+	mask := net.CIDRMask(pool.DelegatedLength, bits)
+
+	var candidates []*net.IPNet
+	if count.Cmp(big.NewInt(smallV6PoolSize)) <= 0 {
+		n := int(count.Int64())
+		for _, index := range rand.Perm(n) {
+			offset := new(big.Int).Mul(big.NewInt(int64(index)), step)
+			candidates = append(candidates, &net.IPNet{IP: offsetIPv6(start, offset), Mask: mask})
+		}
+	} else {
+		for i := 0; i < maxV6Probes; i++ {
+			index, err := crand.Int(crand.Reader, count)
+			if err != nil {
+				return nil, fmt.Errorf("failed to pick random prefix: %w", err)
+			}
+			offset := index.Mul(index, step)
+			candidates = append(candidates, &net.IPNet{IP: offsetIPv6(start, offset), Mask: mask})
+		}
+	}
+
+	for _, prefix := range candidates {
+		lockKey := getAdvisoryLockKey(prefix.IP, pool.Prefix)
+		var delegation *storage.DelegatedPrefix
+		err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
+			existing, err := a.store.GetDelegatedPrefix(ctx, prefix)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return fmt.Errorf("prefix in use")
+			}
+
+			now := time.Now()
+			delegation = &storage.DelegatedPrefix{
+				Prefix:      prefix,
+				DUID:        req.DUID,
+				IAID:        req.IAID,
+				Hostname:    sanitizeUTF8(req.Hostname),
+				Subnet:      req.Subnet,
+				Pool:        pool.Prefix,
+				IssuedAt:    now,
+				ExpiresAt:   now.Add(req.LeaseDuration),
+				LastSeen:    now,
+				State:       storage.LeaseStateActive,
+				AllocatedBy: a.serverID,
+			}
+
+			if err := a.store.CreateDelegatedPrefix(ctx, delegation); err != nil {
+				return fmt.Errorf("failed to create delegation: %w", err)
+			}
+
+			logger.Info().
+				Str("prefix", prefix.String()).
+				Str("duid", req.DUID).
+				Uint32("iaid", req.IAID).
+				Msg("Successfully delegated prefix")
+
+			return nil
+		})
+
+		if err == nil && delegation != nil {
+			return delegation, nil
+		}
+	}
+
+	return nil, fmt.Errorf("pool exhausted: no available prefixes in %s", pool.Prefix)
+}
+
+// RenewPrefix renews an existing delegation owned by the given DUID/IAID
+func (a *Allocator) RenewPrefix(ctx context.Context, duid string, iaid uint32, prefix *net.IPNet, pools []*PrefixPoolConfig, duration time.Duration) (*storage.DelegatedPrefix, error) {
+	pool := prefixPoolFor(prefix, pools)
+	if pool == nil {
+		return nil, fmt.Errorf("prefix %s is not in any configured pool", prefix)
+	}
+
+	lockKey := getAdvisoryLockKey(prefix.IP, pool.Prefix)
+	var delegation *storage.DelegatedPrefix
+
+	err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
+		existing, err := a.store.GetDelegatedPrefix(ctx, prefix)
+		if err != nil {
+			return fmt.Errorf("failed to get delegation: %w", err)
+		}
+		if existing == nil {
+			return fmt.Errorf("delegation not found")
+		}
+		if existing.DUID != duid || existing.IAID != iaid {
+			return fmt.Errorf("DUID/IAID mismatch")
+		}
+
+		expiresAt := time.Now().Add(duration)
+		if err := a.store.RenewDelegatedPrefix(ctx, existing.ID, expiresAt); err != nil {
+			return err
+		}
+
+		existing.ExpiresAt = expiresAt
+		existing.LastSeen = time.Now()
+		existing.State = storage.LeaseStateActive
+		delegation = existing
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return delegation, nil
+}
+
+// ReleasePrefix releases a delegated prefix
+func (a *Allocator) ReleasePrefix(ctx context.Context, duid string, prefix *net.IPNet) error {
+	return a.store.ReleaseDelegatedPrefix(ctx, duid, prefix)
+}
+
+// prefixPoolFor returns the pool a delegated prefix was carved from, or nil
+func prefixPoolFor(prefix *net.IPNet, pools []*PrefixPoolConfig) *PrefixPoolConfig {
+	ones, _ := prefix.Mask.Size()
+	for _, pool := range pools {
+		if ones == pool.DelegatedLength && pool.Prefix.Contains(prefix.IP) {
+			return pool
+		}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+func TestMain(m *testing.M) {
+	// Keep allocation logging out of the test output
+	if err := logger.Setup(logger.Config{Level: "error", Format: "json"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// testAllocationRequest builds a request for the 192.168.1.0/24 test subnet
+func testAllocationRequest(t *testing.T, mac string, pools ...*PoolConfig) *AllocationRequest {
+	t.Helper()
+
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		t.Fatalf("invalid MAC %s: %v", mac, err)
+	}
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+
+	return &AllocationRequest{
+		MAC:           hw,
+		Subnet:        subnet,
+		Pools:         pools,
+		LeaseDuration: time.Hour,
+	}
+}
+
+func TestAllocateIPReturnsExistingLease(t *testing.T) {
+	ctx := context.Background()
+	allocator := NewAllocator(storage.NewMemoryStore(), 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.100", RangeEnd: "192.168.1.200"}
+
+	first, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:11:22:33:44:55", pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if !ipInPool(first.IP, pool) {
+		t.Fatalf("allocated %s outside the pool", first.IP)
+	}
+	if first.AllocatedBy != "test" {
+		t.Errorf("AllocatedBy = %q, want %q", first.AllocatedBy, "test")
+	}
+
+	second, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:11:22:33:44:55", pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if !second.IP.Equal(first.IP) {
+		t.Errorf("second allocation got %s, want the existing lease %s", second.IP, first.IP)
+	}
+}
+
+func TestAllocateIPExhaustsPool(t *testing.T) {
+	ctx := context.Background()
+	allocator := NewAllocator(storage.NewMemoryStore(), 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.11"}
+
+	seen := make(map[string]bool)
+	for _, mac := range []string{"00:00:00:00:00:01", "00:00:00:00:00:02"} {
+		lease, err := allocator.AllocateIP(ctx, testAllocationRequest(t, mac, pool))
+		if err != nil {
+			t.Fatalf("AllocateIP(%s): %v", mac, err)
+		}
+		if seen[lease.IP.String()] {
+			t.Fatalf("%s was handed out twice", lease.IP)
+		}
+		seen[lease.IP.String()] = true
+	}
+
+	if _, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:00:00:00:00:03", pool)); !errors.Is(err, errPoolExhausted) {
+		t.Fatalf("got %v once the pool is exhausted, want errPoolExhausted", err)
+	}
+}
+
+func TestAllocateIPReusesReleasedAddress(t *testing.T) {
+	ctx := context.Background()
+	allocator := NewAllocator(storage.NewMemoryStore(), 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.10"}
+
+	req := testAllocationRequest(t, "00:00:00:00:00:01", pool)
+	lease, err := allocator.AllocateIP(ctx, req)
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if err := allocator.ReleaseLease(ctx, lease.IP, req.Subnet); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+
+	reused, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:00:00:00:00:02", pool))
+	if err != nil {
+		t.Fatalf("AllocateIP after release: %v", err)
+	}
+	if !reused.IP.Equal(lease.IP) {
+		t.Errorf("got %s, want the released address %s", reused.IP, lease.IP)
+	}
+	if reused.ID != lease.ID {
+		t.Errorf("lease ID = %d, want the released row %d to be reused", reused.ID, lease.ID)
+	}
+}
+
+func TestAllocateIPHonoursReservations(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	allocator := NewAllocator(store, 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.11"}
+
+	reserved := testAllocationRequest(t, "aa:bb:cc:dd:ee:ff", pool)
+	err := store.CreateReservation(ctx, &storage.Reservation{
+		MAC:      reserved.MAC,
+		IP:       net.ParseIP("192.168.1.10").To4(),
+		Hostname: "printer",
+		Subnet:   reserved.Subnet,
+	})
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+
+	// Other clients never get the reserved address
+	other, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:00:00:00:00:01", pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if !other.IP.Equal(net.ParseIP("192.168.1.11")) {
+		t.Errorf("unreserved client got %s, want 192.168.1.11", other.IP)
+	}
+
+	lease, err := allocator.AllocateIP(ctx, reserved)
+	if err != nil {
+		t.Fatalf("AllocateIP for reserved client: %v", err)
+	}
+	if !lease.IP.Equal(net.ParseIP("192.168.1.10")) {
+		t.Errorf("reserved client got %s, want 192.168.1.10", lease.IP)
+	}
+	if lease.Hostname != "printer" {
+		t.Errorf("Hostname = %q, want the reservation hostname", lease.Hostname)
+	}
+}
+
+func TestRenewLeaseRejectsOtherClient(t *testing.T) {
+	ctx := context.Background()
+	allocator := NewAllocator(storage.NewMemoryStore(), 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.10"}
+
+	req := testAllocationRequest(t, "00:00:00:00:00:01", pool)
+	lease, err := allocator.AllocateIP(ctx, req)
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+
+	if err := allocator.RenewLease(ctx, req.MAC, lease.IP, req.Subnet, 2*time.Hour); err != nil {
+		t.Fatalf("RenewLease: %v", err)
+	}
+
+	other, _ := net.ParseMAC("00:00:00:00:00:02")
+	if err := allocator.RenewLease(ctx, other, lease.IP, req.Subnet, time.Hour); err == nil {
+		t.Fatal("expected RenewLease to fail for a different MAC")
+	}
+}
+
+func TestDeclinedAddressIsQuarantined(t *testing.T) {
+	ctx := context.Background()
+	allocator := NewAllocator(storage.NewMemoryStore(), 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.10"}
+
+	req := testAllocationRequest(t, "00:00:00:00:00:01", pool)
+	lease, err := allocator.AllocateIP(ctx, req)
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if err := allocator.DeclineLease(ctx, lease.IP, req.Subnet, req.MAC, time.Hour); err != nil {
+		t.Fatalf("DeclineLease: %v", err)
+	}
+
+	if _, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:00:00:00:00:02", pool)); err == nil {
+		t.Fatal("expected the quarantined address to stay out of the pool")
+	}
+}
+
+func TestDeclineRequiresLeaseOwner(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	allocator := NewAllocator(store, 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.10"}
+
+	req := testAllocationRequest(t, "00:00:00:00:00:01", pool)
+	lease, err := allocator.AllocateIP(ctx, req)
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+
+	// Another client cannot take the address out of service
+	other, _ := net.ParseMAC("00:00:00:00:00:02")
+	err = allocator.DeclineLease(ctx, lease.IP, req.Subnet, other, time.Hour)
+	if !errors.Is(err, storage.ErrLeaseHeldByOther) {
+		t.Fatalf("DeclineLease by another client: got %v, want ErrLeaseHeldByOther", err)
+	}
+	if got, _ := store.GetLeaseByIP(ctx, lease.IP, req.Subnet); got.State != storage.LeaseStateActive {
+		t.Errorf("lease state %s after a foreign decline", got.State)
+	}
+
+	// An address with no lease is quarantined on behalf of the decliner
+	free := net.ParseIP("192.168.1.20").To4()
+	if err := allocator.DeclineLease(ctx, free, req.Subnet, other, time.Hour); err != nil {
+		t.Fatalf("DeclineLease of a free address: %v", err)
+	}
+	declined, err := store.GetDeclinedAddresses(ctx)
+	if err != nil {
+		t.Fatalf("GetDeclinedAddresses: %v", err)
+	}
+	if len(declined) != 1 || !declined[0].IP.Equal(free) || declined[0].DeclinedBy != other.String() {
+		t.Errorf("declined addresses %+v", declined)
+	}
+}
+
+// lockCheckingDetector answers probes for the addresses in answering and records
+// whether the address's advisory lock was held while it was probed
+type lockCheckingDetector struct {
+	store     storage.Backend
+	subnet    *net.IPNet
+	answering map[string]bool
+	lockHeld  bool
+}
+
+func (d *lockCheckingDetector) Probe(ctx context.Context, ip net.IP, iface string) (bool, net.HardwareAddr, error) {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := d.store.WithAdvisoryLock(ctx, getAdvisoryLockKey(ip, d.subnet), func(ctx context.Context) error { return nil }); err != nil {
+		d.lockHeld = true
+	}
+	return d.answering[ip.String()], nil, nil
+}
+
+func TestConflictProbeRunsOutsideLock(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	allocator := NewAllocator(store, 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.10"}
+	req := testAllocationRequest(t, "00:00:00:00:00:01", pool)
+
+	detector := &lockCheckingDetector{store: store, subnet: req.Subnet, answering: map[string]bool{"192.168.1.10": true}}
+	allocator.EnableConflictDetection(detector, time.Hour, nil)
+
+	if _, err := allocator.AllocateIP(ctx, req); err == nil {
+		t.Fatal("expected the only address, which answered the probe, not to be offered")
+	}
+	if detector.lockHeld {
+		t.Error("probe ran while holding the address's advisory lock")
+	}
+
+	declined, err := store.GetDeclinedAddresses(ctx)
+	if err != nil {
+		t.Fatalf("GetDeclinedAddresses: %v", err)
+	}
+	if len(declined) != 1 || declined[0].IP.String() != "192.168.1.10" {
+		t.Errorf("declined addresses %+v", declined)
+	}
+}
+
+// failingLeaseStore fails lookups of ip, or of every address if ip is nil, while err is set
+type failingLeaseStore struct {
+	storage.Backend
+	err error
+	ip  net.IP
+}
+
+func (s *failingLeaseStore) GetLeaseByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*storage.Lease, error) {
+	if s.err != nil && (s.ip == nil || s.ip.Equal(ip)) {
+		return nil, s.err
+	}
+	return s.Backend.GetLeaseByIP(ctx, ip, subnet)
+}
+
+func TestStoreErrorLeavesAddressFree(t *testing.T) {
+	ctx := context.Background()
+	store := &failingLeaseStore{Backend: storage.NewMemoryStore(), err: errors.New("connection refused")}
+	allocator := NewAllocator(store, 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.10"}
+	req := testAllocationRequest(t, "00:00:00:00:00:01", pool)
+	pick := func(idx *poolIndex) (net.IP, bool) { return idx.claim(nil) }
+
+	if _, err := allocator.findNeverUsedIP(ctx, req, pool, pick); !errors.Is(err, store.err) {
+		t.Fatalf("got %v, want the store error", err)
+	}
+	idx, err := allocator.poolIndex(ctx, req.Subnet, pool)
+	if err != nil {
+		t.Fatalf("poolIndex: %v", err)
+	}
+	if idx.free != 1 {
+		t.Fatalf("%d free addresses after a store error, want 1", idx.free)
+	}
+
+	store.err = nil
+	lease, err := allocator.findNeverUsedIP(ctx, req, pool, pick)
+	if err != nil || lease == nil {
+		t.Fatalf("findNeverUsedIP = %v, %v once the store recovered", lease, err)
+	}
+	if lease.IP.String() != "192.168.1.10" {
+		t.Errorf("allocated %s, want 192.168.1.10", lease.IP)
+	}
+}
+
+func TestAllocateIPReturnsStoreError(t *testing.T) {
+	ctx := context.Background()
+	store := &failingLeaseStore{Backend: storage.NewMemoryStore(), err: errors.New("connection refused")}
+	allocator := NewAllocator(store, 100, "test", false)
+	first := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.10"}
+	second := &PoolConfig{RangeStart: "192.168.1.20", RangeEnd: "192.168.1.20"}
+
+	for _, strategy := range []string{StrategyRandom, StrategySequential, StrategyHashed, StrategyLRU} {
+		first.Strategy, second.Strategy = strategy, strategy
+		_, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:00:00:00:00:01", first, second))
+		if !errors.Is(err, store.err) || errors.Is(err, errPoolExhausted) {
+			t.Errorf("%s: got %v, want the store error rather than pool exhaustion", strategy, err)
+		}
+	}
+}
+
+// ipInPool reports whether ip lies inside the pool range
+func ipInPool(ip net.IP, pool *PoolConfig) bool {
+	start := net.ParseIP(pool.RangeStart).To4()
+	end := net.ParseIP(pool.RangeEnd).To4()
+	ip = ip.To4()
+	return ip != nil && string(ip) >= string(start) && string(ip) <= string(end)
+}
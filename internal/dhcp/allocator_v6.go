@@ -0,0 +1,241 @@
+package dhcp
+
+import (
+	"context"
+	crand "crypto/rand"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// maxV6Probes bounds the number of random addresses tried in a large IPv6 pool.
+// IPv6 pools are typically far too large to enumerate, and sparsely used, so a
+// handful of random probes almost always finds a free address.
+const maxV6Probes = 64
+
+// smallV6PoolSize is the pool size up to which every address is tried in random order
+const smallV6PoolSize = 4096
+
+// AllocationRequestV6 contains parameters for DHCPv6 IA_NA allocation
+type AllocationRequestV6 struct {
+	DUID          string // Hex-encoded client DUID
+	IAID          uint32
+	MAC           net.HardwareAddr // Optional
+	Hostname      string
+	Subnet        *net.IPNet
+	Pools         []*PoolConfig
+	LeaseDuration time.Duration
+}
+
+// AllocateIPv6 allocates an IPv6 address for a client identity association
+// Priority:
+// 1. Check for existing active lease for this DUID/IAID
+// 2. Allocate from pool (LRU: expired leases first, then random never-used IPs)
+func (a *Allocator) AllocateIPv6(ctx context.Context, req *AllocationRequestV6) (*storage.LeaseV6, error) {
+	lease, err := a.store.GetLeaseV6ByDUID(ctx, req.DUID, req.IAID, req.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing lease: %w", err)
+	}
+	if lease != nil && lease.IsActive() {
+		return lease, nil
+	}
+
+	for i, pool := range req.Pools {
+		lease, err := a.allocateFromPoolV6(ctx, req, pool)
+		if err != nil {
+			logger.Debug().
+				Err(err).
+				Int("pool_index", i).
+				Msg("DHCPv6 pool allocation failed")
+			continue // Try next pool
+		}
+		if lease != nil {
+			return lease, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no available IPv6 addresses in any pool")
+}
+
+// allocateFromPoolV6 attempts to allocate an IPv6 address from a specific pool
+func (a *Allocator) allocateFromPoolV6(ctx context.Context, req *AllocationRequestV6, pool *PoolConfig) (*storage.LeaseV6, error) {
+	rangeStart := net.ParseIP(pool.RangeStart).To16()
+	rangeEnd := net.ParseIP(pool.RangeEnd).To16()
+
+	// First, try to reuse expired leases in this pool (LRU)
+	expiredLeases, err := a.store.GetExpiredLeasesV6(ctx, req.Subnet, rangeStart, rangeEnd, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired leases: %w", err)
+	}
+
+	for _, expired := range expiredLeases {
+		lockKey := getAdvisoryLockKey(expired.IP, req.Subnet)
+		var lease *storage.LeaseV6
+		err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
+			existing, err := a.store.GetLeaseV6ByIP(ctx, expired.IP, req.Subnet)
+			if err != nil {
+				return err
+			}
+			if existing == nil || existing.IsActive() || existing.State == storage.LeaseStateDeclined {
+				// Someone else claimed it
+				return fmt.Errorf("IP already claimed")
+			}
+
+			now := time.Now()
+			existing.DUID = req.DUID
+			existing.IAID = req.IAID
+			existing.MAC = req.MAC
+			existing.Hostname = sanitizeUTF8(req.Hostname)
+			existing.IssuedAt = now
+			existing.ExpiresAt = now.Add(req.LeaseDuration)
+			existing.LastSeen = now
+			existing.State = storage.LeaseStateActive
+			existing.AllocatedBy = a.serverID
+
+			if err := a.store.UpdateLeaseV6(ctx, existing); err != nil {
+				return fmt.Errorf("failed to update lease: %w", err)
+			}
+
+			lease = existing
+			return nil
+		})
+
+		if err == nil && lease != nil {
+			return lease, nil
+		}
+	}
+
+	// If no expired leases, try to find a never-used IP
+	return a.findNeverUsedIPv6(ctx, req, rangeStart, rangeEnd)
+}
+
+// findNeverUsedIPv6 searches for an IPv6 address that has never been allocated
+// Small pools are walked in random order; large pools are sampled randomly
+func (a *Allocator) findNeverUsedIPv6(ctx context.Context, req *AllocationRequestV6, rangeStart, rangeEnd net.IP) (*storage.LeaseV6, error) {
+	start := new(big.Int).SetBytes(rangeStart)
+	end := new(big.Int).SetBytes(rangeEnd)
+	size := new(big.Int).Sub(end, start)
+	size.Add(size, big.NewInt(1))
+
+	var candidates []net.IP
+	if size.Cmp(big.NewInt(smallV6PoolSize)) <= 0 {
+		n := int(size.Int64())
+		for _, offset := range rand.Perm(n) {
+			candidates = append(candidates, offsetIPv6(start, big.NewInt(int64(offset))))
+		}
+	} else {
+		for i := 0; i < maxV6Probes; i++ {
+			offset, err := crand.Int(crand.Reader, size)
+			if err != nil {
+				return nil, fmt.Errorf("failed to pick random address: %w", err)
+			}
+			candidates = append(candidates, offsetIPv6(start, offset))
+		}
+	}
+
+	for _, ip := range candidates {
+		lockKey := getAdvisoryLockKey(ip, req.Subnet)
+		var lease *storage.LeaseV6
+		err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
+			existing, err := a.store.GetLeaseV6ByIP(ctx, ip, req.Subnet)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return fmt.Errorf("IP in use")
+			}
+
+			now := time.Now()
+			lease = &storage.LeaseV6{
+				IP:          ip,
+				DUID:        req.DUID,
+				IAID:        req.IAID,
+				MAC:         req.MAC,
+				Hostname:    sanitizeUTF8(req.Hostname),
+				Subnet:      req.Subnet,
+				IssuedAt:    now,
+				ExpiresAt:   now.Add(req.LeaseDuration),
+				LastSeen:    now,
+				State:       storage.LeaseStateActive,
+				AllocatedBy: a.serverID,
+			}
+
+			if err := a.store.CreateLeaseV6(ctx, lease); err != nil {
+				return fmt.Errorf("failed to create lease: %w", err)
+			}
+
+			logger.Info().
+				Str("ip", ip.String()).
+				Str("duid", req.DUID).
+				Uint32("iaid", req.IAID).
+				Msg("Successfully created DHCPv6 lease")
+
+			return nil
+		})
+
+		if err == nil && lease != nil {
+			return lease, nil
+		}
+	}
+
+	return nil, fmt.Errorf("pool exhausted: no available IPv6 addresses")
+}
+
+// RenewLeaseV6 renews an existing DHCPv6 lease owned by the given DUID/IAID
+func (a *Allocator) RenewLeaseV6(ctx context.Context, duid string, iaid uint32, ip net.IP, subnet *net.IPNet, duration time.Duration) (*storage.LeaseV6, error) {
+	lockKey := getAdvisoryLockKey(ip, subnet)
+	var lease *storage.LeaseV6
+
+	err := a.store.WithAdvisoryLock(ctx, lockKey, func(ctx context.Context) error {
+		existing, err := a.store.GetLeaseV6ByIP(ctx, ip, subnet)
+		if err != nil {
+			return fmt.Errorf("failed to get lease: %w", err)
+		}
+		if existing == nil || existing.State == storage.LeaseStateDeclined {
+			return fmt.Errorf("lease not found")
+		}
+		if existing.DUID != duid || existing.IAID != iaid {
+			return fmt.Errorf("DUID/IAID mismatch")
+		}
+
+		expiresAt := time.Now().Add(duration)
+		if err := a.store.RenewLeaseV6(ctx, existing.ID, expiresAt); err != nil {
+			return err
+		}
+
+		existing.ExpiresAt = expiresAt
+		existing.LastSeen = time.Now()
+		existing.State = storage.LeaseStateActive
+		lease = existing
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+// ReleaseLeaseV6 releases a DHCPv6 lease
+func (a *Allocator) ReleaseLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error {
+	return a.store.ReleaseLeaseV6(ctx, duid, ip, subnet)
+}
+
+// DeclineLeaseV6 marks a DHCPv6 lease as declined (duplicate address detected)
+func (a *Allocator) DeclineLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error {
+	return a.store.DeclineLeaseV6(ctx, duid, ip, subnet)
+}
+
+// offsetIPv6 returns base+offset as a 16-byte IP address
+func offsetIPv6(base, offset *big.Int) net.IP {
+	sum := new(big.Int).Add(base, offset)
+	ip := make(net.IP, net.IPv6len)
+	sum.FillBytes(ip)
+	return ip
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package dhcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	etherTypeARP = 0x0806
+	arpRequest   = 1
+	arpReply     = 2
+)
+
+// arpProbe sends an ARP probe (RFC 5227, sender address 0.0.0.0) for ip on the interface
+// and returns the hardware address of any host that answers
+func arpProbe(ctx context.Context, ip net.IP, ifaceName string, timeout time.Duration) (bool, net.HardwareAddr, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to get interface %s: %w", ifaceName, err)
+	}
+	if len(iface.HardwareAddr) != 6 {
+		return false, nil, fmt.Errorf("interface %s has no Ethernet address", ifaceName)
+	}
+	target := ip.To4()
+	if target == nil {
+		return false, nil, fmt.Errorf("ARP probe requires an IPv4 address")
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(etherTypeARP)))
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to open ARP socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(etherTypeARP), Ifindex: iface.Index}); err != nil {
+		return false, nil, fmt.Errorf("failed to bind ARP socket: %w", err)
+	}
+
+	// Ethernet header followed by an ARP request with an all-zero sender protocol address
+	frame := make([]byte, 42)
+	copy(frame[0:6], net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[6:12], iface.HardwareAddr)
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeARP)
+	binary.BigEndian.PutUint16(frame[14:16], 1)      // Hardware type: Ethernet
+	binary.BigEndian.PutUint16(frame[16:18], 0x0800) // Protocol type: IPv4
+	frame[18], frame[19] = 6, 4
+	binary.BigEndian.PutUint16(frame[20:22], arpRequest)
+	copy(frame[22:28], iface.HardwareAddr)
+	copy(frame[38:42], target)
+
+	dest := &unix.SockaddrLinklayer{Ifindex: iface.Index, Halen: 6}
+	copy(dest.Addr[:], frame[0:6])
+	if err := unix.Sendto(fd, frame, 0, dest); err != nil {
+		return false, nil, fmt.Errorf("failed to send ARP probe: %w", err)
+	}
+
+	deadline := probeDeadline(ctx, timeout)
+	buf := make([]byte, 1500)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil, nil
+		}
+		tv := unix.NsecToTimeval(remaining.Nanoseconds())
+		if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return false, nil, fmt.Errorf("failed to set ARP timeout: %w", err)
+		}
+
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EWOULDBLOCK || err == unix.EINTR {
+				continue
+			}
+			return false, nil, fmt.Errorf("failed to read ARP reply: %w", err)
+		}
+
+		if n < 42 || binary.BigEndian.Uint16(buf[12:14]) != etherTypeARP ||
+			binary.BigEndian.Uint16(buf[20:22]) != arpReply {
+			continue
+		}
+		if bytes.Equal(buf[28:32], target) {
+			mac := make(net.HardwareAddr, 6)
+			copy(mac, buf[22:28])
+			return true, mac, nil
+		}
+	}
+}
+
+// htons converts a 16-bit value to network byte order
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
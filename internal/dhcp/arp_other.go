@@ -0,0 +1,14 @@
+//go:build !linux
+
+package dhcp
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// arpProbe is not available without raw link-layer sockets; callers fall back to ICMP
+func arpProbe(ctx context.Context, ip net.IP, ifaceName string, timeout time.Duration) (bool, net.HardwareAddr, error) {
+	return false, nil, errARPUnsupported
+}
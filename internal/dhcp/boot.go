@@ -0,0 +1,110 @@
+package dhcp
+
+import (
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// httpClientVendorClass is the vendor class prefix sent by UEFI HTTP boot clients
+const httpClientVendorClass = "HTTPClient"
+
+// bootSelection holds the boot settings chosen for a client
+type bootSelection struct {
+	tftpServer string
+	filename   string
+	httpBoot   bool // Reply must carry vendor class "HTTPClient" and a URL
+}
+
+// selectBoot picks the boot settings for a client
+// Precedence: reservation rules, reservation defaults, subnet rules, subnet defaults
+func selectBoot(req *dhcpv4.DHCPv4, subnet *SubnetConfig, reservation *storage.Reservation) bootSelection {
+	attrs := clientAttributesFromRequest(req)
+
+	if reservation != nil {
+		if sel, ok := matchBootRules(reservation.BootRules, attrs); ok {
+			return sel
+		}
+		if reservation.TFTPServer != "" || reservation.BootFilename != "" {
+			sel := bootSelection{
+				tftpServer: subnet.TFTPServer,
+				filename:   subnet.BootFilename,
+			}
+			if reservation.TFTPServer != "" {
+				sel.tftpServer = reservation.TFTPServer
+			}
+			if reservation.BootFilename != "" {
+				sel.filename = reservation.BootFilename
+			}
+			return sel
+		}
+	}
+
+	if sel, ok := matchBootRules(subnet.BootRules, attrs); ok {
+		return sel
+	}
+
+	return bootSelection{
+		tftpServer: subnet.TFTPServer,
+		filename:   subnet.BootFilename,
+	}
+}
+
+// matchBootRules returns the settings of the first rule matching the client
+func matchBootRules(rules []storage.BootRule, attrs *clientAttributes) (bootSelection, bool) {
+	for _, rule := range rules {
+		if bootRuleMatches(&rule, attrs) {
+			sel := bootSelection{
+				filename: rule.Filename,
+				httpBoot: rule.HTTPBoot,
+			}
+			if !rule.HTTPBoot {
+				sel.tftpServer = rule.TFTPServer
+			}
+			return sel, true
+		}
+	}
+	return bootSelection{}, false
+}
+
+// bootRuleMatches returns true if every configured criterion of the rule matches
+func bootRuleMatches(rule *storage.BootRule, attrs *clientAttributes) bool {
+	if rule.HTTPBoot && !strings.HasPrefix(attrs.vendorClass, httpClientVendorClass) {
+		return false
+	}
+
+	if rule.UserClass != "" {
+		found := false
+		for _, uc := range attrs.userClasses {
+			if uc == rule.UserClass {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(rule.Arch) > 0 {
+		found := false
+		for _, archStr := range rule.Arch {
+			want, err := config.ParseArch(archStr)
+			if err != nil {
+				continue
+			}
+			for _, got := range attrs.arch {
+				if want == got {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
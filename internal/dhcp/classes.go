@@ -0,0 +1,202 @@
+package dhcp
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/options"
+)
+
+// ClientClass holds a runtime client class with parsed match criteria
+type ClientClass struct {
+	Name           string
+	LeaseDuration  time.Duration    // Zero means use the subnet lease duration
+	RenewalRatio   float64          // Zero means use the subnet T1/T2 ratios
+	RebindingRatio float64          // Set together with RenewalRatio
+	Options        []options.Option // Added to or overriding subnet options
+
+	vendorClass string
+	userClass   string
+	macPrefix   []byte
+	arch        []uint16
+	circuitID   string
+	remoteID    string
+}
+
+// clientAttributes holds the request fields client classes are matched against
+type clientAttributes struct {
+	mac         net.HardwareAddr
+	vendorClass string
+	userClasses []string
+	arch        []uint16
+	circuitID   string
+	remoteID    string
+}
+
+// newClientClasses converts client classes from the YAML config into their runtime form
+func newClientClasses(cfgs []config.ClientClassConfig) ([]*ClientClass, error) {
+	var classes []*ClientClass
+	for _, cfg := range cfgs {
+		class := &ClientClass{
+			Name:           cfg.Name,
+			LeaseDuration:  cfg.LeaseDuration,
+			RenewalRatio:   cfg.RenewalRatio,
+			RebindingRatio: cfg.RebindingRatio,
+			vendorClass:    cfg.Match.VendorClass,
+			userClass:      cfg.Match.UserClass,
+			circuitID:      cfg.Match.CircuitID,
+			remoteID:       cfg.Match.RemoteID,
+		}
+
+		if cfg.Match.MACPrefix != "" {
+			prefix, err := config.ParseMACPrefix(cfg.Match.MACPrefix)
+			if err != nil {
+				return nil, fmt.Errorf("client class %s: %w", cfg.Name, err)
+			}
+			class.macPrefix = prefix
+		}
+
+		for _, archStr := range cfg.Match.Arch {
+			arch, err := config.ParseArch(archStr)
+			if err != nil {
+				return nil, fmt.Errorf("client class %s: %w", cfg.Name, err)
+			}
+			class.arch = append(class.arch, arch)
+		}
+
+		opts, err := options.Parse(cfg.Options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid options for client class %s: %w", cfg.Name, err)
+		}
+		class.Options = opts
+
+		classes = append(classes, class)
+	}
+
+	return classes, nil
+}
+
+// clientAttributesFromRequest extracts the fields used for class matching
+func clientAttributesFromRequest(req *dhcpv4.DHCPv4) *clientAttributes {
+	attrs := &clientAttributes{
+		mac:         req.ClientHWAddr,
+		vendorClass: req.ClassIdentifier(),
+		userClasses: req.UserClass(),
+	}
+
+	for _, arch := range req.ClientArch() {
+		attrs.arch = append(attrs.arch, uint16(arch))
+	}
+
+	relay := relayAgentInfoFromRequest(req)
+	attrs.circuitID = relay.circuitID
+	attrs.remoteID = relay.remoteID
+
+	return attrs
+}
+
+// Matches returns true if every configured criterion matches the client
+func (c *ClientClass) Matches(attrs *clientAttributes) bool {
+	if c.vendorClass != "" && !strings.Contains(attrs.vendorClass, c.vendorClass) {
+		return false
+	}
+
+	if c.userClass != "" {
+		found := false
+		for _, uc := range attrs.userClasses {
+			if uc == c.userClass {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(c.macPrefix) > 0 && !bytes.HasPrefix(attrs.mac, c.macPrefix) {
+		return false
+	}
+
+	if len(c.arch) > 0 {
+		found := false
+		for _, want := range c.arch {
+			for _, got := range attrs.arch {
+				if want == got {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if c.circuitID != "" && attrs.circuitID != c.circuitID {
+		return false
+	}
+	if c.remoteID != "" && attrs.remoteID != c.remoteID {
+		return false
+	}
+
+	return true
+}
+
+// classifyClient returns the classes a request belongs to, in config order
+func (s *Server) classifyClient(req *dhcpv4.DHCPv4) []*ClientClass {
+	attrs := clientAttributesFromRequest(req)
+
+	var matched []*ClientClass
+	for _, class := range s.classes {
+		if class.Matches(attrs) {
+			matched = append(matched, class)
+		}
+	}
+
+	return matched
+}
+
+// classNames returns the names of the given classes
+func classNames(classes []*ClientClass) []string {
+	names := make([]string, 0, len(classes))
+	for _, class := range classes {
+		names = append(names, class.Name)
+	}
+	return names
+}
+
+// poolsForClasses returns the pools a client may allocate from
+// Pools restricted to one of the client's classes come first, then unrestricted pools
+func poolsForClasses(pools []*PoolConfig, classes []*ClientClass) []*PoolConfig {
+	member := make(map[string]bool)
+	for _, class := range classes {
+		member[class.Name] = true
+	}
+
+	var classPools, openPools []*PoolConfig
+	for _, pool := range pools {
+		switch {
+		case pool.ClientClass == "":
+			openPools = append(openPools, pool)
+		case member[pool.ClientClass]:
+			classPools = append(classPools, pool)
+		}
+	}
+
+	return append(classPools, openPools...)
+}
+
+// leaseDurationForClasses returns the lease duration of the first class that overrides it
+func leaseDurationForClasses(subnet *SubnetConfig, classes []*ClientClass) time.Duration {
+	for _, class := range classes {
+		if class.LeaseDuration > 0 {
+			return class.LeaseDuration
+		}
+	}
+	return subnet.LeaseDuration
+}
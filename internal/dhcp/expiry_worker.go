@@ -10,14 +10,14 @@ import (
 
 // ExpiryWorker handles periodic lease expiration checks
 type ExpiryWorker struct {
-	store        *storage.Store
+	store        storage.LeaseStore
 	checkInterval time.Duration
 	stopChan     chan struct{}
 	doneChan     chan struct{}
 }
 
 // NewExpiryWorker creates a new lease expiry worker
-func NewExpiryWorker(store *storage.Store, checkInterval time.Duration) *ExpiryWorker {
+func NewExpiryWorker(store storage.LeaseStore, checkInterval time.Duration) *ExpiryWorker {
 	return &ExpiryWorker{
 		store:        store,
 		checkInterval: checkInterval,
@@ -99,5 +99,27 @@ func (w *ExpiryWorker) expireLeases(ctx context.Context) error {
 			Msg("Expired leases")
 	}
 
+	countV6, err := w.store.ExpireLeasesV6(ctx)
+	if err != nil {
+		return err
+	}
+
+	if countV6 > 0 {
+		logger.Info().
+			Int64("count", countV6).
+			Msg("Expired DHCPv6 leases")
+	}
+
+	countPD, err := w.store.ExpireDelegatedPrefixes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if countPD > 0 {
+		logger.Info().
+			Int64("count", countPD).
+			Msg("Expired delegated prefixes")
+	}
+
 	return nil
 }
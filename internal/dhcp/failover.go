@@ -0,0 +1,62 @@
+package dhcp
+
+import (
+	"context"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/sashakarcz/irondhcp/internal/failover"
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// EnableFailover shares clients and free addresses with a failover partner
+// and replicates every lease change to it
+func (a *Allocator) EnableFailover(peer *failover.Peer) {
+	a.failover = peer
+}
+
+// ownsAddress reports whether this node may offer a free address
+func (a *Allocator) ownsAddress(ip net.IP) bool {
+	return a.failover == nil || a.failover.OwnsAddress(ip)
+}
+
+// replicate sends a changed lease to the failover partner
+func (a *Allocator) replicate(lease *storage.Lease) {
+	if a.failover != nil && lease != nil {
+		a.failover.LeaseUpdated(lease)
+	}
+}
+
+// replicateIP reloads a lease changed in place by ip and replicates it
+func (a *Allocator) replicateIP(ctx context.Context, ip net.IP, subnet *net.IPNet) {
+	if a.failover == nil {
+		return
+	}
+
+	lease, err := a.store.GetLeaseByIP(ctx, ip, subnet)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("ip", ip.String()).
+			Msg("Failed to load lease for failover replication")
+		return
+	}
+	a.replicate(lease)
+}
+
+// servesClient reports whether this node answers the client under failover load balancing
+func (s *Server) servesClient(req *dhcpv4.DHCPv4) bool {
+	if s.failover == nil {
+		return true
+	}
+	return s.failover.ServesClient(loadBalanceKey(req))
+}
+
+// loadBalanceKey returns the client identifier (option 61) if present, otherwise chaddr (RFC 3074 section 5)
+func loadBalanceKey(req *dhcpv4.DHCPv4) []byte {
+	if opt := req.Options.Get(dhcpv4.OptionClientIdentifier); len(opt) > 0 {
+		return opt
+	}
+	return req.ClientHWAddr
+}
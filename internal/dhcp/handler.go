@@ -2,12 +2,16 @@ package dhcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/sashakarcz/irondhcp/internal/events"
 	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/options"
 	"github.com/sashakarcz/irondhcp/internal/storage"
 )
 
@@ -65,16 +69,28 @@ func (h *Handler) Handle(conn net.PacketConn, peer net.Addr, req *dhcpv4.DHCPv4)
 
 	// Send response
 	if resp != nil {
-		if _, err := conn.WriteTo(resp.ToBytes(), peer); err != nil {
+		// Relay agents expect option 82 back unchanged (RFC 3046 section 2.2)
+		echoRelayAgentInfo(req, resp)
+
+		// A NAK sent through a relay must be broadcast by the relay (RFC 2131 section 4.1)
+		if resp.MessageType() == dhcpv4.MessageTypeNak && !req.GatewayIPAddr.IsUnspecified() {
+			resp.SetBroadcast()
+		}
+
+		dest, err := h.sendReply(conn, req, resp, options.MarshalReply(resp, req))
+		if err != nil {
 			logger.Error().
 				Err(err).
 				Str("type", resp.MessageType().String()).
+				Str("dest", dest.addr.String()).
 				Msg("Failed to send DHCP response")
 		} else {
 			logger.Info().
 				Str("type", resp.MessageType().String()).
 				Str("mac", resp.ClientHWAddr.String()).
 				Str("ip", resp.YourIPAddr.String()).
+				Str("route", dest.kind.String()).
+				Str("dest", dest.addr.String()).
 				Msg("Sent DHCP response")
 		}
 	}
@@ -82,6 +98,14 @@ func (h *Handler) Handle(conn net.PacketConn, peer net.Addr, req *dhcpv4.DHCPv4)
 
 // handleDiscover handles DHCPDISCOVER messages
 func (h *Handler) handleDiscover(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	// The failover partner answers clients that hash into its half
+	if !h.server.servesClient(req) {
+		logger.Debug().
+			Str("mac", req.ClientHWAddr.String()).
+			Msg("Client belongs to failover partner, not responding")
+		return nil, nil
+	}
+
 	// Find subnet for this request
 	subnet, err := h.server.findSubnetForRequest(h.iface, req)
 	if err != nil {
@@ -100,19 +124,33 @@ func (h *Handler) handleDiscover(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcp
 		vendorClass = string(opt)
 	}
 
-	// Build allocation request
+	// Relay agent information (option 82), if relayed
+	relay := relayAgentInfoFromRequest(req)
+
+	// Evaluate client classes before allocation
+	classes := h.server.classifyClient(req)
+	if len(classes) > 0 {
+		logger.Debug().
+			Str("mac", req.ClientHWAddr.String()).
+			Strs("classes", classNames(classes)).
+			Msg("Client matched classes")
+	}
+
+	// Build allocation request (subnet, pools and lease time are set per shared network member)
 	allocReq := &AllocationRequest{
-		MAC:           req.ClientHWAddr,
-		Hostname:      req.HostName(),
-		Subnet:        subnet.Network,
-		Pools:         subnet.Pools,
-		LeaseDuration: subnet.LeaseDuration,
-		ClientID:      clientID,
-		VendorClass:   vendorClass,
+		MAC:                req.ClientHWAddr,
+		Hostname:           req.HostName(),
+		ClientID:           clientID,
+		VendorClass:        vendorClass,
+		UserClass:          strings.Join(req.UserClass(), ","),
+		CircuitID:          relay.circuitID,
+		RemoteID:           relay.remoteID,
+		Interface:          h.iface,
+		RequestedLeaseTime: req.IPAddressLeaseTime(0),
 	}
 
 	// Allocate IP
-	lease, err := h.server.allocator.AllocateIP(ctx, allocReq)
+	lease, subnet, err := h.server.allocateInSharedNetwork(ctx, allocReq, subnet, classes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to allocate IP: %w", err)
 	}
@@ -144,13 +182,12 @@ func (h *Handler) handleDiscover(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcp
 
 	resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
 	resp.YourIPAddr = lease.IP
-	resp.ServerIPAddr = subnet.Gateway
 
 	// Check for reservation to apply per-host boot options
-	reservation, _ := h.server.store.GetReservationByMAC(ctx, req.ClientHWAddr)
+	reservation, _ := h.server.allocator.FindReservation(ctx, req.ClientHWAddr, relay.circuitID, relay.remoteID, subnet.Network)
 
 	// Add DHCP options (with per-host overrides if reservation exists)
-	h.addDHCPOptionsWithReservation(resp, subnet, reservation)
+	h.addDHCPOptionsWithReservation(req, resp, subnet, reservation, classes)
 
 	// Broadcast OFFER event
 	if h.server.broadcaster != nil {
@@ -169,6 +206,8 @@ func (h *Handler) handleDiscover(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcp
 }
 
 // handleRequest handles DHCPREQUEST messages
+// The client state is derived from the server identifier, requested IP and ciaddr
+// (RFC 2131 section 4.3.2); the ACK always carries the lease recorded in the store.
 func (h *Handler) handleRequest(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
 	// Find subnet for this request
 	subnet, err := h.server.findSubnetForRequest(h.iface, req)
@@ -176,86 +215,135 @@ func (h *Handler) handleRequest(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv
 		return nil, fmt.Errorf("failed to find subnet: %w", err)
 	}
 
-	// Get requested IP
-	requestedIP := req.RequestedIPAddress()
-	if requestedIP == nil || requestedIP.IsUnspecified() {
-		requestedIP = req.ClientIPAddr
-	}
+	// Relay agent information (option 82), if relayed
+	relay := relayAgentInfoFromRequest(req)
 
-	// Verify the requested IP is valid
-	if requestedIP.IsUnspecified() {
-		return h.sendNAK(req, "No IP address requested")
-	}
+	// Evaluate client classes before allocation
+	classes := h.server.classifyClient(req)
 
-	// Check if this is a renewal or a new request
-	lease, err := h.server.store.GetLeaseByIP(ctx, requestedIP, subnet.Network)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get lease: %w", err)
-	}
+	state := detectRequestState(req)
 
-	// If lease exists, verify MAC matches
-	if lease != nil {
-		if lease.MAC.String() != req.ClientHWAddr.String() {
-			logger.Warn().
-				Str("requested_ip", requestedIP.String()).
-				Str("lease_mac", lease.MAC.String()).
-				Str("request_mac", req.ClientHWAddr.String()).
-				Msg("MAC mismatch for requested IP")
-			return h.sendNAK(req, "IP already allocated to another client")
+	var lease *storage.Lease
+	switch state {
+	case requestStateSelecting:
+		requestedIP := req.RequestedIPAddress()
+		subnet = h.server.subnetForAddress(subnet, requestedIP)
+
+		// The client accepted another server's offer. Our offer is left to expire rather than
+		// released, since an HA peer sharing the database may have made the accepted one.
+		if !req.ServerIdentifier().Equal(h.serverIdentifier(req, subnet)) {
+			logger.Debug().
+				Str("mac", req.ClientHWAddr.String()).
+				Str("server_id", req.ServerIdentifier().String()).
+				Msg("Client selected another server, not responding")
+			return nil, nil
 		}
 
-		// Renew the lease
-		if err := h.server.allocator.RenewLease(ctx, req.ClientHWAddr, requestedIP, subnet.Network, subnet.LeaseDuration); err != nil {
-			return nil, fmt.Errorf("failed to renew lease: %w", err)
+		lease, err = h.confirmLease(ctx, req, requestedIP, subnet, classes)
+		if err != nil {
+			return nil, err
 		}
+		if lease == nil {
+			// The offer is gone (expired or the database was reset); ACK only if the
+			// address the client asked for can still be leased to it
+			allocReq := &AllocationRequest{
+				MAC:           req.ClientHWAddr,
+				Hostname:      req.HostName(),
+				ClientID:      string(req.Options.Get(dhcpv4.OptionClientIdentifier)),
+				VendorClass:   req.ClassIdentifier(),
+				UserClass:     strings.Join(req.UserClass(), ","),
+				CircuitID:     relay.circuitID,
+				RemoteID:      relay.remoteID,
+				Interface:     h.iface,
+				Subnet:        subnet.Network,
+				Pools:         poolsForClasses(subnet.Pools, classes),
+				LeaseDuration: grantedLeaseDuration(subnet, classes, req.IPAddressLeaseTime(0)),
+			}
+
+			if subnet.Network.Contains(requestedIP) {
+				lease, err = h.server.allocator.ClaimRequestedIP(ctx, allocReq, requestedIP)
+				if err != nil {
+					return nil, fmt.Errorf("failed to claim requested IP: %w", err)
+				}
+			}
+			if lease == nil {
+				logger.Warn().
+					Str("mac", req.ClientHWAddr.String()).
+					Str("requested_ip", requestedIP.String()).
+					Msg("Requested IP is no longer available")
+				return h.sendNAK(req, subnet, "Requested address is not available")
+			}
 
-		logger.Info().
-			Str("mac", req.ClientHWAddr.String()).
-			Str("ip", requestedIP.String()).
-			Msg("Renewed lease")
-	} else {
-		// New lease - allocate
-		// Extract client identifier
-		var clientID string
-		if opt := req.Options.Get(dhcpv4.OptionClientIdentifier); opt != nil {
-			clientID = string(opt)
+			logger.Info().
+				Str("mac", req.ClientHWAddr.String()).
+				Str("ip", lease.IP.String()).
+				Msg("Created new lease")
 		}
 
-		// Extract vendor class identifier
-		var vendorClass string
-		if opt := req.Options.Get(dhcpv4.OptionClassIdentifier); opt != nil {
-			vendorClass = string(opt)
+	case requestStateInitReboot:
+		// INIT-REBOOT is broadcast, so it is load balanced like DHCPDISCOVER (RFC 3074 section 5)
+		if !h.server.servesClient(req) {
+			logger.Debug().
+				Str("mac", req.ClientHWAddr.String()).
+				Msg("Client belongs to failover partner, not responding")
+			return nil, nil
 		}
 
-		allocReq := &AllocationRequest{
-			MAC:           req.ClientHWAddr,
-			Hostname:      req.HostName(),
-			Subnet:        subnet.Network,
-			Pools:         subnet.Pools,
-			LeaseDuration: subnet.LeaseDuration,
-			ClientID:      clientID,
-			VendorClass:   vendorClass,
+		// The remembered address must be on the client's current network
+		requestedIP := req.RequestedIPAddress()
+		member := h.server.subnetForAddress(subnet, requestedIP)
+		if !member.Network.Contains(requestedIP) {
+			return h.sendNAK(req, subnet, "Requested address is not on this network")
 		}
+		subnet = member
 
-		lease, err = h.server.allocator.AllocateIP(ctx, allocReq)
+		lease, err = h.confirmLease(ctx, req, requestedIP, subnet, classes)
 		if err != nil {
-			return nil, fmt.Errorf("failed to allocate IP: %w", err)
+			return nil, err
 		}
-
-		// Check if allocated IP matches requested IP
-		if !lease.IP.Equal(requestedIP) {
-			logger.Warn().
+		if lease == nil {
+			// RFC 2131: a server with no record of the client must remain silent
+			logger.Debug().
+				Str("mac", req.ClientHWAddr.String()).
 				Str("requested_ip", requestedIP.String()).
-				Str("allocated_ip", lease.IP.String()).
-				Msg("Allocated IP differs from requested IP")
+				Msg("No record of INIT-REBOOT client, not responding")
+			return nil, nil
 		}
 
-		logger.Info().
+	case requestStateRenewing:
+		member := h.server.subnetForAddress(subnet, req.ClientIPAddr)
+		if !member.Network.Contains(req.ClientIPAddr) {
+			return h.sendNAK(req, subnet, "Address is not on this network")
+		}
+		subnet = member
+
+		lease, err = h.confirmLease(ctx, req, req.ClientIPAddr, subnet, classes)
+		if err != nil {
+			return nil, err
+		}
+		if lease == nil {
+			return h.sendNAK(req, subnet, "No lease for this address")
+		}
+
+	default:
+		logger.Warn().
 			Str("mac", req.ClientHWAddr.String()).
-			Str("ip", lease.IP.String()).
-			Msg("Created new lease")
+			Str("ciaddr", req.ClientIPAddr.String()).
+			Msg("Ignoring malformed DHCPREQUEST")
+		return nil, nil
 	}
 
+	// The address belongs to another client
+	if lease.MAC.String() != req.ClientHWAddr.String() {
+		return h.sendNAK(req, subnet, "IP already allocated to another client")
+	}
+
+	logger.Debug().
+		Str("mac", req.ClientHWAddr.String()).
+		Str("ip", lease.IP.String()).
+		Str("state", state.String()).
+		Msg("Confirmed lease for DHCPREQUEST")
+
 	// Build ACK response
 	resp, err := dhcpv4.NewReplyFromRequest(req)
 	if err != nil {
@@ -263,14 +351,13 @@ func (h *Handler) handleRequest(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv
 	}
 
 	resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
-	resp.YourIPAddr = requestedIP
-	resp.ServerIPAddr = subnet.Gateway
+	resp.YourIPAddr = lease.IP
 
 	// Check for reservation to apply per-host boot options
-	reservation, _ := h.server.store.GetReservationByMAC(ctx, req.ClientHWAddr)
+	reservation, _ := h.server.allocator.FindReservation(ctx, req.ClientHWAddr, relay.circuitID, relay.remoteID, subnet.Network)
 
 	// Add DHCP options (with per-host overrides if reservation exists)
-	h.addDHCPOptionsWithReservation(resp, subnet, reservation)
+	h.addDHCPOptionsWithReservation(req, resp, subnet, reservation, classes)
 
 	// Broadcast REQUEST event
 	if h.server.broadcaster != nil {
@@ -281,6 +368,7 @@ func (h *Handler) handleRequest(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv
 			req.HostName(),
 			map[string]interface{}{
 				"subnet": subnet.Network.String(),
+				"state":  state.String(),
 			},
 		)
 	}
@@ -301,6 +389,43 @@ func (h *Handler) handleRequest(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv
 	return resp, nil
 }
 
+// confirmLease renews the client's lease on ip
+// Returns nil if the store has no usable record of the address. A lease held by another
+// client is returned unchanged so the caller can NAK it.
+func (h *Handler) confirmLease(ctx context.Context, req *dhcpv4.DHCPv4, ip net.IP, subnet *SubnetConfig, classes []*ClientClass) (*storage.Lease, error) {
+	lease, err := h.server.store.GetLeaseByIP(ctx, ip, subnet.Network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lease: %w", err)
+	}
+	if lease == nil || lease.State == storage.LeaseStateDeclined {
+		return nil, nil
+	}
+
+	if lease.MAC.String() != req.ClientHWAddr.String() {
+		logger.Warn().
+			Str("requested_ip", ip.String()).
+			Str("lease_mac", lease.MAC.String()).
+			Str("request_mac", req.ClientHWAddr.String()).
+			Msg("MAC mismatch for requested IP")
+		return lease, nil
+	}
+
+	leaseDuration := leaseTimesForRequest(req, subnet, classes).Lease
+	if err := h.server.allocator.RenewLease(ctx, req.ClientHWAddr, ip, subnet.Network, leaseDuration); err != nil {
+		return nil, fmt.Errorf("failed to renew lease: %w", err)
+	}
+
+	lease.State = storage.LeaseStateActive
+	lease.ExpiresAt = time.Now().Add(leaseDuration)
+
+	logger.Info().
+		Str("mac", req.ClientHWAddr.String()).
+		Str("ip", ip.String()).
+		Msg("Renewed lease")
+
+	return lease, nil
+}
+
 // handleRelease handles DHCPRELEASE messages
 func (h *Handler) handleRelease(ctx context.Context, req *dhcpv4.DHCPv4) error {
 	// Find subnet for this request
@@ -308,6 +433,7 @@ func (h *Handler) handleRelease(ctx context.Context, req *dhcpv4.DHCPv4) error {
 	if err != nil {
 		return fmt.Errorf("failed to find subnet: %w", err)
 	}
+	subnet = h.server.subnetForAddress(subnet, req.ClientIPAddr)
 
 	// Release the lease
 	if err := h.server.allocator.ReleaseLease(ctx, req.ClientIPAddr, subnet.Network); err != nil {
@@ -347,9 +473,18 @@ func (h *Handler) handleDecline(ctx context.Context, req *dhcpv4.DHCPv4) error {
 	if requestedIP == nil || requestedIP.IsUnspecified() {
 		return fmt.Errorf("no IP address in DECLINE")
 	}
+	subnet = h.server.subnetForAddress(subnet, requestedIP)
 
-	// Mark the lease as declined
-	if err := h.server.allocator.DeclineLease(ctx, requestedIP, subnet.Network); err != nil {
+	// Mark the lease as declined and keep the address out of the pool for the quarantine period
+	err = h.server.allocator.DeclineLease(ctx, requestedIP, subnet.Network, req.ClientHWAddr, subnet.DeclineQuarantine)
+	if errors.Is(err, storage.ErrLeaseHeldByOther) {
+		logger.Warn().
+			Str("mac", req.ClientHWAddr.String()).
+			Str("ip", requestedIP.String()).
+			Msg("Ignoring DECLINE for an address leased to another client")
+		return nil
+	}
+	if err != nil {
 		return fmt.Errorf("failed to decline lease: %w", err)
 	}
 
@@ -366,8 +501,9 @@ func (h *Handler) handleDecline(ctx context.Context, req *dhcpv4.DHCPv4) error {
 			req.ClientHWAddr,
 			req.HostName(),
 			map[string]interface{}{
-				"subnet": subnet.Network.String(),
-				"reason": "IP conflict detected",
+				"subnet":     subnet.Network.String(),
+				"reason":     "IP conflict detected",
+				"quarantine": subnet.DeclineQuarantine.String(),
 			},
 		)
 	}
@@ -382,6 +518,7 @@ func (h *Handler) handleInform(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv4
 	if err != nil {
 		return nil, fmt.Errorf("failed to find subnet: %w", err)
 	}
+	subnet = h.server.subnetForAddress(subnet, req.ClientIPAddr)
 
 	// Build ACK response with options only (no IP allocation)
 	resp, err := dhcpv4.NewReplyFromRequest(req)
@@ -391,10 +528,9 @@ func (h *Handler) handleInform(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv4
 
 	resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
 	resp.YourIPAddr = net.IPv4zero // No IP allocation for INFORM
-	resp.ServerIPAddr = subnet.Gateway
 
 	// Add DHCP options
-	h.addDHCPOptions(resp, subnet)
+	h.addDHCPOptions(req, resp, subnet, h.server.classifyClient(req))
 
 	logger.Info().
 		Str("mac", req.ClientHWAddr.String()).
@@ -404,13 +540,14 @@ func (h *Handler) handleInform(ctx context.Context, req *dhcpv4.DHCPv4) (*dhcpv4
 }
 
 // sendNAK sends a DHCPNAK response
-func (h *Handler) sendNAK(req *dhcpv4.DHCPv4, reason string) (*dhcpv4.DHCPv4, error) {
+func (h *Handler) sendNAK(req *dhcpv4.DHCPv4, subnet *SubnetConfig, reason string) (*dhcpv4.DHCPv4, error) {
 	resp, err := dhcpv4.NewReplyFromRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create NAK: %w", err)
 	}
 
 	resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeNak))
+	resp.UpdateOption(dhcpv4.OptServerIdentifier(h.serverIdentifier(req, subnet)))
 	resp.UpdateOption(dhcpv4.OptMessage(reason))
 
 	logger.Info().
@@ -439,14 +576,14 @@ func (h *Handler) sendNAK(req *dhcpv4.DHCPv4, reason string) (*dhcpv4.DHCPv4, er
 }
 
 // addDHCPOptions adds standard DHCP options to a response
-func (h *Handler) addDHCPOptions(resp *dhcpv4.DHCPv4, subnet *SubnetConfig) {
-	h.addDHCPOptionsWithReservation(resp, subnet, nil)
+func (h *Handler) addDHCPOptions(req, resp *dhcpv4.DHCPv4, subnet *SubnetConfig, classes []*ClientClass) {
+	h.addDHCPOptionsWithReservation(req, resp, subnet, nil, classes)
 }
 
-// addDHCPOptionsWithReservation adds DHCP options with optional per-host overrides
-func (h *Handler) addDHCPOptionsWithReservation(resp *dhcpv4.DHCPv4, subnet *SubnetConfig, reservation *storage.Reservation) {
-	// Lease time
-	resp.UpdateOption(dhcpv4.OptIPAddressLeaseTime(subnet.LeaseDuration))
+// addDHCPOptionsWithReservation adds DHCP options with optional per-host and per-class overrides
+func (h *Handler) addDHCPOptionsWithReservation(req, resp *dhcpv4.DHCPv4, subnet *SubnetConfig, reservation *storage.Reservation, classes []*ClientClass) {
+	// Lease time and renewal (T1) / rebinding (T2) timers
+	addLeaseTimeOptions(resp, leaseTimesForRequest(req, subnet, classes))
 
 	// Router (gateway)
 	if subnet.Gateway != nil && !subnet.Gateway.IsUnspecified() {
@@ -461,35 +598,41 @@ func (h *Handler) addDHCPOptionsWithReservation(resp *dhcpv4.DHCPv4, subnet *Sub
 	// Subnet mask
 	resp.UpdateOption(dhcpv4.OptSubnetMask(subnet.Network.Mask))
 
-	// Domain name
-	if domainName, ok := subnet.Options["domain_name"]; ok {
-		resp.UpdateOption(dhcpv4.OptDomainName(domainName))
+	// Configured options (domain name, NTP servers, static routes, ...)
+	// Applied after the defaults above so they can override them
+	for _, opt := range subnet.DHCPOptions {
+		resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(opt.Code), opt.Value))
+	}
+
+	// Client class options override subnet options; the first matching class wins
+	for i := len(classes) - 1; i >= 0; i-- {
+		for _, opt := range classes[i].Options {
+			resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(opt.Code), opt.Value))
+		}
 	}
 
 	// Server identifier
-	resp.UpdateOption(dhcpv4.OptServerIdentifier(subnet.Gateway))
+	resp.UpdateOption(dhcpv4.OptServerIdentifier(h.serverIdentifier(req, subnet)))
 
 	// Boot options (TFTP server and filename)
-	// Per-host reservation overrides subnet-level settings
-	tftpServer := subnet.TFTPServer
-	bootFilename := subnet.BootFilename
+	// Chosen by architecture/user class rules; per-host reservation overrides subnet-level settings
+	boot := selectBoot(req, subnet, reservation)
 
-	if reservation != nil {
-		if reservation.TFTPServer != "" {
-			tftpServer = reservation.TFTPServer
-		}
-		if reservation.BootFilename != "" {
-			bootFilename = reservation.BootFilename
-		}
+	// siaddr: the server the boot file is fetched from
+	resp.ServerIPAddr = nextServer(subnet, boot)
+
+	// UEFI HTTP boot clients ignore offers that don't identify as HTTPClient
+	if boot.httpBoot {
+		resp.UpdateOption(dhcpv4.OptClassIdentifier(httpClientVendorClass))
 	}
 
 	// DHCP option 66: TFTP server name
-	if tftpServer != "" {
-		resp.UpdateOption(dhcpv4.OptTFTPServerName(tftpServer))
+	if boot.tftpServer != "" {
+		resp.UpdateOption(dhcpv4.OptTFTPServerName(boot.tftpServer))
 	}
 
 	// DHCP option 67: Bootfile name
-	if bootFilename != "" {
-		resp.UpdateOption(dhcpv4.OptBootFileName(bootFilename))
+	if boot.filename != "" {
+		resp.UpdateOption(dhcpv4.OptBootFileName(boot.filename))
 	}
 }
@@ -0,0 +1,304 @@
+package dhcp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// newTestHandler returns a handler for one 192.168.1.0/24 subnet backed by the memory store
+func newTestHandler(t *testing.T, rangeStart, rangeEnd string) (*Handler, *storage.EmbeddedStore) {
+	t.Helper()
+
+	cfg := &config.Config{
+		Subnets: []config.SubnetConfig{{
+			Network:           "192.168.1.0/24",
+			Gateway:           "192.168.1.1",
+			ServerIdentifier:  "192.168.1.1",
+			DNSServers:        []string{"192.168.1.1"},
+			LeaseDuration:     time.Hour,
+			MaxLeaseDuration:  24 * time.Hour,
+			DeclineQuarantine: time.Hour,
+			Pools:             []config.PoolConfig{{RangeStart: rangeStart, RangeEnd: rangeEnd}},
+		}},
+	}
+
+	store := storage.NewMemoryStore()
+	server, err := New(cfg, store, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	return &Handler{server: server}, store
+}
+
+// newTestMessage builds a client message of the given type
+func newTestMessage(t *testing.T, mac string, msgType dhcpv4.MessageType, modifiers ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	t.Helper()
+
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		t.Fatalf("invalid MAC %s: %v", mac, err)
+	}
+	modifiers = append([]dhcpv4.Modifier{dhcpv4.WithHwAddr(hw), dhcpv4.WithMessageType(msgType)}, modifiers...)
+	msg, err := dhcpv4.New(modifiers...)
+	if err != nil {
+		t.Fatalf("dhcpv4.New: %v", err)
+	}
+	return msg
+}
+
+// acquire runs DISCOVER/OFFER/REQUEST/ACK and returns the ACK
+func acquire(t *testing.T, h *Handler, mac string) *dhcpv4.DHCPv4 {
+	t.Helper()
+	ctx := context.Background()
+
+	offer, err := h.handleDiscover(ctx, newTestMessage(t, mac, dhcpv4.MessageTypeDiscover))
+	if err != nil {
+		t.Fatalf("handleDiscover: %v", err)
+	}
+	if offer == nil || offer.MessageType() != dhcpv4.MessageTypeOffer {
+		t.Fatalf("expected an OFFER, got %v", offer)
+	}
+
+	request, err := dhcpv4.NewRequestFromOffer(offer)
+	if err != nil {
+		t.Fatalf("NewRequestFromOffer: %v", err)
+	}
+	ack, err := h.handleRequest(ctx, request)
+	if err != nil {
+		t.Fatalf("handleRequest: %v", err)
+	}
+	if ack == nil || ack.MessageType() != dhcpv4.MessageTypeAck {
+		t.Fatalf("expected an ACK, got %v", ack)
+	}
+	if !ack.YourIPAddr.Equal(offer.YourIPAddr) {
+		t.Fatalf("ACK for %s, but %s was offered", ack.YourIPAddr, offer.YourIPAddr)
+	}
+	return ack
+}
+
+func TestHandlerDORA(t *testing.T) {
+	h, store := newTestHandler(t, "192.168.1.100", "192.168.1.200")
+
+	ack := acquire(t, h, "00:11:22:33:44:55")
+	if !ack.ServerIdentifier().Equal(net.ParseIP("192.168.1.1")) {
+		t.Errorf("server identifier = %s, want 192.168.1.1", ack.ServerIdentifier())
+	}
+	if got := ack.IPAddressLeaseTime(0); got != time.Hour {
+		t.Errorf("lease time = %s, want 1h", got)
+	}
+	if routers := ack.Router(); len(routers) != 1 || !routers[0].Equal(net.ParseIP("192.168.1.1")) {
+		t.Errorf("routers = %v, want [192.168.1.1]", routers)
+	}
+
+	lease, err := store.GetLeaseByIP(context.Background(), ack.YourIPAddr, h.server.subnets["192.168.1.0/24"].Network)
+	if err != nil || lease == nil {
+		t.Fatalf("no lease stored for %s: %v", ack.YourIPAddr, err)
+	}
+	if lease.MAC.String() != "00:11:22:33:44:55" || lease.State != storage.LeaseStateActive {
+		t.Errorf("stored lease = %s %s, want 00:11:22:33:44:55 active", lease.MAC, lease.State)
+	}
+
+	// A second DISCOVER from the same client is offered the same address
+	offer, err := h.handleDiscover(context.Background(), newTestMessage(t, "00:11:22:33:44:55", dhcpv4.MessageTypeDiscover))
+	if err != nil {
+		t.Fatalf("handleDiscover: %v", err)
+	}
+	if !offer.YourIPAddr.Equal(ack.YourIPAddr) {
+		t.Errorf("repeat DISCOVER offered %s, want %s", offer.YourIPAddr, ack.YourIPAddr)
+	}
+}
+
+func TestHandlerRequestForOtherServerIsIgnored(t *testing.T) {
+	h, _ := newTestHandler(t, "192.168.1.100", "192.168.1.200")
+
+	request := newTestMessage(t, "00:11:22:33:44:55", dhcpv4.MessageTypeRequest,
+		dhcpv4.WithServerIP(net.ParseIP("192.168.1.2")),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(net.ParseIP("192.168.1.2"))),
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP("192.168.1.150"))))
+
+	resp, err := h.handleRequest(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handleRequest: %v", err)
+	}
+	if resp != nil {
+		t.Errorf("expected no reply for another server's offer, got %s", resp.MessageType())
+	}
+}
+
+func TestHandlerRequestAfterOfferIsLost(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		wantAck   bool
+	}{
+		{"free address", "192.168.1.150", true},
+		{"taken address", "192.168.1.100", false},
+		{"outside the pool", "192.168.1.50", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store := newTestHandler(t, "192.168.1.100", "192.168.1.200")
+			ctx := context.Background()
+			subnet := h.server.subnets["192.168.1.0/24"].Network
+
+			hw, _ := net.ParseMAC("00:00:00:00:00:01")
+			if err := store.CreateLease(ctx, &storage.Lease{
+				IP:        net.ParseIP("192.168.1.100").To4(),
+				MAC:       hw,
+				Subnet:    subnet,
+				IssuedAt:  time.Now(),
+				ExpiresAt: time.Now().Add(time.Hour),
+				State:     storage.LeaseStateActive,
+			}); err != nil {
+				t.Fatalf("CreateLease: %v", err)
+			}
+
+			// A SELECTING request with no offer on record
+			request := newTestMessage(t, "00:11:22:33:44:55", dhcpv4.MessageTypeRequest,
+				dhcpv4.WithOption(dhcpv4.OptServerIdentifier(net.ParseIP("192.168.1.1"))),
+				dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP(tt.requested))))
+			resp, err := h.handleRequest(ctx, request)
+			if err != nil {
+				t.Fatalf("handleRequest: %v", err)
+			}
+
+			if tt.wantAck {
+				if resp == nil || resp.MessageType() != dhcpv4.MessageTypeAck || !resp.YourIPAddr.Equal(net.ParseIP(tt.requested)) {
+					t.Fatalf("expected an ACK for %s, got %v", tt.requested, resp)
+				}
+				return
+			}
+			if resp == nil || resp.MessageType() != dhcpv4.MessageTypeNak {
+				t.Fatalf("expected a NAK, got %v", resp)
+			}
+
+			// Nothing else was allocated in place of the requested address
+			client, _ := net.ParseMAC("00:11:22:33:44:55")
+			if lease, err := store.GetLeaseByMAC(ctx, client, subnet); err != nil || lease != nil {
+				t.Errorf("NAKed client holds lease %v (%v)", lease, err)
+			}
+		})
+	}
+}
+
+func TestHandlerRenewing(t *testing.T) {
+	h, _ := newTestHandler(t, "192.168.1.100", "192.168.1.200")
+	ack := acquire(t, h, "00:11:22:33:44:55")
+
+	renew := newTestMessage(t, "00:11:22:33:44:55", dhcpv4.MessageTypeRequest, dhcpv4.WithClientIP(ack.YourIPAddr))
+	resp, err := h.handleRequest(context.Background(), renew)
+	if err != nil {
+		t.Fatalf("handleRequest: %v", err)
+	}
+	if resp == nil || resp.MessageType() != dhcpv4.MessageTypeAck {
+		t.Fatalf("expected an ACK for the renewal, got %v", resp)
+	}
+	if !resp.YourIPAddr.Equal(ack.YourIPAddr) {
+		t.Errorf("renewal ACK for %s, want %s", resp.YourIPAddr, ack.YourIPAddr)
+	}
+
+	// Renewing an address the server has no lease for is refused
+	unknown := newTestMessage(t, "00:11:22:33:44:55", dhcpv4.MessageTypeRequest, dhcpv4.WithClientIP(net.ParseIP("192.168.1.201")))
+	resp, err = h.handleRequest(context.Background(), unknown)
+	if err != nil {
+		t.Fatalf("handleRequest: %v", err)
+	}
+	if resp == nil || resp.MessageType() != dhcpv4.MessageTypeNak {
+		t.Fatalf("expected a NAK for an unknown address, got %v", resp)
+	}
+}
+
+func TestHandlerInitReboot(t *testing.T) {
+	h, _ := newTestHandler(t, "192.168.1.100", "192.168.1.200")
+	ack := acquire(t, h, "00:11:22:33:44:55")
+
+	// Another client claiming the address is refused
+	claim := newTestMessage(t, "66:77:88:99:aa:bb", dhcpv4.MessageTypeRequest,
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(ack.YourIPAddr)))
+	resp, err := h.handleRequest(context.Background(), claim)
+	if err != nil {
+		t.Fatalf("handleRequest: %v", err)
+	}
+	if resp == nil || resp.MessageType() != dhcpv4.MessageTypeNak {
+		t.Fatalf("expected a NAK for another client's address, got %v", resp)
+	}
+
+	// A client the server has no record of gets no reply
+	unknown := newTestMessage(t, "66:77:88:99:aa:bb", dhcpv4.MessageTypeRequest,
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP("192.168.1.201"))))
+	resp, err = h.handleRequest(context.Background(), unknown)
+	if err != nil {
+		t.Fatalf("handleRequest: %v", err)
+	}
+	if resp != nil {
+		t.Errorf("expected no reply for an unknown INIT-REBOOT client, got %s", resp.MessageType())
+	}
+
+	// A client on the wrong network is told so
+	moved := newTestMessage(t, "00:11:22:33:44:55", dhcpv4.MessageTypeRequest,
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP("10.0.0.5"))))
+	resp, err = h.handleRequest(context.Background(), moved)
+	if err != nil {
+		t.Fatalf("handleRequest: %v", err)
+	}
+	if resp == nil || resp.MessageType() != dhcpv4.MessageTypeNak {
+		t.Fatalf("expected a NAK for an address on another network, got %v", resp)
+	}
+}
+
+func TestHandlerRelease(t *testing.T) {
+	h, store := newTestHandler(t, "192.168.1.100", "192.168.1.100")
+	ack := acquire(t, h, "00:11:22:33:44:55")
+
+	release := newTestMessage(t, "00:11:22:33:44:55", dhcpv4.MessageTypeRelease, dhcpv4.WithClientIP(ack.YourIPAddr))
+	if err := h.handleRelease(context.Background(), release); err != nil {
+		t.Fatalf("handleRelease: %v", err)
+	}
+
+	lease, err := store.GetLeaseByIP(context.Background(), ack.YourIPAddr, h.server.subnets["192.168.1.0/24"].Network)
+	if err != nil || lease == nil {
+		t.Fatalf("lease for %s disappeared: %v", ack.YourIPAddr, err)
+	}
+	if lease.State != storage.LeaseStateReleased {
+		t.Errorf("state = %s, want %s", lease.State, storage.LeaseStateReleased)
+	}
+
+	// The only address in the pool is free again
+	next := acquire(t, h, "66:77:88:99:aa:bb")
+	if !next.YourIPAddr.Equal(ack.YourIPAddr) {
+		t.Errorf("new client got %s, want the released %s", next.YourIPAddr, ack.YourIPAddr)
+	}
+}
+
+func TestHandlerDecline(t *testing.T) {
+	h, store := newTestHandler(t, "192.168.1.100", "192.168.1.101")
+	ack := acquire(t, h, "00:11:22:33:44:55")
+
+	decline := newTestMessage(t, "00:11:22:33:44:55", dhcpv4.MessageTypeDecline,
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(ack.YourIPAddr)))
+	if err := h.handleDecline(context.Background(), decline); err != nil {
+		t.Fatalf("handleDecline: %v", err)
+	}
+
+	declined, err := store.GetDeclinedAddresses(context.Background())
+	if err != nil {
+		t.Fatalf("GetDeclinedAddresses: %v", err)
+	}
+	if len(declined) != 1 || !declined[0].IP.Equal(ack.YourIPAddr) {
+		t.Fatalf("declined addresses = %v, want only %s", declined, ack.YourIPAddr)
+	}
+
+	// The client is moved to the other address in the pool
+	next := acquire(t, h, "00:11:22:33:44:55")
+	if next.YourIPAddr.Equal(ack.YourIPAddr) {
+		t.Errorf("declined address %s was offered again", ack.YourIPAddr)
+	}
+}
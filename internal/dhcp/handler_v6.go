@@ -0,0 +1,715 @@
+package dhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/sashakarcz/irondhcp/internal/events"
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// Handler6 handles DHCPv6 requests
+type Handler6 struct {
+	server *Server
+	iface  string
+}
+
+// clientInfoV6 holds client identity extracted from a DHCPv6 message
+type clientInfoV6 struct {
+	duid     string
+	mac      net.HardwareAddr
+	hostname string
+}
+
+// Handle processes incoming DHCPv6 messages (direct or relayed)
+func (h *Handler6) Handle(conn net.PacketConn, peer net.Addr, m dhcpv6.DHCPv6) {
+	ctx := context.Background()
+
+	msg, err := m.GetInnerMessage()
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("peer", peer.String()).
+			Msg("Failed to decapsulate DHCPv6 message")
+		return
+	}
+
+	logger.Debug().
+		Str("type", msg.MessageType.String()).
+		Str("xid", msg.TransactionID.String()).
+		Bool("relayed", m.IsRelay()).
+		Str("peer", peer.String()).
+		Str("interface", h.iface).
+		Msg("Received DHCPv6 request")
+
+	// Messages addressed to another server must be ignored (RFC 8415 section 16)
+	if sid := msg.Options.ServerID(); sid != nil && !sid.Equal(h.server.serverDUID) {
+		logger.Debug().
+			Str("type", msg.MessageType.String()).
+			Str("server_id", sid.String()).
+			Msg("Ignoring DHCPv6 message for another server")
+		return
+	}
+
+	var resp *dhcpv6.Message
+
+	switch msg.MessageType {
+	case dhcpv6.MessageTypeSolicit:
+		resp, err = h.handleSolicit(ctx, m, msg)
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeRenew, dhcpv6.MessageTypeRebind:
+		resp, err = h.handleRequest(ctx, m, msg)
+	case dhcpv6.MessageTypeRelease:
+		resp, err = h.handleRelease(ctx, m, msg)
+	case dhcpv6.MessageTypeDecline:
+		resp, err = h.handleDecline(ctx, m, msg)
+	case dhcpv6.MessageTypeInformationRequest:
+		resp, err = h.handleInformationRequest(ctx, m, msg)
+	default:
+		logger.Warn().
+			Str("type", msg.MessageType.String()).
+			Msg("Unsupported DHCPv6 message type")
+		return
+	}
+
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("type", msg.MessageType.String()).
+			Msg("Failed to handle DHCPv6 request")
+		return
+	}
+
+	if resp == nil {
+		return
+	}
+
+	// Relayed requests must be answered with a RELAY-REPL wrapping the reply
+	var out dhcpv6.DHCPv6 = resp
+	if relay, ok := m.(*dhcpv6.RelayMessage); ok {
+		out, err = dhcpv6.NewRelayReplFromRelayForw(relay, resp)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to build DHCPv6 relay reply")
+			return
+		}
+	}
+
+	if _, err := conn.WriteTo(out.ToBytes(), peer); err != nil {
+		logger.Error().
+			Err(err).
+			Str("type", resp.MessageType.String()).
+			Msg("Failed to send DHCPv6 response")
+	} else {
+		logger.Info().
+			Str("type", resp.MessageType.String()).
+			Str("peer", peer.String()).
+			Msg("Sent DHCPv6 response")
+	}
+}
+
+// handleSolicit handles SOLICIT messages (ADVERTISE, or REPLY with rapid commit)
+func (h *Handler6) handleSolicit(ctx context.Context, m dhcpv6.DHCPv6, msg *dhcpv6.Message) (*dhcpv6.Message, error) {
+	subnet, err := h.server.findSubnetForRequestV6(h.iface, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	client, err := clientInfoFromMessage(m, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *dhcpv6.Message
+	if msg.GetOneOption(dhcpv6.OptionRapidCommit) != nil {
+		resp, err = dhcpv6.NewReplyFromMessage(msg, dhcpv6.WithServerID(h.server.serverDUID))
+	} else {
+		resp, err = dhcpv6.NewAdvertiseFromSolicit(msg, dhcpv6.WithServerID(h.server.serverDUID))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reply: %w", err)
+	}
+
+	h.broadcast(events.EventTypeDHCPDiscover, nil, client, subnet)
+
+	for _, ia := range msg.Options.IANA() {
+		resp.AddOption(h.allocateIANA(ctx, ia, client, subnet))
+	}
+	for _, pd := range msg.Options.IAPD() {
+		resp.AddOption(h.allocateIAPD(ctx, pd, client, subnet))
+	}
+
+	h.addDHCPv6Options(resp, subnet)
+
+	eventType := events.EventTypeDHCPOffer
+	if resp.MessageType == dhcpv6.MessageTypeReply {
+		eventType = events.EventTypeDHCPAck
+	}
+	h.broadcast(eventType, firstAddress(resp), client, subnet)
+
+	return resp, nil
+}
+
+// handleRequest handles REQUEST, RENEW and REBIND messages
+func (h *Handler6) handleRequest(ctx context.Context, m dhcpv6.DHCPv6, msg *dhcpv6.Message) (*dhcpv6.Message, error) {
+	// REQUEST and RENEW are addressed to a specific server
+	if msg.MessageType != dhcpv6.MessageTypeRebind && msg.Options.ServerID() == nil {
+		logger.Debug().
+			Str("type", msg.MessageType.String()).
+			Msg("Ignoring DHCPv6 message without server identifier")
+		return nil, nil
+	}
+
+	subnet, err := h.server.findSubnetForRequestV6(h.iface, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	client, err := clientInfoFromMessage(m, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := dhcpv6.NewReplyFromMessage(msg, dhcpv6.WithServerID(h.server.serverDUID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reply: %w", err)
+	}
+
+	h.broadcast(events.EventTypeDHCPRequest, nil, client, subnet)
+
+	for _, ia := range msg.Options.IANA() {
+		if msg.MessageType == dhcpv6.MessageTypeRequest {
+			resp.AddOption(h.allocateIANA(ctx, ia, client, subnet))
+		} else {
+			resp.AddOption(h.renewIANA(ctx, ia, client, subnet))
+		}
+	}
+	for _, pd := range msg.Options.IAPD() {
+		if msg.MessageType == dhcpv6.MessageTypeRequest {
+			resp.AddOption(h.allocateIAPD(ctx, pd, client, subnet))
+		} else {
+			resp.AddOption(h.renewIAPD(ctx, pd, client, subnet))
+		}
+	}
+
+	h.addDHCPv6Options(resp, subnet)
+
+	h.broadcast(events.EventTypeDHCPAck, firstAddress(resp), client, subnet)
+
+	return resp, nil
+}
+
+// handleRelease handles RELEASE messages
+func (h *Handler6) handleRelease(ctx context.Context, m dhcpv6.DHCPv6, msg *dhcpv6.Message) (*dhcpv6.Message, error) {
+	subnet, err := h.server.findSubnetForRequestV6(h.iface, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	client, err := clientInfoFromMessage(m, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC 8415 section 18.3.7: IAs that could not all be released are listed with their status
+	resp, err := h.statusReply(msg, iana.StatusSuccess, "Release received")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ia := range msg.Options.IANA() {
+		status := iana.StatusSuccess
+		for _, addr := range ia.Options.Addresses() {
+			err := h.server.allocator.ReleaseLeaseV6(ctx, client.duid, addr.IPv6Addr, subnet.Network)
+			if err != nil {
+				status = bindingStatus(status, err, client, addr.IPv6Addr, "Failed to release DHCPv6 lease")
+				continue
+			}
+
+			logger.Info().
+				Str("duid", client.duid).
+				Str("ip", addr.IPv6Addr.String()).
+				Msg("Released DHCPv6 lease")
+
+			h.broadcast(events.EventTypeDHCPRelease, addr.IPv6Addr, client, subnet)
+		}
+		if status != iana.StatusSuccess {
+			resp.AddOption(iaStatus(ia.IaId, status, bindingStatusMessage(status)))
+		}
+	}
+	for _, pd := range msg.Options.IAPD() {
+		status := iana.StatusSuccess
+		for _, p := range pd.Options.Prefixes() {
+			if p.Prefix == nil {
+				continue
+			}
+			err := h.server.allocator.ReleasePrefix(ctx, client.duid, p.Prefix)
+			if err != nil {
+				status = bindingStatus(status, err, client, p.Prefix.IP, "Failed to release delegated prefix")
+				continue
+			}
+
+			logger.Info().
+				Str("duid", client.duid).
+				Str("prefix", p.Prefix.String()).
+				Msg("Released delegated prefix")
+
+			h.broadcast(events.EventTypeDHCPRelease, p.Prefix.IP, client, subnet)
+		}
+		if status != iana.StatusSuccess {
+			resp.AddOption(iaPrefixStatus(pd.IaId, status, bindingStatusMessage(status)))
+		}
+	}
+
+	return resp, nil
+}
+
+// handleDecline handles DECLINE messages (duplicate address detected by client)
+func (h *Handler6) handleDecline(ctx context.Context, m dhcpv6.DHCPv6, msg *dhcpv6.Message) (*dhcpv6.Message, error) {
+	subnet, err := h.server.findSubnetForRequestV6(h.iface, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	client, err := clientInfoFromMessage(m, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC 8415 section 18.3.8: IAs that could not all be declined are listed with their status
+	resp, err := h.statusReply(msg, iana.StatusSuccess, "Decline received")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ia := range msg.Options.IANA() {
+		status := iana.StatusSuccess
+		for _, addr := range ia.Options.Addresses() {
+			err := h.server.allocator.DeclineLeaseV6(ctx, client.duid, addr.IPv6Addr, subnet.Network)
+			if err != nil {
+				status = bindingStatus(status, err, client, addr.IPv6Addr, "Failed to decline DHCPv6 lease")
+				continue
+			}
+
+			logger.Warn().
+				Str("duid", client.duid).
+				Str("ip", addr.IPv6Addr.String()).
+				Msg("Client declined IPv6 address (duplicate address detected)")
+
+			h.broadcast(events.EventTypeDHCPDecline, addr.IPv6Addr, client, subnet)
+		}
+		if status != iana.StatusSuccess {
+			resp.AddOption(iaStatus(ia.IaId, status, bindingStatusMessage(status)))
+		}
+	}
+
+	return resp, nil
+}
+
+// handleInformationRequest handles INFORMATION-REQUEST messages (stateless configuration)
+func (h *Handler6) handleInformationRequest(ctx context.Context, m dhcpv6.DHCPv6, msg *dhcpv6.Message) (*dhcpv6.Message, error) {
+	subnet, err := h.server.findSubnetForRequestV6(h.iface, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnet: %w", err)
+	}
+
+	resp, err := dhcpv6.NewReplyFromMessage(msg, dhcpv6.WithServerID(h.server.serverDUID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reply: %w", err)
+	}
+
+	h.addDHCPv6Options(resp, subnet)
+
+	logger.Info().
+		Str("subnet", subnet.Network.String()).
+		Msg("Responded to INFORMATION-REQUEST")
+
+	return resp, nil
+}
+
+// allocateIANA allocates an address for an IA_NA and returns the IA_NA to put in the reply
+func (h *Handler6) allocateIANA(ctx context.Context, req *dhcpv6.OptIANA, client *clientInfoV6, subnet *SubnetConfig) *dhcpv6.OptIANA {
+	iaid := binary.BigEndian.Uint32(req.IaId[:])
+
+	lease, err := h.server.allocator.AllocateIPv6(ctx, &AllocationRequestV6{
+		DUID:          client.duid,
+		IAID:          iaid,
+		MAC:           client.mac,
+		Hostname:      client.hostname,
+		Subnet:        subnet.Network,
+		Pools:         subnet.Pools,
+		LeaseDuration: subnet.LeaseDuration,
+	})
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("duid", client.duid).
+			Uint32("iaid", iaid).
+			Str("subnet", subnet.Network.String()).
+			Msg("Failed to allocate IPv6 address")
+		return iaStatus(req.IaId, iana.StatusNoAddrsAvail, "No addresses available")
+	}
+
+	logger.Info().
+		Str("duid", client.duid).
+		Uint32("iaid", iaid).
+		Str("ip", lease.IP.String()).
+		Str("subnet", subnet.Network.String()).
+		Msg("Allocated IPv6 address")
+
+	return iaAddress(req.IaId, lease.IP, leaseTimesFor(subnet.LeaseDuration, subnet, nil))
+}
+
+// renewIANA extends the addresses of an IA_NA bound to this client
+func (h *Handler6) renewIANA(ctx context.Context, req *dhcpv6.OptIANA, client *clientInfoV6, subnet *SubnetConfig) *dhcpv6.OptIANA {
+	iaid := binary.BigEndian.Uint32(req.IaId[:])
+
+	for _, addr := range req.Options.Addresses() {
+		lease, err := h.server.allocator.RenewLeaseV6(ctx, client.duid, iaid, addr.IPv6Addr, subnet.Network, subnet.LeaseDuration)
+		if err != nil {
+			logger.Debug().
+				Err(err).
+				Str("duid", client.duid).
+				Str("ip", addr.IPv6Addr.String()).
+				Msg("Failed to renew IPv6 address")
+			continue
+		}
+
+		logger.Info().
+			Str("duid", client.duid).
+			Str("ip", lease.IP.String()).
+			Msg("Renewed DHCPv6 lease")
+
+		return iaAddress(req.IaId, lease.IP, leaseTimesFor(subnet.LeaseDuration, subnet, nil))
+	}
+
+	return iaStatus(req.IaId, iana.StatusNoBinding, "No binding for this IA")
+}
+
+// allocateIAPD delegates a prefix for an IA_PD and returns the IA_PD to put in the reply
+func (h *Handler6) allocateIAPD(ctx context.Context, req *dhcpv6.OptIAPD, client *clientInfoV6, subnet *SubnetConfig) *dhcpv6.OptIAPD {
+	iaid := binary.BigEndian.Uint32(req.IaId[:])
+
+	if len(subnet.PrefixPools) == 0 {
+		return iaPrefixStatus(req.IaId, iana.StatusNoPrefixAvail, "Prefix delegation not configured")
+	}
+
+	delegation, err := h.server.allocator.AllocatePrefix(ctx, &PrefixAllocationRequest{
+		DUID:          client.duid,
+		IAID:          iaid,
+		Hostname:      client.hostname,
+		Subnet:        subnet.Network,
+		Pools:         subnet.PrefixPools,
+		LeaseDuration: subnet.LeaseDuration,
+	})
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("duid", client.duid).
+			Uint32("iaid", iaid).
+			Str("subnet", subnet.Network.String()).
+			Msg("Failed to delegate prefix")
+		return iaPrefixStatus(req.IaId, iana.StatusNoPrefixAvail, "No prefixes available")
+	}
+
+	logger.Info().
+		Str("duid", client.duid).
+		Uint32("iaid", iaid).
+		Str("prefix", delegation.Prefix.String()).
+		Str("subnet", subnet.Network.String()).
+		Msg("Delegated prefix")
+
+	return iaPrefix(req.IaId, delegation.Prefix, leaseTimesFor(subnet.LeaseDuration, subnet, nil))
+}
+
+// renewIAPD extends the prefixes of an IA_PD delegated to this client
+func (h *Handler6) renewIAPD(ctx context.Context, req *dhcpv6.OptIAPD, client *clientInfoV6, subnet *SubnetConfig) *dhcpv6.OptIAPD {
+	iaid := binary.BigEndian.Uint32(req.IaId[:])
+
+	for _, p := range req.Options.Prefixes() {
+		if p.Prefix == nil {
+			continue
+		}
+		delegation, err := h.server.allocator.RenewPrefix(ctx, client.duid, iaid, p.Prefix, subnet.PrefixPools, subnet.LeaseDuration)
+		if err != nil {
+			logger.Debug().
+				Err(err).
+				Str("duid", client.duid).
+				Str("prefix", p.Prefix.String()).
+				Msg("Failed to renew delegated prefix")
+			continue
+		}
+
+		logger.Info().
+			Str("duid", client.duid).
+			Str("prefix", delegation.Prefix.String()).
+			Msg("Renewed delegated prefix")
+
+		return iaPrefix(req.IaId, delegation.Prefix, leaseTimesFor(subnet.LeaseDuration, subnet, nil))
+	}
+
+	return iaPrefixStatus(req.IaId, iana.StatusNoBinding, "No binding for this IA")
+}
+
+// statusReply builds a REPLY carrying only a top-level status code
+func (h *Handler6) statusReply(msg *dhcpv6.Message, code iana.StatusCode, message string) (*dhcpv6.Message, error) {
+	var resp *dhcpv6.Message
+	var err error
+	if msg.MessageType == dhcpv6.MessageTypeDecline {
+		// NewReplyFromMessage does not accept DECLINE
+		resp, err = dhcpv6.NewMessage(dhcpv6.WithClientID(msg.Options.ClientID()), dhcpv6.WithServerID(h.server.serverDUID))
+		if err == nil {
+			resp.MessageType = dhcpv6.MessageTypeReply
+			resp.TransactionID = msg.TransactionID
+		}
+	} else {
+		resp, err = dhcpv6.NewReplyFromMessage(msg, dhcpv6.WithServerID(h.server.serverDUID))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reply: %w", err)
+	}
+
+	resp.AddOption(&dhcpv6.OptStatusCode{
+		StatusCode:    code,
+		StatusMessage: message,
+	})
+
+	return resp, nil
+}
+
+// addDHCPv6Options adds subnet-level configuration options to a reply
+func (h *Handler6) addDHCPv6Options(resp *dhcpv6.Message, subnet *SubnetConfig) {
+	// DNS recursive name servers (option 23), IPv6 addresses only
+	var dnsServers []net.IP
+	for _, ip := range subnet.DNSServers {
+		if ip != nil && ip.To4() == nil {
+			dnsServers = append(dnsServers, ip)
+		}
+	}
+	if len(dnsServers) > 0 {
+		resp.UpdateOption(dhcpv6.OptDNS(dnsServers...))
+	}
+
+	// Domain search list (option 24)
+	if domainName, ok := subnet.Options["domain_name"]; ok {
+		dhcpv6.WithDomainSearchList(domainName)(resp)
+	}
+}
+
+// broadcast emits an activity event for a DHCPv6 exchange
+func (h *Handler6) broadcast(eventType events.EventType, ip net.IP, client *clientInfoV6, subnet *SubnetConfig) {
+	if h.server.broadcaster == nil {
+		return
+	}
+
+	h.server.broadcaster.BroadcastDHCPEvent(
+		eventType,
+		ip,
+		client.mac,
+		client.hostname,
+		map[string]interface{}{
+			"subnet":   subnet.Network.String(),
+			"duid":     client.duid,
+			"protocol": "dhcpv6",
+		},
+	)
+}
+
+// clientInfoFromMessage extracts the client DUID, MAC and hostname from a message
+func clientInfoFromMessage(m dhcpv6.DHCPv6, msg *dhcpv6.Message) (*clientInfoV6, error) {
+	cid := msg.Options.ClientID()
+	if cid == nil {
+		return nil, fmt.Errorf("no client identifier in %s", msg.MessageType)
+	}
+
+	client := &clientInfoV6{
+		duid: hex.EncodeToString(cid.ToBytes()),
+	}
+
+	// MAC is only available for DUID-LL/LLT clients or via relay options
+	if mac, err := dhcpv6.ExtractMAC(m); err == nil {
+		client.mac = mac
+	}
+
+	if fqdn := msg.Options.FQDN(); fqdn != nil && fqdn.DomainName != nil && len(fqdn.DomainName.Labels) > 0 {
+		client.hostname = fqdn.DomainName.Labels[0]
+	}
+
+	return client, nil
+}
+
+// iaAddress builds an IA_NA containing a single address
+func iaAddress(iaid [4]byte, ip net.IP, times leaseTimes) *dhcpv6.OptIANA {
+	return &dhcpv6.OptIANA{
+		IaId: iaid,
+		T1:   times.Renewal,
+		T2:   times.Rebinding,
+		Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptIAAddress{
+				IPv6Addr:          ip,
+				PreferredLifetime: times.Lease,
+				ValidLifetime:     times.Lease,
+			},
+		}},
+	}
+}
+
+// iaStatus builds an IA_NA carrying a status code instead of an address
+func iaStatus(iaid [4]byte, code iana.StatusCode, message string) *dhcpv6.OptIANA {
+	return &dhcpv6.OptIANA{
+		IaId: iaid,
+		Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptStatusCode{
+				StatusCode:    code,
+				StatusMessage: message,
+			},
+		}},
+	}
+}
+
+// bindingStatus folds a failed release or decline into the status of its IA
+// A store error outranks a missing binding, since the client may retry it.
+func bindingStatus(status iana.StatusCode, err error, client *clientInfoV6, ip net.IP, msg string) iana.StatusCode {
+	if errors.Is(err, storage.ErrNoBinding) {
+		if status == iana.StatusSuccess {
+			return iana.StatusNoBinding
+		}
+		return status
+	}
+
+	logger.Error().
+		Err(err).
+		Str("duid", client.duid).
+		Str("ip", ip.String()).
+		Msg(msg)
+	return iana.StatusUnspecFail
+}
+
+// bindingStatusMessage describes an IA status set by bindingStatus
+func bindingStatusMessage(status iana.StatusCode) string {
+	if status == iana.StatusNoBinding {
+		return "No binding for this IA"
+	}
+	return "Failed to update binding"
+}
+
+// iaPrefix builds an IA_PD containing a single delegated prefix
+func iaPrefix(iaid [4]byte, prefix *net.IPNet, times leaseTimes) *dhcpv6.OptIAPD {
+	return &dhcpv6.OptIAPD{
+		IaId: iaid,
+		T1:   times.Renewal,
+		T2:   times.Rebinding,
+		Options: dhcpv6.PDOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptIAPrefix{
+				PreferredLifetime: times.Lease,
+				ValidLifetime:     times.Lease,
+				Prefix:            prefix,
+			},
+		}},
+	}
+}
+
+// iaPrefixStatus builds an IA_PD carrying a status code instead of a prefix
+func iaPrefixStatus(iaid [4]byte, code iana.StatusCode, message string) *dhcpv6.OptIAPD {
+	return &dhcpv6.OptIAPD{
+		IaId: iaid,
+		Options: dhcpv6.PDOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptStatusCode{
+				StatusCode:    code,
+				StatusMessage: message,
+			},
+		}},
+	}
+}
+
+// firstAddress returns the first address assigned in a reply, if any
+func firstAddress(resp *dhcpv6.Message) net.IP {
+	for _, ia := range resp.Options.IANA() {
+		if addr := ia.Options.OneAddress(); addr != nil {
+			return addr.IPv6Addr
+		}
+	}
+	return nil
+}
+
+// newServerDUID builds a DUID-LL server identifier from the interface MAC address
+// Falls back to the first interface with a hardware address if the named one has none
+func newServerDUID(ifaceName string) (dhcpv6.DUID, error) {
+	if iface, err := net.InterfaceByName(ifaceName); err == nil && len(iface.HardwareAddr) > 0 {
+		return &dhcpv6.DUIDLL{
+			HWType:        iana.HWTypeEthernet,
+			LinkLayerAddr: iface.HardwareAddr,
+		}, nil
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		if len(iface.HardwareAddr) > 0 {
+			return &dhcpv6.DUIDLL{
+				HWType:        iana.HWTypeEthernet,
+				LinkLayerAddr: iface.HardwareAddr,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no interface with a hardware address found")
+}
+
+// findSubnetForRequestV6 determines which IPv6 subnet a DHCPv6 message belongs to
+func (s *Server) findSubnetForRequestV6(ifaceName string, m dhcpv6.DHCPv6) (*SubnetConfig, error) {
+	// Relayed: the link-address of the relay closest to the client identifies the link
+	if m.IsRelay() {
+		inner, err := dhcpv6.DecapsulateRelayIndex(m, -1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decapsulate relay: %w", err)
+		}
+		if relay, ok := inner.(*dhcpv6.RelayMessage); ok && !relay.LinkAddr.IsUnspecified() {
+			for _, subnet := range s.subnets6 {
+				if subnet.Network.Contains(relay.LinkAddr) {
+					return subnet, nil
+				}
+			}
+		}
+	}
+
+	// Direct: match the global addresses of the receiving interface
+	if ifaceName != "" {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get interface %s: %w", ifaceName, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get addresses for interface %s: %w", ifaceName, err)
+		}
+
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() != nil || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			for _, subnet := range s.subnets6 {
+				if subnet.Network.Contains(ipnet.IP) {
+					return subnet, nil
+				}
+			}
+		}
+	}
+
+	// If only one IPv6 subnet is configured, use it as a default
+	if len(s.subnets6) == 1 {
+		for _, subnet := range s.subnets6 {
+			return subnet, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot determine IPv6 subnet for request")
+}
@@ -0,0 +1,241 @@
+package dhcp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// testClientDUID identifies the DHCPv6 test client
+var testClientDUID = &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+// newTestHandler6 returns a DHCPv6 handler for one 2001:db8::/64 subnet
+// T1 and T2 are a quarter and half of the hour-long lease, unlike either default.
+func newTestHandler6(t *testing.T, store storage.Backend) *Handler6 {
+	t.Helper()
+
+	server, err := New(&config.Config{
+		Subnets: []config.SubnetConfig{{
+			Network:        "2001:db8::/64",
+			LeaseDuration:  time.Hour,
+			RenewalRatio:   0.25,
+			RebindingRatio: 0.5,
+			Pools:          []config.PoolConfig{{RangeStart: "2001:db8::100", RangeEnd: "2001:db8::1ff"}},
+		}},
+	}, store, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	server.serverDUID = &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0, 0, 0, 0, 0, 1}}
+
+	return &Handler6{server: server}
+}
+
+// newTestMessage6 builds a client message with one IA_NA per address; an empty address asks for any
+func newTestMessage6(t *testing.T, h *Handler6, msgType dhcpv6.MessageType, addrs ...string) *dhcpv6.Message {
+	t.Helper()
+
+	msg, err := dhcpv6.NewMessage(dhcpv6.WithClientID(testClientDUID))
+	if err != nil {
+		t.Fatalf("NewMessage: %v", err)
+	}
+	msg.MessageType = msgType
+	if msgType != dhcpv6.MessageTypeSolicit && msgType != dhcpv6.MessageTypeRebind {
+		msg.AddOption(dhcpv6.OptServerID(h.server.serverDUID))
+	}
+
+	for i, addr := range addrs {
+		ia := &dhcpv6.OptIANA{IaId: [4]byte{0, 0, 0, byte(i + 1)}}
+		if addr != "" {
+			ia.Options.Add(&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP(addr)})
+		}
+		msg.AddOption(ia)
+	}
+	return msg
+}
+
+// iaStatuses returns the status code of each IA_NA in a reply that carries one, by the IAID's last byte
+func iaStatuses(resp *dhcpv6.Message) map[byte]iana.StatusCode {
+	statuses := make(map[byte]iana.StatusCode)
+	for _, ia := range resp.Options.IANA() {
+		if status := ia.Options.Status(); status != nil {
+			statuses[ia.IaId[3]] = status.StatusCode
+		}
+	}
+	return statuses
+}
+
+func TestHandler6Exchange(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	h := newTestHandler6(t, store)
+
+	// SOLICIT is answered with an ADVERTISE
+	solicit := newTestMessage6(t, h, dhcpv6.MessageTypeSolicit, "")
+	advertise, err := h.handleSolicit(ctx, solicit, solicit)
+	if err != nil {
+		t.Fatalf("handleSolicit: %v", err)
+	}
+	if advertise.MessageType != dhcpv6.MessageTypeAdvertise || advertise.TransactionID != solicit.TransactionID {
+		t.Fatalf("got %s for transaction %s, want an ADVERTISE for %s", advertise.MessageType, advertise.TransactionID, solicit.TransactionID)
+	}
+	ia := advertise.Options.OneIANA()
+	if ia == nil || ia.Options.OneAddress() == nil {
+		t.Fatalf("ADVERTISE has no address: %v", advertise)
+	}
+	offered := ia.Options.OneAddress().IPv6Addr
+	if ia.T1 != 15*time.Minute || ia.T2 != 30*time.Minute {
+		t.Errorf("T1/T2 = %s/%s, want the subnet's 15m0s/30m0s", ia.T1, ia.T2)
+	}
+	if lifetime := ia.Options.OneAddress().ValidLifetime; lifetime != time.Hour {
+		t.Errorf("valid lifetime %s, want 1h0m0s", lifetime)
+	}
+
+	// REQUEST binds the advertised address
+	request := newTestMessage6(t, h, dhcpv6.MessageTypeRequest, offered.String())
+	reply, err := h.handleRequest(ctx, request, request)
+	if err != nil {
+		t.Fatalf("handleRequest: %v", err)
+	}
+	if reply.MessageType != dhcpv6.MessageTypeReply {
+		t.Fatalf("got %s, want a REPLY", reply.MessageType)
+	}
+	if addr := reply.Options.OneIANA().Options.OneAddress(); addr == nil || !addr.IPv6Addr.Equal(offered) {
+		t.Fatalf("REPLY assigned %v, want %s", addr, offered)
+	}
+	lease, err := store.GetLeaseV6ByIP(ctx, offered, h.server.subnets6["2001:db8::/64"].Network)
+	if err != nil || lease == nil || lease.State != storage.LeaseStateActive || lease.DUID != hex.EncodeToString(testClientDUID.ToBytes()) {
+		t.Fatalf("stored lease %+v (%v)", lease, err)
+	}
+
+	// RENEW extends the bound IA and reports NoBinding for one the client does not hold
+	renew := newTestMessage6(t, h, dhcpv6.MessageTypeRenew, offered.String(), "2001:db8::1ff")
+	reply, err = h.handleRequest(ctx, renew, renew)
+	if err != nil {
+		t.Fatalf("handleRequest(RENEW): %v", err)
+	}
+	ias := reply.Options.IANA()
+	if len(ias) != 2 {
+		t.Fatalf("RENEW reply has %d IA_NAs, want 2", len(ias))
+	}
+	if addr := ias[0].Options.OneAddress(); addr == nil || !addr.IPv6Addr.Equal(offered) || ias[0].T1 != 15*time.Minute {
+		t.Errorf("renewed IA %v", ias[0])
+	}
+	if got := iaStatuses(reply); len(got) != 1 || got[2] != iana.StatusNoBinding {
+		t.Errorf("IA statuses %v, want NoBinding for IA 2", got)
+	}
+
+	// A REQUEST for another server is ignored
+	other := newTestMessage6(t, h, dhcpv6.MessageTypeRenew, offered.String())
+	other.Options.Del(dhcpv6.OptionServerID)
+	if reply, err := h.handleRequest(ctx, other, other); err != nil || reply != nil {
+		t.Errorf("RENEW without a server identifier got %v (%v)", reply, err)
+	}
+}
+
+func TestHandler6RapidCommit(t *testing.T) {
+	h := newTestHandler6(t, storage.NewMemoryStore())
+
+	solicit := newTestMessage6(t, h, dhcpv6.MessageTypeSolicit, "")
+	solicit.AddOption(&dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionRapidCommit})
+	reply, err := h.handleSolicit(context.Background(), solicit, solicit)
+	if err != nil {
+		t.Fatalf("handleSolicit: %v", err)
+	}
+	if reply.MessageType != dhcpv6.MessageTypeReply || reply.Options.OneIANA().Options.OneAddress() == nil {
+		t.Errorf("rapid commit SOLICIT got %v, want a REPLY with an address", reply)
+	}
+}
+
+// failingV6Store fails to release or decline the address in failIP
+type failingV6Store struct {
+	storage.Backend
+	failIP net.IP
+}
+
+func (s *failingV6Store) ReleaseLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error {
+	if ip.Equal(s.failIP) {
+		return errors.New("connection refused")
+	}
+	return s.Backend.ReleaseLeaseV6(ctx, duid, ip, subnet)
+}
+
+func (s *failingV6Store) DeclineLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error {
+	if ip.Equal(s.failIP) {
+		return errors.New("connection refused")
+	}
+	return s.Backend.DeclineLeaseV6(ctx, duid, ip, subnet)
+}
+
+func TestHandler6ReleaseAndDeclineReportEachIA(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType dhcpv6.MessageType
+		state   storage.LeaseState
+	}{
+		{"release", dhcpv6.MessageTypeRelease, storage.LeaseStateReleased},
+		{"decline", dhcpv6.MessageTypeDecline, storage.LeaseStateDeclined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			memory := storage.NewMemoryStore()
+			h := newTestHandler6(t, &failingV6Store{Backend: memory, failIP: net.ParseIP("2001:db8::102")})
+			subnet := h.server.subnets6["2001:db8::/64"].Network
+
+			for i, ip := range []string{"2001:db8::100", "2001:db8::102"} {
+				if err := memory.CreateLeaseV6(ctx, &storage.LeaseV6{
+					IP:        net.ParseIP(ip),
+					DUID:      hex.EncodeToString(testClientDUID.ToBytes()),
+					IAID:      uint32(i),
+					Subnet:    subnet,
+					IssuedAt:  time.Now(),
+					ExpiresAt: time.Now().Add(time.Hour),
+					State:     storage.LeaseStateActive,
+				}); err != nil {
+					t.Fatalf("CreateLeaseV6: %v", err)
+				}
+			}
+
+			// IA 1 holds its address, IA 2 has no binding and IA 3 hits a store error
+			msg := newTestMessage6(t, h, tt.msgType, "2001:db8::100", "2001:db8::101", "2001:db8::102")
+
+			var resp *dhcpv6.Message
+			var err error
+			if tt.msgType == dhcpv6.MessageTypeRelease {
+				resp, err = h.handleRelease(ctx, msg, msg)
+			} else {
+				resp, err = h.handleDecline(ctx, msg, msg)
+			}
+			if err != nil {
+				t.Fatalf("handle %s: %v", tt.name, err)
+			}
+
+			if resp.MessageType != dhcpv6.MessageTypeReply || resp.TransactionID != msg.TransactionID {
+				t.Errorf("got %s for transaction %s, want a REPLY for %s", resp.MessageType, resp.TransactionID, msg.TransactionID)
+			}
+			if status := resp.Options.Status(); status == nil || status.StatusCode != iana.StatusSuccess {
+				t.Errorf("top-level status %v, want Success", status)
+			}
+			got := iaStatuses(resp)
+			want := map[byte]iana.StatusCode{2: iana.StatusNoBinding, 3: iana.StatusUnspecFail}
+			if len(got) != len(want) || got[2] != want[2] || got[3] != want[3] {
+				t.Errorf("IA statuses %v, want %v", got, want)
+			}
+
+			lease, err := memory.GetLeaseV6ByIP(ctx, net.ParseIP("2001:db8::100"), subnet)
+			if err != nil || lease == nil || lease.State != tt.state {
+				t.Errorf("lease for IA 1 = %+v (%v), want state %s", lease, err, tt.state)
+			}
+		})
+	}
+}
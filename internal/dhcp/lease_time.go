@@ -0,0 +1,71 @@
+package dhcp
+
+import (
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// Default T1/T2 ratios (RFC 2131 section 4.4.5), used when none are configured
+const (
+	defaultRenewalRatio   = 0.5
+	defaultRebindingRatio = 0.875
+)
+
+// leaseTimes holds the lease time and renewal timers granted to a client
+type leaseTimes struct {
+	Lease     time.Duration // Option 51
+	Renewal   time.Duration // T1, option 58
+	Rebinding time.Duration // T2, option 59
+}
+
+// grantedLeaseDuration returns the lease time for a client
+// A lease time requested by the client (option 51) is honoured within the subnet's
+// min/max bounds; otherwise the class or subnet default applies
+func grantedLeaseDuration(subnet *SubnetConfig, classes []*ClientClass, requested time.Duration) time.Duration {
+	if requested <= 0 {
+		return leaseDurationForClasses(subnet, classes)
+	}
+
+	if subnet.MinLeaseDuration > 0 && requested < subnet.MinLeaseDuration {
+		return subnet.MinLeaseDuration
+	}
+	if subnet.MaxLeaseDuration > 0 && requested > subnet.MaxLeaseDuration {
+		return subnet.MaxLeaseDuration
+	}
+	return requested
+}
+
+// leaseTimesForRequest returns the lease time and T1/T2 timers to grant for a request
+func leaseTimesForRequest(req *dhcpv4.DHCPv4, subnet *SubnetConfig, classes []*ClientClass) leaseTimes {
+	return leaseTimesFor(grantedLeaseDuration(subnet, classes, req.IPAddressLeaseTime(0)), subnet, classes)
+}
+
+// leaseTimesFor returns the T1/T2 timers for a lease time granted on a subnet
+// The ratios of the first class that overrides them win over the subnet's. DHCPv6
+// uses the same ratios for the T1/T2 of IA_NA and IA_PD options.
+func leaseTimesFor(lease time.Duration, subnet *SubnetConfig, classes []*ClientClass) leaseTimes {
+	renewal, rebinding := subnet.RenewalRatio, subnet.RebindingRatio
+	for _, class := range classes {
+		if class.RenewalRatio > 0 {
+			renewal, rebinding = class.RenewalRatio, class.RebindingRatio
+			break
+		}
+	}
+	if renewal <= 0 || rebinding <= 0 {
+		renewal, rebinding = defaultRenewalRatio, defaultRebindingRatio
+	}
+
+	return leaseTimes{
+		Lease:     lease,
+		Renewal:   time.Duration(float64(lease) * renewal).Truncate(time.Second),
+		Rebinding: time.Duration(float64(lease) * rebinding).Truncate(time.Second),
+	}
+}
+
+// addLeaseTimeOptions sets options 51, 58 and 59 on a reply
+func addLeaseTimeOptions(resp *dhcpv4.DHCPv4, times leaseTimes) {
+	resp.UpdateOption(dhcpv4.OptIPAddressLeaseTime(times.Lease))
+	resp.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionRenewTimeValue, Value: dhcpv4.Duration(times.Renewal)})
+	resp.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionRebindingTimeValue, Value: dhcpv4.Duration(times.Rebinding)})
+}
@@ -0,0 +1,199 @@
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/events"
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// errARPUnsupported is returned by arpProbe on platforms without raw link-layer sockets
+var errARPUnsupported = errors.New("ARP probing is not supported on this platform")
+
+// ConflictDetector checks whether an address is already in use before it is offered
+type ConflictDetector interface {
+	// Probe returns true if a host answered on ip; the MAC is set when it is known (ARP)
+	Probe(ctx context.Context, ip net.IP, iface string) (bool, net.HardwareAddr, error)
+}
+
+// pingChecker probes addresses with ICMP echo or ARP
+type pingChecker struct {
+	method  string
+	timeout time.Duration
+}
+
+// newPingChecker creates a conflict detector from the ping check config
+func newPingChecker(cfg config.PingCheckConfig) *pingChecker {
+	return &pingChecker{
+		method:  cfg.Method,
+		timeout: cfg.Timeout,
+	}
+}
+
+// Probe sends an ARP request when the address is on-link of the bound interface,
+// otherwise (relayed subnets, unbound listeners) an ICMP echo request
+func (p *pingChecker) Probe(ctx context.Context, ip net.IP, iface string) (bool, net.HardwareAddr, error) {
+	if p.method == "arp" && iface != "" && onLink(iface, ip) {
+		inUse, mac, err := arpProbe(ctx, ip, iface, p.timeout)
+		if !errors.Is(err, errARPUnsupported) {
+			return inUse, mac, err
+		}
+	}
+
+	inUse, err := icmpProbe(ctx, ip, p.timeout)
+	return inUse, nil, err
+}
+
+// EnableConflictDetection makes the allocator probe fresh addresses before offering them
+// Addresses that answer are quarantined for the given period and reported to the broadcaster
+func (a *Allocator) EnableConflictDetection(detector ConflictDetector, quarantine time.Duration, broadcaster Broadcaster) {
+	a.conflicts = detector
+	a.quarantine = quarantine
+	a.broadcaster = broadcaster
+}
+
+// probeConflict probes ip before it is offered to the client and reports whether another host answered
+// The MAC is the answering host's when ARP revealed it. A failed probe does not block allocation.
+// The probe can take up to the ping check timeout, so callers run it without holding the address's lock.
+func (a *Allocator) probeConflict(ctx context.Context, req *AllocationRequest, ip net.IP) (bool, net.HardwareAddr) {
+	if a.conflicts == nil {
+		return false, nil
+	}
+
+	inUse, mac, err := a.conflicts.Probe(ctx, ip, req.Interface)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("ip", ip.String()).
+			Msg("Ping check failed, offering address without conflict detection")
+		return false, nil
+	}
+
+	// ICMP replies do not reveal the squatter's MAC; the column is NOT NULL
+	if inUse && mac == nil {
+		mac = make(net.HardwareAddr, 6)
+	}
+	return inUse, mac
+}
+
+// quarantineConflict marks an address that answered the probe as declined until the quarantine
+// period ends and returns an error so the caller moves on to the next candidate
+// The caller holds the address's advisory lock.
+func (a *Allocator) quarantineConflict(ctx context.Context, req *AllocationRequest, ip net.IP, mac net.HardwareAddr) error {
+	until := time.Now().Add(a.quarantine)
+	if err := a.store.QuarantineIP(ctx, ip, req.Subnet, mac, until, a.serverID); err != nil {
+		return err
+	}
+	a.cache.RemoveByIP(ip)
+	a.replicateIP(ctx, ip, req.Subnet)
+
+	logger.Warn().
+		Str("ip", ip.String()).
+		Str("conflict_mac", mac.String()).
+		Str("subnet", req.Subnet.String()).
+		Time("quarantined_until", until).
+		Msg("Address answered ping check, quarantined")
+
+	if a.broadcaster != nil {
+		a.broadcaster.BroadcastDHCPEvent(
+			events.EventTypeIPConflict,
+			ip,
+			mac,
+			"",
+			map[string]interface{}{
+				"subnet":            req.Subnet.String(),
+				"requested_by":      req.MAC.String(),
+				"quarantined_until": until,
+			},
+		)
+	}
+
+	return fmt.Errorf("%w by another host", errAddressInUse)
+}
+
+// onLink returns true if ip belongs to a network configured on the interface
+func onLink(ifaceName string, ip net.IP) bool {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return false
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// icmpProbe sends an ICMP echo request and waits for a matching reply
+func icmpProbe(ctx context.Context, ip net.IP, timeout time.Duration) (bool, error) {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return false, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	defer conn.Close()
+
+	// Raw ICMP sockets see every reply, so concurrent probes are told apart by ID and sequence
+	id, seq := rand.Intn(0xffff), rand.Intn(0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("irondhcp ping check")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to build ICMP echo: %w", err)
+	}
+
+	if _, err := conn.WriteTo(data, &net.IPAddr{IP: ip}); err != nil {
+		return false, fmt.Errorf("failed to send ICMP echo: %w", err)
+	}
+
+	if err := conn.SetReadDeadline(probeDeadline(ctx, timeout)); err != nil {
+		return false, fmt.Errorf("failed to set ICMP deadline: %w", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to read ICMP reply: %w", err)
+		}
+
+		if addr, ok := peer.(*net.IPAddr); !ok || !addr.IP.Equal(ip) {
+			continue
+		}
+
+		reply, err := icmp.ParseMessage(ipv4.ICMPTypeEchoReply.Protocol(), buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == id && echo.Seq == seq {
+			return true, nil
+		}
+	}
+}
+
+// probeDeadline returns the earlier of the probe timeout and the context deadline
+func probeDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
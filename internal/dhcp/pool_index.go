@@ -0,0 +1,213 @@
+package dhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// poolIndexTTL is how long a pool index is trusted before it is rebuilt
+// Rebuilding picks up rows deleted by lease cleanup and removed reservations.
+const poolIndexTTL = 5 * time.Minute
+
+// poolIndexMinAge is how old an index must be before an exhausted pool is rebuilt
+// early, so a genuinely full pool does not reload on every DISCOVER
+const poolIndexMinAge = 30 * time.Second
+
+// poolIndex is a bitmap of the addresses in one pool that are already taken
+// An address is taken if it has a lease row in any state or a reservation; free
+// addresses have never been leased. Other servers sharing the database are not
+// seen until the next rebuild, so a claimed address is still checked under the
+// advisory lock before use.
+type poolIndex struct {
+	mu      sync.Mutex
+	start   uint32 // First address of the pool
+	size    int    // Number of addresses in the pool
+	used    []uint64
+	free    int
+	builtAt time.Time
+}
+
+// newPoolIndex creates an index with every address free
+func newPoolIndex(start, end net.IP) (*poolIndex, error) {
+	start4, end4 := start.To4(), end.To4()
+	if start4 == nil || end4 == nil {
+		return nil, fmt.Errorf("invalid pool range %s-%s", start, end)
+	}
+
+	first := binary.BigEndian.Uint32(start4)
+	last := binary.BigEndian.Uint32(end4)
+	if last < first {
+		return nil, fmt.Errorf("invalid pool range %s-%s", start, end)
+	}
+
+	size := int(last-first) + 1
+	p := &poolIndex{
+		start:   first,
+		size:    size,
+		used:    make([]uint64, (size+63)/64),
+		free:    size,
+		builtAt: time.Now(),
+	}
+
+	// Bits past the end of the pool are never free
+	if tail := size % 64; tail != 0 {
+		p.used[len(p.used)-1] = ^uint64(0) << tail
+	}
+
+	return p, nil
+}
+
+// offset returns the position of ip in the pool, or -1 if it is outside
+func (p *poolIndex) offset(ip net.IP) int {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return -1
+	}
+	n := binary.BigEndian.Uint32(ip4)
+	if n < p.start || int(n-p.start) >= p.size {
+		return -1
+	}
+	return int(n - p.start)
+}
+
+// markUsed records that ip is taken
+func (p *poolIndex) markUsed(ip net.IP) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if i := p.offset(ip); i >= 0 {
+		p.set(i)
+	}
+}
+
+// release records that ip is free again after a claim that could not be completed
+func (p *poolIndex) release(ip net.IP) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if i := p.offset(ip); i >= 0 {
+		word, bit := i/64, uint(i%64)
+		if p.used[word]&(1<<bit) != 0 {
+			p.used[word] &^= 1 << bit
+			p.free++
+		}
+	}
+}
+
+// set marks position i as taken; the caller holds p.mu
+func (p *poolIndex) set(i int) {
+	word, bit := i/64, uint(i%64)
+	if p.used[word]&(1<<bit) == 0 {
+		p.used[word] |= 1 << bit
+		p.free--
+	}
+}
+
+// claim picks a free address accepted by allow, starting at a random position
+// Servers sharing a pool then try different addresses first.
+func (p *poolIndex) claim(allow func(net.IP) bool) (net.IP, bool) {
+	return p.claimFrom(rand.Intn(p.size), allow)
+}
+
+// claimFrom picks the first free address accepted by allow at or after position
+// from, wrapping around the end of the pool, and marks it taken
+// Full 64-address words are skipped at a time.
+func (p *poolIndex) claimFrom(from int, allow func(net.IP) bool) (net.IP, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.free == 0 {
+		return nil, false
+	}
+
+	for scanned := 0; scanned < p.size; {
+		i := (from + scanned) % p.size
+		word := p.used[i/64] >> uint(i%64)
+
+		// Jump to the next free bit in this word, without running past the end of the pool
+		skip := bits.TrailingZeros64(^word)
+		if limit := p.size - i; skip > limit {
+			skip = limit
+		}
+		if skip > 0 {
+			scanned += skip
+			continue
+		}
+
+		ip := p.address(i)
+		if allow != nil && !allow(ip) {
+			scanned++
+			continue
+		}
+
+		p.set(i)
+		return ip, true
+	}
+
+	return nil, false
+}
+
+// address returns the address at position i of the pool
+func (p *poolIndex) address(i int) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, p.start+uint32(i))
+	return ip
+}
+
+// poolIndexKey identifies a pool within a subnet
+func poolIndexKey(subnet *net.IPNet, pool *PoolConfig) string {
+	return subnet.String() + " " + pool.RangeStart + "-" + pool.RangeEnd
+}
+
+// poolIndex returns the index for a pool, building it if missing or older than poolIndexTTL
+func (a *Allocator) poolIndex(ctx context.Context, subnet *net.IPNet, pool *PoolConfig) (*poolIndex, error) {
+	key := poolIndexKey(subnet, pool)
+
+	a.poolsMu.Lock()
+	idx := a.pools[key]
+	a.poolsMu.Unlock()
+
+	if idx != nil && time.Since(idx.builtAt) < poolIndexTTL {
+		return idx, nil
+	}
+	return a.rebuildPoolIndex(ctx, subnet, pool)
+}
+
+// rebuildPoolIndex loads the taken addresses of a pool from the store
+func (a *Allocator) rebuildPoolIndex(ctx context.Context, subnet *net.IPNet, pool *PoolConfig) (*poolIndex, error) {
+	rangeStart := net.ParseIP(pool.RangeStart)
+	rangeEnd := net.ParseIP(pool.RangeEnd)
+
+	idx, err := newPoolIndex(rangeStart, rangeEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	leased, err := a.store.GetLeasedIPs(ctx, subnet, rangeStart.To4(), rangeEnd.To4())
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range leased {
+		idx.markUsed(ip)
+	}
+
+	reservations, err := a.store.GetReservationsBySubnet(ctx, subnet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reservations: %w", err)
+	}
+	for _, reservation := range reservations {
+		idx.markUsed(reservation.IP)
+	}
+
+	a.poolsMu.Lock()
+	a.pools[poolIndexKey(subnet, pool)] = idx
+	a.poolsMu.Unlock()
+
+	return idx, nil
+}
@@ -0,0 +1,86 @@
+package dhcp
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPoolIndexClaimsEveryAddressOnce(t *testing.T) {
+	// 130 addresses span three bitmap words, the last one partial
+	idx, err := newPoolIndex(net.ParseIP("10.0.0.10"), net.ParseIP("10.0.0.139"))
+	if err != nil {
+		t.Fatalf("newPoolIndex: %v", err)
+	}
+	idx.markUsed(net.ParseIP("10.0.0.10"))
+	idx.markUsed(net.ParseIP("10.0.0.139"))
+	idx.markUsed(net.ParseIP("10.0.1.1")) // Outside the pool, ignored
+
+	seen := make(map[string]bool)
+	for {
+		ip, ok := idx.claim(nil)
+		if !ok {
+			break
+		}
+		if seen[ip.String()] {
+			t.Fatalf("%s claimed twice", ip)
+		}
+		if ip.Equal(net.ParseIP("10.0.0.10")) || ip.Equal(net.ParseIP("10.0.0.139")) {
+			t.Fatalf("claimed %s, which was marked used", ip)
+		}
+		seen[ip.String()] = true
+	}
+
+	if len(seen) != 128 {
+		t.Errorf("claimed %d addresses, want 128", len(seen))
+	}
+}
+
+func TestPoolIndexClaimIsRandomised(t *testing.T) {
+	first := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		idx, err := newPoolIndex(net.ParseIP("10.0.0.0"), net.ParseIP("10.0.255.255"))
+		if err != nil {
+			t.Fatalf("newPoolIndex: %v", err)
+		}
+		ip, _ := idx.claim(nil)
+		first[ip.String()] = true
+	}
+
+	if len(first) < 2 {
+		t.Errorf("20 fresh indexes all started at %v", first)
+	}
+}
+
+func TestPoolIndexClaimHonoursFilter(t *testing.T) {
+	idx, err := newPoolIndex(net.ParseIP("10.0.0.0"), net.ParseIP("10.0.0.9"))
+	if err != nil {
+		t.Fatalf("newPoolIndex: %v", err)
+	}
+
+	even := func(ip net.IP) bool { return ip.To4()[3]%2 == 0 }
+	for i := 0; i < 5; i++ {
+		ip, ok := idx.claim(even)
+		if !ok {
+			t.Fatalf("claim %d failed with even addresses left", i)
+		}
+		if !even(ip) {
+			t.Fatalf("claimed %s, which the filter rejects", ip)
+		}
+	}
+
+	if ip, ok := idx.claim(even); ok {
+		t.Errorf("claimed %s after every even address was taken", ip)
+	}
+	if _, ok := idx.claim(nil); !ok {
+		t.Error("odd addresses should still be free")
+	}
+}
+
+func TestNewPoolIndexRejectsBadRanges(t *testing.T) {
+	if _, err := newPoolIndex(net.ParseIP("10.0.0.9"), net.ParseIP("10.0.0.1")); err == nil {
+		t.Error("expected an error for a reversed range")
+	}
+	if _, err := newPoolIndex(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::9")); err == nil {
+		t.Error("expected an error for an IPv6 range")
+	}
+}
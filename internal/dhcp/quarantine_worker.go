@@ -0,0 +1,122 @@
+package dhcp
+
+import (
+	"context"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/metrics"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// QuarantineWorker returns declined addresses to the pool once their quarantine lapses
+// and keeps the per-subnet declined address gauge up to date
+type QuarantineWorker struct {
+	store         storage.LeaseStore
+	metrics       *metrics.Metrics
+	checkInterval time.Duration
+	stopChan      chan struct{}
+	doneChan      chan struct{}
+}
+
+// NewQuarantineWorker creates a new declined address quarantine worker
+func NewQuarantineWorker(store storage.LeaseStore, m *metrics.Metrics, checkInterval time.Duration) *QuarantineWorker {
+	return &QuarantineWorker{
+		store:         store,
+		metrics:       m,
+		checkInterval: checkInterval,
+		stopChan:      make(chan struct{}),
+		doneChan:      make(chan struct{}),
+	}
+}
+
+// Start begins the quarantine check loop
+func (w *QuarantineWorker) Start(ctx context.Context) error {
+	logger.Info().
+		Dur("interval", w.checkInterval).
+		Msg("Starting declined address quarantine worker")
+
+	// Perform initial check
+	if err := w.reclaimDeclined(ctx); err != nil {
+		logger.Error().Err(err).Msg("Initial quarantine check failed")
+	}
+
+	// Start quarantine loop in background
+	go w.quarantineLoop(ctx)
+
+	return nil
+}
+
+// Stop stops the quarantine check loop
+func (w *QuarantineWorker) Stop(ctx context.Context) error {
+	logger.Info().Msg("Stopping declined address quarantine worker")
+
+	close(w.stopChan)
+
+	// Wait for quarantine loop to finish with timeout
+	select {
+	case <-w.doneChan:
+		logger.Info().Msg("Declined address quarantine worker stopped")
+		return nil
+	case <-ctx.Done():
+		logger.Warn().Msg("Declined address quarantine worker stop timed out")
+		return ctx.Err()
+	}
+}
+
+// quarantineLoop is the main quarantine check loop
+func (w *QuarantineWorker) quarantineLoop(ctx context.Context) {
+	defer close(w.doneChan)
+
+	ticker := time.NewTicker(w.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChan:
+			logger.Debug().Msg("Quarantine worker received stop signal")
+			return
+
+		case <-ctx.Done():
+			logger.Debug().Msg("Quarantine worker context cancelled")
+			return
+
+		case <-ticker.C:
+			logger.Debug().Msg("Quarantine worker tick - checking declined addresses")
+			if err := w.reclaimDeclined(ctx); err != nil {
+				logger.Error().Err(err).Msg("Failed to reclaim declined addresses")
+			}
+		}
+	}
+}
+
+// reclaimDeclined returns lapsed addresses to the pool and refreshes the declined address gauge
+func (w *QuarantineWorker) reclaimDeclined(ctx context.Context) error {
+	count, err := w.store.ReclaimDeclinedLeases(ctx)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		logger.Info().
+			Int64("count", count).
+			Msg("Returned declined addresses to the pool")
+	}
+
+	if w.metrics == nil {
+		return nil
+	}
+
+	declined, err := w.store.GetDeclinedAddresses(ctx)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, addr := range declined {
+		counts[addr.Subnet.String()]++
+	}
+	w.metrics.UpdateDeclinedAddresses(counts)
+
+	return nil
+}
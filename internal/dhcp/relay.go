@@ -0,0 +1,44 @@
+package dhcp
+
+import (
+	"encoding/hex"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// relayAgentInfo holds the option 82 sub-options the server acts on (RFC 3046)
+type relayAgentInfo struct {
+	circuitID string
+	remoteID  string
+}
+
+// relayAgentInfoFromRequest extracts circuit-id and remote-id from option 82
+func relayAgentInfoFromRequest(req *dhcpv4.DHCPv4) relayAgentInfo {
+	var info relayAgentInfo
+	if relay := req.RelayAgentInfo(); relay != nil {
+		info.circuitID = formatAgentID(relay.Get(dhcpv4.AgentCircuitIDSubOption))
+		info.remoteID = formatAgentID(relay.Get(dhcpv4.AgentRemoteIDSubOption))
+	}
+	return info
+}
+
+// formatAgentID renders a relay agent sub-option for matching and storage
+// Printable values (e.g. "Gi1/0/12") are kept as-is; binary values become "0x" followed by hex
+func formatAgentID(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	for _, b := range data {
+		if b < 0x20 || b > 0x7e {
+			return "0x" + hex.EncodeToString(data)
+		}
+	}
+	return string(data)
+}
+
+// echoRelayAgentInfo copies option 82 from the request into the reply
+func echoRelayAgentInfo(req, resp *dhcpv4.DHCPv4) {
+	if opt := req.Options.Get(dhcpv4.OptionRelayAgentInformation); opt != nil {
+		resp.Options.Update(dhcpv4.OptGeneric(dhcpv4.OptionRelayAgentInformation, opt))
+	}
+}
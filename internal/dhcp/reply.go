@@ -0,0 +1,148 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/sashakarcz/irondhcp/internal/logger"
+)
+
+const etherTypeIPv4 = 0x0800
+
+// errRawUnsupported is returned by sendToHardwareAddr on platforms without raw link-layer sockets
+var errRawUnsupported = errors.New("raw link-layer replies are not supported on this platform")
+
+// replyKind is how a reply reaches the client (RFC 2131 section 4.1)
+type replyKind int
+
+const (
+	replyRelay     replyKind = iota // To the relay agent (giaddr) on the server port
+	replyUnicast                    // To ciaddr, the client already has a configured address
+	replyBroadcast                  // To 255.255.255.255, the client cannot receive unicast yet
+	replyHardware                   // To yiaddr at chaddr, sent as a raw frame since ARP would fail
+)
+
+// String returns a short name for logging
+func (k replyKind) String() string {
+	switch k {
+	case replyRelay:
+		return "relay"
+	case replyUnicast:
+		return "unicast"
+	case replyBroadcast:
+		return "broadcast"
+	case replyHardware:
+		return "hardware"
+	default:
+		return "unknown"
+	}
+}
+
+// replyDestination is where a reply is sent
+type replyDestination struct {
+	kind replyKind
+	addr *net.UDPAddr
+}
+
+// broadcastDestination is the limited broadcast address on the client port
+var broadcastDestination = replyDestination{
+	kind: replyBroadcast,
+	addr: &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort},
+}
+
+// replyDestinationFor picks the destination of a reply per RFC 2131 section 4.1:
+// relayed requests go back to giaddr, NAKs are broadcast, clients with ciaddr get
+// unicast, clients asking for broadcast get broadcast, and everyone else gets the
+// reply unicast to yiaddr at their hardware address
+func replyDestinationFor(req, resp *dhcpv4.DHCPv4) replyDestination {
+	switch {
+	case req.GatewayIPAddr != nil && !req.GatewayIPAddr.IsUnspecified():
+		return replyDestination{
+			kind: replyRelay,
+			addr: &net.UDPAddr{IP: req.GatewayIPAddr, Port: dhcpv4.ServerPort},
+		}
+	case resp.MessageType() == dhcpv4.MessageTypeNak:
+		return broadcastDestination
+	case req.ClientIPAddr != nil && !req.ClientIPAddr.IsUnspecified():
+		return replyDestination{
+			kind: replyUnicast,
+			addr: &net.UDPAddr{IP: req.ClientIPAddr, Port: dhcpv4.ClientPort},
+		}
+	case req.IsBroadcast():
+		return broadcastDestination
+	case resp.YourIPAddr == nil || resp.YourIPAddr.IsUnspecified():
+		return broadcastDestination
+	default:
+		return replyDestination{
+			kind: replyHardware,
+			addr: &net.UDPAddr{IP: resp.YourIPAddr, Port: dhcpv4.ClientPort},
+		}
+	}
+}
+
+// sendReply delivers a reply to the destination chosen by replyDestinationFor
+// Hardware unicast falls back to broadcast when raw sockets are unavailable.
+func (h *Handler) sendReply(conn net.PacketConn, req, resp *dhcpv4.DHCPv4, payload []byte) (replyDestination, error) {
+	dest := replyDestinationFor(req, resp)
+
+	if dest.kind == replyHardware {
+		err := sendToHardwareAddr(h.iface, payload, resp.ServerIdentifier(), dest.addr.IP, req.ClientHWAddr)
+		if err == nil {
+			return dest, nil
+		}
+		logger.Debug().
+			Err(err).
+			Str("mac", req.ClientHWAddr.String()).
+			Msg("Hardware unicast failed, broadcasting reply")
+		dest = broadcastDestination
+	}
+
+	_, err := conn.WriteTo(payload, dest.addr)
+	return dest, err
+}
+
+// buildUDPFrame builds an Ethernet frame carrying an IPv4/UDP datagram
+// The UDP checksum is left zero, which IPv4 permits.
+func buildUDPFrame(srcMAC, dstMAC net.HardwareAddr, srcIP, dstIP net.IP, srcPort, dstPort int, payload []byte) []byte {
+	const ethLen, ipLen, udpLen = 14, 20, 8
+
+	frame := make([]byte, ethLen+ipLen+udpLen+len(payload))
+
+	// Ethernet header
+	copy(frame[0:6], dstMAC)
+	copy(frame[6:12], srcMAC)
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv4)
+
+	// IPv4 header
+	ip := frame[ethLen : ethLen+ipLen]
+	ip[0] = 0x45 // Version 4, 20-byte header
+	binary.BigEndian.PutUint16(ip[2:4], uint16(ipLen+udpLen+len(payload)))
+	ip[8] = 64 // TTL
+	ip[9] = 17 // UDP
+	copy(ip[12:16], srcIP.To4())
+	copy(ip[16:20], dstIP.To4())
+	binary.BigEndian.PutUint16(ip[10:12], ipv4Checksum(ip))
+
+	// UDP header
+	udp := frame[ethLen+ipLen : ethLen+ipLen+udpLen]
+	binary.BigEndian.PutUint16(udp[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dstPort))
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpLen+len(payload)))
+
+	copy(frame[ethLen+ipLen+udpLen:], payload)
+	return frame
+}
+
+// ipv4Checksum computes the IPv4 header checksum
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i : i+2]))
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package dhcp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"golang.org/x/sys/unix"
+)
+
+// sendToHardwareAddr sends a reply straight to the client's hardware address
+// Clients without an address cannot answer ARP, so the frame is built by hand
+func sendToHardwareAddr(ifaceName string, payload []byte, srcIP, dstIP net.IP, dstMAC net.HardwareAddr) error {
+	if ifaceName == "" {
+		return fmt.Errorf("listener is not bound to an interface")
+	}
+	if len(dstMAC) != 6 {
+		return fmt.Errorf("client hardware address %s is not Ethernet", dstMAC)
+	}
+
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return fmt.Errorf("failed to get interface %s: %w", ifaceName, err)
+	}
+	if len(iface.HardwareAddr) != 6 {
+		return fmt.Errorf("interface %s has no Ethernet address", ifaceName)
+	}
+	if srcIP.To4() == nil {
+		addrs := interfaceAddrs(ifaceName)
+		if len(addrs) == 0 {
+			return fmt.Errorf("interface %s has no IPv4 address", ifaceName)
+		}
+		srcIP = addrs[0].IP
+	}
+
+	// Protocol 0: the socket is only used for sending
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open raw socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	frame := buildUDPFrame(iface.HardwareAddr, dstMAC, srcIP, dstIP, dhcpv4.ServerPort, dhcpv4.ClientPort, payload)
+
+	dest := &unix.SockaddrLinklayer{Protocol: htons(etherTypeIPv4), Ifindex: iface.Index, Halen: 6}
+	copy(dest.Addr[:], dstMAC)
+	if err := unix.Sendto(fd, frame, 0, dest); err != nil {
+		return fmt.Errorf("failed to send raw reply: %w", err)
+	}
+
+	return nil
+}
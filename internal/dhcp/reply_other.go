@@ -0,0 +1,12 @@
+//go:build !linux
+
+package dhcp
+
+import (
+	"net"
+)
+
+// sendToHardwareAddr is not available without raw link-layer sockets; callers fall back to broadcast
+func sendToHardwareAddr(ifaceName string, payload []byte, srcIP, dstIP net.IP, dstMAC net.HardwareAddr) error {
+	return errRawUnsupported
+}
@@ -0,0 +1,178 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func TestReplyDestinationFor(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	relay := net.IPv4(10, 0, 0, 1)
+	clientIP := net.IPv4(192, 168, 1, 50)
+	offered := net.IPv4(192, 168, 1, 100)
+
+	tests := []struct {
+		name      string
+		msgType   dhcpv4.MessageType
+		giaddr    net.IP
+		ciaddr    net.IP
+		yiaddr    net.IP
+		broadcast bool
+		wantKind  replyKind
+		wantAddr  string
+	}{
+		{
+			name:     "relayed offer goes to relay server port",
+			msgType:  dhcpv4.MessageTypeOffer,
+			giaddr:   relay,
+			yiaddr:   offered,
+			wantKind: replyRelay,
+			wantAddr: "10.0.0.1:67",
+		},
+		{
+			name:     "relayed NAK goes to relay",
+			msgType:  dhcpv4.MessageTypeNak,
+			giaddr:   relay,
+			ciaddr:   clientIP,
+			wantKind: replyRelay,
+			wantAddr: "10.0.0.1:67",
+		},
+		{
+			name:     "relay takes precedence over ciaddr",
+			msgType:  dhcpv4.MessageTypeAck,
+			giaddr:   relay,
+			ciaddr:   clientIP,
+			yiaddr:   clientIP,
+			wantKind: replyRelay,
+			wantAddr: "10.0.0.1:67",
+		},
+		{
+			name:     "NAK without relay is broadcast",
+			msgType:  dhcpv4.MessageTypeNak,
+			ciaddr:   clientIP,
+			wantKind: replyBroadcast,
+			wantAddr: "255.255.255.255:68",
+		},
+		{
+			name:     "renewal ACK is unicast to ciaddr",
+			msgType:  dhcpv4.MessageTypeAck,
+			ciaddr:   clientIP,
+			yiaddr:   clientIP,
+			wantKind: replyUnicast,
+			wantAddr: "192.168.1.50:68",
+		},
+		{
+			name:      "ciaddr wins over broadcast flag",
+			msgType:   dhcpv4.MessageTypeAck,
+			ciaddr:    clientIP,
+			yiaddr:    clientIP,
+			broadcast: true,
+			wantKind:  replyUnicast,
+			wantAddr:  "192.168.1.50:68",
+		},
+		{
+			name:     "INFORM reply is unicast to ciaddr",
+			msgType:  dhcpv4.MessageTypeAck,
+			ciaddr:   clientIP,
+			yiaddr:   net.IPv4zero,
+			wantKind: replyUnicast,
+			wantAddr: "192.168.1.50:68",
+		},
+		{
+			name:      "broadcast flag is honoured",
+			msgType:   dhcpv4.MessageTypeOffer,
+			yiaddr:    offered,
+			broadcast: true,
+			wantKind:  replyBroadcast,
+			wantAddr:  "255.255.255.255:68",
+		},
+		{
+			name:     "offer without broadcast flag is unicast to chaddr",
+			msgType:  dhcpv4.MessageTypeOffer,
+			yiaddr:   offered,
+			wantKind: replyHardware,
+			wantAddr: "192.168.1.100:68",
+		},
+		{
+			name:     "no address to unicast to is broadcast",
+			msgType:  dhcpv4.MessageTypeAck,
+			yiaddr:   net.IPv4zero,
+			wantKind: replyBroadcast,
+			wantAddr: "255.255.255.255:68",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := dhcpv4.New(dhcpv4.WithHwAddr(mac))
+			if err != nil {
+				t.Fatalf("failed to build request: %v", err)
+			}
+			if tt.giaddr != nil {
+				req.GatewayIPAddr = tt.giaddr
+			}
+			if tt.ciaddr != nil {
+				req.ClientIPAddr = tt.ciaddr
+			}
+			if tt.broadcast {
+				req.SetBroadcast()
+			}
+
+			resp, err := dhcpv4.NewReplyFromRequest(req, dhcpv4.WithMessageType(tt.msgType))
+			if err != nil {
+				t.Fatalf("failed to build reply: %v", err)
+			}
+			if tt.yiaddr != nil {
+				resp.YourIPAddr = tt.yiaddr
+			}
+
+			dest := replyDestinationFor(req, resp)
+			if dest.kind != tt.wantKind {
+				t.Errorf("kind = %s, want %s", dest.kind, tt.wantKind)
+			}
+			if dest.addr.String() != tt.wantAddr {
+				t.Errorf("addr = %s, want %s", dest.addr, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestBuildUDPFrame(t *testing.T) {
+	srcMAC := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	dstMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	payload := []byte("dhcp reply")
+
+	frame := buildUDPFrame(srcMAC, dstMAC, net.IPv4(192, 168, 1, 1), net.IPv4(192, 168, 1, 100), 67, 68, payload)
+
+	if got, want := len(frame), 14+20+8+len(payload); got != want {
+		t.Fatalf("frame length = %d, want %d", got, want)
+	}
+	if net.HardwareAddr(frame[0:6]).String() != dstMAC.String() {
+		t.Errorf("destination MAC = %s, want %s", net.HardwareAddr(frame[0:6]), dstMAC)
+	}
+	if got := binary.BigEndian.Uint16(frame[12:14]); got != etherTypeIPv4 {
+		t.Errorf("ethertype = %#x, want %#x", got, etherTypeIPv4)
+	}
+
+	// A valid header checksums to zero
+	if sum := ipv4Checksum(frame[14:34]); sum != 0 {
+		t.Errorf("IPv4 header checksum does not verify: %#x", sum)
+	}
+	if !net.IP(frame[30:34]).Equal(net.IPv4(192, 168, 1, 100)) {
+		t.Errorf("destination IP = %s", net.IP(frame[30:34]))
+	}
+
+	udp := frame[34:42]
+	if got := binary.BigEndian.Uint16(udp[2:4]); got != 68 {
+		t.Errorf("destination port = %d, want 68", got)
+	}
+	if got := binary.BigEndian.Uint16(udp[4:6]); int(got) != 8+len(payload) {
+		t.Errorf("UDP length = %d, want %d", got, 8+len(payload))
+	}
+	if string(frame[42:]) != string(payload) {
+		t.Errorf("payload = %q, want %q", frame[42:], payload)
+	}
+}
@@ -0,0 +1,54 @@
+package dhcp
+
+import (
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// requestState is the client state a DHCPREQUEST was sent from (RFC 2131 section 4.3.2)
+type requestState int
+
+const (
+	requestStateSelecting  requestState = iota // Accepting an offer: server-id and requested IP, no ciaddr
+	requestStateInitReboot                     // Verifying a remembered address: requested IP, no ciaddr
+	requestStateRenewing                       // Extending a lease (RENEWING or REBINDING): ciaddr set
+	requestStateInvalid
+)
+
+// String returns the RFC 2131 name of the state
+func (s requestState) String() string {
+	switch s {
+	case requestStateSelecting:
+		return "SELECTING"
+	case requestStateInitReboot:
+		return "INIT-REBOOT"
+	case requestStateRenewing:
+		return "RENEWING"
+	default:
+		return "INVALID"
+	}
+}
+
+// detectRequestState determines the client state from the server identifier (option 54),
+// requested IP address (option 50) and ciaddr of a DHCPREQUEST
+// RENEWING and REBINDING requests look the same on the wire and are handled alike.
+func detectRequestState(req *dhcpv4.DHCPv4) requestState {
+	serverID := req.ServerIdentifier()
+	requestedIP := req.RequestedIPAddress()
+	hasRequestedIP := requestedIP != nil && !requestedIP.IsUnspecified()
+	hasClientIP := req.ClientIPAddr != nil && !req.ClientIPAddr.IsUnspecified()
+
+	switch {
+	case serverID != nil && !serverID.IsUnspecified():
+		if hasRequestedIP {
+			return requestStateSelecting
+		}
+		return requestStateInvalid
+	case hasClientIP:
+		// Some clients also repeat option 50 while renewing; ciaddr takes precedence
+		return requestStateRenewing
+	case hasRequestedIP:
+		return requestStateInitReboot
+	default:
+		return requestStateInvalid
+	}
+}
@@ -9,21 +9,31 @@ import (
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/dhcpv6/server6"
 	"github.com/sashakarcz/irondhcp/internal/config"
 	"github.com/sashakarcz/irondhcp/internal/events"
+	"github.com/sashakarcz/irondhcp/internal/failover"
 	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/options"
 	"github.com/sashakarcz/irondhcp/internal/storage"
 )
 
 // Server represents a DHCP server
 type Server struct {
 	config      *config.Config
-	store       *storage.Store
+	store       storage.Backend
 	allocator   *Allocator
 	broadcaster Broadcaster
+	failover    *failover.Peer // nil unless peer-to-peer failover is enabled
 	servers     []*server4.Server
-	subnets     map[string]*SubnetConfig // subnet CIDR -> config
-	interfaces  []string
+	servers6    []*server6.Server
+	subnets     map[string]*SubnetConfig   // subnet CIDR -> config
+	subnets6    map[string]*SubnetConfig   // IPv6 prefix -> config (served by DHCPv6)
+	shared      map[string][]*SubnetConfig // shared network name -> member subnets, in config order
+	classes     []*ClientClass             // Evaluated in config order
+	interfaces  []config.InterfaceConfig
+	serverDUID  dhcpv6.DUID // DHCPv6 server identifier
 	wg          sync.WaitGroup
 	shutdown    chan struct{}
 }
@@ -35,74 +45,67 @@ type Broadcaster interface {
 
 // SubnetConfig holds runtime subnet configuration
 type SubnetConfig struct {
-	Network          *net.IPNet
-	Description      string
-	Gateway          net.IP
-	DNSServers       []net.IP
-	LeaseDuration    time.Duration
-	MaxLeaseDuration time.Duration
-	Options          map[string]string
-	TFTPServer       string // DHCP option 66
-	BootFilename     string // DHCP option 67
-	Pools            []*PoolConfig
+	Network           *net.IPNet
+	Description       string
+	Gateway           net.IP
+	ServerIdentifier  net.IP // Option 54 override; nil derives it from the listening interface
+	NextServer        net.IP // siaddr override; nil falls back to the TFTP server address
+	SharedNetwork     string // Empty if the subnet is alone on its segment
+	DNSServers        []net.IP
+	LeaseDuration     time.Duration
+	MinLeaseDuration  time.Duration
+	MaxLeaseDuration  time.Duration
+	RenewalRatio      float64 // T1 as a fraction of the lease time
+	RebindingRatio    float64 // T2 as a fraction of the lease time
+	DeclineQuarantine time.Duration
+	Options           map[string]string
+	DHCPOptions       []options.Option // Encoded from Options (IPv4 subnets only)
+	TFTPServer        string           // DHCP option 66
+	BootFilename      string           // DHCP option 67
+	BootRules         []storage.BootRule
+	Pools             []*PoolConfig
+	PrefixPools       []*PrefixPoolConfig // DHCPv6 IA_PD
 }
 
 // New creates a new DHCP server
-func New(cfg *config.Config, store *storage.Store, broadcaster Broadcaster) (*Server, error) {
+func New(cfg *config.Config, store storage.Backend, broadcaster Broadcaster) (*Server, error) {
 	// Create allocator with server ID and optional cache
 	// Use server ID from config, or empty string if not set
 	serverID := cfg.Server.ServerID
 	useCache := cfg.Server.Cluster.UseReadCache
 	allocator := NewAllocator(store, 10000, serverID, useCache) // 10k lease cache
+	if cfg.Server.PingCheck.Enabled {
+		allocator.EnableConflictDetection(newPingChecker(cfg.Server.PingCheck), cfg.Server.PingCheck.Quarantine, broadcaster)
+	}
+	var peer *failover.Peer
+	if cfg.Server.Failover.Enabled {
+		peer = failover.New(cfg.Server.Failover, serverID, store)
+		allocator.EnableFailover(peer)
+	}
 
-	// Build subnet map
+	// Build subnet maps
 	subnets := make(map[string]*SubnetConfig)
+	subnets6 := make(map[string]*SubnetConfig)
+	shared := make(map[string][]*SubnetConfig)
 	for _, subnetCfg := range cfg.Subnets {
-		_, network, err := net.ParseCIDR(subnetCfg.Network)
+		subnet, err := newSubnetConfig(subnetCfg)
 		if err != nil {
-			return nil, fmt.Errorf("invalid subnet %s: %w", subnetCfg.Network, err)
+			return nil, err
 		}
 
-		// Parse DNS servers
-		var dnsServers []net.IP
-		for _, dnsStr := range subnetCfg.DNSServers {
-			dnsServers = append(dnsServers, net.ParseIP(dnsStr))
+		if subnetCfg.IsIPv6() {
+			subnets6[subnet.Network.String()] = subnet
+		} else {
+			subnets[subnet.Network.String()] = subnet
 		}
-
-		// Convert pools
-		var pools []*PoolConfig
-		for _, poolCfg := range subnetCfg.Pools {
-			pools = append(pools, &PoolConfig{
-				RangeStart: poolCfg.RangeStart,
-				RangeEnd:   poolCfg.RangeEnd,
-			})
-		}
-
-		// Extract boot options if present
-		var tftpServer, bootFilename string
-		if subnetCfg.Boot != nil {
-			tftpServer = subnetCfg.Boot.TFTPServer
-			bootFilename = subnetCfg.Boot.Filename
-		}
-
-		subnets[network.String()] = &SubnetConfig{
-			Network:          network,
-			Description:      subnetCfg.Description,
-			Gateway:          net.ParseIP(subnetCfg.Gateway),
-			DNSServers:       dnsServers,
-			LeaseDuration:    subnetCfg.LeaseDuration,
-			MaxLeaseDuration: subnetCfg.MaxLeaseDuration,
-			Options:          subnetCfg.Options,
-			TFTPServer:       tftpServer,
-			BootFilename:     bootFilename,
-			Pools:            pools,
+		if subnet.SharedNetwork != "" {
+			shared[subnet.SharedNetwork] = append(shared[subnet.SharedNetwork], subnet)
 		}
 	}
 
-	// Extract interface names
-	var interfaces []string
-	for _, iface := range cfg.Server.Interfaces {
-		interfaces = append(interfaces, iface.Name)
+	classes, err := newClientClasses(cfg.ClientClasses)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Server{
@@ -110,17 +113,105 @@ func New(cfg *config.Config, store *storage.Store, broadcaster Broadcaster) (*Se
 		store:       store,
 		allocator:   allocator,
 		broadcaster: broadcaster,
+		failover:    peer,
 		subnets:     subnets,
-		interfaces:  interfaces,
+		subnets6:    subnets6,
+		shared:      shared,
+		classes:     classes,
+		interfaces:  cfg.Server.Interfaces,
 		shutdown:    make(chan struct{}),
 	}, nil
 }
 
+// newSubnetConfig converts a subnet from the YAML config into its runtime form
+func newSubnetConfig(subnetCfg config.SubnetConfig) (*SubnetConfig, error) {
+	_, network, err := net.ParseCIDR(subnetCfg.Network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %s: %w", subnetCfg.Network, err)
+	}
+
+	// Parse DNS servers
+	var dnsServers []net.IP
+	for _, dnsStr := range subnetCfg.DNSServers {
+		dnsServers = append(dnsServers, net.ParseIP(dnsStr))
+	}
+
+	// Convert pools
+	var pools []*PoolConfig
+	for _, poolCfg := range subnetCfg.Pools {
+		pools = append(pools, &PoolConfig{
+			RangeStart:  poolCfg.RangeStart,
+			RangeEnd:    poolCfg.RangeEnd,
+			ClientClass: poolCfg.ClientClass,
+			Strategy:    poolCfg.Strategy,
+		})
+	}
+
+	// Convert prefix delegation pools
+	var prefixPools []*PrefixPoolConfig
+	for _, poolCfg := range subnetCfg.PrefixPools {
+		_, prefix, err := net.ParseCIDR(poolCfg.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix pool %s: %w", poolCfg.Prefix, err)
+		}
+		prefixPools = append(prefixPools, &PrefixPoolConfig{
+			Prefix:          prefix,
+			DelegatedLength: poolCfg.DelegatedLength,
+		})
+	}
+
+	// Encode configured DHCP options
+	var dhcpOptions []options.Option
+	if !subnetCfg.IsIPv6() {
+		dhcpOptions, err = options.Parse(subnetCfg.Options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid options for subnet %s: %w", subnetCfg.Network, err)
+		}
+	}
+
+	// Extract boot settings from the subnet config
+	var tftpServer, bootFilename string
+	if subnetCfg.Boot != nil {
+		tftpServer = subnetCfg.Boot.TFTPServer
+		bootFilename = subnetCfg.Boot.Filename
+	}
+	bootRules := storage.BootRulesFromConfig(subnetCfg.Boot)
+
+	return &SubnetConfig{
+		Network:           network,
+		Description:       subnetCfg.Description,
+		Gateway:           net.ParseIP(subnetCfg.Gateway),
+		ServerIdentifier:  net.ParseIP(subnetCfg.ServerIdentifier).To4(),
+		NextServer:        net.ParseIP(subnetCfg.NextServer).To4(),
+		SharedNetwork:     subnetCfg.SharedNetwork,
+		DNSServers:        dnsServers,
+		LeaseDuration:     subnetCfg.LeaseDuration,
+		MinLeaseDuration:  subnetCfg.MinLeaseDuration,
+		MaxLeaseDuration:  subnetCfg.MaxLeaseDuration,
+		RenewalRatio:      subnetCfg.RenewalRatio,
+		RebindingRatio:    subnetCfg.RebindingRatio,
+		DeclineQuarantine: subnetCfg.DeclineQuarantine,
+		Options:           subnetCfg.Options,
+		DHCPOptions:       dhcpOptions,
+		TFTPServer:        tftpServer,
+		BootFilename:      bootFilename,
+		BootRules:         bootRules,
+		Pools:             pools,
+		PrefixPools:       prefixPools,
+	}, nil
+}
+
 // Start starts the DHCP server
 func (s *Server) Start(ctx context.Context) error {
+	var ifaceNames []string
+	for _, iface := range s.interfaces {
+		ifaceNames = append(ifaceNames, iface.Name)
+	}
+
 	logger.Info().
-		Strs("interfaces", s.interfaces).
+		Strs("interfaces", ifaceNames).
 		Int("subnets", len(s.subnets)).
+		Int("subnets_v6", len(s.subnets6)).
 		Msg("Starting DHCP server")
 
 	laddr := &net.UDPAddr{
@@ -129,20 +220,46 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	if len(s.interfaces) > 0 {
-		for _, ifaceName := range s.interfaces {
-			log := logger.With().Str("interface", ifaceName).Logger()
-			log.Info().Msg("Starting DHCP listener on interface")
+		for _, iface := range s.interfaces {
+			log := logger.With().Str("interface", iface.Name).Logger()
+
+			if iface.IPv4 {
+				log.Info().Msg("Starting DHCP listener on interface")
+
+				handler := &Handler{
+					server: s,
+					iface:  iface.Name,
+				}
 
-			handler := &Handler{
-				server: s,
-				iface:  ifaceName,
+				server, err := server4.NewServer(iface.Name, laddr, handler.Handle)
+				if err != nil {
+					return fmt.Errorf("failed to create DHCP server for interface %s: %w", iface.Name, err)
+				}
+				s.servers = append(s.servers, server)
 			}
 
-			server, err := server4.NewServer(ifaceName, laddr, handler.Handle)
-			if err != nil {
-				return fmt.Errorf("failed to create DHCP server for interface %s: %w", ifaceName, err)
+			if iface.IPv6 {
+				log.Info().Msg("Starting DHCPv6 listener on interface")
+
+				if s.serverDUID == nil {
+					duid, err := newServerDUID(iface.Name)
+					if err != nil {
+						return fmt.Errorf("failed to create DHCPv6 server DUID: %w", err)
+					}
+					s.serverDUID = duid
+				}
+
+				handler := &Handler6{
+					server: s,
+					iface:  iface.Name,
+				}
+
+				server, err := server6.NewServer(iface.Name, nil, handler.Handle)
+				if err != nil {
+					return fmt.Errorf("failed to create DHCPv6 server for interface %s: %w", iface.Name, err)
+				}
+				s.servers6 = append(s.servers6, server)
 			}
-			s.servers = append(s.servers, server)
 		}
 	} else {
 		logger.Info().Msg("No interfaces configured, listening on all interfaces")
@@ -157,6 +274,13 @@ func (s *Server) Start(ctx context.Context) error {
 		s.servers = append(s.servers, server)
 	}
 
+	// Connect to the failover partner before answering clients
+	if s.failover != nil {
+		if err := s.failover.Start(ctx); err != nil {
+			return err
+		}
+	}
+
 	// Start expiry worker
 	s.wg.Add(1)
 	go s.expiryWorker(ctx)
@@ -181,6 +305,21 @@ func (s *Server) Start(ctx context.Context) error {
 		}(server)
 	}
 
+	for _, server := range s.servers6 {
+		s.wg.Add(1)
+		go func(server *server6.Server) {
+			defer s.wg.Done()
+			if err := server.Serve(); err != nil {
+				// Don't log error on shutdown
+				select {
+				case <-s.shutdown:
+				default:
+					logger.Error().Err(err).Msg("DHCPv6 server stopped with error")
+				}
+			}
+		}(server)
+	}
+
 	logger.Info().Msg("DHCP server started successfully")
 	return nil
 }
@@ -197,6 +336,16 @@ func (s *Server) Stop(ctx context.Context) error {
 		}
 	}
 
+	for _, server := range s.servers6 {
+		if err := server.Close(); err != nil {
+			logger.Error().Err(err).Msg("Error closing DHCPv6 server")
+		}
+	}
+
+	if s.failover != nil {
+		s.failover.Stop()
+	}
+
 	// Wait for workers to finish with timeout
 	done := make(chan struct{})
 	go func() {
@@ -220,64 +369,46 @@ func (s *Server) ReloadSubnets(cfg *config.Config) error {
 		Int("subnet_count", len(cfg.Subnets)).
 		Msg("Reloading subnet configuration")
 
-	// Build new subnet map
+	// Build new subnet maps
 	newSubnets := make(map[string]*SubnetConfig)
+	newSubnets6 := make(map[string]*SubnetConfig)
+	newShared := make(map[string][]*SubnetConfig)
 	for _, subnetCfg := range cfg.Subnets {
-		_, network, err := net.ParseCIDR(subnetCfg.Network)
+		subnet, err := newSubnetConfig(subnetCfg)
 		if err != nil {
-			return fmt.Errorf("invalid subnet %s: %w", subnetCfg.Network, err)
+			return err
 		}
 
-		// Parse DNS servers
-		var dnsServers []net.IP
-		for _, dnsStr := range subnetCfg.DNSServers {
-			dnsServers = append(dnsServers, net.ParseIP(dnsStr))
+		if subnetCfg.IsIPv6() {
+			newSubnets6[subnet.Network.String()] = subnet
+		} else {
+			newSubnets[subnet.Network.String()] = subnet
 		}
-
-		// Convert pools
-		var pools []*PoolConfig
-		for _, poolCfg := range subnetCfg.Pools {
-			pools = append(pools, &PoolConfig{
-				RangeStart: poolCfg.RangeStart,
-				RangeEnd:   poolCfg.RangeEnd,
-			})
-		}
-
-		// Extract boot settings from the subnet config
-		var tftpServer, bootFilename string
-		if subnetCfg.Boot != nil {
-			tftpServer = subnetCfg.Boot.TFTPServer
-			bootFilename = subnetCfg.Boot.Filename
-		}
-
-		subnet := &SubnetConfig{
-			Network:          network,
-			Description:      subnetCfg.Description,
-			Gateway:          net.ParseIP(subnetCfg.Gateway),
-			DNSServers:       dnsServers,
-			LeaseDuration:    subnetCfg.LeaseDuration,
-			MaxLeaseDuration: subnetCfg.MaxLeaseDuration,
-			Options:          subnetCfg.Options,
-			TFTPServer:       tftpServer,
-			BootFilename:     bootFilename,
-			Pools:            pools,
+		if subnet.SharedNetwork != "" {
+			newShared[subnet.SharedNetwork] = append(newShared[subnet.SharedNetwork], subnet)
 		}
 
-		newSubnets[network.String()] = subnet
-
 		logger.Debug().
-			Str("network", network.String()).
+			Str("network", subnet.Network.String()).
 			Str("description", subnet.Description).
 			Str("gateway", subnet.Gateway.String()).
-			Int("pools", len(pools)).
+			Int("pools", len(subnet.Pools)).
 			Msg("Loaded subnet")
 	}
 
+	newClasses, err := newClientClasses(cfg.ClientClasses)
+	if err != nil {
+		return err
+	}
+
 	// Atomically replace subnets
 	s.subnets = newSubnets
+	s.subnets6 = newSubnets6
+	s.shared = newShared
+	s.classes = newClasses
 
 	logger.Info().
-		Int("subnet_count", len(newSubnets)).
+		Int("subnet_count", len(newSubnets)+len(newSubnets6)).
 		Msg("Successfully reloaded subnet configuration")
 
 	return nil
@@ -0,0 +1,109 @@
+package dhcp
+
+import (
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// serverIdentifier returns the address sent in option 54 for a request
+// Clients unicast renewals to this address, so it must be one ironDHCP listens on.
+// Precedence: subnet server_identifier, interface server_identifier, the listening
+// interface's address on the client's network (or the address used to reach the relay),
+// then any address of the listening interface. The subnet gateway is a last resort.
+func (h *Handler) serverIdentifier(req *dhcpv4.DHCPv4, subnet *SubnetConfig) net.IP {
+	if subnet.ServerIdentifier != nil {
+		return subnet.ServerIdentifier
+	}
+	if id := h.server.interfaceServerIdentifier(h.iface); id != nil {
+		return id
+	}
+
+	addrs := interfaceAddrs(h.iface)
+	for _, addr := range addrs {
+		if subnet.Network.Contains(addr.IP) {
+			return addr.IP
+		}
+	}
+
+	// Relayed request: the relay forwards renewals to the address that reached it
+	if !req.GatewayIPAddr.IsUnspecified() {
+		if ip := localAddrFor(req.GatewayIPAddr); ip != nil {
+			return ip
+		}
+	}
+
+	if len(addrs) > 0 {
+		return addrs[0].IP
+	}
+
+	return subnet.Gateway
+}
+
+// nextServer returns the address for siaddr, the server clients fetch the boot file from
+// An explicit next_server wins; otherwise a TFTP server given as an address is used
+func nextServer(subnet *SubnetConfig, boot bootSelection) net.IP {
+	if subnet.NextServer != nil {
+		return subnet.NextServer
+	}
+	if ip := net.ParseIP(boot.tftpServer).To4(); ip != nil {
+		return ip
+	}
+	return net.IPv4zero
+}
+
+// interfaceServerIdentifier returns the server_identifier configured on an interface, if any
+func (s *Server) interfaceServerIdentifier(ifaceName string) net.IP {
+	for _, iface := range s.interfaces {
+		if iface.Name == ifaceName && iface.ServerIdentifier != "" {
+			return net.ParseIP(iface.ServerIdentifier).To4()
+		}
+	}
+	return nil
+}
+
+// interfaceAddrs returns the IPv4 addresses of an interface, or of all interfaces when
+// the listener is not bound to one
+func interfaceAddrs(ifaceName string) []*net.IPNet {
+	var addrs []net.Addr
+	if ifaceName == "" {
+		all, err := net.InterfaceAddrs()
+		if err != nil {
+			return nil
+		}
+		addrs = all
+	} else {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return nil
+		}
+		if addrs, err = iface.Addrs(); err != nil {
+			return nil
+		}
+	}
+
+	var result []*net.IPNet
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil || ipnet.IP.IsLoopback() {
+			continue
+		}
+		result = append(result, &net.IPNet{IP: ipnet.IP.To4(), Mask: ipnet.Mask})
+	}
+	return result
+}
+
+// localAddrFor returns the local address the kernel would use to reach dst
+// Connecting a UDP socket only performs a route lookup; nothing is sent
+func localAddrFor(dst net.IP) net.IP {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: dst, Port: dhcpv4.ServerPort})
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP.To4()
+	}
+	return nil
+}
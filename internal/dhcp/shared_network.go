@@ -0,0 +1,94 @@
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// sharedNetworkSubnets returns the subnets sharing a segment with the given subnet, in config order
+// A subnet outside any shared network is returned on its own
+func (s *Server) sharedNetworkSubnets(subnet *SubnetConfig) []*SubnetConfig {
+	if subnet.SharedNetwork == "" {
+		return []*SubnetConfig{subnet}
+	}
+	if members := s.shared[subnet.SharedNetwork]; len(members) > 0 {
+		return members
+	}
+	return []*SubnetConfig{subnet}
+}
+
+// subnetForAddress returns the member of the subnet's shared network containing ip
+// Falls back to the given subnet when no member contains it
+func (s *Server) subnetForAddress(subnet *SubnetConfig, ip net.IP) *SubnetConfig {
+	if ip == nil || ip.IsUnspecified() {
+		return subnet
+	}
+	for _, member := range s.sharedNetworkSubnets(subnet) {
+		if member.Network.Contains(ip) {
+			return member
+		}
+	}
+	return subnet
+}
+
+// allocateInSharedNetwork allocates a lease on the subnet's segment
+// An existing lease or reservation in any member subnet is honoured first; otherwise
+// member subnets are tried in config order until one has a free address.
+// The subnet the lease was allocated from is returned so replies carry its options.
+func (s *Server) allocateInSharedNetwork(ctx context.Context, req *AllocationRequest, subnet *SubnetConfig, classes []*ClientClass) (*storage.Lease, *SubnetConfig, error) {
+	members := s.sharedNetworkSubnets(subnet)
+
+	allocate := func(member *SubnetConfig) (*storage.Lease, error) {
+		memberReq := *req
+		memberReq.Subnet = member.Network
+		memberReq.Pools = poolsForClasses(member.Pools, classes)
+		memberReq.LeaseDuration = grantedLeaseDuration(member, classes, req.RequestedLeaseTime)
+		return s.allocator.AllocateIP(ctx, &memberReq)
+	}
+
+	if len(members) == 1 {
+		lease, err := allocate(subnet)
+		return lease, subnet, err
+	}
+
+	// Keep the client on the member subnet it already holds an address in
+	for _, member := range members {
+		lease, err := s.store.GetLeaseByMAC(ctx, req.MAC, member.Network)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check existing lease: %w", err)
+		}
+		reservation, err := s.allocator.FindReservation(ctx, req.MAC, req.CircuitID, req.RemoteID, member.Network)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check reservation: %w", err)
+		}
+		if (lease != nil && lease.IsActive()) || reservation != nil {
+			lease, err := allocate(member)
+			return lease, member, err
+		}
+	}
+
+	var lastErr error
+	for _, member := range members {
+		lease, err := allocate(member)
+		if errors.Is(err, errPoolExhausted) {
+			logger.Debug().
+				Err(err).
+				Str("shared_network", member.SharedNetwork).
+				Str("subnet", member.Network.String()).
+				Msg("Shared network member exhausted, trying next subnet")
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return lease, member, nil
+	}
+
+	return nil, nil, fmt.Errorf("no available IPs in shared network %s: %w", subnet.SharedNetwork, lastErr)
+}
@@ -0,0 +1,130 @@
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// Pool allocation strategies, selected with a pool's strategy field
+const (
+	StrategyRandom     = "random"     // Reuse the oldest expired lease, else a random never-used address
+	StrategySequential = "sequential" // Lowest never-used address, else the oldest expired lease
+	StrategyHashed     = "hashed"     // Address derived from the client MAC, so it survives a database wipe
+	StrategyLRU        = "lru"        // Never-used addresses first, then the oldest expired lease
+)
+
+// AllocationStrategy chooses the address a new client gets from a pool
+// Implementations combine the allocator's reuseExpiredLease, findNeverUsedIP and
+// claimAddress, and return nil, nil when the pool has nothing to offer. Existing
+// leases and reservations are handled before a strategy is consulted.
+type AllocationStrategy interface {
+	Name() string
+	Allocate(ctx context.Context, a *Allocator, req *AllocationRequest, pool *PoolConfig) (*storage.Lease, error)
+}
+
+// strategies holds the available strategies by name
+var strategies = map[string]AllocationStrategy{
+	StrategyRandom:     randomStrategy{},
+	StrategySequential: sequentialStrategy{},
+	StrategyHashed:     hashedStrategy{},
+	StrategyLRU:        lruStrategy{},
+}
+
+// strategyFor returns the named strategy, defaulting to StrategyRandom
+func strategyFor(name string) AllocationStrategy {
+	if strategy, ok := strategies[name]; ok {
+		return strategy
+	}
+	return strategies[StrategyRandom]
+}
+
+// randomStrategy recycles addresses before touching never-used ones, which are
+// picked at random so HA servers sharing a pool rarely contend for an address
+type randomStrategy struct{}
+
+func (randomStrategy) Name() string { return StrategyRandom }
+
+func (randomStrategy) Allocate(ctx context.Context, a *Allocator, req *AllocationRequest, pool *PoolConfig) (*storage.Lease, error) {
+	lease, err := a.reuseExpiredLease(ctx, req, pool)
+	if err != nil || lease != nil {
+		return lease, err
+	}
+	return a.findNeverUsedIP(ctx, req, pool, func(idx *poolIndex) (net.IP, bool) {
+		return idx.claim(a.ownsAddress)
+	})
+}
+
+// sequentialStrategy fills the pool from the bottom, which keeps lab networks easy to read
+// Freed addresses are reused, oldest first, once the pool has been filled.
+type sequentialStrategy struct{}
+
+func (sequentialStrategy) Name() string { return StrategySequential }
+
+func (sequentialStrategy) Allocate(ctx context.Context, a *Allocator, req *AllocationRequest, pool *PoolConfig) (*storage.Lease, error) {
+	lease, err := a.findNeverUsedIP(ctx, req, pool, func(idx *poolIndex) (net.IP, bool) {
+		return idx.claimFrom(0, a.ownsAddress)
+	})
+	if err != nil || lease != nil {
+		return lease, err
+	}
+	return a.reuseExpiredLease(ctx, req, pool)
+}
+
+// hashedStrategy gives each client a home address derived from its MAC
+// A client whose home address is free or reusable gets it, even after the lease
+// database is wiped; if it is taken the pool is searched onwards from the home
+// address. Any other failure to claim it, such as a database error, is returned.
+type hashedStrategy struct{}
+
+func (hashedStrategy) Name() string { return StrategyHashed }
+
+func (hashedStrategy) Allocate(ctx context.Context, a *Allocator, req *AllocationRequest, pool *PoolConfig) (*storage.Lease, error) {
+	idx, err := a.poolIndex(ctx, req.Subnet, pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pool index: %w", err)
+	}
+
+	h := fnv.New32a()
+	h.Write(req.MAC)
+	home := int(h.Sum32() % uint32(idx.size))
+
+	if ip := idx.address(home); a.ownsAddress(ip) {
+		lease, err := a.claimAddress(ctx, req, ip)
+		if err == nil {
+			idx.markUsed(ip)
+			return lease, nil
+		}
+		if !errors.Is(err, errAddressInUse) {
+			return nil, err
+		}
+	}
+
+	lease, err := a.findNeverUsedIP(ctx, req, pool, func(idx *poolIndex) (net.IP, bool) {
+		return idx.claimFrom(home, a.ownsAddress)
+	})
+	if err != nil || lease != nil {
+		return lease, err
+	}
+	return a.reuseExpiredLease(ctx, req, pool)
+}
+
+// lruStrategy hands out never-used addresses before recycling the oldest expired
+// lease, so an address stays unused for as long as possible after a client leaves
+type lruStrategy struct{}
+
+func (lruStrategy) Name() string { return StrategyLRU }
+
+func (lruStrategy) Allocate(ctx context.Context, a *Allocator, req *AllocationRequest, pool *PoolConfig) (*storage.Lease, error) {
+	lease, err := a.findNeverUsedIP(ctx, req, pool, func(idx *poolIndex) (net.IP, bool) {
+		return idx.claim(a.ownsAddress)
+	})
+	if err != nil || lease != nil {
+		return lease, err
+	}
+	return a.reuseExpiredLease(ctx, req, pool)
+}
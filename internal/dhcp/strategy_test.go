@@ -0,0 +1,116 @@
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+func TestSequentialStrategyFillsFromBottom(t *testing.T) {
+	ctx := context.Background()
+	allocator := NewAllocator(storage.NewMemoryStore(), 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.20", Strategy: StrategySequential}
+
+	for i, mac := range []string{"00:00:00:00:00:01", "00:00:00:00:00:02", "00:00:00:00:00:03"} {
+		lease, err := allocator.AllocateIP(ctx, testAllocationRequest(t, mac, pool))
+		if err != nil {
+			t.Fatalf("AllocateIP(%s): %v", mac, err)
+		}
+		if want := byte(10 + i); lease.IP.To4()[3] != want {
+			t.Errorf("client %d got %s, want 192.168.1.%d", i, lease.IP, want)
+		}
+	}
+}
+
+func TestHashedStrategyIsStableAcrossStores(t *testing.T) {
+	ctx := context.Background()
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.200", Strategy: StrategyHashed}
+	mac := "00:11:22:33:44:55"
+
+	// A wiped database must hand the client the same address again
+	first, err := NewAllocator(storage.NewMemoryStore(), 100, "test", false).
+		AllocateIP(ctx, testAllocationRequest(t, mac, pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	second, err := NewAllocator(storage.NewMemoryStore(), 100, "test", false).
+		AllocateIP(ctx, testAllocationRequest(t, mac, pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if !first.IP.Equal(second.IP) {
+		t.Errorf("hashed allocation moved from %s to %s", first.IP, second.IP)
+	}
+}
+
+func TestHashedStrategyProbesPastTakenHome(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	allocator := NewAllocator(store, 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.11", Strategy: StrategyHashed}
+
+	seen := make(map[string]bool)
+	for _, mac := range []string{"00:00:00:00:00:01", "00:00:00:00:00:02"} {
+		lease, err := allocator.AllocateIP(ctx, testAllocationRequest(t, mac, pool))
+		if err != nil {
+			t.Fatalf("AllocateIP(%s): %v", mac, err)
+		}
+		if seen[lease.IP.String()] {
+			t.Fatalf("%s was handed out twice", lease.IP)
+		}
+		seen[lease.IP.String()] = true
+	}
+}
+
+func TestHashedStrategyReturnsHomeStoreError(t *testing.T) {
+	ctx := context.Background()
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.200", Strategy: StrategyHashed}
+	mac := "00:11:22:33:44:55"
+
+	home, err := NewAllocator(storage.NewMemoryStore(), 100, "test", false).
+		AllocateIP(ctx, testAllocationRequest(t, mac, pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+
+	// A database error on the home address must not move the client elsewhere
+	store := &failingLeaseStore{Backend: storage.NewMemoryStore(), err: errors.New("connection refused"), ip: home.IP}
+	lease, err := NewAllocator(store, 100, "test", false).AllocateIP(ctx, testAllocationRequest(t, mac, pool))
+	if !errors.Is(err, store.err) {
+		t.Errorf("got %v (%v), want the store error", lease, err)
+	}
+}
+
+func TestLRUStrategyPrefersNeverUsedAddresses(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	allocator := NewAllocator(store, 100, "test", false)
+	pool := &PoolConfig{RangeStart: "192.168.1.10", RangeEnd: "192.168.1.11", Strategy: StrategyLRU}
+
+	first, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:00:00:00:00:01", pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if err := store.ReleaseLease(ctx, first.IP, first.Subnet); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+
+	// The released address waits while a never-used one is left
+	second, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:00:00:00:00:02", pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if second.IP.Equal(first.IP) {
+		t.Errorf("lru reused released %s while a never-used address was free", first.IP)
+	}
+
+	third, err := allocator.AllocateIP(ctx, testAllocationRequest(t, "00:00:00:00:00:03", pool))
+	if err != nil {
+		t.Fatalf("AllocateIP: %v", err)
+	}
+	if !third.IP.Equal(first.IP) {
+		t.Errorf("third client got %s, want the released %s", third.IP, first.IP)
+	}
+}
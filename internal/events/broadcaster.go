@@ -23,6 +23,7 @@ const (
 	EventTypeDHCPRelease  EventType = "dhcp_release"
 	EventTypeDHCPDecline  EventType = "dhcp_decline"
 	EventTypeLeaseExpired EventType = "lease_expired"
+	EventTypeIPConflict   EventType = "ip_conflict"
 	EventTypeGitSync      EventType = "git_sync"
 )
 
@@ -0,0 +1,45 @@
+package failover
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestLoadBalanceMixTableIsPermutation(t *testing.T) {
+	var seen [256]bool
+	for i, v := range loadBalanceMixTable {
+		if seen[v] {
+			t.Fatalf("value %d repeated at index %d", v, i)
+		}
+		seen[v] = true
+	}
+}
+
+func TestLoadBalanceHash(t *testing.T) {
+	// Worked through the RFC 3074 section 6 reference code, which starts from
+	// the key length and mixes in bytes from the last to the first
+	tests := []struct {
+		name string
+		key  string // hex
+		want uint8
+	}{
+		{name: "empty key", key: "", want: 0},
+		{name: "single zero byte", key: "00", want: 175},         // T[1^0x00]
+		{name: "two bytes, last first", key: "0102", want: 170},  // T[T[2^0x02]^0x01] = T[251^1]
+		{name: "ethernet chaddr", key: "aabbccddeeff", want: 57}, // First-to-last order would give 21
+		{name: "low chaddr", key: "000000000001", want: 153},
+		{name: "client identifier with hardware type", key: "01aabbccddeeff", want: 102},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := hex.DecodeString(tt.key)
+			if err != nil {
+				t.Fatalf("bad test key %q: %v", tt.key, err)
+			}
+			if got := LoadBalanceHash(key); got != tt.want {
+				t.Errorf("LoadBalanceHash(%s) = %d, want %d", tt.key, got, tt.want)
+			}
+		})
+	}
+}
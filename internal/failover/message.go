@@ -0,0 +1,183 @@
+package failover
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// Message types exchanged between peers, one JSON object per line
+const (
+	messageHello     = "hello"
+	messageHeartbeat = "heartbeat"
+	messageLease     = "lease"
+)
+
+// nonceSize is the length of the challenge the accepting peer sends on each connection
+const nonceSize = 32
+
+// errBadSignature is returned for a frame not signed with the shared secret
+var errBadSignature = errors.New("invalid frame signature")
+
+// challenge is the first and only thing the accepting peer sends
+// Every frame on the connection is signed over its nonce, so frames cannot be replayed on another connection
+type challenge struct {
+	Nonce []byte `json:"nonce"`
+}
+
+// frame is a signed message on the failover connection
+type frame struct {
+	Seq  uint64          `json:"seq"`
+	Body json.RawMessage `json:"body"`
+	MAC  []byte          `json:"mac"`
+}
+
+// message is the payload of a single frame
+type message struct {
+	Type     string     `json:"type"`
+	ServerID string     `json:"server_id,omitempty"`
+	Role     string     `json:"role,omitempty"`
+	Split    *int       `json:"split,omitempty"`
+	Lease    *wireLease `json:"lease,omitempty"`
+}
+
+// frameSigner signs the frames sent on one connection, or verifies the frames received on it
+// The shared secret itself never goes on the wire.
+type frameSigner struct {
+	secret []byte
+	nonce  []byte
+	seq    uint64
+}
+
+func newFrameSigner(secret string, nonce []byte) *frameSigner {
+	return &frameSigner{secret: []byte(secret), nonce: nonce}
+}
+
+// sum returns HMAC-SHA256(secret, nonce || seq || body)
+func (f *frameSigner) sum(seq uint64, body []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(f.nonce)
+	binary.Write(mac, binary.BigEndian, seq)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// sign wraps a message in the next frame
+func (f *frameSigner) sign(msg *message) (*frame, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := &frame{Seq: f.seq, Body: body, MAC: f.sum(f.seq, body)}
+	f.seq++
+	return signed, nil
+}
+
+// verify checks that a frame is the next one in sequence and was signed with the secret, then decodes it
+func (f *frameSigner) verify(signed *frame) (*message, error) {
+	if signed.Seq != f.seq {
+		return nil, fmt.Errorf("unexpected frame sequence %d, want %d", signed.Seq, f.seq)
+	}
+	if !hmac.Equal(signed.MAC, f.sum(signed.Seq, signed.Body)) {
+		return nil, errBadSignature
+	}
+	f.seq++
+
+	var msg message
+	if err := json.Unmarshal(signed.Body, &msg); err != nil {
+		return nil, fmt.Errorf("invalid frame: %w", err)
+	}
+	return &msg, nil
+}
+
+// wireLease is the replicated form of a storage.Lease
+// Database IDs are local to each peer and are not sent
+type wireLease struct {
+	IP          string     `json:"ip"`
+	MAC         string     `json:"mac"`
+	Hostname    string     `json:"hostname,omitempty"`
+	Subnet      string     `json:"subnet"`
+	IssuedAt    time.Time  `json:"issued_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	LastSeen    time.Time  `json:"last_seen"`
+	State       string     `json:"state"`
+	ClientID    string     `json:"client_id,omitempty"`
+	VendorClass string     `json:"vendor_class,omitempty"`
+	UserClass   string     `json:"user_class,omitempty"`
+	AllocatedBy string     `json:"allocated_by,omitempty"`
+	CircuitID   string     `json:"circuit_id,omitempty"`
+	RemoteID    string     `json:"remote_id,omitempty"`
+	DeclinedAt  *time.Time `json:"declined_at,omitempty"`
+	DeclinedBy  string     `json:"declined_by,omitempty"`
+}
+
+// newWireLease converts a lease for replication
+func newWireLease(lease *storage.Lease) *wireLease {
+	return &wireLease{
+		IP:          lease.IP.String(),
+		MAC:         lease.MAC.String(),
+		Hostname:    lease.Hostname,
+		Subnet:      lease.Subnet.String(),
+		IssuedAt:    lease.IssuedAt,
+		ExpiresAt:   lease.ExpiresAt,
+		LastSeen:    lease.LastSeen,
+		State:       string(lease.State),
+		ClientID:    lease.ClientID,
+		VendorClass: lease.VendorClass,
+		UserClass:   lease.UserClass,
+		AllocatedBy: lease.AllocatedBy,
+		CircuitID:   lease.CircuitID,
+		RemoteID:    lease.RemoteID,
+		DeclinedAt:  lease.DeclinedAt,
+		DeclinedBy:  lease.DeclinedBy,
+	}
+}
+
+// lease converts a replicated lease back into its storage form
+func (w *wireLease) lease() (*storage.Lease, error) {
+	ip := net.ParseIP(w.IP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid lease IP %q", w.IP)
+	}
+	mac, err := net.ParseMAC(w.MAC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lease MAC %q: %w", w.MAC, err)
+	}
+	_, subnet, err := net.ParseCIDR(w.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lease subnet %q: %w", w.Subnet, err)
+	}
+
+	switch storage.LeaseState(w.State) {
+	case storage.LeaseStateActive, storage.LeaseStateExpired, storage.LeaseStateReleased, storage.LeaseStateDeclined:
+	default:
+		return nil, fmt.Errorf("invalid lease state %q", w.State)
+	}
+
+	return &storage.Lease{
+		IP:          ip,
+		MAC:         mac,
+		Hostname:    w.Hostname,
+		Subnet:      subnet,
+		IssuedAt:    w.IssuedAt,
+		ExpiresAt:   w.ExpiresAt,
+		LastSeen:    w.LastSeen,
+		State:       storage.LeaseState(w.State),
+		ClientID:    w.ClientID,
+		VendorClass: w.VendorClass,
+		UserClass:   w.UserClass,
+		AllocatedBy: w.AllocatedBy,
+		CircuitID:   w.CircuitID,
+		RemoteID:    w.RemoteID,
+		DeclinedAt:  w.DeclinedAt,
+		DeclinedBy:  w.DeclinedBy,
+	}, nil
+}
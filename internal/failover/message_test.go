@@ -0,0 +1,171 @@
+package failover
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+func TestWireLeaseRoundTrip(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	declinedAt := now.Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		lease storage.Lease
+	}{
+		{
+			name: "active lease with relay information",
+			lease: storage.Lease{
+				IP:          net.ParseIP("192.168.1.10"),
+				MAC:         mac,
+				Hostname:    "laptop",
+				Subnet:      subnet,
+				IssuedAt:    now.Add(-time.Hour),
+				ExpiresAt:   now.Add(time.Hour),
+				LastSeen:    now,
+				State:       storage.LeaseStateActive,
+				ClientID:    "01aabbccddeeff",
+				VendorClass: "MSFT 5.0",
+				UserClass:   "office",
+				AllocatedBy: "dhcp-01",
+				CircuitID:   "eth0/1",
+				RemoteID:    "switch-1",
+			},
+		},
+		{
+			name: "declined lease keeps the decliner",
+			lease: storage.Lease{
+				IP:         net.ParseIP("192.168.1.11"),
+				MAC:        mac,
+				Subnet:     subnet,
+				IssuedAt:   now.Add(-time.Hour),
+				ExpiresAt:  now.Add(24 * time.Hour),
+				LastSeen:   now,
+				State:      storage.LeaseStateDeclined,
+				DeclinedAt: &declinedAt,
+				DeclinedBy: mac.String(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(newWireLease(&tt.lease))
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var w wireLease
+			if err := json.Unmarshal(data, &w); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			got, err := w.lease()
+			if err != nil {
+				t.Fatalf("lease: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.lease) {
+				t.Errorf("round trip\n got  %+v\n want %+v", *got, tt.lease)
+			}
+		})
+	}
+}
+
+func TestWireLeaseRejectsInvalid(t *testing.T) {
+	valid := wireLease{IP: "192.168.1.10", MAC: "aa:bb:cc:dd:ee:ff", Subnet: "192.168.1.0/24", State: "active"}
+
+	tests := []struct {
+		name   string
+		modify func(*wireLease)
+	}{
+		{name: "bad IP", modify: func(w *wireLease) { w.IP = "192.168.1" }},
+		{name: "bad MAC", modify: func(w *wireLease) { w.MAC = "not-a-mac" }},
+		{name: "bad subnet", modify: func(w *wireLease) { w.Subnet = "192.168.1.0" }},
+		{name: "unknown state", modify: func(w *wireLease) { w.State = "stolen" }},
+	}
+
+	if _, err := valid.lease(); err != nil {
+		t.Fatalf("valid lease rejected: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := valid
+			tt.modify(&w)
+			if _, err := w.lease(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestFrameSigner(t *testing.T) {
+	nonce := bytes.Repeat([]byte{1}, nonceSize)
+	otherNonce := bytes.Repeat([]byte{2}, nonceSize)
+
+	tests := []struct {
+		name    string
+		secret  string
+		nonce   []byte
+		tamper  func(*frame)
+		wantErr bool
+	}{
+		{name: "valid frame", secret: "s3cret", nonce: nonce},
+		{name: "wrong secret", secret: "guess", nonce: nonce, wantErr: true},
+		{name: "frame from another connection", secret: "s3cret", nonce: otherNonce, wantErr: true},
+		{
+			name:    "modified body",
+			secret:  "s3cret",
+			nonce:   nonce,
+			tamper:  func(f *frame) { f.Body = []byte(`{"type":"heartbeat"}`) },
+			wantErr: true,
+		},
+		{
+			name:    "replayed sequence",
+			secret:  "s3cret",
+			nonce:   nonce,
+			tamper:  func(f *frame) { f.Seq = 0 },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := newFrameSigner(tt.secret, tt.nonce)
+			verifier := newFrameSigner("s3cret", nonce)
+
+			// Both sides have already exchanged one frame
+			first, _ := signer.sign(&message{Type: messageHeartbeat})
+			verifier.verify(first)
+
+			signed, err := signer.sign(&message{Type: messageHello, ServerID: "dhcp-01"})
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(signed)
+			}
+
+			msg, err := verifier.verify(signed)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected the frame to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if msg.Type != messageHello || msg.ServerID != "dhcp-01" {
+				t.Errorf("decoded %+v", msg)
+			}
+		})
+	}
+
+}
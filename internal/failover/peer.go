@@ -0,0 +1,474 @@
+package failover
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// State describes what a node currently knows about its partner
+type State string
+
+const (
+	// StateNormal means the partner is reachable and each node serves its own half
+	StateNormal State = "normal"
+	// StateCommunicationsInterrupted means the partner is silent but may still be serving clients
+	StateCommunicationsInterrupted State = "communications-interrupted"
+	// StatePartnerDown means the partner has been silent past the timeout and this node serves everyone
+	StatePartnerDown State = "partner-down"
+)
+
+const (
+	updateQueueSize = 4096             // Lease updates buffered while the partner is slow or away
+	writeTimeout    = 10 * time.Second // Per-message write deadline on the partner connection
+)
+
+// Peer replicates leases to a failover partner and decides which clients
+// and free addresses this node is responsible for
+type Peer struct {
+	cfg      config.FailoverConfig
+	serverID string
+	store    storage.LeaseStore
+	primary  bool
+	split    int // Hash buckets served by the primary
+
+	updates chan *storage.Lease
+	resync  atomic.Bool // Set when an update was dropped; the next heartbeat resends every lease
+
+	mu          sync.RWMutex
+	state       State
+	lastContact time.Time
+	conns       map[net.Conn]struct{}
+	stopped     bool
+
+	listener net.Listener
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New creates a failover peer from the server's failover settings
+func New(cfg config.FailoverConfig, serverID string, store storage.LeaseStore) *Peer {
+	split := 128
+	if cfg.Split != nil {
+		split = *cfg.Split
+	}
+
+	return &Peer{
+		cfg:      cfg,
+		serverID: serverID,
+		store:    store,
+		primary:  cfg.Role == "primary",
+		split:    split,
+		updates:  make(chan *storage.Lease, updateQueueSize),
+		state:    StateCommunicationsInterrupted,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Start listens for the partner, connects to it and begins monitoring its health
+func (p *Peer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", p.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen for failover partner on %s: %w", p.cfg.Listen, err)
+	}
+	p.listener = listener
+
+	// The partner gets the full timeout after startup before we take over its clients
+	p.mu.Lock()
+	p.lastContact = time.Now()
+	p.mu.Unlock()
+
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	logger.Info().
+		Str("role", p.cfg.Role).
+		Str("listen", p.cfg.Listen).
+		Str("peer", p.cfg.Peer).
+		Int("split", p.split).
+		Dur("partner_down_timeout", p.cfg.PartnerDownTimeout).
+		Msg("Starting DHCP failover")
+
+	p.wg.Add(3)
+	go p.acceptLoop(ctx)
+	go p.sendLoop(ctx)
+	go p.monitorLoop(ctx)
+
+	return nil
+}
+
+// Stop closes the partner connections and waits for the failover goroutines to exit
+func (p *Peer) Stop() {
+	logger.Info().Msg("Stopping DHCP failover")
+
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if p.listener != nil {
+		p.listener.Close()
+	}
+
+	p.mu.Lock()
+	p.stopped = true
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// State returns the current partner state
+func (p *Peer) State() State {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.state
+}
+
+// ServesClient reports whether this node should answer a client with the given
+// load balancing key (RFC 3074). The primary serves buckets below the split.
+func (p *Peer) ServesClient(key []byte) bool {
+	if p.State() == StatePartnerDown {
+		return true
+	}
+
+	bucket := int(LoadBalanceHash(key))
+	if p.primary {
+		return bucket < p.split
+	}
+	return bucket >= p.split
+}
+
+// OwnsAddress reports whether this node may hand out a free address
+// Free addresses are split by the same hash as clients, applied to the address,
+// so each node gets a share of the pool in proportion to the clients it serves
+// and the peers never offer the same one
+func (p *Peer) OwnsAddress(ip net.IP) bool {
+	if p.State() == StatePartnerDown {
+		return true
+	}
+
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return true
+	}
+	bucket := int(LoadBalanceHash(ip4))
+	if p.primary {
+		return bucket < p.split
+	}
+	return bucket >= p.split
+}
+
+// LeaseUpdated queues a lease for replication to the partner
+// It never blocks; if the queue is full the partner is resynchronised in full later
+func (p *Peer) LeaseUpdated(lease *storage.Lease) {
+	select {
+	case p.updates <- lease:
+	default:
+		p.resync.Store(true)
+	}
+}
+
+// acceptLoop accepts connections from the partner
+func (p *Peer) acceptLoop(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error().Err(err).Msg("Failed to accept failover connection")
+			continue
+		}
+
+		p.wg.Add(1)
+		go p.receive(ctx, conn)
+	}
+}
+
+// receive applies lease updates sent by the partner
+func (p *Peer) receive(ctx context.Context, conn net.Conn) {
+	defer p.wg.Done()
+	if !p.track(conn) {
+		return
+	}
+	defer p.untrack(conn)
+
+	log := logger.With().Str("remote", conn.RemoteAddr().String()).Logger()
+	readTimeout := 3 * p.cfg.HeartbeatInterval
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		log.Error().Err(err).Msg("Failed to generate failover challenge")
+		return
+	}
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := json.NewEncoder(conn).Encode(&challenge{Nonce: nonce}); err != nil {
+		log.Warn().Err(err).Msg("Failed to send failover challenge")
+		return
+	}
+
+	verifier := newFrameSigner(p.cfg.SharedSecret, nonce)
+	decoder := json.NewDecoder(conn)
+	next := func() (*message, error) {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+		var signed frame
+		if err := decoder.Decode(&signed); err != nil {
+			return nil, err
+		}
+		return verifier.verify(&signed)
+	}
+
+	hello, err := next()
+	if errors.Is(err, errBadSignature) {
+		log.Warn().Msg("Rejected failover connection with wrong shared secret")
+		return
+	}
+	if err != nil || hello.Type != messageHello {
+		log.Warn().Err(err).Msg("Failover partner did not send hello")
+		return
+	}
+	if hello.Role == p.cfg.Role {
+		log.Error().Str("role", hello.Role).Msg("Failover partner has the same role, both nodes must not be primary or secondary")
+		return
+	}
+	if hello.Split == nil || *hello.Split != p.split {
+		log.Error().Int("split", p.split).Msg("Failover partner has a different split, both nodes must use the same one")
+		return
+	}
+
+	log.Info().Str("partner", hello.ServerID).Msg("Failover partner connected")
+	p.markContact()
+
+	for {
+		msg, err := next()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warn().Err(err).Msg("Failover partner connection closed")
+			}
+			return
+		}
+		p.markContact()
+
+		if msg.Type == messageLease && msg.Lease != nil {
+			p.applyLease(ctx, msg.Lease)
+		}
+	}
+}
+
+// applyLease stores a lease received from the partner
+func (p *Peer) applyLease(ctx context.Context, w *wireLease) {
+	lease, err := w.lease()
+	if err != nil {
+		logger.Warn().Err(err).Msg("Ignoring invalid lease from failover partner")
+		return
+	}
+
+	if err := p.store.ApplyReplicatedLease(ctx, lease); err != nil {
+		logger.Error().
+			Err(err).
+			Str("ip", lease.IP.String()).
+			Msg("Failed to apply lease from failover partner")
+	}
+}
+
+// sendLoop keeps an outbound connection to the partner open and streams lease updates over it
+func (p *Peer) sendLoop(ctx context.Context) {
+	defer p.wg.Done()
+
+	dialer := net.Dialer{Timeout: p.cfg.HeartbeatInterval}
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", p.cfg.Peer)
+		if err == nil && p.track(conn) {
+			err = p.stream(ctx, conn)
+			p.untrack(conn)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Debug().
+			Err(err).
+			Str("peer", p.cfg.Peer).
+			Msg("Failover partner unreachable, retrying")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.cfg.HeartbeatInterval):
+		}
+	}
+}
+
+// stream answers the partner's challenge with a signed hello, then sends every
+// known lease followed by incremental updates and heartbeats
+func (p *Peer) stream(ctx context.Context, conn net.Conn) error {
+	var c challenge
+	conn.SetReadDeadline(time.Now().Add(writeTimeout))
+	if err := json.NewDecoder(conn).Decode(&c); err != nil {
+		return fmt.Errorf("failed to read failover challenge: %w", err)
+	}
+	if len(c.Nonce) != nonceSize {
+		return fmt.Errorf("invalid failover challenge")
+	}
+
+	signer := newFrameSigner(p.cfg.SharedSecret, c.Nonce)
+	encoder := json.NewEncoder(conn)
+	send := func(msg *message) error {
+		signed, err := signer.sign(msg)
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return encoder.Encode(signed)
+	}
+
+	hello := &message{
+		Type:     messageHello,
+		ServerID: p.serverID,
+		Role:     p.cfg.Role,
+		Split:    &p.split,
+	}
+	if err := send(hello); err != nil {
+		return err
+	}
+
+	// Anything may have changed while we were apart, so start with a full sync
+	p.resync.Store(false)
+	if err := p.sendAll(ctx, send); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(p.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case lease := <-p.updates:
+			if err := send(&message{Type: messageLease, Lease: newWireLease(lease)}); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if p.resync.Swap(false) {
+				if err := p.sendAll(ctx, send); err != nil {
+					return err
+				}
+			}
+			if err := send(&message{Type: messageHeartbeat}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendAll replicates every lease in the local database
+func (p *Peer) sendAll(ctx context.Context, send func(*message) error) error {
+	leases, err := p.store.GetAllLeases(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load leases for failover sync: %w", err)
+	}
+
+	for _, lease := range leases {
+		if err := send(&message{Type: messageLease, Lease: newWireLease(lease)}); err != nil {
+			return err
+		}
+	}
+
+	logger.Info().
+		Int("leases", len(leases)).
+		Str("peer", p.cfg.Peer).
+		Msg("Sent full lease sync to failover partner")
+
+	return nil
+}
+
+// monitorLoop moves to communications-interrupted and then partner-down as the partner stays silent
+func (p *Peer) monitorLoop(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkPartner()
+		}
+	}
+}
+
+// checkPartner updates the partner state from the time since it was last heard from
+func (p *Peer) checkPartner() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	silence := time.Since(p.lastContact)
+	next := p.state
+	switch {
+	case silence >= p.cfg.PartnerDownTimeout:
+		next = StatePartnerDown
+	case p.state == StateNormal && silence > 3*p.cfg.HeartbeatInterval:
+		next = StateCommunicationsInterrupted
+	}
+
+	if next != p.state {
+		logger.Warn().
+			Str("from", string(p.state)).
+			Str("to", string(next)).
+			Dur("silence", silence).
+			Msg("Failover partner state changed")
+		p.state = next
+	}
+}
+
+// markContact records that the partner was heard from
+func (p *Peer) markContact() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastContact = time.Now()
+	if p.state != StateNormal {
+		logger.Info().
+			Str("from", string(p.state)).
+			Str("to", string(StateNormal)).
+			Msg("Failover partner state changed")
+		p.state = StateNormal
+	}
+}
+
+// track registers a connection so Stop can close it; it refuses once stopping
+func (p *Peer) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		conn.Close()
+		return false
+	}
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack closes and forgets a connection
+func (p *Peer) untrack(conn net.Conn) {
+	p.mu.Lock()
+	delete(p.conns, conn)
+	p.mu.Unlock()
+	conn.Close()
+}
@@ -0,0 +1,196 @@
+package failover
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+func testFailoverConfig(role, secret string, split int) config.FailoverConfig {
+	return config.FailoverConfig{
+		Enabled:            true,
+		Role:               role,
+		SharedSecret:       secret,
+		Split:              &split,
+		HeartbeatInterval:  50 * time.Millisecond,
+		PartnerDownTimeout: time.Hour,
+	}
+}
+
+func TestPeerSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		split int
+	}{
+		{name: "even split", split: 128},
+		{name: "primary takes most", split: 200},
+		{name: "secondary serves everyone", split: 0},
+		{name: "primary serves everyone", split: 256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := New(testFailoverConfig("primary", "s3cret", tt.split), "dhcp-01", nil)
+			secondary := New(testFailoverConfig("secondary", "s3cret", tt.split), "dhcp-02", nil)
+
+			// Every client and every free address belongs to exactly one peer
+			clients := 0
+			for i := 0; i < 4096; i++ {
+				key := []byte{0xaa, 0xbb, 0xcc, 0xdd, byte(i >> 8), byte(i)}
+				if primary.ServesClient(key) == secondary.ServesClient(key) {
+					t.Fatalf("client %x is served by both or neither peer", key)
+				}
+				if primary.ServesClient(key) {
+					clients++
+				}
+			}
+
+			addresses := 0
+			for i := 0; i < 4096; i++ {
+				ip := net.IPv4(10, 0, byte(i>>8), byte(i))
+				if primary.OwnsAddress(ip) == secondary.OwnsAddress(ip) {
+					t.Fatalf("address %s is owned by both or neither peer", ip)
+				}
+				if primary.OwnsAddress(ip) {
+					addresses++
+				}
+			}
+
+			// The primary's share of free addresses follows its share of clients
+			want := 4096 * tt.split / 256
+			for name, got := range map[string]int{"clients": clients, "addresses": addresses} {
+				if got < want-4096/20 || got > want+4096/20 {
+					t.Errorf("primary has %d of 4096 %s, want about %d", got, name, want)
+				}
+			}
+
+			// In partner-down a peer serves everyone from the whole pool
+			secondary.state = StatePartnerDown
+			if !secondary.ServesClient([]byte{0x01}) || !secondary.OwnsAddress(net.IPv4(10, 0, 0, 1)) {
+				t.Error("partner-down peer must serve every client and address")
+			}
+		})
+	}
+}
+
+func TestCheckPartner(t *testing.T) {
+	heartbeat := 5 * time.Second
+	tests := []struct {
+		name    string
+		state   State
+		silence time.Duration
+		want    State
+	}{
+		{name: "normal stays normal", state: StateNormal, silence: heartbeat, want: StateNormal},
+		{name: "normal is interrupted after three heartbeats", state: StateNormal, silence: 4 * heartbeat, want: StateCommunicationsInterrupted},
+		{name: "interrupted waits for the timeout", state: StateCommunicationsInterrupted, silence: 30 * time.Minute, want: StateCommunicationsInterrupted},
+		{name: "interrupted becomes partner-down", state: StateCommunicationsInterrupted, silence: time.Hour, want: StatePartnerDown},
+		{name: "normal becomes partner-down", state: StateNormal, silence: 2 * time.Hour, want: StatePartnerDown},
+		{name: "partner-down stays partner-down", state: StatePartnerDown, silence: time.Hour, want: StatePartnerDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testFailoverConfig("primary", "s3cret", 128)
+			cfg.HeartbeatInterval = heartbeat
+			p := New(cfg, "dhcp-01", nil)
+			p.state = tt.state
+			p.lastContact = time.Now().Add(-tt.silence)
+
+			p.checkPartner()
+			if got := p.State(); got != tt.want {
+				t.Errorf("state %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Hearing from the partner always returns to normal
+	p := New(testFailoverConfig("primary", "s3cret", 128), "dhcp-01", nil)
+	p.state = StatePartnerDown
+	p.markContact()
+	if p.State() != StateNormal {
+		t.Errorf("state after contact %s, want %s", p.State(), StateNormal)
+	}
+}
+
+func TestPeerLink(t *testing.T) {
+	tests := []struct {
+		name        string
+		secret      string
+		split       int
+		wantApplied bool
+	}{
+		{name: "matching secret and split", secret: "s3cret", split: 128, wantApplied: true},
+		{name: "wrong secret is rejected", secret: "guess", split: 128},
+		{name: "different split is rejected", secret: "s3cret", split: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			senderStore := storage.NewMemoryStore()
+			_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+			mac, _ := net.ParseMAC("00:00:00:00:00:01")
+			if err := senderStore.CreateLease(ctx, &storage.Lease{
+				IP:        net.ParseIP("192.168.1.10").To4(),
+				MAC:       mac,
+				Subnet:    subnet,
+				IssuedAt:  time.Now(),
+				ExpiresAt: time.Now().Add(time.Hour),
+				LastSeen:  time.Now(),
+				State:     storage.LeaseStateActive,
+			}); err != nil {
+				t.Fatalf("CreateLease: %v", err)
+			}
+
+			receiverStore := storage.NewMemoryStore()
+			sender := New(testFailoverConfig("primary", tt.secret, tt.split), "dhcp-01", senderStore)
+			receiver := New(testFailoverConfig("secondary", "s3cret", 128), "dhcp-02", receiverStore)
+
+			client, server := net.Pipe()
+			defer client.Close()
+			receiver.wg.Add(1)
+			go receiver.receive(ctx, server)
+			go sender.stream(ctx, client)
+
+			applied := false
+			deadline := time.Now().Add(time.Second)
+			for !applied && time.Now().Before(deadline) {
+				leases, err := receiverStore.GetAllLeases(ctx)
+				if err != nil {
+					t.Fatalf("GetAllLeases: %v", err)
+				}
+				applied = len(leases) == 1
+				if !tt.wantApplied {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if tt.wantApplied {
+				if !applied {
+					t.Fatal("lease was not replicated")
+				}
+				if receiver.State() != StateNormal {
+					t.Errorf("receiver state %s, want %s", receiver.State(), StateNormal)
+				}
+			} else {
+				// The receiver hangs up once it rejects the hello
+				receiver.wg.Wait()
+				leases, _ := receiverStore.GetAllLeases(ctx)
+				if len(leases) != 0 {
+					t.Errorf("rejected partner replicated %d leases", len(leases))
+				}
+			}
+
+			cancel()
+			receiver.Stop()
+		})
+	}
+}
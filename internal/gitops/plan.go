@@ -0,0 +1,511 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// Change actions in a Plan
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Plan describes what applying a config would change, without changing anything
+type Plan struct {
+	CommitHash     string              `json:"commit_hash,omitempty"`
+	Subnets        []SubnetChange      `json:"subnets"`
+	Reservations   []ReservationChange `json:"reservations"`
+	OrphanedLeases []OrphanedLease     `json:"orphaned_leases"`
+	Destructive    bool                `json:"destructive"` // Removes subnets or reservations, or orphans active leases
+}
+
+// SubnetChange is a subnet added, removed or changed
+type SubnetChange struct {
+	Network      string        `json:"network"`
+	Action       string        `json:"action"`
+	Fields       []FieldChange `json:"fields,omitempty"` // Settings, options and pool settings that differ
+	PoolsAdded   []string      `json:"pools_added,omitempty"`
+	PoolsRemoved []string      `json:"pools_removed,omitempty"`
+}
+
+// FieldChange is one setting that differs, named by its YAML path
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// ReservationChange is a reservation that would be created, updated or deleted
+type ReservationChange struct {
+	Action   string        `json:"action"`
+	Key      string        `json:"key"` // MAC, plus relay circuit/remote ID if set
+	Subnet   string        `json:"subnet"`
+	IP       string        `json:"ip"`
+	Hostname string        `json:"hostname,omitempty"`
+	Fields   []FieldChange `json:"fields,omitempty"` // Only for updates
+}
+
+// OrphanedLease is an active lease the new config no longer covers
+// The client keeps the address until it renews and is refused.
+type OrphanedLease struct {
+	IP        string    `json:"ip"`
+	MAC       string    `json:"mac"`
+	Hostname  string    `json:"hostname,omitempty"`
+	Subnet    string    `json:"subnet"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Reason    string    `json:"reason"`
+}
+
+// HasChanges reports whether applying the config would change anything
+func (p *Plan) HasChanges() bool {
+	return len(p.Subnets) > 0 || len(p.Reservations) > 0
+}
+
+// BuildPlan compares a proposed config with the running one and the database
+// Subnet changes are relative to current; reservation changes and orphaned
+// leases are computed against the stored reservations and leases.
+func BuildPlan(ctx context.Context, store storage.Backend, current, proposed []config.SubnetConfig) (*Plan, error) {
+	plan := &Plan{
+		Subnets:        diffSubnets(current, proposed),
+		Reservations:   []ReservationChange{},
+		OrphanedLeases: []OrphanedLease{},
+	}
+
+	existing, err := store.GetAllReservations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing reservations: %w", err)
+	}
+	plan.Reservations = diffReservations(existing, proposed).changes
+
+	leases, err := store.GetAllLeases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leases: %w", err)
+	}
+	plan.OrphanedLeases = orphanedLeases(leases, proposed, time.Now())
+
+	for _, change := range plan.Subnets {
+		plan.Destructive = plan.Destructive || change.Action == ChangeDelete
+	}
+	for _, change := range plan.Reservations {
+		plan.Destructive = plan.Destructive || change.Action == ChangeDelete
+	}
+	plan.Destructive = plan.Destructive || len(plan.OrphanedLeases) > 0
+
+	return plan, nil
+}
+
+// diffSubnets lists subnets added, removed or changed, in network order
+func diffSubnets(current, proposed []config.SubnetConfig) []SubnetChange {
+	before := subnetsByNetwork(current)
+	after := subnetsByNetwork(proposed)
+
+	changes := []SubnetChange{}
+	for network, old := range before {
+		if _, ok := after[network]; !ok {
+			changes = append(changes, SubnetChange{Network: old.Network, Action: ChangeDelete})
+		}
+	}
+	for network, subnet := range after {
+		old, ok := before[network]
+		if !ok {
+			change := SubnetChange{Network: subnet.Network, Action: ChangeAdd}
+			for _, pool := range subnet.Pools {
+				change.PoolsAdded = append(change.PoolsAdded, poolRange(pool))
+			}
+			changes = append(changes, change)
+			continue
+		}
+		if change := diffSubnet(old, subnet); change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Network < changes[j].Network })
+	return changes
+}
+
+// diffSubnet compares two versions of a subnet, returning nil if they match
+// Reservations are left to diffReservations, which compares against the database.
+func diffSubnet(old, new *config.SubnetConfig) *SubnetChange {
+	change := &SubnetChange{Network: new.Network, Action: ChangeUpdate}
+
+	oldSettings, newSettings := *old, *new
+	oldSettings.Pools, newSettings.Pools = nil, nil
+	oldSettings.Reservations, newSettings.Reservations = nil, nil
+	change.Fields = diffFields(flattenFields(oldSettings), flattenFields(newSettings))
+
+	oldPools := make(map[string]config.PoolConfig)
+	for _, pool := range old.Pools {
+		oldPools[poolRange(pool)] = pool
+	}
+	for _, pool := range new.Pools {
+		key := poolRange(pool)
+		oldPool, ok := oldPools[key]
+		if !ok {
+			change.PoolsAdded = append(change.PoolsAdded, key)
+			continue
+		}
+		delete(oldPools, key)
+
+		for _, field := range diffFields(flattenFields(oldPool), flattenFields(pool)) {
+			field.Field = "pools[" + key + "]." + field.Field
+			change.Fields = append(change.Fields, field)
+		}
+	}
+	for key := range oldPools {
+		change.PoolsRemoved = append(change.PoolsRemoved, key)
+	}
+	sort.Strings(change.PoolsRemoved)
+
+	if len(change.Fields) == 0 && len(change.PoolsAdded) == 0 && len(change.PoolsRemoved) == 0 {
+		return nil
+	}
+	return change
+}
+
+// subnetsByNetwork indexes subnets by their normalized network
+func subnetsByNetwork(subnets []config.SubnetConfig) map[string]*config.SubnetConfig {
+	index := make(map[string]*config.SubnetConfig, len(subnets))
+	for i := range subnets {
+		index[networkKey(subnets[i].Network)] = &subnets[i]
+	}
+	return index
+}
+
+// networkKey normalizes a CIDR so 192.168.1.1/24 and 192.168.1.0/24 match
+func networkKey(network string) string {
+	if _, ipnet, err := net.ParseCIDR(network); err == nil {
+		return ipnet.String()
+	}
+	return network
+}
+
+// poolRange names a pool by its address range
+func poolRange(pool config.PoolConfig) string {
+	return pool.RangeStart + "-" + pool.RangeEnd
+}
+
+// flattenFields renders a config struct as YAML path to value
+// Unset fields are left out, so adding or clearing a setting shows up as a change.
+func flattenFields(v interface{}) map[string]string {
+	fields := make(map[string]string)
+	flattenValue("", reflect.ValueOf(v), fields)
+	return fields
+}
+
+func flattenValue(path string, v reflect.Value, fields map[string]string) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			flattenValue(path, v.Elem(), fields)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if name == "" || name == "-" || !t.Field(i).IsExported() {
+				continue
+			}
+			flattenValue(joinPath(path, name), v.Field(i), fields)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			flattenValue(joinPath(path, fmt.Sprint(key.Interface())), v.MapIndex(key), fields)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			flattenValue(fmt.Sprintf("%s[%d]", path, i), v.Index(i), fields)
+		}
+	default:
+		if v.IsZero() {
+			return
+		}
+		if d, ok := v.Interface().(time.Duration); ok {
+			fields[path] = d.String()
+			return
+		}
+		fields[path] = fmt.Sprint(v.Interface())
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// diffFields lists the fields whose values differ, sorted by path
+func diffFields(old, new map[string]string) []FieldChange {
+	var changes []FieldChange
+	for field, value := range old {
+		if newValue, ok := new[field]; !ok || newValue != value {
+			changes = append(changes, FieldChange{Field: field, Old: value, New: newValue})
+		}
+	}
+	for field, value := range new {
+		if _, ok := old[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, New: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// reservationDiff is the set of writes that brings stored reservations in line with a config
+type reservationDiff struct {
+	create   []*storage.Reservation
+	update   []*storage.Reservation // Stored rows carrying the new values
+	previous []*storage.Reservation // The rows update replaces, in the same order
+	remove   []*storage.Reservation
+	changes  []ReservationChange
+}
+
+// storageChanges returns the writes in the form the store applies them
+func (d *reservationDiff) storageChanges() *storage.ReservationChanges {
+	return &storage.ReservationChanges{Create: d.create, Update: d.update, Delete: d.remove}
+}
+
+// revertChanges returns the writes that undo storageChanges once applied
+// Deleted reservations come back with new IDs.
+func (d *reservationDiff) revertChanges() *storage.ReservationChanges {
+	revert := &storage.ReservationChanges{Update: d.previous, Delete: d.create}
+	for _, res := range d.remove {
+		restored := *res
+		restored.ID = 0
+		revert.Create = append(revert.Create, &restored)
+	}
+	return revert
+}
+
+// diffReservations compares stored reservations with those in a config
+func diffReservations(existing []*storage.Reservation, subnets []config.SubnetConfig) *reservationDiff {
+	diff := &reservationDiff{}
+
+	existingMap := make(map[string]*storage.Reservation)
+	for _, res := range existing {
+		existingMap[res.Key()] = res
+	}
+
+	for _, subnetCfg := range subnets {
+		_, network, _ := config.ParseCIDR(subnetCfg.Network)
+
+		for _, resCfg := range subnetCfg.Reservations {
+			want := reservationFromConfig(resCfg, network)
+			key := want.Key()
+
+			existingRes, found := existingMap[key]
+			if !found {
+				diff.create = append(diff.create, want)
+				diff.changes = append(diff.changes, reservationChange(ChangeAdd, want, nil))
+				continue
+			}
+			delete(existingMap, key)
+
+			fields := diffFields(reservationFields(existingRes), reservationFields(want))
+			if len(fields) == 0 {
+				continue
+			}
+
+			want.ID = existingRes.ID
+			diff.update = append(diff.update, want)
+			diff.previous = append(diff.previous, existingRes)
+			diff.changes = append(diff.changes, reservationChange(ChangeUpdate, want, fields))
+		}
+	}
+
+	for _, res := range existingMap {
+		diff.remove = append(diff.remove, res)
+		diff.changes = append(diff.changes, reservationChange(ChangeDelete, res, nil))
+	}
+	sort.Slice(diff.remove, func(i, j int) bool { return diff.remove[i].Key() < diff.remove[j].Key() })
+
+	// Keep config order for adds and updates, then deletes by key
+	sort.SliceStable(diff.changes, func(i, j int) bool {
+		di, dj := diff.changes[i].Action == ChangeDelete, diff.changes[j].Action == ChangeDelete
+		if di && dj {
+			return diff.changes[i].Key < diff.changes[j].Key
+		}
+		return !di && dj
+	})
+
+	return diff
+}
+
+// reservationFromConfig builds the stored form of a configured reservation
+func reservationFromConfig(resCfg config.ReservationConfig, network *net.IPNet) *storage.Reservation {
+	mac, _ := config.ParseMAC(resCfg.MAC)
+
+	res := &storage.Reservation{
+		MAC:         mac,
+		CircuitID:   resCfg.CircuitID,
+		RemoteID:    resCfg.RemoteID,
+		IP:          config.ParseIP(resCfg.IP),
+		Hostname:    resCfg.Hostname,
+		Subnet:      network,
+		Description: resCfg.Description,
+	}
+	if resCfg.Boot != nil {
+		res.TFTPServer = resCfg.Boot.TFTPServer
+		res.BootFilename = resCfg.Boot.Filename
+		res.BootRules = storage.BootRulesFromConfig(resCfg.Boot)
+	}
+	return res
+}
+
+// reservationFields renders the synced fields of a reservation for comparison
+func reservationFields(res *storage.Reservation) map[string]string {
+	fields := map[string]string{
+		"ip":          res.IP.String(),
+		"hostname":    res.Hostname,
+		"description": res.Description,
+		"circuit_id":  res.CircuitID,
+		"remote_id":   res.RemoteID,
+		"tftp_server": res.TFTPServer,
+		"filename":    res.BootFilename,
+	}
+	if res.Subnet != nil {
+		fields["subnet"] = res.Subnet.String()
+	}
+	for i, rule := range res.BootRules {
+		for field, value := range flattenFields(config.BootRuleConfig(rule)) {
+			fields[fmt.Sprintf("boot.rules[%d].%s", i, field)] = value
+		}
+	}
+
+	for field, value := range fields {
+		if value == "" {
+			delete(fields, field)
+		}
+	}
+	return fields
+}
+
+func reservationChange(action string, res *storage.Reservation, fields []FieldChange) ReservationChange {
+	change := ReservationChange{
+		Action:   action,
+		Key:      res.Key(),
+		IP:       res.IP.String(),
+		Hostname: res.Hostname,
+		Fields:   fields,
+	}
+	if res.Subnet != nil {
+		change.Subnet = res.Subnet.String()
+	}
+	return change
+}
+
+// orphanedLeases finds active leases the proposed subnets no longer cover
+// A lease is covered if its address is in one of its subnet's pools or reserved
+// for the same client.
+func orphanedLeases(leases []*storage.Lease, subnets []config.SubnetConfig, now time.Time) []OrphanedLease {
+	index := subnetsByNetwork(subnets)
+
+	orphans := []OrphanedLease{}
+	for _, lease := range leases {
+		if lease.State != storage.LeaseStateActive || !lease.ExpiresAt.After(now) || lease.Subnet == nil {
+			continue
+		}
+
+		reason := ""
+		subnet := index[lease.Subnet.String()]
+		if subnet == nil {
+			reason = "subnet removed"
+		} else {
+			reason = leaseNotCovered(subnet, lease)
+		}
+		if reason == "" {
+			continue
+		}
+
+		orphans = append(orphans, OrphanedLease{
+			IP:        lease.IP.String(),
+			MAC:       lease.MAC.String(),
+			Hostname:  lease.Hostname,
+			Subnet:    lease.Subnet.String(),
+			ExpiresAt: lease.ExpiresAt,
+			Reason:    reason,
+		})
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(orphans[i].IP).To16(), net.ParseIP(orphans[j].IP).To16()) < 0
+	})
+	return orphans
+}
+
+// leaseNotCovered explains why a subnet no longer covers a lease, or returns ""
+func leaseNotCovered(subnet *config.SubnetConfig, lease *storage.Lease) string {
+	for _, res := range subnet.Reservations {
+		if !config.ParseIP(res.IP).Equal(lease.IP) {
+			continue
+		}
+		if res.MAC == "" {
+			// Relay agent reservations match like GetReservationByRelayAgent: an empty remote_id matches any
+			if lease.CircuitID != res.CircuitID || (res.RemoteID != "" && lease.RemoteID != res.RemoteID) {
+				return "reserved for " + storage.ReservationKey(nil, res.CircuitID, res.RemoteID)
+			}
+			return ""
+		}
+		if mac, err := config.ParseMAC(res.MAC); err == nil && !bytes.Equal(mac, lease.MAC) {
+			return "reserved for " + mac.String()
+		}
+		return ""
+	}
+
+	ip := lease.IP.To16()
+	for _, pool := range subnet.Pools {
+		start, end := net.ParseIP(pool.RangeStart).To16(), net.ParseIP(pool.RangeEnd).To16()
+		if start != nil && end != nil && bytes.Compare(ip, start) >= 0 && bytes.Compare(ip, end) <= 0 {
+			return ""
+		}
+	}
+	return "outside every pool"
+}
+
+// activeConfigFile is the form subnets are recorded in by RecordActiveConfig
+type activeConfigFile struct {
+	Subnets []config.SubnetConfig `yaml:"subnets"`
+}
+
+// RecordActiveConfig stores the subnets just applied, for plans to compare against
+func RecordActiveConfig(ctx context.Context, store storage.GitSyncStore, commitHash string, subnets []config.SubnetConfig) error {
+	data, err := yaml.Marshal(activeConfigFile{Subnets: subnets})
+	if err != nil {
+		return fmt.Errorf("failed to marshal active config: %w", err)
+	}
+
+	return store.SetActiveConfig(ctx, &storage.ActiveConfig{
+		CommitHash: commitHash,
+		AppliedAt:  time.Now(),
+		ConfigYAML: string(data),
+	})
+}
+
+// ActiveSubnets returns the subnets recorded by RecordActiveConfig
+// Returns nil if no configuration has been recorded yet.
+func ActiveSubnets(ctx context.Context, store storage.GitSyncStore) ([]config.SubnetConfig, *storage.ActiveConfig, error) {
+	active, err := store.GetActiveConfig(ctx)
+	if err != nil || active == nil {
+		return nil, nil, err
+	}
+
+	var file activeConfigFile
+	if err := yaml.Unmarshal([]byte(active.ConfigYAML), &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse active config: %w", err)
+	}
+	return file.Subnets, active, nil
+}
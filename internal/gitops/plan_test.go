@@ -0,0 +1,268 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+func TestBuildPlan(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	current := []config.SubnetConfig{
+		{
+			Network:       "192.168.1.0/24",
+			LeaseDuration: time.Hour,
+			Pools:         []config.PoolConfig{{RangeStart: "192.168.1.100", RangeEnd: "192.168.1.200"}},
+			Reservations: []config.ReservationConfig{
+				{MAC: "aa:bb:cc:dd:ee:01", IP: "192.168.1.10", Hostname: "printer"},
+				{MAC: "aa:bb:cc:dd:ee:02", IP: "192.168.1.11", Hostname: "nas"},
+			},
+		},
+		{
+			Network: "10.0.0.0/24",
+			Pools:   []config.PoolConfig{{RangeStart: "10.0.0.100", RangeEnd: "10.0.0.200"}},
+		},
+	}
+	proposed := []config.SubnetConfig{
+		{
+			Network:       "192.168.1.0/24",
+			LeaseDuration: 2 * time.Hour,
+			Pools:         []config.PoolConfig{{RangeStart: "192.168.1.100", RangeEnd: "192.168.1.150"}},
+			Reservations: []config.ReservationConfig{
+				{MAC: "aa:bb:cc:dd:ee:01", IP: "192.168.1.12", Hostname: "printer"},
+				{MAC: "aa:bb:cc:dd:ee:03", IP: "192.168.1.120", Hostname: "camera"},
+			},
+		},
+		{
+			Network: "172.16.0.0/24",
+			Pools:   []config.PoolConfig{{RangeStart: "172.16.0.100", RangeEnd: "172.16.0.200"}},
+		},
+	}
+
+	for _, subnet := range current {
+		_, network, _ := config.ParseCIDR(subnet.Network)
+		for _, res := range subnet.Reservations {
+			if err := store.CreateReservation(ctx, reservationFromConfig(res, network)); err != nil {
+				t.Fatalf("CreateReservation: %v", err)
+			}
+		}
+	}
+
+	addLease := func(ip, mac, network string, expires time.Time) {
+		t.Helper()
+		hw, _ := net.ParseMAC(mac)
+		_, subnet, _ := net.ParseCIDR(network)
+		if err := store.CreateLease(ctx, &storage.Lease{
+			IP:        net.ParseIP(ip).To4(),
+			MAC:       hw,
+			Subnet:    subnet,
+			IssuedAt:  time.Now(),
+			ExpiresAt: expires,
+			State:     storage.LeaseStateActive,
+		}); err != nil {
+			t.Fatalf("CreateLease: %v", err)
+		}
+	}
+	later := time.Now().Add(time.Hour)
+	addLease("192.168.1.110", "00:00:00:00:00:01", "192.168.1.0/24", later) // Still in the pool
+	addLease("192.168.1.180", "00:00:00:00:00:02", "192.168.1.0/24", later) // Pool shrunk
+	addLease("192.168.1.120", "00:00:00:00:00:03", "192.168.1.0/24", later) // Now reserved for a camera
+	addLease("10.0.0.150", "00:00:00:00:00:04", "10.0.0.0/24", later)       // Subnet removed
+	addLease("10.0.0.151", "00:00:00:00:00:05", "10.0.0.0/24", time.Now().Add(-time.Hour))
+
+	plan, err := BuildPlan(ctx, store, current, proposed)
+	if err != nil {
+		t.Fatalf("BuildPlan: %v", err)
+	}
+
+	if len(plan.Subnets) != 3 {
+		t.Fatalf("got %d subnet changes, want 3: %+v", len(plan.Subnets), plan.Subnets)
+	}
+	subnetActions := map[string]string{}
+	for _, change := range plan.Subnets {
+		subnetActions[change.Network] = change.Action
+	}
+	if subnetActions["10.0.0.0/24"] != ChangeDelete || subnetActions["172.16.0.0/24"] != ChangeAdd ||
+		subnetActions["192.168.1.0/24"] != ChangeUpdate {
+		t.Errorf("subnet actions %v", subnetActions)
+	}
+
+	for _, change := range plan.Subnets {
+		if change.Network != "192.168.1.0/24" {
+			continue
+		}
+		if len(change.Fields) != 1 || change.Fields[0] != (FieldChange{Field: "lease_duration", Old: "1h0m0s", New: "2h0m0s"}) {
+			t.Errorf("field changes %+v", change.Fields)
+		}
+		if len(change.PoolsAdded) != 1 || change.PoolsAdded[0] != "192.168.1.100-192.168.1.150" ||
+			len(change.PoolsRemoved) != 1 || change.PoolsRemoved[0] != "192.168.1.100-192.168.1.200" {
+			t.Errorf("pools added %v, removed %v", change.PoolsAdded, change.PoolsRemoved)
+		}
+	}
+
+	reservationActions := map[string]string{}
+	for _, change := range plan.Reservations {
+		reservationActions[change.Key] = change.Action
+		if change.Action == ChangeUpdate && (len(change.Fields) != 1 || change.Fields[0].Field != "ip") {
+			t.Errorf("update fields %+v", change.Fields)
+		}
+	}
+	want := map[string]string{
+		"aa:bb:cc:dd:ee:01": ChangeUpdate,
+		"aa:bb:cc:dd:ee:02": ChangeDelete,
+		"aa:bb:cc:dd:ee:03": ChangeAdd,
+	}
+	if len(reservationActions) != len(want) {
+		t.Errorf("reservation changes %v, want %v", reservationActions, want)
+	}
+	for key, action := range want {
+		if reservationActions[key] != action {
+			t.Errorf("reservation %s: action %q, want %q", key, reservationActions[key], action)
+		}
+	}
+
+	orphans := map[string]string{}
+	for _, lease := range plan.OrphanedLeases {
+		orphans[lease.IP] = lease.Reason
+	}
+	wantOrphans := map[string]string{
+		"10.0.0.150":    "subnet removed",
+		"192.168.1.120": "reserved for aa:bb:cc:dd:ee:03",
+		"192.168.1.180": "outside every pool",
+	}
+	if len(orphans) != len(wantOrphans) {
+		t.Errorf("orphaned leases %v, want %v", orphans, wantOrphans)
+	}
+	for ip, reason := range wantOrphans {
+		if orphans[ip] != reason {
+			t.Errorf("lease %s: reason %q, want %q", ip, orphans[ip], reason)
+		}
+	}
+
+	if !plan.Destructive {
+		t.Error("plan should be destructive")
+	}
+}
+
+func TestLeaseNotCovered(t *testing.T) {
+	subnet := &config.SubnetConfig{
+		Network: "192.168.1.0/24",
+		Pools:   []config.PoolConfig{{RangeStart: "192.168.1.100", RangeEnd: "192.168.1.200"}},
+		Reservations: []config.ReservationConfig{
+			{MAC: "aa:bb:cc:dd:ee:01", IP: "192.168.1.10"},
+			{CircuitID: "eth0/1", IP: "192.168.1.20"},
+			{CircuitID: "eth0/2", RemoteID: "switch1", IP: "192.168.1.21"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		mac       string
+		circuitID string
+		remoteID  string
+		want      string
+	}{
+		{"in pool", "192.168.1.150", "00:00:00:00:00:01", "", "", ""},
+		{"outside pools", "192.168.1.250", "00:00:00:00:00:01", "", "", "outside every pool"},
+		{"MAC reservation holder", "192.168.1.10", "aa:bb:cc:dd:ee:01", "", "", ""},
+		{"MAC reservation other client", "192.168.1.10", "00:00:00:00:00:01", "", "", "reserved for aa:bb:cc:dd:ee:01"},
+		{"circuit reservation holder", "192.168.1.20", "00:00:00:00:00:01", "eth0/1", "any", ""},
+		{"circuit reservation other port", "192.168.1.20", "00:00:00:00:00:01", "eth0/9", "", "reserved for relay:eth0/1|"},
+		{"circuit reservation without relay info", "192.168.1.20", "00:00:00:00:00:01", "", "", "reserved for relay:eth0/1|"},
+		{"remote reservation holder", "192.168.1.21", "00:00:00:00:00:01", "eth0/2", "switch1", ""},
+		{"remote reservation other relay", "192.168.1.21", "00:00:00:00:00:01", "eth0/2", "switch2", "reserved for relay:eth0/2|switch1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac, _ := net.ParseMAC(tt.mac)
+			lease := &storage.Lease{IP: net.ParseIP(tt.ip).To4(), MAC: mac, CircuitID: tt.circuitID, RemoteID: tt.remoteID}
+			if got := leaseNotCovered(subnet, lease); got != tt.want {
+				t.Errorf("leaseNotCovered = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPlanWithoutChanges(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	subnets := []config.SubnetConfig{{
+		Network: "192.168.1.0/24",
+		Options: map[string]string{"ntp_servers": "192.168.1.1"},
+		Pools:   []config.PoolConfig{{RangeStart: "192.168.1.100", RangeEnd: "192.168.1.200"}},
+	}}
+
+	plan, err := BuildPlan(ctx, store, subnets, subnets)
+	if err != nil {
+		t.Fatalf("BuildPlan: %v", err)
+	}
+	if plan.HasChanges() || plan.Destructive {
+		t.Errorf("identical configs produced %+v", plan)
+	}
+
+	// An added option shows up under its YAML path
+	changed := []config.SubnetConfig{subnets[0]}
+	changed[0].Options = map[string]string{"ntp_servers": "192.168.1.1", "domain_name": "lan"}
+	plan, err = BuildPlan(ctx, store, subnets, changed)
+	if err != nil {
+		t.Fatalf("BuildPlan: %v", err)
+	}
+	if len(plan.Subnets) != 1 || len(plan.Subnets[0].Fields) != 1 ||
+		plan.Subnets[0].Fields[0] != (FieldChange{Field: "options.domain_name", New: "lan"}) {
+		t.Errorf("subnet changes %+v", plan.Subnets)
+	}
+	if plan.Destructive {
+		t.Error("adding an option is not destructive")
+	}
+}
+
+func TestPlanDoesNotApply(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// The sync recorded what it applied
+	active, _, err := ActiveSubnets(ctx, remote.store)
+	if err != nil {
+		t.Fatalf("ActiveSubnets: %v", err)
+	}
+	if len(active) != 1 || active[0].Reservations[0].IP != "192.168.1.10" {
+		t.Fatalf("active subnets %+v", active)
+	}
+
+	head := commitFile(t, remote.repo, remote.dir, "dhcp.yaml", testSubnetConfig("192.168.1.20"))
+
+	plan, err := remote.sync.Plan(ctx, "", nil)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if plan.CommitHash != head {
+		t.Errorf("planned commit %s, want %s", plan.CommitHash, head)
+	}
+	if len(plan.Reservations) != 1 || plan.Reservations[0].Action != ChangeUpdate || plan.Reservations[0].IP != "192.168.1.20" {
+		t.Errorf("reservation changes %+v", plan.Reservations)
+	}
+	if plan.Destructive {
+		t.Error("moving a reservation is not destructive")
+	}
+	if ip := remote.reservedIP(t); ip != "192.168.1.10" {
+		t.Errorf("plan changed the reservation to %s", ip)
+	}
+
+	if _, err := remote.sync.Plan(ctx, "", []byte("subnets: []\n")); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("empty config: got %v, want ErrInvalidConfig", err)
+	}
+}
@@ -32,6 +32,11 @@ func (p *Poller) Start(ctx context.Context) error {
 		Dur("interval", p.pollInterval).
 		Msg("Starting Git repository poller")
 
+	// A rollback pin outlives restarts
+	if err := p.syncService.RestorePin(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to restore Git rollback pin")
+	}
+
 	// Perform initial sync
 	logger.Info().Msg("Performing initial Git sync")
 	if _, err := p.syncService.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
@@ -106,11 +111,38 @@ func (p *Poller) performSync(ctx context.Context) {
 	}
 }
 
-// TriggerSync manually triggers a sync operation
-func (p *Poller) TriggerSync(ctx context.Context, triggeredByUser string) (*SyncResult, error) {
+// TriggerSync runs a sync outside the polling loop
+// trigger records where the request came from, e.g. the API or a push webhook.
+func (p *Poller) TriggerSync(ctx context.Context, trigger storage.GitSyncTrigger, triggeredByUser string) (*SyncResult, error) {
+	logger.Info().
+		Str("trigger", string(trigger)).
+		Str("user", triggeredByUser).
+		Msg("Git sync triggered")
+
+	return p.syncService.Sync(ctx, trigger, triggeredByUser)
+}
+
+// Rollback applies the config from an earlier commit and pins the server to it
+func (p *Poller) Rollback(ctx context.Context, commit string, triggeredByUser string) (*SyncResult, error) {
 	logger.Info().
+		Str("commit", commit).
 		Str("user", triggeredByUser).
-		Msg("Manual Git sync triggered")
+		Msg("Git rollback triggered")
+
+	return p.syncService.Rollback(ctx, commit, triggeredByUser)
+}
+
+// Unpin releases a rollback pin and syncs the head of the branch
+func (p *Poller) Unpin(ctx context.Context, triggeredByUser string) (*SyncResult, error) {
+	return p.syncService.Unpin(ctx, triggeredByUser)
+}
+
+// Plan reports what syncing a config would change, without applying it
+func (p *Poller) Plan(ctx context.Context, commit string, data []byte) (*Plan, error) {
+	return p.syncService.Plan(ctx, commit, data)
+}
 
-	return p.syncService.Sync(ctx, storage.GitSyncTriggerManual, triggeredByUser)
+// PinnedCommit returns the commit the server is pinned to, or "" if it follows the branch
+func (p *Poller) PinnedCommit() string {
+	return p.syncService.PinnedCommit()
 }
@@ -2,18 +2,28 @@ package gitops
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/sashakarcz/irondhcp/internal/logger"
 )
 
+// ErrCommitNotFound is returned when a commit is in neither the clone nor the remote branch
+var ErrCommitNotFound = errors.New("commit not found")
+
 // RepositoryConfig holds configuration for Git repository operations
 type RepositoryConfig struct {
 	URL              string
@@ -22,6 +32,10 @@ type RepositoryConfig struct {
 	Username         string
 	Password         string
 	PrivateKeyPath   string
+	PrivateKeyPass   string // Passphrase for an encrypted PrivateKeyPath
+	SSHAgent         bool   // Authenticate with the keys held by $SSH_AUTH_SOCK
+	SSHUser          string // Defaults to the user in URL, then "git"
+	KnownHostsPath   string // Pinned host keys; defaults to ~/.ssh/known_hosts
 	ConfigFilePath   string // Path to config file within repo (e.g., "config.yaml")
 	PollInterval     time.Duration
 	AutoSync         bool
@@ -97,12 +111,11 @@ func (r *Repository) clone(ctx context.Context) error {
 	}
 
 	// Add authentication if configured
-	if r.config.Username != "" && r.config.Password != "" {
-		cloneOptions.Auth = &http.BasicAuth{
-			Username: r.config.Username,
-			Password: r.config.Password,
-		}
+	auth, err := r.authMethod()
+	if err != nil {
+		return err
 	}
+	cloneOptions.Auth = auth
 
 	// Clone the repository
 	repo, err := git.PlainCloneContext(ctx, r.config.LocalPath, false, cloneOptions)
@@ -119,6 +132,74 @@ func (r *Repository) clone(ctx context.Context) error {
 	return nil
 }
 
+// authMethod builds the credentials for the remote, or nil for anonymous access
+// SSH keys are read on every call so a rotated key is picked up without a restart.
+func (r *Repository) authMethod() (transport.AuthMethod, error) {
+	switch {
+	case r.config.PrivateKeyPath != "" || r.config.SSHAgent:
+		return r.sshAuth()
+	case r.config.Username != "" && r.config.Password != "":
+		return &http.BasicAuth{
+			Username: r.config.Username,
+			Password: r.config.Password,
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// sshAuth builds public-key credentials from the key file or the SSH agent
+// With KnownHostsPath set, only the host keys pinned there are accepted.
+func (r *Repository) sshAuth() (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(r.config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	// The credentials' user wins over the URL's, so fall back to the URL's
+	user := r.config.SSHUser
+	if user == "" {
+		user = endpoint.User
+	}
+	if user == "" {
+		user = "git"
+	}
+
+	var auth transport.AuthMethod
+	var helper *gitssh.HostKeyCallbackHelper
+	if r.config.PrivateKeyPath != "" {
+		keys, err := gitssh.NewPublicKeysFromFile(user, r.config.PrivateKeyPath, r.config.PrivateKeyPass)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH key %s: %w", r.config.PrivateKeyPath, err)
+		}
+		auth, helper = keys, &keys.HostKeyCallbackHelper
+	} else {
+		agent, err := gitssh.NewSSHAgentAuth(user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+		}
+		auth, helper = agent, &agent.HostKeyCallbackHelper
+	}
+
+	if r.config.KnownHostsPath != "" {
+		db, err := gitssh.NewKnownHostsDb(r.config.KnownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known hosts %s: %w", r.config.KnownHostsPath, err)
+		}
+
+		port := endpoint.Port
+		if port <= 0 {
+			port = gitssh.DefaultPort
+		}
+
+		// Negotiate a host key type that is actually pinned for this host
+		helper.HostKeyCallback = db.HostKeyCallback()
+		helper.HostKeyAlgorithms = db.HostKeyAlgorithms(net.JoinHostPort(endpoint.Host, strconv.Itoa(port)))
+	}
+
+	return auth, nil
+}
+
 // Pull pulls the latest changes from the remote repository
 func (r *Repository) Pull(ctx context.Context) (*CommitInfo, bool, error) {
 	if r.repo == nil {
@@ -146,12 +227,11 @@ func (r *Repository) Pull(ctx context.Context) (*CommitInfo, bool, error) {
 	}
 
 	// Add authentication if configured
-	if r.config.Username != "" && r.config.Password != "" {
-		pullOptions.Auth = &http.BasicAuth{
-			Username: r.config.Username,
-			Password: r.config.Password,
-		}
+	auth, err := r.authMethod()
+	if err != nil {
+		return nil, false, err
 	}
+	pullOptions.Auth = auth
 
 	// Pull changes
 	err = worktree.PullContext(ctx, pullOptions)
@@ -195,6 +275,32 @@ func (r *Repository) Pull(ctx context.Context) (*CommitInfo, bool, error) {
 	return commitInfo, hasChanges, nil
 }
 
+// Fetch updates the remote-tracking branch without touching the worktree
+// It returns the ref to read the fetched config from with ReadConfigAt.
+func (r *Repository) Fetch(ctx context.Context) (string, error) {
+	if r.repo == nil {
+		return "", fmt.Errorf("repository not initialized")
+	}
+
+	auth, err := r.authMethod()
+	if err != nil {
+		return "", err
+	}
+
+	remoteRef := "refs/remotes/origin/" + r.config.Branch
+	err = r.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(r.config.Branch), remoteRef))},
+		Depth:      1,
+		Auth:       auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return "", fmt.Errorf("failed to fetch: %w", err)
+	}
+
+	return remoteRef, nil
+}
+
 // GetCurrentCommit returns information about the current HEAD commit
 func (r *Repository) GetCurrentCommit() (*CommitInfo, error) {
 	if r.repo == nil {
@@ -221,6 +327,92 @@ func (r *Repository) GetCurrentCommit() (*CommitInfo, error) {
 	}, nil
 }
 
+// ReadConfigAt returns the config file as it was at a commit
+// hash may be abbreviated if the commit is already in the local clone. A full
+// hash missing from the shallow clone is fetched from the remote first.
+func (r *Repository) ReadConfigAt(ctx context.Context, hash string) ([]byte, *CommitInfo, error) {
+	if r.repo == nil {
+		return nil, nil, fmt.Errorf("repository not initialized")
+	}
+
+	commitHash, err := r.repo.ResolveRevision(plumbing.Revision(hash))
+	if err != nil || !r.hasCommit(*commitHash) {
+		if !plumbing.IsHash(hash) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrCommitNotFound, hash)
+		}
+		if err := r.fetchCommit(ctx, hash); err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch commit %s: %w", hash, err)
+		}
+		h := plumbing.NewHash(hash)
+		commitHash = &h
+	}
+
+	commit, err := r.repo.CommitObject(*commitHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get commit %s: %w", hash, err)
+	}
+
+	file, err := commit.File(r.config.ConfigFilePath)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil, fmt.Errorf("%w: %s not found at commit %s", ErrInvalidConfig, r.config.ConfigFilePath, commit.Hash)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s not found at commit %s: %w", r.config.ConfigFilePath, commit.Hash, err)
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s at commit %s: %w", r.config.ConfigFilePath, commit.Hash, err)
+	}
+
+	return []byte(contents), &CommitInfo{
+		Hash:      commit.Hash.String(),
+		Message:   commit.Message,
+		Author:    commit.Author.Name,
+		Timestamp: commit.Author.When,
+	}, nil
+}
+
+// hasCommit reports whether the commit object is in the local clone
+func (r *Repository) hasCommit(hash plumbing.Hash) bool {
+	_, err := r.repo.CommitObject(hash)
+	return err == nil
+}
+
+// fetchCommit fetches a single commit by hash from the remote
+func (r *Repository) fetchCommit(ctx context.Context, hash string) error {
+	auth, err := r.authMethod()
+	if err != nil {
+		return err
+	}
+
+	err = r.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(hash + ":refs/irondhcp/fetched")},
+		Depth:      1,
+		Auth:       auth,
+	})
+	if err == nil || err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+
+	// Servers that refuse to send unadvertised commits need the full history
+	logger.Debug().Err(err).Msg("Fetching commit by hash failed, unshallowing repository")
+	branch := plumbing.NewBranchReferenceName(r.config.Branch)
+	err = r.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+%s:refs/remotes/origin/%s", branch, r.config.Branch))},
+		Depth:      math.MaxInt32,
+		Auth:       auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	if !r.hasCommit(plumbing.NewHash(hash)) {
+		return fmt.Errorf("%w on branch %s", ErrCommitNotFound, r.config.Branch)
+	}
+	return nil
+}
+
 // GetConfigFilePath returns the full path to the config file within the repository
 func (r *Repository) GetConfigFilePath() string {
 	return filepath.Join(r.config.LocalPath, r.config.ConfigFilePath)
@@ -0,0 +1,358 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/sashakarcz/irondhcp/internal/logger"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestMain(m *testing.M) {
+	// Keep clone and pull logging out of the test output
+	if err := logger.Setup(logger.Config{Level: "error", Format: "json"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestSigner generates an ed25519 SSH key
+func newTestSigner(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey: %v", err)
+	}
+	return signer, key
+}
+
+// startSSHGitServer serves git-upload-pack over SSH to clients holding clientKey
+// It returns the listening address and the server's host key.
+func startSSHGitServer(t *testing.T, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git-upload-pack"); err != nil {
+		t.Skip("git-upload-pack not installed")
+	}
+
+	hostSigner, _ := newTestSigner(t)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHGit(conn, config)
+		}
+	}()
+
+	return listener.Addr().String(), hostSigner.PublicKey()
+}
+
+// serveSSHGit runs the exec requests of one SSH connection
+func serveSSHGit(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					req.Reply(false, nil)
+					return
+				}
+				name, path, _ := strings.Cut(payload.Command, " ")
+				if name != "git-upload-pack" {
+					req.Reply(false, nil)
+					return
+				}
+				req.Reply(true, nil)
+
+				cmd := exec.Command(name, strings.Trim(path, "'"))
+				cmd.Stdin = channel
+				cmd.Stdout = channel
+				cmd.Stderr = io.Discard
+				status := uint32(0)
+				if err := cmd.Run(); err != nil {
+					status = 1
+				}
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+// commitFile writes a file into the remote repository and commits it
+func commitFile(t *testing.T, repo *git.Repository, dir, name, content string) string {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Worktree: %v", err)
+	}
+	if _, err := worktree.Add(name); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	hash, err := worktree.Commit("update "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	return hash.String()
+}
+
+// sshTestRemote is a repository served over SSH with an encrypted client key
+type sshTestRemote struct {
+	repo       *git.Repository
+	dir        string
+	url        string
+	keyPath    string
+	passphrase string
+	knownHosts string
+}
+
+func newSSHTestRemote(t *testing.T) *sshTestRemote {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("PlainInit: %v", err)
+	}
+	commitFile(t, repo, dir, "dhcp.yaml", "subnets: []\n")
+
+	clientSigner, clientKey := newTestSigner(t)
+	addr, hostKey := startSSHGitServer(t, clientSigner.PublicKey())
+
+	keys := t.TempDir()
+	passphrase := "correct horse"
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(clientKey, "", []byte(passphrase))
+	if err != nil {
+		t.Fatalf("MarshalPrivateKeyWithPassphrase: %v", err)
+	}
+	keyPath := filepath.Join(keys, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	knownHosts := filepath.Join(keys, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey)
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	return &sshTestRemote{
+		repo:       repo,
+		dir:        dir,
+		url:        "ssh://git@" + addr + dir,
+		keyPath:    keyPath,
+		passphrase: passphrase,
+		knownHosts: knownHosts,
+	}
+}
+
+// repositoryConfig returns a config that clones the remote into a fresh directory
+func (r *sshTestRemote) repositoryConfig(t *testing.T) *RepositoryConfig {
+	return &RepositoryConfig{
+		URL:            r.url,
+		Branch:         "master",
+		LocalPath:      filepath.Join(t.TempDir(), "clone"),
+		PrivateKeyPath: r.keyPath,
+		PrivateKeyPass: r.passphrase,
+		KnownHostsPath: r.knownHosts,
+		ConfigFilePath: "dhcp.yaml",
+	}
+}
+
+func TestRepositorySSHCloneAndPull(t *testing.T) {
+	ctx := context.Background()
+	remote := newSSHTestRemote(t)
+
+	repo := NewRepository(remote.repositoryConfig(t))
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := os.Stat(repo.GetConfigFilePath()); err != nil {
+		t.Fatalf("config file missing after clone: %v", err)
+	}
+
+	hash := commitFile(t, remote.repo, remote.dir, "dhcp.yaml", "subnets: []\n# changed\n")
+	commit, changed, err := repo.Pull(ctx)
+	if err != nil {
+		t.Fatalf("Pull: %v", err)
+	}
+	if !changed || commit.Hash != hash {
+		t.Errorf("Pull = %s (changed %v), want %s", commit.Hash, changed, hash)
+	}
+}
+
+func TestRepositorySSHRejectsUnpinnedHostKey(t *testing.T) {
+	remote := newSSHTestRemote(t)
+
+	// Pin some other host's key for the server's address
+	other, _ := newTestSigner(t)
+	addr := strings.TrimPrefix(strings.TrimSuffix(remote.url, remote.dir), "ssh://git@")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, other.PublicKey())
+	if err := os.WriteFile(remote.knownHosts, []byte(line+"\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	repo := NewRepository(remote.repositoryConfig(t))
+	if err := repo.Initialize(context.Background()); err == nil {
+		t.Fatal("cloned from a server whose host key is not pinned")
+	}
+}
+
+func TestRepositorySSHRequiresPassphrase(t *testing.T) {
+	remote := newSSHTestRemote(t)
+
+	config := remote.repositoryConfig(t)
+	config.PrivateKeyPass = "wrong"
+	repo := NewRepository(config)
+	if err := repo.Initialize(context.Background()); err == nil {
+		t.Fatal("cloned with the wrong key passphrase")
+	}
+}
+
+func TestSSHAuthUser(t *testing.T) {
+	_, key := newTestSigner(t)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		sshUser string
+		want    string
+	}{
+		{"user from url", "ssh://gitea@git.example.com/infra/dhcp.git", "", "gitea"},
+		{"user from scp url", "forgejo@git.example.com:infra/dhcp.git", "", "forgejo"},
+		{"ssh_user wins", "ssh://gitea@git.example.com/infra/dhcp.git", "deploy", "deploy"},
+		{"default", "ssh://git.example.com/infra/dhcp.git", "", "git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewRepository(&RepositoryConfig{
+				URL:            tt.url,
+				PrivateKeyPath: keyPath,
+				SSHUser:        tt.sshUser,
+			})
+			auth, err := repo.sshAuth()
+			if err != nil {
+				t.Fatalf("sshAuth: %v", err)
+			}
+			if user := auth.(*gitssh.PublicKeys).User; user != tt.want {
+				t.Errorf("user %q, want %q", user, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigAtFetchesCommitsOutsideShallowClone(t *testing.T) {
+	if _, err := exec.LookPath("git-upload-pack"); err != nil {
+		t.Skip("git-upload-pack not installed")
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("PlainInit: %v", err)
+	}
+	old := commitFile(t, remote, dir, "dhcp.yaml", "subnets: []\n# old\n")
+	commitFile(t, remote, dir, "dhcp.yaml", "subnets: []\n# new\n")
+
+	// The depth 1 clone only has the newest commit
+	repo := NewRepository(&RepositoryConfig{
+		URL:            dir,
+		Branch:         "master",
+		LocalPath:      filepath.Join(t.TempDir(), "clone"),
+		ConfigFilePath: "dhcp.yaml",
+	})
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	data, commit, err := repo.ReadConfigAt(ctx, old)
+	if err != nil {
+		t.Fatalf("ReadConfigAt: %v", err)
+	}
+	if commit.Hash != old || string(data) != "subnets: []\n# old\n" {
+		t.Errorf("ReadConfigAt = %q at %s, want the old config at %s", data, commit.Hash, old)
+	}
+
+	if _, _, err := repo.ReadConfigAt(ctx, "0000000000000000000000000000000000000000"); !errors.Is(err, ErrCommitNotFound) {
+		t.Errorf("read config at a commit that does not exist: got %v, want ErrCommitNotFound", err)
+	}
+}
@@ -2,8 +2,11 @@ package gitops
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sashakarcz/irondhcp/internal/config"
@@ -15,10 +18,12 @@ import (
 // SyncService manages configuration synchronization from Git
 type SyncService struct {
 	repo        *Repository
-	store       *storage.Store
+	store       storage.Backend
 	reloadFunc  func(*config.Config) error
 	currentHash string
 	baseConfig  *config.Config
+	mu          sync.Mutex   // Serializes syncs from the poller, the API and webhooks
+	pinned      atomic.Value // Commit hash set by Rollback; "" follows the branch. Written under mu.
 }
 
 // SyncResult contains the result of a sync operation
@@ -28,10 +33,17 @@ type SyncResult struct {
 	CommitInfo    *CommitInfo
 	ErrorMessage  string
 	ChangesApplied map[string]interface{}
+	PinnedCommit  string // Set when the commit applied is a rollback pin
 }
 
+// ErrInvalidConfig is returned when a Git config file fails to parse or validate
+var ErrInvalidConfig = errors.New("config validation failed")
+
+// pinnedCommitKey records in git_sync_log changes which commit a pinned sync applied
+const pinnedCommitKey = "pinned_commit"
+
 // NewSyncService creates a new sync service
-func NewSyncService(repo *Repository, store *storage.Store, baseConfig *config.Config, reloadFunc func(*config.Config) error) *SyncService {
+func NewSyncService(repo *Repository, store storage.Backend, baseConfig *config.Config, reloadFunc func(*config.Config) error) *SyncService {
 	return &SyncService{
 		repo:       repo,
 		store:      store,
@@ -47,17 +59,23 @@ func (s *SyncService) SetReloadFunc(reloadFunc func(*config.Config) error) {
 
 // Sync performs a complete sync operation: pull, validate, and apply
 func (s *SyncService) Sync(ctx context.Context, trigger storage.GitSyncTrigger, triggeredByUser string) (*SyncResult, error) {
-	// Create sync log entry
-	syncLog := &storage.GitSyncLog{
-		SyncStartedAt:   time.Now(),
-		Status:          storage.GitSyncStatusInProgress,
-		TriggeredBy:     trigger,
-		TriggeredByUser: triggeredByUser,
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sync(ctx, trigger, triggeredByUser)
+}
+
+// sync implements Sync; the caller holds s.mu
+func (s *SyncService) sync(ctx context.Context, trigger storage.GitSyncTrigger, triggeredByUser string) (*SyncResult, error) {
+	// A rolled-back server keeps serving its pinned commit until unpinned
+	if pinned := s.PinnedCommit(); pinned != "" {
+		return s.syncCommit(ctx, pinned, trigger, triggeredByUser)
 	}
 
-	if err := s.store.CreateGitSyncLog(ctx, syncLog); err != nil {
-		logger.Error().Err(err).Msg("Failed to create git sync log")
-		return nil, fmt.Errorf("failed to create git sync log: %w", err)
+	// Create sync log entry
+	syncLog, err := s.startSyncLog(ctx, trigger, triggeredByUser)
+	if err != nil {
+		return nil, err
 	}
 
 	result := &SyncResult{
@@ -131,6 +149,204 @@ func (s *SyncService) Sync(ctx context.Context, trigger storage.GitSyncTrigger,
 	return result, nil
 }
 
+// Rollback applies the config file from an earlier commit and pins the server to it
+// Polls, manual syncs and webhooks re-apply the pinned commit until Unpin is called.
+// A commit that fails to validate or apply leaves the running config and pin unchanged.
+func (s *SyncService) Rollback(ctx context.Context, hash string, triggeredByUser string) (*SyncResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.syncCommit(ctx, hash, storage.GitSyncTriggerRollback, triggeredByUser)
+	if err != nil {
+		return result, err
+	}
+
+	s.pinned.Store(result.CommitInfo.Hash)
+	if err := s.store.SetPinnedCommit(ctx, result.CommitInfo.Hash); err != nil {
+		logger.Error().Err(err).Msg("Failed to record rollback pin; it will not survive a restart")
+	}
+
+	logger.Warn().
+		Str("commit", result.CommitInfo.Hash).
+		Str("user", triggeredByUser).
+		Msg("Rolled back configuration; pinned to commit until unpinned")
+
+	return result, nil
+}
+
+// Unpin releases a rollback pin and syncs the head of the branch
+// The pin stays released even if that sync fails; the next poll retries it.
+func (s *SyncService) Unpin(ctx context.Context, triggeredByUser string) (*SyncResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.SetPinnedCommit(ctx, ""); err != nil {
+		return nil, err
+	}
+	if previous, _ := s.pinned.Swap("").(string); previous != "" {
+		logger.Info().
+			Str("commit", previous).
+			Str("user", triggeredByUser).
+			Msg("Unpinned configuration, following branch again")
+	}
+
+	return s.sync(ctx, storage.GitSyncTriggerManual, triggeredByUser)
+}
+
+// PinnedCommit returns the commit the server is pinned to, or "" if it follows the branch
+func (s *SyncService) PinnedCommit() string {
+	hash, _ := s.pinned.Load().(string)
+	return hash
+}
+
+// RestorePin re-pins the server after a restart if a rollback pin was recorded
+func (s *SyncService) RestorePin(ctx context.Context) error {
+	hash, err := s.store.GetPinnedCommit(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pinned.Store(hash)
+	if hash != "" {
+		logger.Warn().
+			Str("commit", hash).
+			Msg("Configuration is pinned to a rolled-back commit")
+	}
+
+	return nil
+}
+
+// Plan reports what syncing a config would change, without applying it
+// data is the proposed config file; if nil, the file is read at commit, or at the
+// head of the remote branch when commit is empty. Changes are relative to the last
+// applied config, falling back to the subnets in the base config.
+func (s *SyncService) Plan(ctx context.Context, commit string, data []byte) (*Plan, error) {
+	var commitInfo *CommitInfo
+	if data == nil {
+		var err error
+		data, commitInfo, err = s.readPlanConfig(ctx, commit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newConfig, err := s.parseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _, err := ActiveSubnets(ctx, s.store)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		current = s.baseConfig.Subnets
+	}
+
+	plan, err := BuildPlan(ctx, s.store, current, newConfig.Subnets)
+	if err != nil {
+		return nil, err
+	}
+	if commitInfo != nil {
+		plan.CommitHash = commitInfo.Hash
+	}
+	return plan, nil
+}
+
+// readPlanConfig reads the config file at commit, fetching the branch head if commit is empty
+func (s *SyncService) readPlanConfig(ctx context.Context, commit string) ([]byte, *CommitInfo, error) {
+	// The clone is shared with syncs
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if commit == "" {
+		ref, err := s.repo.Fetch(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		commit = ref
+	}
+
+	return s.repo.ReadConfigAt(ctx, commit)
+}
+
+// syncCommit applies the config file as of a commit instead of the branch head
+// It is used for rollbacks and while pinned; the caller holds s.mu.
+func (s *SyncService) syncCommit(ctx context.Context, hash string, trigger storage.GitSyncTrigger, triggeredByUser string) (*SyncResult, error) {
+	syncLog, err := s.startSyncLog(ctx, trigger, triggeredByUser)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{
+		ChangesApplied: make(map[string]interface{}),
+	}
+
+	data, commitInfo, err := s.repo.ReadConfigAt(ctx, hash)
+	if err != nil {
+		result.Success = false
+		result.ErrorMessage = fmt.Sprintf("Failed to read configuration at %s: %v", hash, err)
+		s.finalizeSyncLog(ctx, syncLog, result)
+		return result, fmt.Errorf("failed to read configuration at %s: %w", hash, err)
+	}
+
+	result.CommitInfo = commitInfo
+	syncLog.CommitHash = commitInfo.Hash
+	syncLog.CommitMessage = commitInfo.Message
+	syncLog.CommitAuthor = commitInfo.Author
+	syncLog.CommitTimestamp = &commitInfo.Timestamp
+
+	if s.currentHash != commitInfo.Hash {
+		newConfig, err := s.parseConfig(data)
+		if err != nil {
+			result.Success = false
+			result.ErrorMessage = fmt.Sprintf("Configuration validation failed: %v", err)
+			s.finalizeSyncLog(ctx, syncLog, result)
+			return result, fmt.Errorf("configuration validation failed: %w", err)
+		}
+
+		logger.Info().
+			Str("commit", commitInfo.Hash).
+			Msg("Applying configuration from pinned commit")
+		if err := s.applyConfig(ctx, newConfig, result); err != nil {
+			result.Success = false
+			result.ErrorMessage = fmt.Sprintf("Failed to apply configuration: %v", err)
+			s.finalizeSyncLog(ctx, syncLog, result)
+			return result, fmt.Errorf("failed to apply configuration: %w", err)
+		}
+
+		s.currentHash = commitInfo.Hash
+		result.HasChanges = true
+	}
+
+	result.Success = true
+	result.PinnedCommit = commitInfo.Hash
+	result.ChangesApplied[pinnedCommitKey] = commitInfo.Hash
+
+	s.finalizeSyncLog(ctx, syncLog, result)
+	return result, nil
+}
+
+// startSyncLog records the start of a sync
+func (s *SyncService) startSyncLog(ctx context.Context, trigger storage.GitSyncTrigger, triggeredByUser string) (*storage.GitSyncLog, error) {
+	syncLog := &storage.GitSyncLog{
+		SyncStartedAt:   time.Now(),
+		Status:          storage.GitSyncStatusInProgress,
+		TriggeredBy:     trigger,
+		TriggeredByUser: triggeredByUser,
+	}
+
+	if err := s.store.CreateGitSyncLog(ctx, syncLog); err != nil {
+		logger.Error().Err(err).Msg("Failed to create git sync log")
+		return nil, fmt.Errorf("failed to create git sync log: %w", err)
+	}
+
+	return syncLog, nil
+}
+
 // validateConfig validates a configuration file from Git and merges it with base config
 func (s *SyncService) validateConfig(configPath string) (*config.Config, error) {
 	// Check if file exists
@@ -144,75 +360,89 @@ func (s *SyncService) validateConfig(configPath string) (*config.Config, error)
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	return s.parseConfig(data)
+}
+
+// parseConfig parses and validates the contents of a Git config file
+func (s *SyncService) parseConfig(data []byte) (*config.Config, error) {
+	return ParseConfig(s.baseConfig, data)
+}
+
+// ParseConfig parses a Git config file and merges its subnets into base
+// Errors are wrapped in ErrInvalidConfig.
+func ParseConfig(base *config.Config, data []byte) (*config.Config, error) {
 	// Parse as partial config (only subnets)
 	var partialCfg struct {
 		Subnets []config.SubnetConfig `yaml:"subnets"`
 	}
 	if err := yaml.Unmarshal(data, &partialCfg); err != nil {
-		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		return nil, fmt.Errorf("%w: failed to parse YAML: %v", ErrInvalidConfig, err)
 	}
 
 	// Create a new config based on the base config
 	// Clone the base config to avoid modifying it
 	newConfig := &config.Config{
-		Server:        s.baseConfig.Server,
-		Database:      s.baseConfig.Database,
-		Observability: s.baseConfig.Observability,
-		Git:           s.baseConfig.Git,
+		Server:        base.Server,
+		Database:      base.Database,
+		Observability: base.Observability,
+		Git:           base.Git,
 		Subnets:       partialCfg.Subnets,
+		ClientClasses: base.ClientClasses, // Pools refer to classes, so a reload must keep them
 	}
 
-	// Validate the merged config
-	if err := s.validateConfigStructure(newConfig); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+	// Git-managed subnets get the same defaults and checks as those in the config file
+	newConfig.SetSubnetDefaults()
+	if err := newConfig.ValidateSubnets(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if err := validateConfigStructure(newConfig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 	}
 
 	return newConfig, nil
 }
 
-// validateConfigStructure performs structural validation on the config
-func (s *SyncService) validateConfigStructure(cfg *config.Config) error {
-	// Validate subnets
+// validateConfigStructure checks what ValidateSubnets leaves to config.Load
+func validateConfigStructure(cfg *config.Config) error {
 	if len(cfg.Subnets) == 0 {
 		return fmt.Errorf("no subnets defined")
 	}
 
-	// Validate each subnet
-	for i, subnet := range cfg.Subnets {
-		if subnet.Network == "" {
-			return fmt.Errorf("subnet %d: network is required", i)
-		}
+	// Validate database config; bolt and memory stores need no connection string
+	if cfg.Database.Driver == storage.DriverPostgres && cfg.Database.Connection == "" {
+		return fmt.Errorf("database connection string is required")
+	}
 
-		if len(subnet.Pools) == 0 && len(subnet.Reservations) == 0 {
-			logger.Warn().
-				Str("subnet", subnet.Network).
-				Msg("Subnet has no pools or reservations")
-		}
+	return nil
+}
 
-		// Validate pools
-		for j, pool := range subnet.Pools {
-			if pool.RangeStart == "" || pool.RangeEnd == "" {
-				return fmt.Errorf("subnet %d, pool %d: range_start and range_end are required", i, j)
-			}
-		}
+// SyncReservations makes the stored reservations match those in the subnets
+// The server calls it at startup when GitOps is disabled; a GitOps sync applies the same changes.
+func SyncReservations(ctx context.Context, store storage.ReservationStore, subnets []config.SubnetConfig) error {
+	_, err := syncReservations(ctx, store, subnets)
+	return err
+}
 
-		// Validate reservations
-		for j, res := range subnet.Reservations {
-			if res.MAC == "" {
-				return fmt.Errorf("subnet %d, reservation %d: MAC address is required", i, j)
-			}
-			if res.IP == "" {
-				return fmt.Errorf("subnet %d, reservation %d: IP address is required", i, j)
-			}
-		}
+// syncReservations applies the reservation changes for subnets and returns them so they can be reverted
+func syncReservations(ctx context.Context, store storage.ReservationStore, subnets []config.SubnetConfig) (*reservationDiff, error) {
+	existing, err := store.GetAllReservations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing reservations: %w", err)
 	}
+	diff := diffReservations(existing, subnets)
 
-	// Validate database config
-	if cfg.Database.Connection == "" {
-		return fmt.Errorf("database connection string is required")
+	// All or nothing, so a failed sync leaves the previous reservations in place
+	if err := store.ApplyReservationChanges(ctx, diff.storageChanges()); err != nil {
+		return nil, fmt.Errorf("failed to sync reservations: %w", err)
 	}
 
-	return nil
+	logger.Info().
+		Int("added", len(diff.create)).
+		Int("updated", len(diff.update)).
+		Int("deleted", len(diff.remove)).
+		Msg("Synced reservations")
+
+	return diff, nil
 }
 
 // applyConfig applies the new configuration atomically
@@ -222,106 +452,38 @@ func (s *SyncService) applyConfig(ctx context.Context, newConfig *config.Config,
 
 	// Sync reservations to database
 	logger.Info().Msg("Syncing reservations to database")
-
-	// Get existing reservations
-	existing, err := s.store.GetAllReservations(ctx)
+	diff, err := syncReservations(ctx, s.store, newConfig.Subnets)
 	if err != nil {
-		return fmt.Errorf("failed to get existing reservations: %w", err)
-	}
-
-	existingMap := make(map[string]*storage.Reservation)
-	for _, res := range existing {
-		existingMap[res.MAC.String()] = res
+		return err
 	}
 
-	reservationsAdded := 0
-	reservationsUpdated := 0
-	reservationsDeleted := 0
-
-	// Add/update reservations from config
-	for _, subnetCfg := range newConfig.Subnets {
-		_, network, _ := config.ParseCIDR(subnetCfg.Network)
-
-		for _, resCfg := range subnetCfg.Reservations {
-			mac, _ := config.ParseMAC(resCfg.MAC)
-			ip := config.ParseIP(resCfg.IP)
-
-			var tftpServer, bootFilename string
-			if resCfg.Boot != nil {
-				tftpServer = resCfg.Boot.TFTPServer
-				bootFilename = resCfg.Boot.Filename
-			}
-
-			if existingRes, found := existingMap[mac.String()]; found {
-				// Update if changed
-				if !existingRes.IP.Equal(ip) || existingRes.Hostname != resCfg.Hostname ||
-					existingRes.Description != resCfg.Description ||
-					existingRes.TFTPServer != tftpServer || existingRes.BootFilename != bootFilename {
-
-					existingRes.IP = ip
-					existingRes.Hostname = resCfg.Hostname
-					existingRes.Subnet = network
-					existingRes.Description = resCfg.Description
-					existingRes.TFTPServer = tftpServer
-					existingRes.BootFilename = bootFilename
-
-					if err := s.store.UpdateReservation(ctx, existingRes); err != nil {
-						logger.Error().Err(err).Str("mac", mac.String()).Msg("Failed to update reservation")
-					} else {
-						reservationsUpdated++
-					}
-				}
-				delete(existingMap, mac.String())
-			} else {
-				// Create new reservation
-				newRes := &storage.Reservation{
-					MAC:          mac,
-					IP:           ip,
-					Hostname:     resCfg.Hostname,
-					Subnet:       network,
-					Description:  resCfg.Description,
-					TFTPServer:   tftpServer,
-					BootFilename: bootFilename,
-				}
-
-				if err := s.store.CreateReservation(ctx, newRes); err != nil {
-					logger.Error().Err(err).Str("mac", mac.String()).Msg("Failed to create reservation")
-				} else {
-					reservationsAdded++
-				}
-			}
-		}
-	}
-
-	// Delete reservations not in config
-	for _, res := range existingMap {
-		if err := s.store.DeleteReservation(ctx, res.ID); err != nil {
-			logger.Error().Err(err).Str("mac", res.MAC.String()).Msg("Failed to delete reservation")
-		} else {
-			reservationsDeleted++
-		}
-	}
-
-	changes["reservations_added"] = reservationsAdded
-	changes["reservations_updated"] = reservationsUpdated
-	changes["reservations_deleted"] = reservationsDeleted
+	changes["reservations_added"] = len(diff.create)
+	changes["reservations_updated"] = len(diff.update)
+	changes["reservations_deleted"] = len(diff.remove)
 	changes["total_subnets"] = len(newConfig.Subnets)
 
-	logger.Info().
-		Int("added", reservationsAdded).
-		Int("updated", reservationsUpdated).
-		Int("deleted", reservationsDeleted).
-		Msg("Synced reservations")
-
 	// Call reload function to reload DHCP server configuration
 	if s.reloadFunc != nil {
 		logger.Info().Msg("Reloading DHCP server configuration")
 		if err := s.reloadFunc(newConfig); err != nil {
+			// The server keeps running the previous config, so put its reservations back
+			if revertErr := s.store.ApplyReservationChanges(ctx, diff.revertChanges()); revertErr != nil {
+				logger.Error().Err(revertErr).Msg("Failed to restore reservations after failed reload")
+			}
 			return fmt.Errorf("failed to reload configuration: %w", err)
 		}
 		changes["config_reloaded"] = true
 	}
 
+	// Recorded for plans; the config is live either way
+	commitHash := ""
+	if result.CommitInfo != nil {
+		commitHash = result.CommitInfo.Hash
+	}
+	if err := RecordActiveConfig(ctx, s.store, commitHash, newConfig.Subnets); err != nil {
+		logger.Warn().Err(err).Msg("Failed to record active configuration")
+	}
+
 	result.ChangesApplied = changes
 	return nil
 }
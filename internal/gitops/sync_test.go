@@ -0,0 +1,502 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/sashakarcz/irondhcp/internal/config"
+	"github.com/sashakarcz/irondhcp/internal/storage"
+)
+
+// testSubnetConfig is a Git config file with one reservation at ip
+func testSubnetConfig(ip string) string {
+	return fmt.Sprintf(`subnets:
+  - network: 192.168.1.0/24
+    gateway: 192.168.1.1
+    pools:
+      - range_start: 192.168.1.100
+        range_end: 192.168.1.200
+    reservations:
+      - mac: "aa:bb:cc:dd:ee:ff"
+        ip: %s
+        hostname: printer
+`, ip)
+}
+
+// syncTestRemote is a local repository synced by a SyncService over the file transport
+type syncTestRemote struct {
+	repo  *git.Repository
+	dir   string
+	store *storage.EmbeddedStore
+	sync  *SyncService
+}
+
+func newSyncTestRemote(t *testing.T) *syncTestRemote {
+	t.Helper()
+
+	if _, err := exec.LookPath("git-upload-pack"); err != nil {
+		t.Skip("git-upload-pack not installed")
+	}
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("PlainInit: %v", err)
+	}
+	commitFile(t, repo, dir, "dhcp.yaml", testSubnetConfig("192.168.1.10"))
+
+	local := NewRepository(&RepositoryConfig{
+		URL:            dir,
+		Branch:         "master",
+		LocalPath:      filepath.Join(t.TempDir(), "clone"),
+		ConfigFilePath: "dhcp.yaml",
+	})
+	if err := local.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	store := storage.NewMemoryStore()
+	base := &config.Config{Database: config.DatabaseConfig{Connection: "memory"}}
+	return &syncTestRemote{
+		repo:  repo,
+		dir:   dir,
+		store: store,
+		sync:  NewSyncService(local, store, base, nil),
+	}
+}
+
+// reservedIP returns the IP of the only reservation in the store
+func (r *syncTestRemote) reservedIP(t *testing.T) string {
+	t.Helper()
+
+	reservations, err := r.store.GetAllReservations(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllReservations: %v", err)
+	}
+	if len(reservations) != 1 {
+		t.Fatalf("got %d reservations, want 1", len(reservations))
+	}
+	return reservations[0].IP.String()
+}
+
+func TestSyncKeepsClientClasses(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+	remote.sync.baseConfig.ClientClasses = []config.ClientClassConfig{{
+		Name:  "phones",
+		Match: config.ClassMatchConfig{VendorClass: "Polycom"},
+	}}
+
+	var reloaded *config.Config
+	remote.sync.SetReloadFunc(func(cfg *config.Config) error {
+		reloaded = cfg
+		return nil
+	})
+
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if reloaded == nil {
+		t.Fatal("sync did not reload the server")
+	}
+	if len(reloaded.ClientClasses) != 1 || reloaded.ClientClasses[0].Name != "phones" {
+		t.Errorf("reloaded with client classes %+v, want phones", reloaded.ClientClasses)
+	}
+}
+
+func TestSyncDefaultsDeclineQuarantine(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+
+	var reloaded *config.Config
+	remote.sync.SetReloadFunc(func(cfg *config.Config) error {
+		reloaded = cfg
+		return nil
+	})
+
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if reloaded == nil {
+		t.Fatal("sync did not reload the server")
+	}
+	// The Git file sets no decline_quarantine, so declined addresses must not be reclaimed at once
+	if got := reloaded.Subnets[0].DeclineQuarantine; got != 24*time.Hour {
+		t.Errorf("decline_quarantine = %s, want the 24h0m0s default", got)
+	}
+}
+
+func TestRollbackPinsUntilUnpinned(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	good, err := remote.sync.repo.GetCurrentCommit()
+	if err != nil {
+		t.Fatalf("GetCurrentCommit: %v", err)
+	}
+
+	commitFile(t, remote.repo, remote.dir, "dhcp.yaml", testSubnetConfig("192.168.1.20"))
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerPoll, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ip := remote.reservedIP(t); ip != "192.168.1.20" {
+		t.Fatalf("reservation at %s after sync, want 192.168.1.20", ip)
+	}
+
+	// Roll back by abbreviated hash
+	result, err := remote.sync.Rollback(ctx, good.Hash[:10], "admin")
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if result.PinnedCommit != good.Hash || remote.sync.PinnedCommit() != good.Hash {
+		t.Errorf("pinned to %q, want %s", remote.sync.PinnedCommit(), good.Hash)
+	}
+	if ip := remote.reservedIP(t); ip != "192.168.1.10" {
+		t.Errorf("reservation at %s after rollback, want 192.168.1.10", ip)
+	}
+
+	// New pushes are ignored while pinned
+	commitFile(t, remote.repo, remote.dir, "dhcp.yaml", testSubnetConfig("192.168.1.30"))
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerPoll, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ip := remote.reservedIP(t); ip != "192.168.1.10" {
+		t.Errorf("reservation at %s while pinned, want 192.168.1.10", ip)
+	}
+
+	// The pin survives a restart
+	restarted := NewSyncService(remote.sync.repo, remote.store, remote.sync.baseConfig, nil)
+	if err := restarted.RestorePin(ctx); err != nil {
+		t.Fatalf("RestorePin: %v", err)
+	}
+	if restarted.PinnedCommit() != good.Hash {
+		t.Errorf("restored pin %q, want %s", restarted.PinnedCommit(), good.Hash)
+	}
+
+	if _, err := remote.sync.Unpin(ctx, "admin"); err != nil {
+		t.Fatalf("Unpin: %v", err)
+	}
+	if remote.sync.PinnedCommit() != "" {
+		t.Errorf("still pinned to %s", remote.sync.PinnedCommit())
+	}
+	if ip := remote.reservedIP(t); ip != "192.168.1.30" {
+		t.Errorf("reservation at %s after unpin, want 192.168.1.30", ip)
+	}
+}
+
+func TestRollbackToInvalidCommitKeepsConfig(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+
+	bad := commitFile(t, remote.repo, remote.dir, "dhcp.yaml", "subnets: []\n")
+	commitFile(t, remote.repo, remote.dir, "dhcp.yaml", testSubnetConfig("192.168.1.20"))
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if _, err := remote.sync.Rollback(ctx, bad, "admin"); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("rollback to a commit with no subnets: got %v, want ErrInvalidConfig", err)
+	}
+	if _, err := remote.sync.Rollback(ctx, "no-such-branch", "admin"); !errors.Is(err, ErrCommitNotFound) {
+		t.Errorf("rollback to an unknown revision: got %v, want ErrCommitNotFound", err)
+	}
+	if remote.sync.PinnedCommit() != "" {
+		t.Errorf("pinned to %s after a failed rollback", remote.sync.PinnedCommit())
+	}
+	if ip := remote.reservedIP(t); ip != "192.168.1.20" {
+		t.Errorf("reservation at %s after failed rollback, want 192.168.1.20", ip)
+	}
+}
+
+func TestPinIsStoredExplicitly(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	good := remote.sync.GetCurrentCommitHash()
+	if _, err := remote.sync.Rollback(ctx, good, "admin"); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	// However many syncs fail after the rollback, a restart finds the pin
+	for i := 0; i < 60; i++ {
+		if err := remote.store.CreateGitSyncLog(ctx, &storage.GitSyncLog{
+			SyncStartedAt: time.Now(),
+			Status:        storage.GitSyncStatusFailed,
+			TriggeredBy:   storage.GitSyncTriggerPoll,
+		}); err != nil {
+			t.Fatalf("CreateGitSyncLog: %v", err)
+		}
+	}
+	restarted := NewSyncService(remote.sync.repo, remote.store, remote.sync.baseConfig, nil)
+	if err := restarted.RestorePin(ctx); err != nil {
+		t.Fatalf("RestorePin: %v", err)
+	}
+	if restarted.PinnedCommit() != good {
+		t.Errorf("restored pin %q, want %s", restarted.PinnedCommit(), good)
+	}
+
+	// Unpinning sticks even when the branch head fails to sync
+	commitFile(t, remote.repo, remote.dir, "dhcp.yaml", "subnets: []\n")
+	if _, err := remote.sync.Unpin(ctx, "admin"); err == nil {
+		t.Fatal("synced a config with no subnets")
+	}
+	restarted = NewSyncService(remote.sync.repo, remote.store, remote.sync.baseConfig, nil)
+	if err := restarted.RestorePin(ctx); err != nil {
+		t.Fatalf("RestorePin: %v", err)
+	}
+	if restarted.PinnedCommit() != "" {
+		t.Errorf("pinned to %s after unpin", restarted.PinnedCommit())
+	}
+}
+
+// twoReservationConfig is a Git config file reserving printerIP and scannerIP
+func twoReservationConfig(printerIP, scannerIP string) string {
+	return fmt.Sprintf(`subnets:
+  - network: 192.168.1.0/24
+    gateway: 192.168.1.1
+    pools:
+      - range_start: 192.168.1.100
+        range_end: 192.168.1.200
+    reservations:
+      - mac: "aa:bb:cc:dd:ee:ff"
+        ip: %s
+        hostname: printer
+      - mac: "aa:bb:cc:dd:ee:01"
+        ip: %s
+        hostname: scanner
+`, printerIP, scannerIP)
+}
+
+// reservedIPs returns the reserved IP of each hostname
+func (r *syncTestRemote) reservedIPs(t *testing.T) map[string]string {
+	t.Helper()
+
+	reservations, err := r.store.GetAllReservations(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllReservations: %v", err)
+	}
+	ips := make(map[string]string)
+	for _, res := range reservations {
+		ips[res.Hostname] = res.IP.String()
+	}
+	return ips
+}
+
+func TestSyncSwapsReservationAddresses(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+
+	commitFile(t, remote.repo, remote.dir, "dhcp.yaml", twoReservationConfig("192.168.1.10", "192.168.1.11"))
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	commitFile(t, remote.repo, remote.dir, "dhcp.yaml", twoReservationConfig("192.168.1.11", "192.168.1.10"))
+	result, err := remote.sync.Sync(ctx, storage.GitSyncTriggerPoll, "")
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.ChangesApplied["reservations_updated"] != 2 {
+		t.Errorf("changes %v, want 2 updates", result.ChangesApplied)
+	}
+
+	ips := remote.reservedIPs(t)
+	if ips["printer"] != "192.168.1.11" || ips["scanner"] != "192.168.1.10" {
+		t.Errorf("reservations %v after swap", ips)
+	}
+}
+
+func TestFailedSyncKeepsReservations(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+
+	reloads := 0
+	remote.sync.SetReloadFunc(func(*config.Config) error {
+		reloads++
+		return nil
+	})
+
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	applied := remote.sync.GetCurrentCommitHash()
+
+	// The scanner's address is taken by the printer, which the commit also leaves alone
+	commitFile(t, remote.repo, remote.dir, "dhcp.yaml", twoReservationConfig("192.168.1.10", "192.168.1.10"))
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerPoll, ""); err == nil {
+		t.Fatal("synced two reservations for one address")
+	}
+
+	if ips := remote.reservedIPs(t); len(ips) != 1 || ips["printer"] != "192.168.1.10" {
+		t.Errorf("reservations %v after failed sync", ips)
+	}
+	if reloads != 1 {
+		t.Errorf("reloaded %d times, want only the first sync", reloads)
+	}
+	if remote.sync.GetCurrentCommitHash() != applied {
+		t.Errorf("current commit moved to %s after failed sync", remote.sync.GetCurrentCommitHash())
+	}
+
+	logs, err := remote.store.GetRecentGitSyncLogs(ctx, 1)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("GetRecentGitSyncLogs = %v, %v", logs, err)
+	}
+	if logs[0].Status != storage.GitSyncStatusFailed {
+		t.Errorf("sync recorded as %s, want failed", logs[0].Status)
+	}
+}
+
+func TestFailedReloadRestoresReservations(t *testing.T) {
+	ctx := context.Background()
+	remote := newSyncTestRemote(t)
+
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerStartup, ""); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	remote.sync.SetReloadFunc(func(*config.Config) error {
+		return fmt.Errorf("interface not found")
+	})
+	commitFile(t, remote.repo, remote.dir, "dhcp.yaml", twoReservationConfig("192.168.1.20", "192.168.1.21"))
+	if _, err := remote.sync.Sync(ctx, storage.GitSyncTriggerPoll, ""); err == nil {
+		t.Fatal("sync succeeded although the reload failed")
+	}
+
+	if ips := remote.reservedIPs(t); len(ips) != 1 || ips["printer"] != "192.168.1.10" {
+		t.Errorf("reservations %v after failed reload", ips)
+	}
+}
+
+func TestSyncReservationsFromConfig(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	subnets := []config.SubnetConfig{{
+		Network: "192.168.1.0/24",
+		Reservations: []config.ReservationConfig{{
+			MAC:      "aa:bb:cc:dd:ee:01",
+			IP:       "192.168.1.10",
+			Hostname: "pxe-client",
+			Boot: &config.BootConfig{
+				Filename: "pxelinux.0",
+				Rules:    []config.BootRuleConfig{{Arch: []string{"7"}, Filename: "ipxe.efi"}},
+			},
+		}},
+	}}
+
+	if err := SyncReservations(ctx, store, subnets); err != nil {
+		t.Fatalf("SyncReservations: %v", err)
+	}
+	stored, err := store.GetAllReservations(ctx)
+	if err != nil {
+		t.Fatalf("GetAllReservations: %v", err)
+	}
+	if len(stored) != 1 || stored[0].BootFilename != "pxelinux.0" ||
+		len(stored[0].BootRules) != 1 || stored[0].BootRules[0].Filename != "ipxe.efi" {
+		t.Fatalf("stored reservations %+v", stored)
+	}
+
+	// Startup sync and GitOps sync share the diff, so a second pass finds nothing to change
+	diff := diffReservations(stored, subnets)
+	if len(diff.changes) != 0 {
+		t.Errorf("unexpected changes after sync: %+v", diff.changes)
+	}
+}
+
+func TestParseConfigAcceptsCircuitIDReservations(t *testing.T) {
+	ctx := context.Background()
+	base := &config.Config{Database: config.DatabaseConfig{Connection: "memory"}}
+
+	cfg, err := ParseConfig(base, []byte(`subnets:
+  - network: 192.168.1.0/24
+    gateway: 192.168.1.1
+    pools:
+      - range_start: 192.168.1.100
+        range_end: 192.168.1.200
+    reservations:
+      - circuit_id: "eth0/1/3"
+        ip: 192.168.1.30
+        hostname: switch-port-3
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+
+	store := storage.NewMemoryStore()
+	if err := SyncReservations(ctx, store, cfg.Subnets); err != nil {
+		t.Fatalf("SyncReservations: %v", err)
+	}
+	stored, err := store.GetAllReservations(ctx)
+	if err != nil {
+		t.Fatalf("GetAllReservations: %v", err)
+	}
+	if len(stored) != 1 || stored[0].CircuitID != "eth0/1/3" || stored[0].MAC != nil {
+		t.Errorf("stored reservations %+v", stored)
+	}
+
+	if _, err := ParseConfig(base, []byte(`subnets:
+  - network: 192.168.1.0/24
+    gateway: 192.168.1.1
+    pools:
+      - range_start: 192.168.1.100
+        range_end: 192.168.1.200
+    reservations:
+      - ip: 192.168.1.30
+        hostname: nobody
+`)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("reservation without mac or circuit_id: got %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestParseConfigAppliesSubnetDefaults(t *testing.T) {
+	base := &config.Config{Database: config.DatabaseConfig{Connection: "memory"}}
+	subnet := func(extra string) []byte {
+		return []byte(`subnets:
+  - network: 192.168.1.0/24
+    gateway: 192.168.1.1
+    pools:
+      - range_start: 192.168.1.100
+        range_end: 192.168.1.200
+` + extra)
+	}
+
+	cfg, err := ParseConfig(base, subnet(""))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	got := cfg.Subnets[0]
+	if got.LeaseDuration != 24*time.Hour || got.MinLeaseDuration != time.Hour || got.MaxLeaseDuration != 168*time.Hour {
+		t.Errorf("lease durations %s/%s/%s, want 1h0m0s/24h0m0s/168h0m0s", got.MinLeaseDuration, got.LeaseDuration, got.MaxLeaseDuration)
+	}
+	if got.RenewalRatio != 0.5 || got.RebindingRatio != 0.875 {
+		t.Errorf("renewal ratios %v/%v, want 0.5/0.875", got.RenewalRatio, got.RebindingRatio)
+	}
+
+	invalid := []struct {
+		name  string
+		extra string
+	}{
+		{"rebinding before renewal", "    renewal_ratio: 0.9\n    rebinding_ratio: 0.8\n"},
+		{"lease under min", "    lease_duration: 1h\n    min_lease_duration: 2h\n"},
+		{"lease over max", "    lease_duration: 48h\n    max_lease_duration: 24h\n"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseConfig(base, subnet(tt.extra)); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
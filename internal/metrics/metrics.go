@@ -19,6 +19,7 @@ type Metrics struct {
 	LeaseRenewals prometheus.Counter
 	LeaseReleases prometheus.Counter
 	LeaseDeclines prometheus.Counter
+	DeclinedAddresses *prometheus.GaugeVec
 
 	// IP allocation metrics
 	IPAllocations prometheus.Counter
@@ -42,6 +43,10 @@ type Metrics struct {
 	DatabaseQueries *prometheus.CounterVec
 	DatabaseErrors prometheus.Counter
 	DatabaseConnections prometheus.Gauge
+
+	// Write-behind lease renewal metrics (database.batch_writes)
+	LeaseBatchSize *prometheus.HistogramVec
+	LeaseBatchFlushDuration prometheus.Histogram
 }
 
 // New creates and registers all metrics
@@ -115,6 +120,14 @@ func New() *Metrics {
 			},
 		),
 
+		DeclinedAddresses: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "irondhcp_declined_addresses",
+				Help: "Number of addresses quarantined after a decline or failed ping check",
+			},
+			[]string{"subnet"},
+		),
+
 		// IP allocation metrics
 		IPAllocations: promauto.NewCounter(
 			prometheus.CounterOpts{
@@ -219,6 +232,24 @@ func New() *Metrics {
 				Help: "Number of active database connections",
 			},
 		),
+
+		// Write-behind lease renewal metrics
+		LeaseBatchSize: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "irondhcp_lease_batch_size",
+				Help:    "Number of lease renewals written per batch flush",
+				Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+			},
+			[]string{"status"}, // success, failed
+		),
+
+		LeaseBatchFlushDuration: promauto.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "irondhcp_lease_batch_flush_duration_seconds",
+				Help:    "Duration of lease renewal batch flushes",
+				Buckets: []float64{0.001, 0.005, 0.010, 0.025, 0.050, 0.100, 0.250, 0.500, 1.0},
+			},
+		),
 	}
 
 	return m
@@ -265,6 +296,14 @@ func (m *Metrics) RecordLeaseDecline() {
 	m.LeaseDeclines.Inc()
 }
 
+// UpdateDeclinedAddresses replaces the per-subnet declined address counts
+func (m *Metrics) UpdateDeclinedAddresses(counts map[string]int) {
+	m.DeclinedAddresses.Reset()
+	for subnet, count := range counts {
+		m.DeclinedAddresses.WithLabelValues(subnet).Set(float64(count))
+	}
+}
+
 // RecordGitSync records a git sync operation
 func (m *Metrics) RecordGitSync(success bool, duration float64) {
 	status := "success"
@@ -323,3 +362,13 @@ func (m *Metrics) RecordAllocationRetries(serverID, subnet string, retries float
 func (m *Metrics) RecordDatabaseLatency(operation string, duration float64) {
 	m.DatabaseLatency.WithLabelValues(operation).Observe(duration)
 }
+
+// RecordLeaseBatch records a flush of batched lease renewals
+func (m *Metrics) RecordLeaseBatch(size int, success bool, duration float64) {
+	status := "success"
+	if !success {
+		status = "failed"
+	}
+	m.LeaseBatchSize.WithLabelValues(status).Observe(float64(size))
+	m.LeaseBatchFlushDuration.Observe(duration)
+}
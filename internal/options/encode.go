@@ -0,0 +1,202 @@
+package options
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+)
+
+// Option is an encoded DHCPv4 option ready to be added to a reply
+type Option struct {
+	Code  uint8
+	Name  string
+	Value []byte
+}
+
+// Parse resolves and encodes a subnet options map
+// The result is ordered by option code so replies are deterministic
+func Parse(opts map[string]string) ([]Option, error) {
+	seen := make(map[uint8]string)
+	var result []Option
+
+	for key, value := range opts {
+		def, err := Lookup(key)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[def.Code]; ok {
+			return nil, fmt.Errorf("option %d configured twice ('%s' and '%s')", def.Code, other, key)
+		}
+		seen[def.Code] = key
+
+		data, err := Encode(def, value)
+		if err != nil {
+			return nil, fmt.Errorf("option '%s': %w", key, err)
+		}
+
+		result = append(result, Option{Code: def.Code, Name: def.Name, Value: data})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Code < result[j].Code })
+	return result, nil
+}
+
+// Encode converts a configured value to its wire format according to the option type
+// Lists are comma-separated; routes are "destination/len via router" pairs
+func Encode(def *Definition, value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+
+	switch def.Type {
+	case TypeIP:
+		ip, err := parseIPv4(value)
+		if err != nil {
+			return nil, err
+		}
+		return ip, nil
+
+	case TypeIPList:
+		var data []byte
+		for _, item := range splitList(value) {
+			ip, err := parseIPv4(item)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, ip...)
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("at least one IP address is required")
+		}
+		return data, nil
+
+	case TypeUint8:
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uint8 '%s'", value)
+		}
+		return []byte{uint8(n)}, nil
+
+	case TypeUint16:
+		n, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uint16 '%s'", value)
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(n)), nil
+
+	case TypeUint32:
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uint32 '%s'", value)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(n)), nil
+
+	case TypeInt32:
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int32 '%s'", value)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(n))), nil
+
+	case TypeString:
+		if value == "" {
+			return nil, fmt.Errorf("value must not be empty")
+		}
+		return []byte(value), nil
+
+	case TypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool '%s'", value)
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+
+	case TypeDomainList:
+		domains := splitList(value)
+		if len(domains) == 0 {
+			return nil, fmt.Errorf("at least one domain is required")
+		}
+		labels := &rfc1035label.Labels{Labels: domains}
+		return labels.ToBytes(), nil
+
+	case TypeRoutes:
+		return encodeRoutes(value)
+
+	case TypeHex:
+		return parseHex(value)
+	}
+
+	return nil, fmt.Errorf("unsupported option type %s", def.Type)
+}
+
+// encodeRoutes encodes classless static routes (RFC 3442)
+// Format: "10.0.0.0/8 via 192.168.1.1, 0.0.0.0/0 via 192.168.1.1"
+func encodeRoutes(value string) ([]byte, error) {
+	var routes dhcpv4.Routes
+	for _, item := range splitList(value) {
+		fields := strings.Fields(item)
+		if len(fields) == 3 && fields[1] == "via" {
+			fields = []string{fields[0], fields[2]}
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid route '%s' (expected 'destination/len via router')", item)
+		}
+
+		_, dest, err := net.ParseCIDR(fields[0])
+		if err != nil || dest.IP.To4() == nil {
+			return nil, fmt.Errorf("invalid route destination '%s'", fields[0])
+		}
+		router, err := parseIPv4(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		routes = append(routes, &dhcpv4.Route{Dest: dest, Router: router})
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("at least one route is required")
+	}
+	return routes.ToBytes(), nil
+}
+
+// parseIPv4 parses a single IPv4 address in 4-byte form
+func parseIPv4(value string) (net.IP, error) {
+	ip := net.ParseIP(strings.TrimSpace(value)).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IPv4 address '%s'", value)
+	}
+	return ip, nil
+}
+
+// parseHex parses raw bytes given as "0a0b0c", "0x0a0b0c" or "0a:0b:0c"
+func parseHex(value string) ([]byte, error) {
+	clean := strings.TrimPrefix(strings.ToLower(value), "0x")
+	clean = strings.NewReplacer(":", "", " ", "", "-", "").Replace(clean)
+	data, err := hex.DecodeString(clean)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex value '%s'", value)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("value must not be empty")
+	}
+	return data, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
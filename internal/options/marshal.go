@@ -0,0 +1,100 @@
+package options
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+const (
+	// headerLen is the fixed BOOTP header plus the magic cookie
+	headerLen = 240
+	// bootpMinLen is the minimum BOOTP message length (RFC 951)
+	bootpMinLen = 300
+	// defaultMaxMessageSize is the IP datagram size every client must accept (RFC 2131 section 2)
+	defaultMaxMessageSize = 576
+	// ipUDPOverhead is the IP and UDP header size included in the maximum message size
+	ipUDPOverhead = 28
+)
+
+// essential lists options that are always sent, regardless of the size limit
+var essential = map[uint8]bool{
+	uint8(dhcpv4.OptionDHCPMessageType):       true,
+	uint8(dhcpv4.OptionServerIdentifier):      true,
+	uint8(dhcpv4.OptionIPAddressLeaseTime):    true,
+	uint8(dhcpv4.OptionSubnetMask):            true,
+	uint8(dhcpv4.OptionRouter):                true,
+	uint8(dhcpv4.OptionMessage):               true,
+	uint8(dhcpv4.OptionRelayAgentInformation): true,
+}
+
+// MarshalReply serializes a reply with its options in the order the client asked for
+// The message type and server identifier come first, then options in the client's
+// Parameter Request List order, then any remaining options by code. Non-essential
+// options that would exceed the client's maximum message size are dropped, so the
+// options the client listed first are the last to go.
+func MarshalReply(resp *dhcpv4.DHCPv4, req *dhcpv4.DHCPv4) []byte {
+	maxSize := defaultMaxMessageSize - ipUDPOverhead
+	if size, err := req.MaxMessageSize(); err == nil && int(size)-ipUDPOverhead > maxSize {
+		maxSize = int(size) - ipUDPOverhead
+	}
+
+	order := []uint8{uint8(dhcpv4.OptionDHCPMessageType), uint8(dhcpv4.OptionServerIdentifier)}
+	for _, code := range req.ParameterRequestList() {
+		order = append(order, code.Code())
+	}
+	var rest []int
+	for code := range resp.Options {
+		rest = append(rest, int(code))
+	}
+	sort.Ints(rest)
+	for _, code := range rest {
+		order = append(order, uint8(code))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(resp.ToBytes()[:headerLen])
+
+	written := make(map[uint8]bool)
+	for _, code := range order {
+		value, ok := resp.Options[code]
+		if !ok || written[code] || code == uint8(dhcpv4.OptionEnd) || code == uint8(dhcpv4.OptionPad) {
+			continue
+		}
+		written[code] = true
+
+		encoded := encodeOption(code, value)
+		// Leave room for the End option
+		if !essential[code] && buf.Len()+len(encoded)+1 > maxSize {
+			continue
+		}
+		buf.Write(encoded)
+	}
+
+	buf.WriteByte(uint8(dhcpv4.OptionEnd))
+	if buf.Len() < bootpMinLen {
+		buf.Write(make([]byte, bootpMinLen-buf.Len()))
+	}
+
+	return buf.Bytes()
+}
+
+// encodeOption encodes a single option, splitting values over 255 bytes (RFC 3396)
+func encodeOption(code uint8, value []byte) []byte {
+	if len(value) == 0 {
+		return []byte{code, 0}
+	}
+
+	var out []byte
+	for len(value) > 0 {
+		n := len(value)
+		if n > 255 {
+			n = 255
+		}
+		out = append(out, code, uint8(n))
+		out = append(out, value[:n]...)
+		value = value[n:]
+	}
+	return out
+}
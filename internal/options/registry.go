@@ -0,0 +1,159 @@
+package options
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type describes how an option value is encoded on the wire (RFC 2132 section 2)
+type Type int
+
+const (
+	TypeIP         Type = iota // Single IPv4 address
+	TypeIPList                 // One or more IPv4 addresses
+	TypeUint8                  // 8-bit unsigned integer
+	TypeUint16                 // 16-bit unsigned integer
+	TypeUint32                 // 32-bit unsigned integer
+	TypeInt32                  // 32-bit signed integer
+	TypeString                 // NVT ASCII string
+	TypeBool                   // Single byte, 0 or 1
+	TypeDomainList             // RFC 1035 encoded domain names (RFC 3397)
+	TypeRoutes                 // Classless static routes (RFC 3442)
+	TypeHex                    // Raw bytes given as hex
+)
+
+// String returns a human-readable name for the type
+func (t Type) String() string {
+	switch t {
+	case TypeIP:
+		return "ip"
+	case TypeIPList:
+		return "ip-list"
+	case TypeUint8:
+		return "uint8"
+	case TypeUint16:
+		return "uint16"
+	case TypeUint32:
+		return "uint32"
+	case TypeInt32:
+		return "int32"
+	case TypeString:
+		return "string"
+	case TypeBool:
+		return "bool"
+	case TypeDomainList:
+		return "domain-list"
+	case TypeRoutes:
+		return "routes"
+	case TypeHex:
+		return "hex"
+	default:
+		return "unknown"
+	}
+}
+
+// Definition describes a known DHCPv4 option
+type Definition struct {
+	Code uint8
+	Name string
+	Type Type
+}
+
+// definitions is the registry of options that can be set from the subnet options map
+var definitions = []Definition{
+	{1, "subnet_mask", TypeIP},
+	{2, "time_offset", TypeInt32},
+	{3, "routers", TypeIPList},
+	{4, "time_servers", TypeIPList},
+	{6, "domain_name_servers", TypeIPList},
+	{7, "log_servers", TypeIPList},
+	{9, "lpr_servers", TypeIPList},
+	{12, "host_name", TypeString},
+	{15, "domain_name", TypeString},
+	{19, "ip_forwarding", TypeBool},
+	{23, "default_ip_ttl", TypeUint8},
+	{26, "interface_mtu", TypeUint16},
+	{28, "broadcast_address", TypeIP},
+	{35, "arp_cache_timeout", TypeUint32},
+	{37, "default_tcp_ttl", TypeUint8},
+	{38, "tcp_keepalive_interval", TypeUint32},
+	{40, "nis_domain", TypeString},
+	{41, "nis_servers", TypeIPList},
+	{42, "ntp_servers", TypeIPList},
+	{43, "vendor_encapsulated_options", TypeHex},
+	{44, "netbios_name_servers", TypeIPList},
+	{46, "netbios_node_type", TypeUint8},
+	{47, "netbios_scope", TypeString},
+	{66, "tftp_server_name", TypeString},
+	{67, "bootfile_name", TypeString},
+	{69, "smtp_servers", TypeIPList},
+	{70, "pop3_servers", TypeIPList},
+	{100, "tz_posix", TypeString},
+	{101, "tz_database", TypeString},
+	{114, "captive_portal", TypeString},
+	{119, "domain_search", TypeDomainList},
+	{121, "classless_static_routes", TypeRoutes},
+	{150, "tftp_server_address", TypeIPList},
+	{252, "wpad_url", TypeString},
+}
+
+// reserved lists option codes managed by the server that cannot be set from config
+var reserved = map[uint8]string{
+	0:   "pad",
+	50:  "requested IP address",
+	51:  "lease time (use lease_duration)",
+	52:  "option overload",
+	53:  "message type",
+	54:  "server identifier",
+	55:  "parameter request list",
+	57:  "maximum message size",
+	61:  "client identifier",
+	82:  "relay agent information",
+	255: "end",
+}
+
+var (
+	byName = make(map[string]*Definition)
+	byCode = make(map[uint8]*Definition)
+)
+
+func init() {
+	for i := range definitions {
+		def := &definitions[i]
+		byName[def.Name] = def
+		byCode[def.Code] = def
+	}
+}
+
+// Lookup resolves an option by name (e.g. "ntp_servers") or decimal code (e.g. "42")
+// Codes without a registered definition are treated as raw hex options
+func Lookup(key string) (*Definition, error) {
+	key = strings.TrimSpace(key)
+
+	if def, ok := byName[strings.ToLower(key)]; ok {
+		return def, checkReserved(def.Code)
+	}
+
+	code, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(key), "option_"), 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("unknown option '%s'", key)
+	}
+
+	if err := checkReserved(uint8(code)); err != nil {
+		return nil, err
+	}
+	if def, ok := byCode[uint8(code)]; ok {
+		return def, nil
+	}
+
+	return &Definition{Code: uint8(code), Name: fmt.Sprintf("option_%d", code), Type: TypeHex}, nil
+}
+
+// checkReserved returns an error if the option code is managed by the server
+func checkReserved(code uint8) error {
+	if reason, ok := reserved[code]; ok {
+		return fmt.Errorf("option %d (%s) is managed by the server and cannot be configured", code, reason)
+	}
+	return nil
+}
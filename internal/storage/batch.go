@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/logger"
+)
+
+// maxLeaseBatch flushes early once this many renewals are pending
+const maxLeaseBatch = 1000
+
+// closeFlushTimeout bounds the final flush when the store is closed
+const closeFlushTimeout = 10 * time.Second
+
+// LeaseRenewal is a pending RenewLease write
+type LeaseRenewal struct {
+	LeaseID   int64
+	ExpiresAt time.Time
+	LastSeen  time.Time
+}
+
+// BatchRecorder receives measurements of each batch flush
+type BatchRecorder interface {
+	RecordLeaseBatch(size int, success bool, duration float64)
+}
+
+// BatchedStore is a Backend that writes lease renewals behind in batches
+// RenewLease only queues the write; queued renewals for the same lease coalesce
+// and are flushed with one RenewLeases call every interval, or sooner once
+// maxLeaseBatch are pending. Lease lookups through the store see queued renewals,
+// and any other lease write or expiry query flushes first, so a renewal can
+// never be applied over a later release or decline. Other servers sharing the
+// database see renewals up to one interval late.
+type BatchedStore struct {
+	Backend
+
+	interval time.Duration
+	recorder BatchRecorder
+
+	mu      sync.Mutex
+	pending map[int64]LeaseRenewal
+	flushMu sync.Mutex // Held for a whole flush so batches are written in order
+
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBatchedStore wraps backend and starts flushing every interval
+// recorder may be nil.
+func NewBatchedStore(backend Backend, interval time.Duration, recorder BatchRecorder) *BatchedStore {
+	s := &BatchedStore{
+		Backend:  backend,
+		interval: interval,
+		recorder: recorder,
+		pending:  make(map[int64]LeaseRenewal),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go s.run()
+	return s
+}
+
+// run flushes on every tick and whenever a batch fills up
+func (s *BatchedStore) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.interval+closeFlushTimeout)
+		if err := s.Flush(ctx); err != nil {
+			logger.Error().Err(err).Msg("Failed to flush lease renewals, will retry")
+		}
+		cancel()
+	}
+}
+
+// Close flushes pending renewals and closes the wrapped backend
+func (s *BatchedStore) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+
+		ctx, cancel := context.WithTimeout(context.Background(), closeFlushTimeout)
+		defer cancel()
+		if err := s.Flush(ctx); err != nil {
+			logger.Error().Err(err).Msg("Failed to flush lease renewals on shutdown")
+		}
+
+		s.Backend.Close()
+	})
+}
+
+// Flush writes all pending renewals
+// Renewals that fail to write stay queued unless a newer one has replaced them.
+func (s *BatchedStore) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	batch := make([]LeaseRenewal, 0, len(s.pending))
+	for _, renewal := range s.pending {
+		batch = append(batch, renewal)
+	}
+	s.pending = make(map[int64]LeaseRenewal)
+	s.mu.Unlock()
+
+	start := time.Now()
+	err := s.Backend.RenewLeases(ctx, batch)
+	if s.recorder != nil {
+		s.recorder.RecordLeaseBatch(len(batch), err == nil, time.Since(start).Seconds())
+	}
+	if err != nil {
+		s.mu.Lock()
+		for _, renewal := range batch {
+			if _, ok := s.pending[renewal.LeaseID]; !ok {
+				s.pending[renewal.LeaseID] = renewal
+			}
+		}
+		s.mu.Unlock()
+		return fmt.Errorf("failed to flush %d lease renewals: %w", len(batch), err)
+	}
+
+	return nil
+}
+
+// RenewLease queues a renewal for the next flush
+func (s *BatchedStore) RenewLease(ctx context.Context, leaseID int64, expiresAt time.Time) error {
+	s.mu.Lock()
+	s.pending[leaseID] = LeaseRenewal{LeaseID: leaseID, ExpiresAt: expiresAt, LastSeen: time.Now()}
+	full := len(s.pending) >= maxLeaseBatch
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// overlay applies a queued renewal to a lease read from the backend
+func (s *BatchedStore) overlay(lease *Lease) *Lease {
+	if lease == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	renewal, ok := s.pending[lease.ID]
+	s.mu.Unlock()
+
+	if ok {
+		lease.ExpiresAt = renewal.ExpiresAt
+		lease.LastSeen = renewal.LastSeen
+		lease.State = LeaseStateActive
+	}
+	return lease
+}
+
+// GetLeaseByMAC retrieves a lease, including any queued renewal
+func (s *BatchedStore) GetLeaseByMAC(ctx context.Context, mac net.HardwareAddr, subnet *net.IPNet) (*Lease, error) {
+	lease, err := s.Backend.GetLeaseByMAC(ctx, mac, subnet)
+	if err != nil {
+		return nil, err
+	}
+	return s.overlay(lease), nil
+}
+
+// GetLeaseByIP retrieves a lease, including any queued renewal
+func (s *BatchedStore) GetLeaseByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*Lease, error) {
+	lease, err := s.Backend.GetLeaseByIP(ctx, ip, subnet)
+	if err != nil {
+		return nil, err
+	}
+	return s.overlay(lease), nil
+}
+
+// The remaining lease methods write or select leases by state or expiry,
+// so queued renewals are flushed before they run
+
+// UpdateLease flushes queued renewals and updates a lease
+func (s *BatchedStore) UpdateLease(ctx context.Context, lease *Lease) error {
+	if err := s.Flush(ctx); err != nil {
+		return err
+	}
+	return s.Backend.UpdateLease(ctx, lease)
+}
+
+// ApplyReplicatedLease flushes queued renewals and applies a partner's lease
+func (s *BatchedStore) ApplyReplicatedLease(ctx context.Context, lease *Lease) error {
+	if err := s.Flush(ctx); err != nil {
+		return err
+	}
+	return s.Backend.ApplyReplicatedLease(ctx, lease)
+}
+
+// ReleaseLease flushes queued renewals and releases a lease
+func (s *BatchedStore) ReleaseLease(ctx context.Context, ip net.IP, subnet *net.IPNet) error {
+	if err := s.Flush(ctx); err != nil {
+		return err
+	}
+	return s.Backend.ReleaseLease(ctx, ip, subnet)
+}
+
+// DeclineLease flushes queued renewals and declines a lease
+func (s *BatchedStore) DeclineLease(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, until time.Time, allocatedBy string) error {
+	if err := s.Flush(ctx); err != nil {
+		return err
+	}
+	return s.Backend.DeclineLease(ctx, ip, subnet, mac, until, allocatedBy)
+}
+
+// QuarantineIP flushes queued renewals and quarantines an address
+func (s *BatchedStore) QuarantineIP(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, until time.Time, allocatedBy string) error {
+	if err := s.Flush(ctx); err != nil {
+		return err
+	}
+	return s.Backend.QuarantineIP(ctx, ip, subnet, mac, until, allocatedBy)
+}
+
+// GetExpiredLeases flushes queued renewals and lists reusable leases
+func (s *BatchedStore) GetExpiredLeases(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP, limit int) ([]*Lease, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return s.Backend.GetExpiredLeases(ctx, subnet, rangeStart, rangeEnd, limit)
+}
+
+// ExpireOldLeases flushes queued renewals and expires lapsed leases
+func (s *BatchedStore) ExpireOldLeases(ctx context.Context) (int64, error) {
+	if err := s.Flush(ctx); err != nil {
+		return 0, err
+	}
+	return s.Backend.ExpireOldLeases(ctx)
+}
+
+// ExpireLeases flushes queued renewals and expires lapsed leases
+func (s *BatchedStore) ExpireLeases(ctx context.Context) (int64, error) {
+	if err := s.Flush(ctx); err != nil {
+		return 0, err
+	}
+	return s.Backend.ExpireLeases(ctx)
+}
+
+// DeleteOldLeases flushes queued renewals and deletes old expired leases
+func (s *BatchedStore) DeleteOldLeases(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if err := s.Flush(ctx); err != nil {
+		return 0, err
+	}
+	return s.Backend.DeleteOldLeases(ctx, olderThan)
+}
+
+// GetAllLeases flushes queued renewals and lists every lease
+func (s *BatchedStore) GetAllLeases(ctx context.Context) ([]*Lease, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return s.Backend.GetAllLeases(ctx)
+}
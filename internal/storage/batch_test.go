@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecord captures flushes reported to a BatchRecorder
+type batchRecord struct {
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (r *batchRecord) RecordLeaseBatch(size int, success bool, duration float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sizes = append(r.sizes, size)
+}
+
+func (r *batchRecord) flushes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.sizes...)
+}
+
+// newBatchTestLease stores an active lease that expires in a minute
+func newBatchTestLease(t *testing.T, store Backend, ip string) *Lease {
+	t.Helper()
+
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	now := time.Now()
+	lease := &Lease{
+		IP:        net.ParseIP(ip).To4(),
+		MAC:       mac,
+		Subnet:    subnet,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(time.Minute),
+		LastSeen:  now,
+		State:     LeaseStateActive,
+	}
+	if err := store.CreateLease(context.Background(), lease); err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	return lease
+}
+
+func TestBatchedStoreCoalescesRenewals(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore()
+	recorder := &batchRecord{}
+	store := NewBatchedStore(backend, time.Hour, recorder)
+	defer store.Close()
+
+	a := newBatchTestLease(t, store, "192.168.1.10")
+	b := newBatchTestLease(t, store, "192.168.1.11")
+
+	final := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	for i := 1; i <= 3; i++ {
+		if err := store.RenewLease(ctx, a.ID, time.Now().Add(time.Duration(i)*time.Hour).Truncate(time.Second)); err != nil {
+			t.Fatalf("RenewLease: %v", err)
+		}
+	}
+	if err := store.RenewLease(ctx, b.ID, final); err != nil {
+		t.Fatalf("RenewLease: %v", err)
+	}
+
+	// Nothing is written until a flush, but reads through the store see the renewal
+	raw, _ := backend.GetLeaseByIP(ctx, a.IP, a.Subnet)
+	if !raw.ExpiresAt.Equal(a.ExpiresAt) {
+		t.Errorf("renewal reached the backend before a flush")
+	}
+	seen, _ := store.GetLeaseByIP(ctx, a.IP, a.Subnet)
+	if !seen.ExpiresAt.Equal(final) {
+		t.Errorf("read through the store expires at %s, want %s", seen.ExpiresAt, final)
+	}
+
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := recorder.flushes(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("flushes = %v, want one batch of 2 coalesced renewals", got)
+	}
+	for _, lease := range []*Lease{a, b} {
+		stored, _ := backend.GetLeaseByIP(ctx, lease.IP, lease.Subnet)
+		if !stored.ExpiresAt.Equal(final) {
+			t.Errorf("%s expires at %s after flush, want %s", lease.IP, stored.ExpiresAt, final)
+		}
+	}
+}
+
+func TestBatchedStoreFlushesBeforeRelease(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore()
+	store := NewBatchedStore(backend, time.Hour, nil)
+	defer store.Close()
+
+	lease := newBatchTestLease(t, store, "192.168.1.10")
+	if err := store.RenewLease(ctx, lease.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RenewLease: %v", err)
+	}
+	if err := store.ReleaseLease(ctx, lease.IP, lease.Subnet); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+
+	// A later flush must not reactivate the released lease
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	stored, _ := backend.GetLeaseByIP(ctx, lease.IP, lease.Subnet)
+	if stored.State != LeaseStateReleased {
+		t.Errorf("state = %s, want %s", stored.State, LeaseStateReleased)
+	}
+}
+
+func TestBatchedStoreFlushesOnIntervalAndClose(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore()
+	store := NewBatchedStore(backend, 10*time.Millisecond, nil)
+
+	lease := newBatchTestLease(t, store, "192.168.1.10")
+	renewed := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := store.RenewLease(ctx, lease.ID, renewed); err != nil {
+		t.Fatalf("RenewLease: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		stored, _ := backend.GetLeaseByIP(ctx, lease.IP, lease.Subnet)
+		if stored.ExpiresAt.Equal(renewed) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("renewal was not flushed within the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Close writes whatever is still queued
+	later := renewed.Add(time.Hour)
+	if err := store.RenewLease(ctx, lease.ID, later); err != nil {
+		t.Fatalf("RenewLease: %v", err)
+	}
+	store.Close()
+
+	stored, _ := backend.GetLeaseByIP(ctx, lease.IP, lease.Subnet)
+	if !stored.ExpiresAt.Equal(later) {
+		t.Errorf("expires at %s after Close, want %s", stored.ExpiresAt, later)
+	}
+}
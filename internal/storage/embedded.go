@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket names in the embedded database, one per PostgreSQL table
+const (
+	bucketLeases       = "leases"
+	bucketLeasesV6     = "leases_v6"
+	bucketPrefixes     = "delegated_prefixes"
+	bucketReservations = "reservations"
+	bucketGitSyncLog   = "git_sync_log"
+	bucketActiveConfig = "active_config"
+)
+
+// pinnedCommitID is the key of the rollback pin in the active_config bucket,
+// next to the active config itself as in the PostgreSQL table
+const pinnedCommitID = 2
+
+// EmbeddedStore is a single-node storage backend kept in a BoltDB file
+// Records are held in memory and written through to the file, which suits the
+// small deployments it is meant for. Only one server may use the file at a time.
+type EmbeddedStore struct {
+	db *bolt.DB
+
+	mu           sync.RWMutex
+	leases       map[int64]*embeddedLease
+	leasesV6     map[int64]*LeaseV6
+	prefixes     map[int64]*DelegatedPrefix
+	reservations map[int64]*Reservation
+	gitSyncLogs  map[int64]*GitSyncLog
+	activeConfig *ActiveConfig
+	pinnedCommit string
+	sequences    map[string]int64 // Last ID handed out per bucket
+
+	locks keyedLocks
+}
+
+// embeddedPin is the stored rollback pin
+type embeddedPin struct {
+	Commit string
+}
+
+// embeddedLease is the stored record of a lease
+type embeddedLease struct {
+	Lease
+}
+
+// OpenEmbedded opens (creating if needed) the BoltDB file at path and loads its records
+func OpenEmbedded(path string) (*EmbeddedStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded database %s: %w", path, err)
+	}
+
+	s := newEmbeddedStore()
+	s.db = db
+
+	if err := s.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewMemoryStore creates a storage backend that keeps everything in memory
+// Nothing survives a restart, so it is meant for tests and throwaway lab servers.
+func NewMemoryStore() *EmbeddedStore {
+	return newEmbeddedStore()
+}
+
+// newEmbeddedStore creates an empty store without a backing file
+func newEmbeddedStore() *EmbeddedStore {
+	return &EmbeddedStore{
+		leases:       make(map[int64]*embeddedLease),
+		leasesV6:     make(map[int64]*LeaseV6),
+		prefixes:     make(map[int64]*DelegatedPrefix),
+		reservations: make(map[int64]*Reservation),
+		gitSyncLogs:  make(map[int64]*GitSyncLog),
+		sequences:    make(map[string]int64),
+		locks:        keyedLocks{locks: make(map[int64]*keyedLock)},
+	}
+}
+
+// load creates the buckets and reads every record into memory
+func (s *EmbeddedStore) load() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{bucketLeases, bucketLeasesV6, bucketPrefixes, bucketReservations, bucketGitSyncLog, bucketActiveConfig} {
+			bucket, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", name, err)
+			}
+
+			err = bucket.ForEach(func(k, v []byte) error {
+				id := int64(binary.BigEndian.Uint64(k))
+				if id > s.sequences[name] {
+					s.sequences[name] = id
+				}
+				return s.decode(name, id, v)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to load %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// decode stores one persisted record in the matching map
+func (s *EmbeddedStore) decode(bucket string, id int64, data []byte) error {
+	switch bucket {
+	case bucketLeases:
+		var lease embeddedLease
+		if err := json.Unmarshal(data, &lease); err != nil {
+			return err
+		}
+		s.leases[id] = &lease
+	case bucketLeasesV6:
+		var lease LeaseV6
+		if err := json.Unmarshal(data, &lease); err != nil {
+			return err
+		}
+		s.leasesV6[id] = &lease
+	case bucketPrefixes:
+		var p DelegatedPrefix
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		s.prefixes[id] = &p
+	case bucketReservations:
+		var reservation Reservation
+		if err := json.Unmarshal(data, &reservation); err != nil {
+			return err
+		}
+		s.reservations[id] = &reservation
+	case bucketGitSyncLog:
+		var log GitSyncLog
+		if err := json.Unmarshal(data, &log); err != nil {
+			return err
+		}
+		s.gitSyncLogs[id] = &log
+	case bucketActiveConfig:
+		if id == pinnedCommitID {
+			var pin embeddedPin
+			if err := json.Unmarshal(data, &pin); err != nil {
+				return err
+			}
+			s.pinnedCommit = pin.Commit
+			return nil
+		}
+		var cfg ActiveConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		s.activeConfig = &cfg
+	}
+	return nil
+}
+
+// nextID reserves the next record ID for a bucket; the caller holds s.mu
+func (s *EmbeddedStore) nextID(bucket string) int64 {
+	s.sequences[bucket]++
+	return s.sequences[bucket]
+}
+
+// persist writes records to the backing file in one transaction; the caller holds s.mu
+// Callers update the in-memory maps only after persist succeeds
+func (s *EmbeddedStore) persist(bucket string, records map[int64]interface{}) error {
+	if len(records) == 0 || s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		for id, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(embeddedKey(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// unpersist deletes records from the backing file in one transaction; the caller holds s.mu
+func (s *EmbeddedStore) unpersist(bucket string, ids []int64) error {
+	if len(ids) == 0 || s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		for _, id := range ids {
+			if err := b.Delete(embeddedKey(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// persistBatch writes and deletes records in one transaction; the caller holds s.mu
+func (s *EmbeddedStore) persistBatch(bucket string, records map[int64]interface{}, deleted []int64) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		for _, id := range deleted {
+			if err := b.Delete(embeddedKey(id)); err != nil {
+				return err
+			}
+		}
+		for id, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(embeddedKey(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// embeddedKey encodes a record ID so keys sort numerically
+func embeddedKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// Driver returns the database.driver name of the backend
+func (s *EmbeddedStore) Driver() string {
+	if s.db == nil {
+		return DriverMemory
+	}
+	return DriverBolt
+}
+
+// Close closes the backing file
+func (s *EmbeddedStore) Close() {
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+// Health checks that the backing file is still open
+func (s *EmbeddedStore) Health(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+// Stats reports zero values; the embedded backend has no connection pool
+func (s *EmbeddedStore) Stats() PoolStats {
+	return PoolStats{}
+}
+
+// WithAdvisoryLock executes a function while holding an in-process lock on key
+func (s *EmbeddedStore) WithAdvisoryLock(ctx context.Context, key int64, fn func(context.Context) error) error {
+	if err := s.locks.acquire(ctx, key); err != nil {
+		return fmt.Errorf("failed to acquire advisory lock: %w", err)
+	}
+	defer s.locks.release(key)
+
+	return fn(ctx)
+}
+
+// keyedLocks is a set of mutexes addressed by advisory lock key
+// Entries are removed once no goroutine holds or waits for them
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[int64]*keyedLock
+}
+
+type keyedLock struct {
+	held chan struct{} // Buffered with capacity one; a value in it means the lock is held
+	refs int
+}
+
+// acquire waits for the lock on key or for ctx to be cancelled
+func (l *keyedLocks) acquire(ctx context.Context, key int64) error {
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyedLock{held: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	select {
+	case lock.held <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		l.unref(key, lock)
+		return ctx.Err()
+	}
+}
+
+// release unlocks key
+func (l *keyedLocks) release(key int64) {
+	l.mu.Lock()
+	lock := l.locks[key]
+	l.mu.Unlock()
+
+	<-lock.held
+	l.unref(key, lock)
+}
+
+func (l *keyedLocks) unref(key int64, lock *keyedLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+// ipInRange reports whether start <= ip <= end, comparing addresses of the same family
+func ipInRange(ip, start, end net.IP) bool {
+	ip16, start16, end16 := ip.To16(), start.To16(), end.To16()
+	return bytes.Compare(ip16, start16) >= 0 && bytes.Compare(ip16, end16) <= 0
+}
+
+// sameNetwork reports whether two networks are identical, as PostgreSQL compares cidr values
+func sameNetwork(a, b *net.IPNet) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.String() == b.String()
+}
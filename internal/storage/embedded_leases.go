@@ -0,0 +1,618 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// insertRecord stores a new record under an ID from nextID; the caller holds s.mu
+func insertRecord[T any](s *EmbeddedStore, bucket string, records map[int64]*T, id int64, record *T) error {
+	if err := s.persist(bucket, map[int64]interface{}{id: record}); err != nil {
+		return err
+	}
+	records[id] = record
+	return nil
+}
+
+// updateWhere applies fn to a copy of every record matching match, persists
+// the copies and swaps them in; the caller holds s.mu
+func updateWhere[T any](s *EmbeddedStore, bucket string, records map[int64]*T, match func(*T) bool, fn func(*T)) (int64, error) {
+	changed := make(map[int64]*T)
+	pending := make(map[int64]interface{})
+	for id, record := range records {
+		if !match(record) {
+			continue
+		}
+		c := *record
+		fn(&c)
+		changed[id] = &c
+		pending[id] = &c
+	}
+
+	if err := s.persist(bucket, pending); err != nil {
+		return 0, err
+	}
+	for id, c := range changed {
+		records[id] = c
+	}
+	return int64(len(changed)), nil
+}
+
+// deleteWhere removes every record matching match; the caller holds s.mu
+func deleteWhere[T any](s *EmbeddedStore, bucket string, records map[int64]*T, match func(*T) bool) (int64, error) {
+	var ids []int64
+	for id, record := range records {
+		if match(record) {
+			ids = append(ids, id)
+		}
+	}
+
+	if err := s.unpersist(bucket, ids); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		delete(records, id)
+	}
+	return int64(len(ids)), nil
+}
+
+// findLease returns the lease matching match with the latest expiry; the caller holds s.mu
+func (s *EmbeddedStore) findLease(match func(*embeddedLease) bool) *embeddedLease {
+	var found *embeddedLease
+	for _, lease := range s.leases {
+		if match(lease) && (found == nil || lease.ExpiresAt.After(found.ExpiresAt)) {
+			found = lease
+		}
+	}
+	return found
+}
+
+// copyLease returns a copy of the stored lease that callers may modify
+func (l *embeddedLease) copyLease() *Lease {
+	lease := l.Lease
+	return &lease
+}
+
+// GetLeaseByMAC retrieves a lease by MAC address
+func (s *EmbeddedStore) GetLeaseByMAC(ctx context.Context, mac net.HardwareAddr, subnet *net.IPNet) (*Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lease := s.findLease(func(l *embeddedLease) bool {
+		return l.State == LeaseStateActive && l.MAC.String() == mac.String() && sameNetwork(l.Subnet, subnet)
+	})
+	if lease == nil {
+		return nil, nil
+	}
+	return lease.copyLease(), nil
+}
+
+// GetLeaseByIP retrieves a lease by IP address
+func (s *EmbeddedStore) GetLeaseByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lease := s.findLease(func(l *embeddedLease) bool {
+		return l.IP.Equal(ip) && sameNetwork(l.Subnet, subnet)
+	})
+	if lease == nil {
+		return nil, nil
+	}
+	return lease.copyLease(), nil
+}
+
+// CreateLease creates a new lease record
+func (s *EmbeddedStore) CreateLease(ctx context.Context, lease *Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.findLease(func(l *embeddedLease) bool {
+		return l.IP.Equal(lease.IP) && sameNetwork(l.Subnet, lease.Subnet)
+	})
+	if existing != nil {
+		return fmt.Errorf("failed to create lease: %s already leased in %s", lease.IP, lease.Subnet)
+	}
+
+	now := time.Now()
+	record := &embeddedLease{Lease: *lease}
+	record.CreatedAt = now
+	record.UpdatedAt = now
+
+	record.ID = s.nextID(bucketLeases)
+	if err := insertRecord(s, bucketLeases, s.leases, record.ID, record); err != nil {
+		return fmt.Errorf("failed to create lease: %w", err)
+	}
+
+	lease.ID = record.ID
+	lease.CreatedAt = now
+	lease.UpdatedAt = now
+
+	return nil
+}
+
+// UpdateLease updates an existing lease record
+func (s *EmbeddedStore) UpdateLease(ctx context.Context, lease *Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count, err := updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { return l.ID == lease.ID },
+		func(l *embeddedLease) {
+			l.Hostname = lease.Hostname
+			l.IssuedAt = lease.IssuedAt
+			l.ExpiresAt = lease.ExpiresAt
+			l.LastSeen = lease.LastSeen
+			l.State = lease.State
+			l.ClientID = lease.ClientID
+			l.VendorClass = lease.VendorClass
+			l.UserClass = lease.UserClass
+			l.AllocatedBy = lease.AllocatedBy
+			l.CircuitID = lease.CircuitID
+			l.RemoteID = lease.RemoteID
+			l.MAC = lease.MAC
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to update lease: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("failed to update lease: lease %d not found", lease.ID)
+	}
+
+	lease.UpdatedAt = now
+	return nil
+}
+
+// ApplyReplicatedLease stores a lease received from a failover partner
+// Records are matched on (ip, subnet) and only overwritten when the incoming copy was seen later
+func (s *EmbeddedStore) ApplyReplicatedLease(ctx context.Context, lease *Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	existing := s.findLease(func(l *embeddedLease) bool {
+		return l.IP.Equal(lease.IP) && sameNetwork(l.Subnet, lease.Subnet)
+	})
+	if existing == nil {
+		record := &embeddedLease{Lease: *lease}
+		record.CreatedAt = now
+		record.UpdatedAt = now
+		record.ID = s.nextID(bucketLeases)
+		if err := insertRecord(s, bucketLeases, s.leases, record.ID, record); err != nil {
+			return fmt.Errorf("failed to apply replicated lease: %w", err)
+		}
+		return nil
+	}
+	if existing.LastSeen.After(lease.LastSeen) {
+		return nil
+	}
+
+	_, err := updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { return l.ID == existing.ID },
+		func(l *embeddedLease) {
+			id, createdAt := l.ID, l.CreatedAt
+			l.Lease = *lease
+			l.ID = id
+			l.CreatedAt = createdAt
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to apply replicated lease: %w", err)
+	}
+
+	return nil
+}
+
+// RenewLease renews an existing lease with a new expiration time
+func (s *EmbeddedStore) RenewLease(ctx context.Context, leaseID int64, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	_, err := updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { return l.ID == leaseID },
+		func(l *embeddedLease) {
+			l.ExpiresAt = expiresAt
+			l.LastSeen = now
+			l.State = LeaseStateActive
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to renew lease: %w", err)
+	}
+
+	return nil
+}
+
+// RenewLeases applies many renewals in one transaction
+func (s *EmbeddedStore) RenewLeases(ctx context.Context, renewals []LeaseRenewal) error {
+	byID := make(map[int64]LeaseRenewal, len(renewals))
+	for _, r := range renewals {
+		byID[r.LeaseID] = r
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	_, err := updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { _, ok := byID[l.ID]; return ok },
+		func(l *embeddedLease) {
+			r := byID[l.ID]
+			l.ExpiresAt = r.ExpiresAt
+			l.LastSeen = r.LastSeen
+			l.State = LeaseStateActive
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to renew leases: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseLease marks a lease as released
+func (s *EmbeddedStore) ReleaseLease(ctx context.Context, ip net.IP, subnet *net.IPNet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	_, err := updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { return l.IP.Equal(ip) && sameNetwork(l.Subnet, subnet) },
+		func(l *embeddedLease) {
+			l.State = LeaseStateReleased
+			l.LastSeen = now
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+
+	return nil
+}
+
+// DeclineLease marks a lease as declined (IP conflict detected)
+// The address stays out of the pool until the quarantine ends at until. Only the client
+// holding the lease may decline an active lease; an address with no lease is quarantined.
+func (s *EmbeddedStore) DeclineLease(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, until time.Time, allocatedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	existing := s.findLease(func(l *embeddedLease) bool {
+		return l.IP.Equal(ip) && sameNetwork(l.Subnet, subnet)
+	})
+	if existing == nil {
+		record := &embeddedLease{
+			Lease: Lease{
+				IP:          ip,
+				MAC:         mac,
+				Subnet:      subnet,
+				IssuedAt:    now,
+				ExpiresAt:   until,
+				LastSeen:    now,
+				State:       LeaseStateDeclined,
+				AllocatedBy: allocatedBy,
+				DeclinedAt:  &now,
+				DeclinedBy:  mac.String(),
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			},
+		}
+		record.ID = s.nextID(bucketLeases)
+		if err := insertRecord(s, bucketLeases, s.leases, record.ID, record); err != nil {
+			return fmt.Errorf("failed to decline lease: %w", err)
+		}
+		return nil
+	}
+	if existing.IsActive() && existing.MAC.String() != mac.String() {
+		return ErrLeaseHeldByOther
+	}
+
+	_, err := updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { return l.ID == existing.ID },
+		func(l *embeddedLease) {
+			l.MAC = mac
+			l.State = LeaseStateDeclined
+			l.LastSeen = now
+			l.DeclinedAt = &now
+			l.DeclinedBy = mac.String()
+			l.ExpiresAt = until
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to decline lease: %w", err)
+	}
+
+	return nil
+}
+
+// QuarantineIP marks an address as declined until the given time
+// Used when conflict detection finds a host answering on an address the server was about to offer
+func (s *EmbeddedStore) QuarantineIP(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, until time.Time, allocatedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	existing := s.findLease(func(l *embeddedLease) bool {
+		return l.IP.Equal(ip) && sameNetwork(l.Subnet, subnet)
+	})
+	if existing == nil {
+		record := &embeddedLease{
+			Lease: Lease{
+				IP:          ip,
+				MAC:         mac,
+				Subnet:      subnet,
+				IssuedAt:    now,
+				ExpiresAt:   until,
+				LastSeen:    now,
+				State:       LeaseStateDeclined,
+				AllocatedBy: allocatedBy,
+				DeclinedAt:  &now,
+				DeclinedBy:  "ping_check",
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			},
+		}
+		record.ID = s.nextID(bucketLeases)
+		if err := insertRecord(s, bucketLeases, s.leases, record.ID, record); err != nil {
+			return fmt.Errorf("failed to quarantine IP: %w", err)
+		}
+		return nil
+	}
+
+	_, err := updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { return l.ID == existing.ID },
+		func(l *embeddedLease) {
+			l.MAC = mac
+			l.ExpiresAt = until
+			l.LastSeen = now
+			l.State = LeaseStateDeclined
+			l.DeclinedAt = &now
+			l.DeclinedBy = "ping_check"
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine IP: %w", err)
+	}
+
+	return nil
+}
+
+// ReclaimDeclinedLeases returns declined addresses whose quarantine has lapsed to the pool
+func (s *EmbeddedStore) ReclaimDeclinedLeases(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count, err := updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { return l.State == LeaseStateDeclined && l.ExpiresAt.Before(now) },
+		func(l *embeddedLease) {
+			l.State = LeaseStateExpired
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return 0, fmt.Errorf("failed to reclaim declined leases: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetDeclinedAddresses returns the addresses currently quarantined after a decline or failed ping check
+func (s *EmbeddedStore) GetDeclinedAddresses(ctx context.Context) ([]*DeclinedAddress, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var addresses []*DeclinedAddress
+	for _, l := range s.leases {
+		if l.State != LeaseStateDeclined {
+			continue
+		}
+		declinedAt := l.LastSeen
+		if l.DeclinedAt != nil {
+			declinedAt = *l.DeclinedAt
+		}
+		addresses = append(addresses, &DeclinedAddress{
+			IP:               l.IP,
+			MAC:              l.MAC,
+			Subnet:           l.Subnet,
+			DeclinedBy:       l.DeclinedBy,
+			DeclinedAt:       declinedAt,
+			QuarantinedUntil: l.ExpiresAt,
+			AllocatedBy:      l.AllocatedBy,
+		})
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		if c := compareNetworks(addresses[i].Subnet, addresses[j].Subnet); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(addresses[i].IP.To16(), addresses[j].IP.To16()) < 0
+	})
+
+	return addresses, nil
+}
+
+// GetExpiredLeases returns leases that have expired, including declined ones past their quarantine
+func (s *EmbeddedStore) GetExpiredLeases(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP, limit int) ([]*Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var leases []*Lease
+	for _, l := range s.leases {
+		if !sameNetwork(l.Subnet, subnet) || !ipInRange(l.IP, rangeStart, rangeEnd) {
+			continue
+		}
+		reusable := l.State == LeaseStateExpired || l.State == LeaseStateReleased ||
+			(l.State == LeaseStateDeclined && l.ExpiresAt.Before(now))
+		if reusable {
+			leases = append(leases, l.copyLease())
+		}
+	}
+
+	sort.Slice(leases, func(i, j int) bool { return leases[i].ExpiresAt.Before(leases[j].ExpiresAt) })
+	if len(leases) > limit {
+		leases = leases[:limit]
+	}
+
+	return leases, nil
+}
+
+// GetLeasedIPs returns every address in a range that has a lease row, whatever its state
+func (s *EmbeddedStore) GetLeasedIPs(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP) ([]net.IP, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ips []net.IP
+	for _, l := range s.leases {
+		if sameNetwork(l.Subnet, subnet) && ipInRange(l.IP, rangeStart, rangeEnd) {
+			ips = append(ips, append(net.IP(nil), l.IP...))
+		}
+	}
+
+	return ips, nil
+}
+
+// ExpireOldLeases marks leases as expired if they have passed their expiration time
+func (s *EmbeddedStore) ExpireOldLeases(ctx context.Context) (int64, error) {
+	count, err := s.expireLeases()
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire old leases: %w", err)
+	}
+	return count, nil
+}
+
+// ExpireLeases marks all expired leases as expired
+func (s *EmbeddedStore) ExpireLeases(ctx context.Context) (int64, error) {
+	count, err := s.expireLeases()
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire leases: %w", err)
+	}
+	return count, nil
+}
+
+// expireLeases moves active leases past their expiry to expired
+func (s *EmbeddedStore) expireLeases() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	return updateWhere(s, bucketLeases, s.leases,
+		func(l *embeddedLease) bool { return l.State == LeaseStateActive && l.ExpiresAt.Before(now) },
+		func(l *embeddedLease) {
+			l.State = LeaseStateExpired
+			l.UpdatedAt = now
+		})
+}
+
+// DeleteOldLeases removes leases older than the specified duration
+func (s *EmbeddedStore) DeleteOldLeases(ctx context.Context, olderThan time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	count, err := deleteWhere(s, bucketLeases, s.leases, func(l *embeddedLease) bool {
+		return (l.State == LeaseStateExpired || l.State == LeaseStateReleased) && l.UpdatedAt.Before(cutoff)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old leases: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetLeaseStatistics returns aggregated statistics per subnet (DHCPv4 and DHCPv6)
+func (s *EmbeddedStore) GetLeaseStatistics(ctx context.Context) ([]*LeaseStatistics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bySubnet := make(map[string]*LeaseStatistics)
+	add := func(subnet *net.IPNet, state LeaseState, expiresAt, lastSeen time.Time) {
+		stat, ok := bySubnet[subnet.String()]
+		if !ok {
+			stat = &LeaseStatistics{Subnet: subnet}
+			bySubnet[subnet.String()] = stat
+		}
+
+		switch state {
+		case LeaseStateActive:
+			stat.ActiveLeases++
+			if stat.NextExpiry == nil || expiresAt.Before(*stat.NextExpiry) {
+				next := expiresAt
+				stat.NextExpiry = &next
+			}
+		case LeaseStateExpired:
+			stat.ExpiredLeases++
+		case LeaseStateReleased:
+			stat.ReleasedLeases++
+		case LeaseStateDeclined:
+			stat.DeclinedLeases++
+		}
+
+		if stat.LastActivity == nil || lastSeen.After(*stat.LastActivity) {
+			last := lastSeen
+			stat.LastActivity = &last
+		}
+	}
+
+	for _, l := range s.leases {
+		add(l.Subnet, l.State, l.ExpiresAt, l.LastSeen)
+	}
+	for _, l := range s.leasesV6 {
+		add(l.Subnet, l.State, l.ExpiresAt, l.LastSeen)
+	}
+
+	var stats []*LeaseStatistics
+	for _, stat := range bySubnet {
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return compareNetworks(stats[i].Subnet, stats[j].Subnet) < 0 })
+
+	return stats, nil
+}
+
+// GetActiveLeaseCount returns the count of active leases in a subnet
+func (s *EmbeddedStore) GetActiveLeaseCount(ctx context.Context, subnet *net.IPNet) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var count int64
+	for _, l := range s.leases {
+		if sameNetwork(l.Subnet, subnet) && l.State == LeaseStateActive && l.ExpiresAt.After(now) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetAllLeases retrieves all leases
+func (s *EmbeddedStore) GetAllLeases(ctx context.Context) ([]*Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	leases := make([]*Lease, 0, len(s.leases))
+	for _, l := range s.leases {
+		leases = append(leases, l.copyLease())
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].ExpiresAt.After(leases[j].ExpiresAt) })
+
+	return leases, nil
+}
+
+// compareNetworks orders networks by address and then prefix length, as PostgreSQL orders cidr values
+func compareNetworks(a, b *net.IPNet) int {
+	if c := bytes.Compare(a.IP.To16(), b.IP.To16()); c != 0 {
+		return c
+	}
+	aOnes, _ := a.Mask.Size()
+	bOnes, _ := b.Mask.Size()
+	return aOnes - bOnes
+}
@@ -0,0 +1,439 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// findReservation returns a copy of the first reservation matching match; the caller holds s.mu
+func (s *EmbeddedStore) findReservation(match func(*Reservation) bool) *Reservation {
+	for _, r := range s.reservations {
+		if match(r) {
+			reservation := *r
+			return &reservation
+		}
+	}
+	return nil
+}
+
+// reservationConflict reports which unique constraint a reservation would violate
+// The PostgreSQL schema keeps MAC, (ip, subnet) and (circuit_id, remote_id) unique
+func (s *EmbeddedStore) reservationConflict(reservation *Reservation) error {
+	return reservationConflictIn(s.reservations, reservation)
+}
+
+// reservationConflictIn is reservationConflict against an arbitrary set of reservations
+func reservationConflictIn(reservations map[int64]*Reservation, reservation *Reservation) error {
+	for _, r := range reservations {
+		if r.ID == reservation.ID {
+			continue
+		}
+		if len(reservation.MAC) > 0 && r.MAC.String() == reservation.MAC.String() {
+			return fmt.Errorf("MAC %s is already reserved", reservation.MAC)
+		}
+		if r.IP.Equal(reservation.IP) && sameNetwork(r.Subnet, reservation.Subnet) {
+			return fmt.Errorf("IP %s is already reserved in %s", reservation.IP, reservation.Subnet)
+		}
+		if reservation.CircuitID != "" && r.CircuitID == reservation.CircuitID && r.RemoteID == reservation.RemoteID {
+			return fmt.Errorf("relay agent %s is already reserved", ReservationKey(nil, reservation.CircuitID, reservation.RemoteID))
+		}
+	}
+	return nil
+}
+
+// GetReservationByMAC retrieves a reservation by MAC address
+func (s *EmbeddedStore) GetReservationByMAC(ctx context.Context, mac net.HardwareAddr) (*Reservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.findReservation(func(r *Reservation) bool {
+		return len(r.MAC) > 0 && r.MAC.String() == mac.String()
+	}), nil
+}
+
+// GetReservationByIP retrieves a reservation by IP address
+func (s *EmbeddedStore) GetReservationByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*Reservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.findReservation(func(r *Reservation) bool {
+		return r.IP.Equal(ip) && sameNetwork(r.Subnet, subnet)
+	}), nil
+}
+
+// GetReservationByRelayAgent retrieves a reservation keyed on relay agent information
+// A reservation with a remote-id only matches that remote-id; one without matches any
+func (s *EmbeddedStore) GetReservationByRelayAgent(ctx context.Context, circuitID, remoteID string, subnet *net.IPNet) (*Reservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *Reservation
+	for _, r := range s.reservations {
+		if r.CircuitID != circuitID || !sameNetwork(r.Subnet, subnet) {
+			continue
+		}
+		if r.RemoteID != "" && r.RemoteID != remoteID {
+			continue
+		}
+		// A reservation naming the remote-id wins over a wildcard one
+		if found == nil || r.RemoteID > found.RemoteID {
+			found = r
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+
+	reservation := *found
+	return &reservation, nil
+}
+
+// CreateReservation creates a new reservation
+func (s *EmbeddedStore) CreateReservation(ctx context.Context, reservation *Reservation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := *reservation
+	record.ID = 0
+	if err := s.reservationConflict(&record); err != nil {
+		return fmt.Errorf("failed to create reservation: %w", err)
+	}
+
+	now := time.Now()
+	record.ID = s.nextID(bucketReservations)
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	if err := insertRecord(s, bucketReservations, s.reservations, record.ID, &record); err != nil {
+		return fmt.Errorf("failed to create reservation: %w", err)
+	}
+
+	reservation.ID = record.ID
+	reservation.CreatedAt = now
+	reservation.UpdatedAt = now
+
+	return nil
+}
+
+// UpdateReservation updates an existing reservation
+func (s *EmbeddedStore) UpdateReservation(ctx context.Context, reservation *Reservation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.reservations[reservation.ID]
+	if !ok {
+		return fmt.Errorf("failed to update reservation: reservation %d not found", reservation.ID)
+	}
+
+	// The MAC is not updatable, as in the PostgreSQL backend
+	candidate := *reservation
+	candidate.MAC = existing.MAC
+	if err := s.reservationConflict(&candidate); err != nil {
+		return fmt.Errorf("failed to update reservation: %w", err)
+	}
+
+	now := time.Now()
+	_, err := updateWhere(s, bucketReservations, s.reservations,
+		func(r *Reservation) bool { return r.ID == reservation.ID },
+		func(r *Reservation) {
+			r.IP = reservation.IP
+			r.Hostname = reservation.Hostname
+			r.Subnet = reservation.Subnet
+			r.Description = reservation.Description
+			r.TFTPServer = reservation.TFTPServer
+			r.BootFilename = reservation.BootFilename
+			r.BootRules = reservation.BootRules
+			r.CircuitID = reservation.CircuitID
+			r.RemoteID = reservation.RemoteID
+			r.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to update reservation: %w", err)
+	}
+
+	reservation.UpdatedAt = now
+	return nil
+}
+
+// DeleteReservation deletes a reservation
+func (s *EmbeddedStore) DeleteReservation(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := deleteWhere(s, bucketReservations, s.reservations, func(r *Reservation) bool { return r.ID == id }); err != nil {
+		return fmt.Errorf("failed to delete reservation: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAllReservations removes all reservations (used during config sync)
+func (s *EmbeddedStore) DeleteAllReservations(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := deleteWhere(s, bucketReservations, s.reservations, func(r *Reservation) bool { return true }); err != nil {
+		return fmt.Errorf("failed to delete all reservations: %w", err)
+	}
+
+	return nil
+}
+
+// ApplyReservationChanges deletes, updates and creates reservations in one transaction
+// Conflicts are checked against the final set, so reservations may swap addresses.
+func (s *EmbeddedStore) ApplyReservationChanges(ctx context.Context, changes *ReservationChanges) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	final := make(map[int64]*Reservation, len(s.reservations))
+	for id, r := range s.reservations {
+		final[id] = r
+	}
+
+	var deleted []int64
+	for _, reservation := range changes.Delete {
+		if _, ok := final[reservation.ID]; ok {
+			delete(final, reservation.ID)
+			deleted = append(deleted, reservation.ID)
+		}
+	}
+
+	now := time.Now()
+	pending := make(map[int64]interface{})
+	var written []*Reservation
+	for _, reservation := range changes.Update {
+		existing, ok := final[reservation.ID]
+		if !ok {
+			return fmt.Errorf("failed to apply reservation changes: reservation %d not found", reservation.ID)
+		}
+
+		// The MAC is not updatable, as in UpdateReservation
+		record := *reservation
+		record.MAC = existing.MAC
+		record.CreatedAt = existing.CreatedAt
+		record.UpdatedAt = now
+		final[record.ID] = &record
+		pending[record.ID] = &record
+		written = append(written, &record)
+	}
+
+	// IDs are only handed out once the changes are known to apply
+	sequence := s.sequences[bucketReservations]
+	for _, reservation := range changes.Create {
+		sequence++
+		record := *reservation
+		record.ID = sequence
+		record.CreatedAt = now
+		record.UpdatedAt = now
+		final[record.ID] = &record
+		pending[record.ID] = &record
+		written = append(written, &record)
+	}
+
+	for _, record := range written {
+		if err := reservationConflictIn(final, record); err != nil {
+			return fmt.Errorf("failed to apply reservation changes: reservation %s: %w", record.Key(), err)
+		}
+	}
+
+	if err := s.persistBatch(bucketReservations, pending, deleted); err != nil {
+		return fmt.Errorf("failed to apply reservation changes: %w", err)
+	}
+
+	s.reservations = final
+	s.sequences[bucketReservations] = sequence
+
+	for i, reservation := range changes.Update {
+		reservation.UpdatedAt = written[i].UpdatedAt
+	}
+	for i, reservation := range changes.Create {
+		record := written[len(changes.Update)+i]
+		reservation.ID = record.ID
+		reservation.CreatedAt = record.CreatedAt
+		reservation.UpdatedAt = record.UpdatedAt
+	}
+
+	return nil
+}
+
+// GetAllReservations retrieves all reservations
+func (s *EmbeddedStore) GetAllReservations(ctx context.Context) ([]*Reservation, error) {
+	return s.listReservations(func(r *Reservation) bool { return true }), nil
+}
+
+// GetReservationsBySubnet retrieves all reservations for a specific subnet
+func (s *EmbeddedStore) GetReservationsBySubnet(ctx context.Context, subnet *net.IPNet) ([]*Reservation, error) {
+	return s.listReservations(func(r *Reservation) bool { return sameNetwork(r.Subnet, subnet) }), nil
+}
+
+// listReservations returns copies of the matching reservations ordered by subnet and IP
+func (s *EmbeddedStore) listReservations(match func(*Reservation) bool) []*Reservation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reservations []*Reservation
+	for _, r := range s.reservations {
+		if match(r) {
+			reservation := *r
+			reservations = append(reservations, &reservation)
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if c := compareNetworks(reservations[i].Subnet, reservations[j].Subnet); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(reservations[i].IP.To16(), reservations[j].IP.To16()) < 0
+	})
+
+	return reservations
+}
+
+// CreateGitSyncLog creates a new git sync log entry
+func (s *EmbeddedStore) CreateGitSyncLog(ctx context.Context, log *GitSyncLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := *log
+	record.ID = s.nextID(bucketGitSyncLog)
+	record.CreatedAt = time.Now()
+	if err := insertRecord(s, bucketGitSyncLog, s.gitSyncLogs, record.ID, &record); err != nil {
+		return fmt.Errorf("failed to create git sync log: %w", err)
+	}
+
+	log.ID = record.ID
+	log.CreatedAt = record.CreatedAt
+
+	return nil
+}
+
+// UpdateGitSyncLog updates an existing git sync log entry
+func (s *EmbeddedStore) UpdateGitSyncLog(ctx context.Context, log *GitSyncLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := updateWhere(s, bucketGitSyncLog, s.gitSyncLogs,
+		func(l *GitSyncLog) bool { return l.ID == log.ID },
+		func(l *GitSyncLog) {
+			l.SyncCompletedAt = log.SyncCompletedAt
+			l.Status = log.Status
+			l.ErrorMessage = log.ErrorMessage
+			l.ChangesApplied = log.ChangesApplied
+			l.CommitHash = log.CommitHash
+			l.CommitMessage = log.CommitMessage
+			l.CommitAuthor = log.CommitAuthor
+			l.CommitTimestamp = log.CommitTimestamp
+		})
+	if err != nil {
+		return fmt.Errorf("failed to update git sync log: %w", err)
+	}
+
+	return nil
+}
+
+// GetGitSyncLog retrieves a git sync log by ID
+func (s *EmbeddedStore) GetGitSyncLog(ctx context.Context, id int64) (*GitSyncLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	log, ok := s.gitSyncLogs[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to get git sync log: log %d not found", id)
+	}
+
+	c := *log
+	return &c, nil
+}
+
+// GetRecentGitSyncLogs retrieves the most recent git sync logs
+func (s *EmbeddedStore) GetRecentGitSyncLogs(ctx context.Context, limit int) ([]*GitSyncLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	logs := make([]*GitSyncLog, 0, len(s.gitSyncLogs))
+	for _, log := range s.gitSyncLogs {
+		c := *log
+		logs = append(logs, &c)
+	}
+
+	sort.Slice(logs, func(i, j int) bool { return logs[i].SyncStartedAt.After(logs[j].SyncStartedAt) })
+	if len(logs) > limit {
+		logs = logs[:limit]
+	}
+
+	return logs, nil
+}
+
+// GetLastSuccessfulSync retrieves the most recent successful git sync
+func (s *EmbeddedStore) GetLastSuccessfulSync(ctx context.Context) (*GitSyncLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var last *GitSyncLog
+	for _, log := range s.gitSyncLogs {
+		if log.Status != GitSyncStatusSuccess || log.SyncCompletedAt == nil {
+			continue
+		}
+		if last == nil || log.SyncCompletedAt.After(*last.SyncCompletedAt) {
+			last = log
+		}
+	}
+	if last == nil {
+		return nil, fmt.Errorf("failed to get last successful sync: no successful sync recorded")
+	}
+
+	c := *last
+	return &c, nil
+}
+
+// GetActiveConfig retrieves the last applied configuration
+func (s *EmbeddedStore) GetActiveConfig(ctx context.Context) (*ActiveConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.activeConfig == nil {
+		return nil, nil
+	}
+	c := *s.activeConfig
+	return &c, nil
+}
+
+// SetActiveConfig records the configuration that was just applied
+func (s *EmbeddedStore) SetActiveConfig(ctx context.Context, cfg *ActiveConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := *cfg
+	record.ID = 1
+	if err := s.persist(bucketActiveConfig, map[int64]interface{}{1: &record}); err != nil {
+		return fmt.Errorf("failed to set active config: %w", err)
+	}
+
+	s.activeConfig = &record
+	cfg.ID = 1
+	return nil
+}
+
+// GetPinnedCommit retrieves the commit a rollback pinned the config to
+func (s *EmbeddedStore) GetPinnedCommit(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.pinnedCommit, nil
+}
+
+// SetPinnedCommit records the commit a rollback pinned the config to; "" clears the pin
+func (s *EmbeddedStore) SetPinnedCommit(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.persist(bucketActiveConfig, map[int64]interface{}{pinnedCommitID: &embeddedPin{Commit: hash}}); err != nil {
+		return fmt.Errorf("failed to set pinned commit: %w", err)
+	}
+
+	s.pinnedCommit = hash
+	return nil
+}
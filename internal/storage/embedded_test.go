@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreAdvisoryLock(t *testing.T) {
+	store := NewMemoryStore()
+	held := make(chan struct{})
+	release := make(chan struct{})
+
+	go store.WithAdvisoryLock(context.Background(), 42, func(ctx context.Context) error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+
+	// A second holder waits until the context gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := store.WithAdvisoryLock(ctx, 42, func(ctx context.Context) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the lock to be held, got %v", err)
+	}
+
+	// Other keys are independent
+	if err := store.WithAdvisoryLock(context.Background(), 43, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("lock on another key: %v", err)
+	}
+
+	close(release)
+	if err := store.WithAdvisoryLock(context.Background(), 42, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+}
+
+func TestMemoryStoreReservationConflicts(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	mac1, _ := net.ParseMAC("00:00:00:00:00:01")
+	mac2, _ := net.ParseMAC("00:00:00:00:00:02")
+
+	first := &Reservation{MAC: mac1, IP: net.ParseIP("192.168.1.10").To4(), Subnet: subnet}
+	if err := store.CreateReservation(ctx, first); err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	if first.ID == 0 {
+		t.Error("CreateReservation did not assign an ID")
+	}
+
+	sameMAC := &Reservation{MAC: mac1, IP: net.ParseIP("192.168.1.11").To4(), Subnet: subnet}
+	if err := store.CreateReservation(ctx, sameMAC); err == nil {
+		t.Error("expected a duplicate MAC to be rejected")
+	}
+	sameIP := &Reservation{MAC: mac2, IP: net.ParseIP("192.168.1.10").To4(), Subnet: subnet}
+	if err := store.CreateReservation(ctx, sameIP); err == nil {
+		t.Error("expected a duplicate IP to be rejected")
+	}
+
+	got, err := store.GetReservationByIP(ctx, net.ParseIP("192.168.1.10"), subnet)
+	if err != nil || got == nil || got.MAC.String() != mac1.String() {
+		t.Fatalf("GetReservationByIP = %v, %v", got, err)
+	}
+}
+
+func TestMemoryStoreReplicatedDecline(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	mac, _ := net.ParseMAC("00:00:00:00:00:01")
+	declinedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	err := store.ApplyReplicatedLease(ctx, &Lease{
+		IP:         net.ParseIP("192.168.1.10").To4(),
+		MAC:        mac,
+		Subnet:     subnet,
+		IssuedAt:   declinedAt,
+		ExpiresAt:  time.Now().Add(time.Hour),
+		LastSeen:   time.Now(),
+		State:      LeaseStateDeclined,
+		DeclinedAt: &declinedAt,
+		DeclinedBy: mac.String(),
+	})
+	if err != nil {
+		t.Fatalf("ApplyReplicatedLease: %v", err)
+	}
+
+	declined, err := store.GetDeclinedAddresses(ctx)
+	if err != nil {
+		t.Fatalf("GetDeclinedAddresses: %v", err)
+	}
+	if len(declined) != 1 || declined[0].DeclinedBy != mac.String() || !declined[0].DeclinedAt.Equal(declinedAt) {
+		t.Errorf("declined addresses %+v", declined)
+	}
+}
+
+func TestEmbeddedStoreApplyReservationChanges(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "irondhcp.db")
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	mac1, _ := net.ParseMAC("00:00:00:00:00:01")
+	mac2, _ := net.ParseMAC("00:00:00:00:00:02")
+	mac3, _ := net.ParseMAC("00:00:00:00:00:03")
+
+	store, err := OpenEmbedded(path)
+	if err != nil {
+		t.Fatalf("OpenEmbedded: %v", err)
+	}
+	first := &Reservation{MAC: mac1, IP: net.ParseIP("192.168.1.10").To4(), Subnet: subnet}
+	second := &Reservation{MAC: mac2, IP: net.ParseIP("192.168.1.11").To4(), Subnet: subnet}
+	for _, r := range []*Reservation{first, second} {
+		if err := store.CreateReservation(ctx, r); err != nil {
+			t.Fatalf("CreateReservation: %v", err)
+		}
+	}
+
+	// One update takes an address the other frees
+	swapFirst, swapSecond := *first, *second
+	swapFirst.IP, swapSecond.IP = second.IP, first.IP
+	if err := store.ApplyReservationChanges(ctx, &ReservationChanges{Update: []*Reservation{&swapFirst, &swapSecond}}); err != nil {
+		t.Fatalf("swapping addresses: %v", err)
+	}
+
+	// A conflict anywhere in the set rejects all of it
+	moved := swapFirst
+	moved.Hostname = "moved"
+	third := &Reservation{MAC: mac3, IP: net.ParseIP("192.168.1.11").To4(), Subnet: subnet}
+	err = store.ApplyReservationChanges(ctx, &ReservationChanges{
+		Create: []*Reservation{third},
+		Update: []*Reservation{&moved},
+		Delete: []*Reservation{second},
+	})
+	if err == nil {
+		t.Fatal("expected a duplicate IP to be rejected")
+	}
+	if third.ID != 0 {
+		t.Errorf("rejected reservation was given ID %d", third.ID)
+	}
+	store.Close()
+
+	store, err = OpenEmbedded(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+
+	got, err := store.GetAllReservations(ctx)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("GetAllReservations = %d reservations, %v", len(got), err)
+	}
+	for _, r := range got {
+		want := map[string]string{mac1.String(): "192.168.1.11", mac2.String(): "192.168.1.10"}[r.MAC.String()]
+		if r.IP.String() != want || r.Hostname != "" {
+			t.Errorf("reservation %s at %s (%q), want %s", r.MAC, r.IP, r.Hostname, want)
+		}
+	}
+
+	// IDs were not used up by the rejected create
+	third.IP = net.ParseIP("192.168.1.12").To4()
+	if err := store.CreateReservation(ctx, third); err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	if third.ID != second.ID+1 {
+		t.Errorf("next reservation ID %d, want %d", third.ID, second.ID+1)
+	}
+}
+
+func TestEmbeddedStoreReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "irondhcp.db")
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+
+	store, err := OpenEmbedded(path)
+	if err != nil {
+		t.Fatalf("OpenEmbedded: %v", err)
+	}
+	now := time.Now()
+	lease := &Lease{
+		IP:        net.ParseIP("192.168.1.100").To4(),
+		MAC:       mac,
+		Subnet:    subnet,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(time.Hour),
+		LastSeen:  now,
+		State:     LeaseStateActive,
+	}
+	if err := store.CreateLease(ctx, lease); err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if err := store.SetActiveConfig(ctx, &ActiveConfig{CommitHash: "abc123", AppliedAt: now, ConfigYAML: "subnets: []\n"}); err != nil {
+		t.Fatalf("SetActiveConfig: %v", err)
+	}
+	store.Close()
+
+	store, err = OpenEmbedded(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+
+	got, err := store.GetLeaseByMAC(ctx, mac, subnet)
+	if err != nil || got == nil {
+		t.Fatalf("lease not reloaded: %v", err)
+	}
+	if !got.IP.Equal(lease.IP) || got.ID != lease.ID {
+		t.Errorf("reloaded lease %d %s, want %d %s", got.ID, got.IP, lease.ID, lease.IP)
+	}
+
+	active, err := store.GetActiveConfig(ctx)
+	if err != nil || active == nil || active.CommitHash != "abc123" || active.ConfigYAML != "subnets: []\n" {
+		t.Errorf("active config not reloaded: %+v, %v", active, err)
+	}
+
+	// IDs keep counting from the reloaded records
+	next := &Lease{IP: net.ParseIP("192.168.1.101").To4(), MAC: mac, Subnet: subnet, IssuedAt: now, ExpiresAt: now, LastSeen: now, State: LeaseStateExpired}
+	if err := store.CreateLease(ctx, next); err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if next.ID <= lease.ID {
+		t.Errorf("new lease ID %d does not follow %d", next.ID, lease.ID)
+	}
+}
@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// findLeaseV6 returns the DHCPv6 lease matching match with the latest expiry; the caller holds s.mu
+func (s *EmbeddedStore) findLeaseV6(match func(*LeaseV6) bool) *LeaseV6 {
+	var found *LeaseV6
+	for _, lease := range s.leasesV6 {
+		if match(lease) && (found == nil || lease.ExpiresAt.After(found.ExpiresAt)) {
+			found = lease
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	lease := *found
+	return &lease
+}
+
+// GetLeaseV6ByDUID retrieves the active DHCPv6 lease for a client DUID and IAID
+func (s *EmbeddedStore) GetLeaseV6ByDUID(ctx context.Context, duid string, iaid uint32, subnet *net.IPNet) (*LeaseV6, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.findLeaseV6(func(l *LeaseV6) bool {
+		return l.DUID == duid && l.IAID == iaid && sameNetwork(l.Subnet, subnet) && l.State == LeaseStateActive
+	}), nil
+}
+
+// GetLeaseV6ByIP retrieves a DHCPv6 lease by IP address
+func (s *EmbeddedStore) GetLeaseV6ByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*LeaseV6, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.findLeaseV6(func(l *LeaseV6) bool {
+		return l.IP.Equal(ip) && sameNetwork(l.Subnet, subnet)
+	}), nil
+}
+
+// CreateLeaseV6 creates a new DHCPv6 lease record
+func (s *EmbeddedStore) CreateLeaseV6(ctx context.Context, lease *LeaseV6) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.findLeaseV6(func(l *LeaseV6) bool {
+		return l.IP.Equal(lease.IP) && sameNetwork(l.Subnet, lease.Subnet)
+	})
+	if existing != nil {
+		return fmt.Errorf("failed to create DHCPv6 lease: %s already leased in %s", lease.IP, lease.Subnet)
+	}
+
+	now := time.Now()
+	record := *lease
+	record.ID = s.nextID(bucketLeasesV6)
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	if err := insertRecord(s, bucketLeasesV6, s.leasesV6, record.ID, &record); err != nil {
+		return fmt.Errorf("failed to create DHCPv6 lease: %w", err)
+	}
+
+	lease.ID = record.ID
+	lease.CreatedAt = now
+	lease.UpdatedAt = now
+
+	return nil
+}
+
+// UpdateLeaseV6 updates an existing DHCPv6 lease record
+// Used to hand a previously expired or released address to a new client
+func (s *EmbeddedStore) UpdateLeaseV6(ctx context.Context, lease *LeaseV6) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count, err := updateWhere(s, bucketLeasesV6, s.leasesV6,
+		func(l *LeaseV6) bool { return l.ID == lease.ID },
+		func(l *LeaseV6) {
+			l.DUID = lease.DUID
+			l.IAID = lease.IAID
+			l.MAC = lease.MAC
+			l.Hostname = lease.Hostname
+			l.IssuedAt = lease.IssuedAt
+			l.ExpiresAt = lease.ExpiresAt
+			l.LastSeen = lease.LastSeen
+			l.State = lease.State
+			l.AllocatedBy = lease.AllocatedBy
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to update DHCPv6 lease: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("failed to update DHCPv6 lease: lease %d not found", lease.ID)
+	}
+
+	lease.UpdatedAt = now
+	return nil
+}
+
+// RenewLeaseV6 renews an existing DHCPv6 lease with a new expiration time
+func (s *EmbeddedStore) RenewLeaseV6(ctx context.Context, leaseID int64, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	_, err := updateWhere(s, bucketLeasesV6, s.leasesV6,
+		func(l *LeaseV6) bool { return l.ID == leaseID },
+		func(l *LeaseV6) {
+			l.ExpiresAt = expiresAt
+			l.LastSeen = now
+			l.State = LeaseStateActive
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to renew DHCPv6 lease: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseLeaseV6 marks a DHCPv6 lease as released
+// The DUID is checked so a client can only release its own bindings; ErrNoBinding means it has none
+func (s *EmbeddedStore) ReleaseLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error {
+	err := s.setLeaseV6State(duid, ip, subnet, LeaseStateReleased)
+	if err != nil && err != ErrNoBinding {
+		return fmt.Errorf("failed to release DHCPv6 lease: %w", err)
+	}
+	return err
+}
+
+// DeclineLeaseV6 marks a DHCPv6 lease as declined (duplicate address detected)
+// ErrNoBinding is returned if the client holds no binding for the address.
+func (s *EmbeddedStore) DeclineLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error {
+	err := s.setLeaseV6State(duid, ip, subnet, LeaseStateDeclined)
+	if err != nil && err != ErrNoBinding {
+		return fmt.Errorf("failed to decline DHCPv6 lease: %w", err)
+	}
+	return err
+}
+
+// setLeaseV6State moves a client's DHCPv6 binding to state
+func (s *EmbeddedStore) setLeaseV6State(duid string, ip net.IP, subnet *net.IPNet, state LeaseState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	n, err := updateWhere(s, bucketLeasesV6, s.leasesV6,
+		func(l *LeaseV6) bool { return l.DUID == duid && l.IP.Equal(ip) && sameNetwork(l.Subnet, subnet) },
+		func(l *LeaseV6) {
+			l.State = state
+			l.LastSeen = now
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoBinding
+	}
+	return nil
+}
+
+// GetExpiredLeasesV6 returns expired or released DHCPv6 leases in a pool range
+func (s *EmbeddedStore) GetExpiredLeasesV6(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP, limit int) ([]*LeaseV6, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var leases []*LeaseV6
+	for _, l := range s.leasesV6 {
+		if sameNetwork(l.Subnet, subnet) && ipInRange(l.IP, rangeStart, rangeEnd) &&
+			(l.State == LeaseStateExpired || l.State == LeaseStateReleased) {
+			lease := *l
+			leases = append(leases, &lease)
+		}
+	}
+
+	sort.Slice(leases, func(i, j int) bool { return leases[i].ExpiresAt.Before(leases[j].ExpiresAt) })
+	if len(leases) > limit {
+		leases = leases[:limit]
+	}
+
+	return leases, nil
+}
+
+// ExpireLeasesV6 marks all expired DHCPv6 leases as expired
+func (s *EmbeddedStore) ExpireLeasesV6(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count, err := updateWhere(s, bucketLeasesV6, s.leasesV6,
+		func(l *LeaseV6) bool { return l.State == LeaseStateActive && l.ExpiresAt.Before(now) },
+		func(l *LeaseV6) {
+			l.State = LeaseStateExpired
+			l.UpdatedAt = now
+		})
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire DHCPv6 leases: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetAllLeasesV6 retrieves all DHCPv6 leases
+func (s *EmbeddedStore) GetAllLeasesV6(ctx context.Context) ([]*LeaseV6, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	leases := make([]*LeaseV6, 0, len(s.leasesV6))
+	for _, l := range s.leasesV6 {
+		lease := *l
+		leases = append(leases, &lease)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].ExpiresAt.After(leases[j].ExpiresAt) })
+
+	return leases, nil
+}
+
+// findPrefix returns the delegation matching match with the latest expiry; the caller holds s.mu
+func (s *EmbeddedStore) findPrefix(match func(*DelegatedPrefix) bool) *DelegatedPrefix {
+	var found *DelegatedPrefix
+	for _, p := range s.prefixes {
+		if match(p) && (found == nil || p.ExpiresAt.After(found.ExpiresAt)) {
+			found = p
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	p := *found
+	return &p
+}
+
+// GetDelegatedPrefixByDUID retrieves the active delegation for a client DUID and IAID in a pool
+func (s *EmbeddedStore) GetDelegatedPrefixByDUID(ctx context.Context, duid string, iaid uint32, pool *net.IPNet) (*DelegatedPrefix, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.findPrefix(func(p *DelegatedPrefix) bool {
+		return p.DUID == duid && p.IAID == iaid && sameNetwork(p.Pool, pool) && p.State == LeaseStateActive
+	}), nil
+}
+
+// GetDelegatedPrefix retrieves the delegation record for a prefix
+func (s *EmbeddedStore) GetDelegatedPrefix(ctx context.Context, prefix *net.IPNet) (*DelegatedPrefix, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.findPrefix(func(p *DelegatedPrefix) bool { return sameNetwork(p.Prefix, prefix) }), nil
+}
+
+// CreateDelegatedPrefix creates a new prefix delegation record
+func (s *EmbeddedStore) CreateDelegatedPrefix(ctx context.Context, p *DelegatedPrefix) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findPrefix(func(existing *DelegatedPrefix) bool { return sameNetwork(existing.Prefix, p.Prefix) }) != nil {
+		return fmt.Errorf("failed to create delegated prefix: %s already delegated", p.Prefix)
+	}
+
+	now := time.Now()
+	record := *p
+	record.ID = s.nextID(bucketPrefixes)
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	if err := insertRecord(s, bucketPrefixes, s.prefixes, record.ID, &record); err != nil {
+		return fmt.Errorf("failed to create delegated prefix: %w", err)
+	}
+
+	p.ID = record.ID
+	p.CreatedAt = now
+	p.UpdatedAt = now
+
+	return nil
+}
+
+// UpdateDelegatedPrefix updates an existing prefix delegation record
+// Used to hand a previously expired or released prefix to a new client
+func (s *EmbeddedStore) UpdateDelegatedPrefix(ctx context.Context, p *DelegatedPrefix) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count, err := updateWhere(s, bucketPrefixes, s.prefixes,
+		func(existing *DelegatedPrefix) bool { return existing.ID == p.ID },
+		func(existing *DelegatedPrefix) {
+			existing.DUID = p.DUID
+			existing.IAID = p.IAID
+			existing.Hostname = p.Hostname
+			existing.Subnet = p.Subnet
+			existing.IssuedAt = p.IssuedAt
+			existing.ExpiresAt = p.ExpiresAt
+			existing.LastSeen = p.LastSeen
+			existing.State = p.State
+			existing.AllocatedBy = p.AllocatedBy
+			existing.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to update delegated prefix: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("failed to update delegated prefix: prefix %d not found", p.ID)
+	}
+
+	p.UpdatedAt = now
+	return nil
+}
+
+// RenewDelegatedPrefix renews an existing prefix delegation with a new expiration time
+func (s *EmbeddedStore) RenewDelegatedPrefix(ctx context.Context, id int64, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	_, err := updateWhere(s, bucketPrefixes, s.prefixes,
+		func(p *DelegatedPrefix) bool { return p.ID == id },
+		func(p *DelegatedPrefix) {
+			p.ExpiresAt = expiresAt
+			p.LastSeen = now
+			p.State = LeaseStateActive
+			p.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to renew delegated prefix: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseDelegatedPrefix marks a prefix delegation as released
+// The DUID is checked so a client can only release its own delegations; ErrNoBinding means it has none
+func (s *EmbeddedStore) ReleaseDelegatedPrefix(ctx context.Context, duid string, prefix *net.IPNet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	n, err := updateWhere(s, bucketPrefixes, s.prefixes,
+		func(p *DelegatedPrefix) bool { return p.DUID == duid && sameNetwork(p.Prefix, prefix) },
+		func(p *DelegatedPrefix) {
+			p.State = LeaseStateReleased
+			p.LastSeen = now
+			p.UpdatedAt = now
+		})
+	if err != nil {
+		return fmt.Errorf("failed to release delegated prefix: %w", err)
+	}
+	if n == 0 {
+		return ErrNoBinding
+	}
+
+	return nil
+}
+
+// GetExpiredDelegatedPrefixes returns expired or released delegations carved from a pool
+func (s *EmbeddedStore) GetExpiredDelegatedPrefixes(ctx context.Context, pool *net.IPNet, limit int) ([]*DelegatedPrefix, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var prefixes []*DelegatedPrefix
+	for _, p := range s.prefixes {
+		if sameNetwork(p.Pool, pool) && (p.State == LeaseStateExpired || p.State == LeaseStateReleased) {
+			c := *p
+			prefixes = append(prefixes, &c)
+		}
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].ExpiresAt.Before(prefixes[j].ExpiresAt) })
+	if len(prefixes) > limit {
+		prefixes = prefixes[:limit]
+	}
+
+	return prefixes, nil
+}
+
+// ExpireDelegatedPrefixes marks all expired prefix delegations as expired
+func (s *EmbeddedStore) ExpireDelegatedPrefixes(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count, err := updateWhere(s, bucketPrefixes, s.prefixes,
+		func(p *DelegatedPrefix) bool { return p.State == LeaseStateActive && p.ExpiresAt.Before(now) },
+		func(p *DelegatedPrefix) {
+			p.State = LeaseStateExpired
+			p.UpdatedAt = now
+		})
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire delegated prefixes: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetAllDelegatedPrefixes retrieves all prefix delegations
+func (s *EmbeddedStore) GetAllDelegatedPrefixes(ctx context.Context) ([]*DelegatedPrefix, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefixes := make([]*DelegatedPrefix, 0, len(s.prefixes))
+	for _, p := range s.prefixes {
+		c := *p
+		prefixes = append(prefixes, &c)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].ExpiresAt.After(prefixes[j].ExpiresAt) })
+
+	return prefixes, nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // CreateGitSyncLog creates a new git sync log entry
@@ -220,3 +222,79 @@ func (s *Store) GetLastSuccessfulSync(ctx context.Context) (*GitSyncLog, error)
 
 	return &log, nil
 }
+
+// GetActiveConfig retrieves the last applied configuration
+// The placeholder row created by the initial migration counts as none.
+func (s *Store) GetActiveConfig(ctx context.Context) (*ActiveConfig, error) {
+	query := `
+		SELECT id, commit_hash, applied_at, config_yaml
+		FROM active_config
+		WHERE id = 1
+	`
+
+	var cfg ActiveConfig
+	err := s.pool.QueryRow(ctx, query).Scan(&cfg.ID, &cfg.CommitHash, &cfg.AppliedAt, &cfg.ConfigYAML)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active config: %w", err)
+	}
+	if cfg.ConfigYAML == "" {
+		return nil, nil
+	}
+
+	return &cfg, nil
+}
+
+// SetActiveConfig records the configuration that was just applied
+func (s *Store) SetActiveConfig(ctx context.Context, cfg *ActiveConfig) error {
+	query := `
+		INSERT INTO active_config (id, commit_hash, applied_at, config_yaml)
+		VALUES (1, $1, $2, $3)
+		ON CONFLICT (id) DO UPDATE
+		SET commit_hash = EXCLUDED.commit_hash,
+		    applied_at = EXCLUDED.applied_at,
+		    config_yaml = EXCLUDED.config_yaml
+	`
+
+	if _, err := s.pool.Exec(ctx, query, cfg.CommitHash, cfg.AppliedAt, cfg.ConfigYAML); err != nil {
+		return fmt.Errorf("failed to set active config: %w", err)
+	}
+
+	cfg.ID = 1
+	return nil
+}
+
+// GetPinnedCommit retrieves the commit a rollback pinned the config to
+func (s *Store) GetPinnedCommit(ctx context.Context) (string, error) {
+	query := `SELECT pinned_commit FROM active_config WHERE id = 1`
+
+	var hash string
+	err := s.pool.QueryRow(ctx, query).Scan(&hash)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get pinned commit: %w", err)
+	}
+
+	return hash, nil
+}
+
+// SetPinnedCommit records the commit a rollback pinned the config to; "" clears the pin
+// The active config row is left alone, or created as the placeholder GetActiveConfig ignores.
+func (s *Store) SetPinnedCommit(ctx context.Context, hash string) error {
+	query := `
+		INSERT INTO active_config (id, commit_hash, applied_at, config_yaml, pinned_commit)
+		VALUES (1, 'initial', NOW(), '', $1)
+		ON CONFLICT (id) DO UPDATE
+		SET pinned_commit = EXCLUDED.pinned_commit
+	`
+
+	if _, err := s.pool.Exec(ctx, query, hash); err != nil {
+		return fmt.Errorf("failed to set pinned commit: %w", err)
+	}
+
+	return nil
+}
@@ -128,28 +128,13 @@ func createDatabase(ctx context.Context, originalConnStr, dbName string) error {
 	return nil
 }
 
-// runMigrations runs database migrations
+// runMigrations applies pending migrations and records them in schema_migrations
 func runMigrations(ctx context.Context, conn *pgx.Conn) error {
-	// List of migration files to run in order
-	migrations := []string{
-		"migrations/001_initial_schema.sql",
-		"migrations/002_add_boot_options.sql",
-		"migrations/003_git_sync_audit.sql",
-	}
-
-	for _, migrationFile := range migrations {
-		// Read migration file from embedded FS
-		migrationSQL, err := migrationsFS.ReadFile(migrationFile)
-		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %w", migrationFile, err)
-		}
-
-		// Execute migration
-		_, err = conn.Exec(ctx, string(migrationSQL))
-		if err != nil {
-			return fmt.Errorf("failed to execute migration %s: %w", migrationFile, err)
-		}
+	migrator, err := newMigrator(ctx, conn)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	_, err = migrator.Up(ctx)
+	return err
 }
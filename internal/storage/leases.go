@@ -13,7 +13,8 @@ import (
 func (s *Store) GetLeaseByMAC(ctx context.Context, mac net.HardwareAddr, subnet *net.IPNet) (*Lease, error) {
 	query := `
 		SELECT id, ip::text, mac::text, hostname, subnet::text, issued_at, expires_at, last_seen,
-		       state, client_id, vendor_class, user_class, allocated_by, created_at, updated_at
+		       state, client_id, vendor_class, user_class, allocated_by,
+		       COALESCE(circuit_id, ''), COALESCE(remote_id, ''), created_at, updated_at
 		FROM leases
 		WHERE mac = $1 AND subnet = $2 AND state = 'active'
 		ORDER BY expires_at DESC
@@ -27,7 +28,7 @@ func (s *Store) GetLeaseByMAC(ctx context.Context, mac net.HardwareAddr, subnet
 		&lease.ID, &ipStr, &macStr, &lease.Hostname, &subnetStr,
 		&lease.IssuedAt, &lease.ExpiresAt, &lease.LastSeen, &lease.State,
 		&lease.ClientID, &lease.VendorClass, &lease.UserClass, &lease.AllocatedBy,
-		&lease.CreatedAt, &lease.UpdatedAt,
+		&lease.CircuitID, &lease.RemoteID, &lease.CreatedAt, &lease.UpdatedAt,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -55,7 +56,9 @@ func (s *Store) GetLeaseByMAC(ctx context.Context, mac net.HardwareAddr, subnet
 func (s *Store) GetLeaseByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*Lease, error) {
 	query := `
 		SELECT id, ip::text, mac::text, hostname, subnet::text, issued_at, expires_at, last_seen,
-		       state, client_id, vendor_class, user_class, allocated_by, created_at, updated_at
+		       state, client_id, vendor_class, user_class, allocated_by,
+		       COALESCE(circuit_id, ''), COALESCE(remote_id, ''), declined_at, COALESCE(declined_by, ''),
+		       created_at, updated_at
 		FROM leases
 		WHERE ip = $1 AND subnet = $2
 		ORDER BY expires_at DESC
@@ -69,6 +72,7 @@ func (s *Store) GetLeaseByIP(ctx context.Context, ip net.IP, subnet *net.IPNet)
 		&lease.ID, &ipStr, &macStr, &lease.Hostname, &subnetStr,
 		&lease.IssuedAt, &lease.ExpiresAt, &lease.LastSeen, &lease.State,
 		&lease.ClientID, &lease.VendorClass, &lease.UserClass, &lease.AllocatedBy,
+		&lease.CircuitID, &lease.RemoteID, &lease.DeclinedAt, &lease.DeclinedBy,
 		&lease.CreatedAt, &lease.UpdatedAt,
 	)
 
@@ -96,8 +100,9 @@ func (s *Store) GetLeaseByIP(ctx context.Context, ip net.IP, subnet *net.IPNet)
 // CreateLease creates a new lease record
 func (s *Store) CreateLease(ctx context.Context, lease *Lease) error {
 	query := `
-		INSERT INTO leases (ip, mac, hostname, subnet, issued_at, expires_at, last_seen, state, client_id, vendor_class, user_class, allocated_by)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		INSERT INTO leases (ip, mac, hostname, subnet, issued_at, expires_at, last_seen, state, client_id, vendor_class, user_class, allocated_by,
+		                    circuit_id, remote_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		RETURNING id, created_at, updated_at
 	`
 
@@ -114,6 +119,8 @@ func (s *Store) CreateLease(ctx context.Context, lease *Lease) error {
 		lease.VendorClass,
 		lease.UserClass,
 		lease.AllocatedBy,
+		lease.CircuitID,
+		lease.RemoteID,
 	).Scan(&lease.ID, &lease.CreatedAt, &lease.UpdatedAt)
 
 	if err != nil {
@@ -128,8 +135,9 @@ func (s *Store) UpdateLease(ctx context.Context, lease *Lease) error {
 	query := `
 		UPDATE leases
 		SET hostname = $1, issued_at = $2, expires_at = $3, last_seen = $4,
-		    state = $5, client_id = $6, vendor_class = $7, user_class = $8, allocated_by = $9
-		WHERE id = $10
+		    state = $5, client_id = $6, vendor_class = $7, user_class = $8, allocated_by = $9,
+		    circuit_id = $10, remote_id = $11, mac = $12
+		WHERE id = $13
 		RETURNING updated_at
 	`
 
@@ -143,6 +151,9 @@ func (s *Store) UpdateLease(ctx context.Context, lease *Lease) error {
 		lease.VendorClass,
 		lease.UserClass,
 		lease.AllocatedBy,
+		lease.CircuitID,
+		lease.RemoteID,
+		lease.MAC.String(),
 		lease.ID,
 	).Scan(&lease.UpdatedAt)
 
@@ -153,6 +164,47 @@ func (s *Store) UpdateLease(ctx context.Context, lease *Lease) error {
 	return nil
 }
 
+// ApplyReplicatedLease stores a lease received from a failover partner
+// Rows are matched on (ip, subnet) and only overwritten when the incoming copy was seen later
+func (s *Store) ApplyReplicatedLease(ctx context.Context, lease *Lease) error {
+	query := `
+		INSERT INTO leases (ip, mac, hostname, subnet, issued_at, expires_at, last_seen, state, client_id, vendor_class, user_class, allocated_by,
+		                    circuit_id, remote_id, declined_at, declined_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, ''))
+		ON CONFLICT (ip, subnet) DO UPDATE
+		SET mac = EXCLUDED.mac, hostname = EXCLUDED.hostname, issued_at = EXCLUDED.issued_at, expires_at = EXCLUDED.expires_at,
+		    last_seen = EXCLUDED.last_seen, state = EXCLUDED.state, client_id = EXCLUDED.client_id,
+		    vendor_class = EXCLUDED.vendor_class, user_class = EXCLUDED.user_class, allocated_by = EXCLUDED.allocated_by,
+		    circuit_id = EXCLUDED.circuit_id, remote_id = EXCLUDED.remote_id, declined_at = EXCLUDED.declined_at,
+		    declined_by = EXCLUDED.declined_by
+		WHERE leases.last_seen <= EXCLUDED.last_seen
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		lease.IP.String(),
+		lease.MAC.String(),
+		lease.Hostname,
+		lease.Subnet.String(),
+		lease.IssuedAt,
+		lease.ExpiresAt,
+		lease.LastSeen,
+		lease.State,
+		lease.ClientID,
+		lease.VendorClass,
+		lease.UserClass,
+		lease.AllocatedBy,
+		lease.CircuitID,
+		lease.RemoteID,
+		lease.DeclinedAt,
+		lease.DeclinedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to apply replicated lease: %w", err)
+	}
+
+	return nil
+}
+
 // RenewLease renews an existing lease with a new expiration time
 func (s *Store) RenewLease(ctx context.Context, leaseID int64, expiresAt time.Time) error {
 	query := `
@@ -169,6 +221,36 @@ func (s *Store) RenewLease(ctx context.Context, leaseID int64, expiresAt time.Ti
 	return nil
 }
 
+// RenewLeases applies many renewals in one statement
+func (s *Store) RenewLeases(ctx context.Context, renewals []LeaseRenewal) error {
+	if len(renewals) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(renewals))
+	expiresAt := make([]time.Time, len(renewals))
+	lastSeen := make([]time.Time, len(renewals))
+	for i, r := range renewals {
+		ids[i] = r.LeaseID
+		expiresAt[i] = r.ExpiresAt
+		lastSeen[i] = r.LastSeen
+	}
+
+	query := `
+		UPDATE leases AS l
+		SET expires_at = v.expires_at, last_seen = v.last_seen, state = 'active'
+		FROM unnest($1::bigint[], $2::timestamptz[], $3::timestamptz[]) AS v(id, expires_at, last_seen)
+		WHERE l.id = v.id
+	`
+
+	_, err := s.pool.Exec(ctx, query, ids, expiresAt, lastSeen)
+	if err != nil {
+		return fmt.Errorf("failed to renew leases: %w", err)
+	}
+
+	return nil
+}
+
 // ReleaseLease marks a lease as released
 func (s *Store) ReleaseLease(ctx context.Context, ip net.IP, subnet *net.IPNet) error {
 	query := `
@@ -186,36 +268,124 @@ func (s *Store) ReleaseLease(ctx context.Context, ip net.IP, subnet *net.IPNet)
 }
 
 // DeclineLease marks a lease as declined (IP conflict detected)
-func (s *Store) DeclineLease(ctx context.Context, ip net.IP, subnet *net.IPNet) error {
+// The address stays out of the pool until the quarantine ends at until. Only the client
+// holding the lease may decline an active lease; an address with no lease is quarantined.
+func (s *Store) DeclineLease(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, until time.Time, allocatedBy string) error {
 	query := `
-		UPDATE leases
-		SET state = 'declined', last_seen = $1
-		WHERE ip = $2 AND subnet = $3
+		INSERT INTO leases (ip, mac, hostname, subnet, issued_at, expires_at, last_seen, state, client_id, vendor_class, user_class, allocated_by,
+		                    declined_at, declined_by)
+		VALUES ($1, $2, '', $3, $4, $5, $4, 'declined', '', '', '', $6, $4, $2)
+		ON CONFLICT (ip, subnet) DO UPDATE
+		SET mac = EXCLUDED.mac, expires_at = EXCLUDED.expires_at, last_seen = EXCLUDED.last_seen, state = 'declined',
+		    declined_at = EXCLUDED.declined_at, declined_by = EXCLUDED.declined_by
+		WHERE leases.mac = EXCLUDED.mac OR leases.state <> 'active' OR leases.expires_at < EXCLUDED.last_seen
 	`
 
-	_, err := s.pool.Exec(ctx, query, time.Now(), ip.String(), subnet.String())
+	result, err := s.pool.Exec(ctx, query, ip.String(), mac.String(), subnet.String(), time.Now(), until, allocatedBy)
 	if err != nil {
 		return fmt.Errorf("failed to decline lease: %w", err)
 	}
+	if result.RowsAffected() == 0 {
+		return ErrLeaseHeldByOther
+	}
 
 	return nil
 }
 
-// GetExpiredLeases returns leases that have expired
+// QuarantineIP marks an address as declined until the given time
+// Used when conflict detection finds a host answering on an address the server was about to offer
+func (s *Store) QuarantineIP(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, until time.Time, allocatedBy string) error {
+	query := `
+		INSERT INTO leases (ip, mac, hostname, subnet, issued_at, expires_at, last_seen, state, client_id, vendor_class, user_class, allocated_by,
+		                    declined_at, declined_by)
+		VALUES ($1, $2, '', $3, $4, $5, $4, 'declined', '', '', '', $6, $4, 'ping_check')
+		ON CONFLICT (ip, subnet) DO UPDATE
+		SET mac = EXCLUDED.mac, expires_at = EXCLUDED.expires_at, last_seen = EXCLUDED.last_seen, state = 'declined',
+		    declined_at = EXCLUDED.declined_at, declined_by = EXCLUDED.declined_by
+	`
+
+	_, err := s.pool.Exec(ctx, query, ip.String(), mac.String(), subnet.String(), time.Now(), until, allocatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine IP: %w", err)
+	}
+
+	return nil
+}
+
+// ReclaimDeclinedLeases returns declined addresses whose quarantine has lapsed to the pool
+func (s *Store) ReclaimDeclinedLeases(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE leases
+		SET state = 'expired'
+		WHERE state = 'declined' AND expires_at < $1
+	`
+
+	result, err := s.pool.Exec(ctx, query, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to reclaim declined leases: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetDeclinedAddresses returns the addresses currently quarantined after a decline or failed ping check
+func (s *Store) GetDeclinedAddresses(ctx context.Context) ([]*DeclinedAddress, error) {
+	query := `
+		SELECT ip::text, mac::text, subnet::text, COALESCE(declined_by, ''),
+		       COALESCE(declined_at, last_seen), expires_at, COALESCE(allocated_by, '')
+		FROM leases
+		WHERE state = 'declined'
+		ORDER BY subnet, ip
+	`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get declined addresses: %w", err)
+	}
+	defer rows.Close()
+
+	var addresses []*DeclinedAddress
+	for rows.Next() {
+		var addr DeclinedAddress
+		var ipStr, macStr, subnetStr string
+
+		err := rows.Scan(
+			&ipStr, &macStr, &subnetStr, &addr.DeclinedBy,
+			&addr.DeclinedAt, &addr.QuarantinedUntil, &addr.AllocatedBy,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan declined address: %w", err)
+		}
+
+		if ip, _, err := net.ParseCIDR(ipStr); err == nil {
+			addr.IP = ip
+		} else {
+			addr.IP = net.ParseIP(ipStr)
+		}
+		addr.MAC, _ = net.ParseMAC(macStr)
+		_, addr.Subnet, _ = net.ParseCIDR(subnetStr)
+		addresses = append(addresses, &addr)
+	}
+
+	return addresses, rows.Err()
+}
+
+// GetExpiredLeases returns leases that have expired, including declined ones past their quarantine
 func (s *Store) GetExpiredLeases(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP, limit int) ([]*Lease, error) {
 	query := `
 		SELECT id, ip::text, mac::text, hostname, subnet::text, issued_at, expires_at, last_seen,
-		       state, client_id, vendor_class, user_class, allocated_by, created_at, updated_at
+		       state, client_id, vendor_class, user_class, allocated_by,
+		       COALESCE(circuit_id, ''), COALESCE(remote_id, ''), created_at, updated_at
 		FROM leases
 		WHERE subnet = $1
 		  AND ip >= $2
 		  AND ip <= $3
-		  AND state IN ('expired', 'released')
+		  AND (state IN ('expired', 'released') OR (state = 'declined' AND expires_at < $5))
 		ORDER BY expires_at ASC
 		LIMIT $4
 	`
 
-	rows, err := s.pool.Query(ctx, query, subnet.String(), rangeStart.String(), rangeEnd.String(), limit)
+	rows, err := s.pool.Query(ctx, query, subnet.String(), rangeStart.String(), rangeEnd.String(), limit, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get expired leases: %w", err)
 	}
@@ -230,7 +400,7 @@ func (s *Store) GetExpiredLeases(ctx context.Context, subnet *net.IPNet, rangeSt
 			&lease.ID, &ipStr, &macStr, &lease.Hostname, &subnetStr,
 			&lease.IssuedAt, &lease.ExpiresAt, &lease.LastSeen, &lease.State,
 			&lease.ClientID, &lease.VendorClass, &lease.UserClass, &lease.AllocatedBy,
-			&lease.CreatedAt, &lease.UpdatedAt,
+			&lease.CircuitID, &lease.RemoteID, &lease.CreatedAt, &lease.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan lease: %w", err)
@@ -251,6 +421,36 @@ func (s *Store) GetExpiredLeases(ctx context.Context, subnet *net.IPNet, rangeSt
 	return leases, rows.Err()
 }
 
+// GetLeasedIPs returns every address in a range that has a lease row, whatever its state
+func (s *Store) GetLeasedIPs(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP) ([]net.IP, error) {
+	query := `
+		SELECT host(ip)
+		FROM leases
+		WHERE subnet = $1
+		  AND ip >= $2
+		  AND ip <= $3
+	`
+
+	rows, err := s.pool.Query(ctx, query, subnet.String(), rangeStart.String(), rangeEnd.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leased IPs: %w", err)
+	}
+	defer rows.Close()
+
+	var ips []net.IP
+	for rows.Next() {
+		var ipStr string
+		if err := rows.Scan(&ipStr); err != nil {
+			return nil, fmt.Errorf("failed to scan leased IP: %w", err)
+		}
+		if ip := net.ParseIP(ipStr); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips, rows.Err()
+}
+
 // ExpireOldLeases marks leases as expired if they have passed their expiration time
 func (s *Store) ExpireOldLeases(ctx context.Context) (int64, error) {
 	query := `
@@ -282,7 +482,7 @@ func (s *Store) DeleteOldLeases(ctx context.Context, olderThan time.Duration) (i
 	return result.RowsAffected(), nil
 }
 
-// GetLeaseStatistics returns aggregated statistics per subnet
+// GetLeaseStatistics returns aggregated statistics per subnet (DHCPv4 and DHCPv6)
 func (s *Store) GetLeaseStatistics(ctx context.Context) ([]*LeaseStatistics, error) {
 	query := `
 		SELECT subnet::text,
@@ -292,7 +492,11 @@ func (s *Store) GetLeaseStatistics(ctx context.Context) ([]*LeaseStatistics, err
 		       COUNT(*) FILTER (WHERE state = 'declined') AS declined_leases,
 		       MIN(expires_at) FILTER (WHERE state = 'active') AS next_expiry,
 		       MAX(last_seen) AS last_activity
-		FROM leases
+		FROM (
+			SELECT subnet, state, expires_at, last_seen FROM leases
+			UNION ALL
+			SELECT subnet, state, expires_at, last_seen FROM leases_v6
+		) AS all_leases
 		GROUP BY subnet
 	`
 
@@ -364,7 +568,9 @@ func (s *Store) ExpireLeases(ctx context.Context) (int64, error) {
 func (s *Store) GetAllLeases(ctx context.Context) ([]*Lease, error) {
 	query := `
 		SELECT id, ip::text, mac::text, hostname, subnet::text, issued_at, expires_at, last_seen,
-		       state, client_id, vendor_class, user_class, allocated_by, created_at, updated_at
+		       state, client_id, vendor_class, user_class, allocated_by,
+		       COALESCE(circuit_id, ''), COALESCE(remote_id, ''), declined_at, COALESCE(declined_by, ''),
+		       created_at, updated_at
 		FROM leases
 		ORDER BY expires_at DESC
 	`
@@ -384,6 +590,7 @@ func (s *Store) GetAllLeases(ctx context.Context) ([]*Lease, error) {
 			&lease.ID, &ipStr, &macStr, &lease.Hostname, &subnetStr,
 			&lease.IssuedAt, &lease.ExpiresAt, &lease.LastSeen, &lease.State,
 			&lease.ClientID, &lease.VendorClass, &lease.UserClass, &lease.AllocatedBy,
+			&lease.CircuitID, &lease.RemoteID, &lease.DeclinedAt, &lease.DeclinedBy,
 			&lease.CreatedAt, &lease.UpdatedAt,
 		)
 		if err != nil {
@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// leaseV6Columns is the column list shared by all DHCPv6 lease queries
+const leaseV6Columns = `id, ip::text, duid, iaid, mac::text, hostname, subnet::text, issued_at, expires_at,
+		       last_seen, state, allocated_by, created_at, updated_at`
+
+// scanLeaseV6 scans a single DHCPv6 lease row
+func scanLeaseV6(row pgx.Row) (*LeaseV6, error) {
+	var lease LeaseV6
+	var ipStr, subnetStr string
+	var iaid int64
+	var macStr, hostname, allocatedBy *string
+
+	err := row.Scan(
+		&lease.ID, &ipStr, &lease.DUID, &iaid, &macStr, &hostname, &subnetStr,
+		&lease.IssuedAt, &lease.ExpiresAt, &lease.LastSeen, &lease.State,
+		&allocatedBy, &lease.CreatedAt, &lease.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// PostgreSQL inet type returns CIDR notation (e.g., "2001:db8::10/128")
+	// so we need to handle both plain IP and CIDR formats
+	if ip, _, err := net.ParseCIDR(ipStr); err == nil {
+		lease.IP = ip
+	} else {
+		lease.IP = net.ParseIP(ipStr)
+	}
+	_, lease.Subnet, _ = net.ParseCIDR(subnetStr)
+	lease.IAID = uint32(iaid)
+
+	if macStr != nil {
+		lease.MAC, _ = net.ParseMAC(*macStr)
+	}
+	if hostname != nil {
+		lease.Hostname = *hostname
+	}
+	if allocatedBy != nil {
+		lease.AllocatedBy = *allocatedBy
+	}
+
+	return &lease, nil
+}
+
+// macOrNil converts an optional MAC address into a nullable query argument
+func macOrNil(mac net.HardwareAddr) interface{} {
+	if len(mac) == 0 {
+		return nil
+	}
+	return mac.String()
+}
+
+// GetLeaseV6ByDUID retrieves the active DHCPv6 lease for a client DUID and IAID
+func (s *Store) GetLeaseV6ByDUID(ctx context.Context, duid string, iaid uint32, subnet *net.IPNet) (*LeaseV6, error) {
+	query := `
+		SELECT ` + leaseV6Columns + `
+		FROM leases_v6
+		WHERE duid = $1 AND iaid = $2 AND subnet = $3 AND state = 'active'
+		ORDER BY expires_at DESC
+		LIMIT 1
+	`
+
+	lease, err := scanLeaseV6(s.pool.QueryRow(ctx, query, duid, int64(iaid), subnet.String()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DHCPv6 lease by DUID: %w", err)
+	}
+
+	return lease, nil
+}
+
+// GetLeaseV6ByIP retrieves a DHCPv6 lease by IP address
+func (s *Store) GetLeaseV6ByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*LeaseV6, error) {
+	query := `
+		SELECT ` + leaseV6Columns + `
+		FROM leases_v6
+		WHERE ip = $1 AND subnet = $2
+		ORDER BY expires_at DESC
+		LIMIT 1
+	`
+
+	lease, err := scanLeaseV6(s.pool.QueryRow(ctx, query, ip.String(), subnet.String()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DHCPv6 lease by IP: %w", err)
+	}
+
+	return lease, nil
+}
+
+// CreateLeaseV6 creates a new DHCPv6 lease record
+func (s *Store) CreateLeaseV6(ctx context.Context, lease *LeaseV6) error {
+	query := `
+		INSERT INTO leases_v6 (ip, duid, iaid, mac, hostname, subnet, issued_at, expires_at, last_seen, state, allocated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := s.pool.QueryRow(ctx, query,
+		lease.IP.String(),
+		lease.DUID,
+		int64(lease.IAID),
+		macOrNil(lease.MAC),
+		lease.Hostname,
+		lease.Subnet.String(),
+		lease.IssuedAt,
+		lease.ExpiresAt,
+		lease.LastSeen,
+		lease.State,
+		lease.AllocatedBy,
+	).Scan(&lease.ID, &lease.CreatedAt, &lease.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create DHCPv6 lease: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLeaseV6 updates an existing DHCPv6 lease record
+// Used to hand a previously expired or released address to a new client
+func (s *Store) UpdateLeaseV6(ctx context.Context, lease *LeaseV6) error {
+	query := `
+		UPDATE leases_v6
+		SET duid = $1, iaid = $2, mac = $3, hostname = $4, issued_at = $5, expires_at = $6,
+		    last_seen = $7, state = $8, allocated_by = $9
+		WHERE id = $10
+		RETURNING updated_at
+	`
+
+	err := s.pool.QueryRow(ctx, query,
+		lease.DUID,
+		int64(lease.IAID),
+		macOrNil(lease.MAC),
+		lease.Hostname,
+		lease.IssuedAt,
+		lease.ExpiresAt,
+		lease.LastSeen,
+		lease.State,
+		lease.AllocatedBy,
+		lease.ID,
+	).Scan(&lease.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to update DHCPv6 lease: %w", err)
+	}
+
+	return nil
+}
+
+// RenewLeaseV6 renews an existing DHCPv6 lease with a new expiration time
+func (s *Store) RenewLeaseV6(ctx context.Context, leaseID int64, expiresAt time.Time) error {
+	query := `
+		UPDATE leases_v6
+		SET expires_at = $1, last_seen = $2, state = 'active'
+		WHERE id = $3
+	`
+
+	_, err := s.pool.Exec(ctx, query, expiresAt, time.Now(), leaseID)
+	if err != nil {
+		return fmt.Errorf("failed to renew DHCPv6 lease: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseLeaseV6 marks a DHCPv6 lease as released
+// The DUID is checked so a client can only release its own bindings; ErrNoBinding means it has none
+func (s *Store) ReleaseLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error {
+	query := `
+		UPDATE leases_v6
+		SET state = 'released', last_seen = $1
+		WHERE duid = $2 AND ip = $3 AND subnet = $4
+	`
+
+	tag, err := s.pool.Exec(ctx, query, time.Now(), duid, ip.String(), subnet.String())
+	if err != nil {
+		return fmt.Errorf("failed to release DHCPv6 lease: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoBinding
+	}
+
+	return nil
+}
+
+// DeclineLeaseV6 marks a DHCPv6 lease as declined (duplicate address detected)
+// ErrNoBinding is returned if the client holds no binding for the address.
+func (s *Store) DeclineLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error {
+	query := `
+		UPDATE leases_v6
+		SET state = 'declined', last_seen = $1
+		WHERE duid = $2 AND ip = $3 AND subnet = $4
+	`
+
+	tag, err := s.pool.Exec(ctx, query, time.Now(), duid, ip.String(), subnet.String())
+	if err != nil {
+		return fmt.Errorf("failed to decline DHCPv6 lease: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoBinding
+	}
+
+	return nil
+}
+
+// GetExpiredLeasesV6 returns expired or released DHCPv6 leases in a pool range
+func (s *Store) GetExpiredLeasesV6(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP, limit int) ([]*LeaseV6, error) {
+	query := `
+		SELECT ` + leaseV6Columns + `
+		FROM leases_v6
+		WHERE subnet = $1
+		  AND ip >= $2
+		  AND ip <= $3
+		  AND state IN ('expired', 'released')
+		ORDER BY expires_at ASC
+		LIMIT $4
+	`
+
+	rows, err := s.pool.Query(ctx, query, subnet.String(), rangeStart.String(), rangeEnd.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired DHCPv6 leases: %w", err)
+	}
+	defer rows.Close()
+
+	var leases []*LeaseV6
+	for rows.Next() {
+		lease, err := scanLeaseV6(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan DHCPv6 lease: %w", err)
+		}
+		leases = append(leases, lease)
+	}
+
+	return leases, rows.Err()
+}
+
+// ExpireLeasesV6 marks all expired DHCPv6 leases as expired
+func (s *Store) ExpireLeasesV6(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE leases_v6
+		SET state = 'expired'
+		WHERE state = 'active' AND expires_at < $1
+	`
+
+	result, err := s.pool.Exec(ctx, query, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire DHCPv6 leases: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetAllLeasesV6 retrieves all DHCPv6 leases
+func (s *Store) GetAllLeasesV6(ctx context.Context) ([]*LeaseV6, error) {
+	query := `
+		SELECT ` + leaseV6Columns + `
+		FROM leases_v6
+		ORDER BY expires_at DESC
+	`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all DHCPv6 leases: %w", err)
+	}
+	defer rows.Close()
+
+	var leases []*LeaseV6
+	for rows.Next() {
+		lease, err := scanLeaseV6(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan DHCPv6 lease: %w", err)
+		}
+		leases = append(leases, lease)
+	}
+
+	return leases, rows.Err()
+}
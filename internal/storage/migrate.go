@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// createSchemaMigrations creates the table recording applied migrations
+const createSchemaMigrations = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)
+`
+
+// migrationLockKey is the advisory lock held while migrating, so servers
+// starting together against one database apply each migration once
+const migrationLockKey int64 = 0x69726f6e64686370 // "irondhcp"
+
+// Migration is one numbered schema change from migrations/NNN_name.sql
+// The optional NNN_name.down.sql alongside it reverts the change.
+type Migration struct {
+	Version  int
+	Name     string
+	Checksum string // SHA-256 of the up script, recorded when applied
+	up       string
+	down     string // Empty if the migration cannot be reverted
+}
+
+// MigrationStatus describes a migration known to the binary or recorded in the database
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Drifted   bool // The script changed after it was applied
+	Unknown   bool // Applied by a newer release; this binary does not have the script
+}
+
+// appliedMigration is a row of schema_migrations
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Migrator applies and reverts the embedded migrations on a PostgreSQL database
+type Migrator struct {
+	conn       *pgx.Conn
+	migrations []*Migration
+}
+
+// OpenMigrator connects to the database and prepares the schema_migrations table
+func OpenMigrator(ctx context.Context, connectionString string) (*Migrator, error) {
+	conn, err := pgx.Connect(ctx, connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	m, err := newMigrator(ctx, conn)
+	if err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// newMigrator prepares a migrator on an open connection; the caller keeps ownership of conn
+func newMigrator(ctx context.Context, conn *pgx.Conn) (*Migrator, error) {
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Exec(ctx, createSchemaMigrations); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return &Migrator{conn: conn, migrations: migrations}, nil
+}
+
+// Close closes the migrator's database connection
+func (m *Migrator) Close(ctx context.Context) {
+	m.conn.Close(ctx)
+}
+
+// Status reports every known or applied migration in version order
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []*MigrationStatus
+	for _, migration := range m.migrations {
+		status := &MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = row.appliedAt
+			status.Drifted = row.checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range applied {
+		statuses = append(statuses, &MigrationStatus{
+			Version:   version,
+			Name:      row.name,
+			Applied:   true,
+			AppliedAt: row.appliedAt,
+			Unknown:   true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order, each in its own transaction
+// It refuses to run if an applied migration's script has changed since.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var done []*Migration
+
+	err := m.withLock(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if row, ok := applied[migration.Version]; ok && row.checksum != migration.Checksum {
+				return fmt.Errorf("migration %s has changed since it was applied (recorded checksum %s, embedded %s)",
+					migration, row.checksum, migration.Checksum)
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the most recently applied migrations, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var done []*Migration
+
+	err := m.withLock(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		for _, version := range versions {
+			migration := m.find(version)
+			if migration == nil {
+				return fmt.Errorf("migration %03d_%s was applied by a newer release and cannot be reverted by this one",
+					version, applied[version].name)
+			}
+			if migration.down == "" {
+				return fmt.Errorf("migration %s has no down script", migration)
+			}
+			if err := m.revert(ctx, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// apply runs an up script and records it in one transaction
+func (m *Migrator) apply(ctx context.Context, migration *Migration) error {
+	return pgx.BeginFunc(ctx, m.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, migration.up); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", migration, err)
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, migration.Checksum)
+		if err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", migration, err)
+		}
+		return nil
+	})
+}
+
+// revert runs a down script and removes its record in one transaction
+func (m *Migrator) revert(ctx context.Context, migration *Migration) error {
+	return pgx.BeginFunc(ctx, m.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, migration.down); err != nil {
+			return fmt.Errorf("failed to revert migration %s: %w", migration, err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+			return fmt.Errorf("failed to remove record of migration %s: %w", migration, err)
+		}
+		return nil
+	})
+}
+
+// applied returns the rows of schema_migrations by version
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	rows, err := m.conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var row appliedMigration
+		if err := rows.Scan(&version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = row
+	}
+
+	return applied, rows.Err()
+}
+
+// withLock runs fn while holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if _, err := m.conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer m.conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	return fn()
+}
+
+// find returns the embedded migration with the given version
+func (m *Migrator) find(version int) *Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+// String returns the migration's file name without the extension
+func (m *Migration) String() string {
+	return fmt.Sprintf("%03d_%s", m.Version, m.Name)
+}
+
+// embeddedMigrations returns the migrations compiled into the binary
+func embeddedMigrations() ([]*Migration, error) {
+	fsys, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return loadMigrations(fsys)
+}
+
+// loadMigrations reads NNN_name.sql and NNN_name.down.sql files and orders them by version
+func loadMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	downs := make(map[int]string)
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(file, ".sql") {
+			continue
+		}
+
+		base := strings.TrimSuffix(file, ".sql")
+		isDown := strings.HasSuffix(base, ".down")
+		version, name, err := parseMigrationName(strings.TrimSuffix(base, ".down"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file %s: %w", file, err)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", file, err)
+		}
+
+		if isDown {
+			downs[version] = string(data)
+			continue
+		}
+		if existing, ok := byVersion[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %03d", existing, file, version)
+		}
+
+		sum := sha256.Sum256(data)
+		byVersion[version] = &Migration{
+			Version:  version,
+			Name:     name,
+			Checksum: hex.EncodeToString(sum[:]),
+			up:       string(data),
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for version, migration := range byVersion {
+		migration.down = downs[version]
+		delete(downs, version)
+		migrations = append(migrations, migration)
+	}
+	for version := range downs {
+		return nil, fmt.Errorf("down script for migration %03d has no up script", version)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parseMigrationName splits "001_initial_schema" into its version and name
+func parseMigrationName(base string) (int, string, error) {
+	prefix, name, ok := strings.Cut(base, "_")
+	if !ok || name == "" {
+		return 0, "", fmt.Errorf("expected NNN_name.sql")
+	}
+
+	version, err := strconv.Atoi(prefix)
+	if err != nil || version <= 0 {
+		return 0, "", fmt.Errorf("version %q is not a positive number", prefix)
+	}
+
+	return version, name, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		t.Fatalf("embeddedMigrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s: want version %03d, versions must be contiguous", m, i+1)
+		}
+		if m.down == "" {
+			t.Errorf("migration %s has no down script", m)
+		}
+		if len(m.Checksum) != 64 {
+			t.Errorf("migration %s: checksum %q is not SHA-256 hex", m, m.Checksum)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"010_second.sql":      {Data: []byte("SELECT 2;")},
+		"002_first.sql":       {Data: []byte("SELECT 1;")},
+		"002_first.down.sql":  {Data: []byte("SELECT -1;")},
+		"README.md":           {Data: []byte("not a migration")},
+		"subdir/003_skip.sql": {Data: []byte("SELECT 3;")},
+	}
+
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	if migrations[0].String() != "002_first" || migrations[1].String() != "010_second" {
+		t.Errorf("order = %s, %s; want 002_first, 010_second", migrations[0], migrations[1])
+	}
+	if migrations[0].down != "SELECT -1;" || migrations[1].down != "" {
+		t.Error("down scripts not paired with their migrations")
+	}
+}
+
+func TestLoadMigrationsRejectsBadFiles(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"duplicate version": {
+			"002_a.sql": {Data: []byte("SELECT 1;")},
+			"002_b.sql": {Data: []byte("SELECT 2;")},
+		},
+		"missing name":  {"003.sql": {Data: []byte("SELECT 1;")}},
+		"bad version":   {"abc_thing.sql": {Data: []byte("SELECT 1;")}},
+		"orphaned down": {"004_gone.down.sql": {Data: []byte("SELECT 1;")}},
+		"version zero":  {"000_zero.sql": {Data: []byte("SELECT 1;")}},
+	}
+
+	for name, fsys := range tests {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+-- Revert 001_initial_schema.sql
+-- Drops every table the server owns; all leases and reservations are lost
+
+DROP VIEW IF EXISTS lease_statistics;
+DROP FUNCTION IF EXISTS get_next_available_ip(CIDR, INET, INET);
+DROP TABLE IF EXISTS active_config;
+DROP TABLE IF EXISTS git_sync_log;
+DROP TABLE IF EXISTS reservations;
+DROP TABLE IF EXISTS leases;
+DROP FUNCTION IF EXISTS update_updated_at_column();
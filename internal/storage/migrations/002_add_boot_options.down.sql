@@ -0,0 +1,7 @@
+-- Revert 002_add_boot_options.sql
+
+DROP INDEX IF EXISTS idx_reservations_tftp;
+
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS tftp_server,
+DROP COLUMN IF EXISTS boot_filename;
@@ -0,0 +1,24 @@
+-- Revert 003_git_sync_audit.sql
+-- Restores the placeholder table from 001_initial_schema.sql; the audit history is lost
+
+DROP TABLE IF EXISTS git_sync_log CASCADE;
+
+CREATE TABLE git_sync_log (
+    id BIGSERIAL PRIMARY KEY,
+    commit_hash TEXT NOT NULL,
+    sync_started_at TIMESTAMPTZ NOT NULL,
+    sync_completed_at TIMESTAMPTZ,
+    status TEXT NOT NULL,  -- syncing, applied, failed
+    error_message TEXT,
+    config_diff TEXT,  -- Store the diff for audit
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_sync_status CHECK (status IN ('syncing', 'applied', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_git_sync_log_commit ON git_sync_log(commit_hash);
+CREATE INDEX IF NOT EXISTS idx_git_sync_log_status ON git_sync_log(status);
+CREATE INDEX IF NOT EXISTS idx_git_sync_log_created ON git_sync_log(created_at DESC);
+
+COMMENT ON TABLE git_sync_log IS 'Audit log of Git configuration synchronization events';
@@ -1,10 +1,23 @@
 -- Git sync audit log
 -- Tracks all git repository synchronization operations
 
--- Drop old version of table if it exists (from incomplete migration)
-DROP TABLE IF EXISTS git_sync_log CASCADE;
+-- Replace the placeholder table from 001_initial_schema.sql. Older releases
+-- re-ran this script on every start, so only drop a table that still has the
+-- old shape; an upgraded database keeps its audit history.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema()
+          AND table_name = 'git_sync_log'
+          AND column_name = 'triggered_by'
+    ) THEN
+        DROP TABLE IF EXISTS git_sync_log CASCADE;
+    END IF;
+END
+$$;
 
-CREATE TABLE git_sync_log (
+CREATE TABLE IF NOT EXISTS git_sync_log (
     id BIGSERIAL PRIMARY KEY,
     sync_started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     sync_completed_at TIMESTAMPTZ,
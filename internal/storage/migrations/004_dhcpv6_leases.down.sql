@@ -0,0 +1,3 @@
+-- Revert 004_dhcpv6_leases.sql
+
+DROP TABLE IF EXISTS leases_v6;
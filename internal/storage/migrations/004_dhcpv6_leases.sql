@@ -0,0 +1,43 @@
+-- DHCPv6 lease support
+-- IA_NA bindings are keyed by client DUID and IAID rather than MAC address
+
+CREATE TABLE IF NOT EXISTS leases_v6 (
+    id BIGSERIAL PRIMARY KEY,
+    ip INET NOT NULL,
+    duid TEXT NOT NULL,  -- Hex-encoded client DUID
+    iaid BIGINT NOT NULL,
+    mac MACADDR,         -- Link-layer address when derivable from DUID or relay
+    hostname TEXT,
+    subnet CIDR NOT NULL,
+
+    -- Lease timing
+    issued_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+
+    -- State
+    state TEXT NOT NULL DEFAULT 'active', -- active, expired, released, declined
+
+    -- Audit
+    allocated_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT unique_ip_v6_per_subnet UNIQUE(ip, subnet),
+    CONSTRAINT valid_state_v6 CHECK (state IN ('active', 'expired', 'released', 'declined'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_leases_v6_duid ON leases_v6(duid, iaid);
+CREATE INDEX IF NOT EXISTS idx_leases_v6_subnet ON leases_v6(subnet);
+CREATE INDEX IF NOT EXISTS idx_leases_v6_state ON leases_v6(state);
+CREATE INDEX IF NOT EXISTS idx_leases_v6_expires ON leases_v6(expires_at) WHERE state = 'active';
+
+DROP TRIGGER IF EXISTS update_leases_v6_updated_at ON leases_v6;
+CREATE TRIGGER update_leases_v6_updated_at
+    BEFORE UPDATE ON leases_v6
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE leases_v6 IS 'DHCPv6 IA_NA lease records keyed by client DUID and IAID';
+COMMENT ON COLUMN leases_v6.duid IS 'Hex-encoded DHCP Unique Identifier of the client';
+COMMENT ON COLUMN leases_v6.iaid IS 'Identity Association ID chosen by the client for this IA_NA';
@@ -0,0 +1,3 @@
+-- Revert 005_delegated_prefixes.sql
+
+DROP TABLE IF EXISTS delegated_prefixes;
@@ -0,0 +1,42 @@
+-- DHCPv6 prefix delegation (IA_PD) support
+-- Delegated prefixes are routed to a requesting router rather than assigned on-link
+
+CREATE TABLE IF NOT EXISTS delegated_prefixes (
+    id BIGSERIAL PRIMARY KEY,
+    prefix CIDR NOT NULL,
+    duid TEXT NOT NULL,  -- Hex-encoded client DUID
+    iaid BIGINT NOT NULL,
+    hostname TEXT,
+    subnet CIDR NOT NULL, -- Link the requesting router was found on
+    pool CIDR NOT NULL,   -- Prefix pool the delegation was carved from
+
+    -- Delegation timing
+    issued_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+
+    -- State
+    state TEXT NOT NULL DEFAULT 'active', -- active, expired, released
+
+    -- Audit
+    allocated_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT unique_delegated_prefix UNIQUE(prefix),
+    CONSTRAINT valid_state_pd CHECK (state IN ('active', 'expired', 'released'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_delegated_prefixes_duid ON delegated_prefixes(duid, iaid);
+CREATE INDEX IF NOT EXISTS idx_delegated_prefixes_pool ON delegated_prefixes(pool);
+CREATE INDEX IF NOT EXISTS idx_delegated_prefixes_state ON delegated_prefixes(state);
+CREATE INDEX IF NOT EXISTS idx_delegated_prefixes_expires ON delegated_prefixes(expires_at) WHERE state = 'active';
+
+DROP TRIGGER IF EXISTS update_delegated_prefixes_updated_at ON delegated_prefixes;
+CREATE TRIGGER update_delegated_prefixes_updated_at
+    BEFORE UPDATE ON delegated_prefixes
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE delegated_prefixes IS 'DHCPv6 IA_PD prefix delegations keyed by client DUID and IAID';
+COMMENT ON COLUMN delegated_prefixes.pool IS 'Configured prefix pool the delegated prefix belongs to';
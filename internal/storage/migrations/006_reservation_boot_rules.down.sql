@@ -0,0 +1,4 @@
+-- Revert 006_reservation_boot_rules.sql
+
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS boot_rules;
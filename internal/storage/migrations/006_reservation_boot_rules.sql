@@ -0,0 +1,7 @@
+-- Architecture-aware boot rules for reservations
+-- Rules are evaluated in order before the reservation's tftp_server/boot_filename defaults
+
+ALTER TABLE reservations
+ADD COLUMN IF NOT EXISTS boot_rules JSONB;
+
+COMMENT ON COLUMN reservations.boot_rules IS 'Ordered boot rules keyed on client architecture (option 93), user class or HTTP boot';
@@ -0,0 +1,16 @@
+-- Revert 007_relay_agent_info.sql
+-- Reservations keyed only on a relay agent have no MAC and are deleted
+
+DROP INDEX IF EXISTS idx_reservations_relay_agent;
+DROP INDEX IF EXISTS idx_leases_circuit_id;
+
+DELETE FROM reservations WHERE mac IS NULL;
+
+ALTER TABLE reservations
+ALTER COLUMN mac SET NOT NULL,
+DROP COLUMN IF EXISTS circuit_id,
+DROP COLUMN IF EXISTS remote_id;
+
+ALTER TABLE leases
+DROP COLUMN IF EXISTS circuit_id,
+DROP COLUMN IF EXISTS remote_id;
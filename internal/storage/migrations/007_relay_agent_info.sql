@@ -0,0 +1,23 @@
+-- Relay Agent Information (option 82) support
+-- Leases record the circuit-id/remote-id they were allocated through, and
+-- reservations can be keyed on them instead of a MAC address
+
+ALTER TABLE leases
+ADD COLUMN IF NOT EXISTS circuit_id TEXT,
+ADD COLUMN IF NOT EXISTS remote_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_leases_circuit_id ON leases(circuit_id) WHERE circuit_id IS NOT NULL;
+
+ALTER TABLE reservations
+ALTER COLUMN mac DROP NOT NULL,
+ADD COLUMN IF NOT EXISTS circuit_id TEXT,
+ADD COLUMN IF NOT EXISTS remote_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reservations_relay_agent
+    ON reservations(circuit_id, COALESCE(remote_id, ''))
+    WHERE circuit_id IS NOT NULL;
+
+COMMENT ON COLUMN leases.circuit_id IS 'Relay agent circuit-id (option 82 sub-option 1)';
+COMMENT ON COLUMN leases.remote_id IS 'Relay agent remote-id (option 82 sub-option 2)';
+COMMENT ON COLUMN reservations.circuit_id IS 'Match clients relayed through this circuit-id (e.g. switch port)';
+COMMENT ON COLUMN reservations.remote_id IS 'Match clients relayed by this remote-id (e.g. switch); empty matches any';
@@ -0,0 +1,7 @@
+-- Revert 008_decline_quarantine.sql
+
+DROP INDEX IF EXISTS idx_leases_declined;
+
+ALTER TABLE leases
+DROP COLUMN IF EXISTS declined_at,
+DROP COLUMN IF EXISTS declined_by;
@@ -0,0 +1,12 @@
+-- Declined address quarantine
+-- A declined lease keeps its row with expires_at moved to the end of the
+-- quarantine period; the quarantine worker returns it to the pool afterwards
+
+ALTER TABLE leases
+ADD COLUMN IF NOT EXISTS declined_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS declined_by TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_leases_declined ON leases(expires_at) WHERE state = 'declined';
+
+COMMENT ON COLUMN leases.declined_at IS 'When the address was declined or found in use';
+COMMENT ON COLUMN leases.declined_by IS 'MAC of the client that sent DHCPDECLINE, or ping_check';
@@ -0,0 +1,6 @@
+-- Revert 009_lease_allocated_by.sql
+
+DROP INDEX IF EXISTS idx_leases_allocated_by;
+
+ALTER TABLE leases
+DROP COLUMN IF EXISTS allocated_by;
@@ -0,0 +1,13 @@
+-- Track which server allocated each lease
+-- This enables debugging and monitoring in active/active deployments.
+-- Shipped as 002_add_server_id.sql but never applied, so databases created
+-- before versioned migrations are missing the column.
+
+-- Add allocated_by column (nullable for backward compatibility)
+ALTER TABLE leases ADD COLUMN IF NOT EXISTS allocated_by TEXT;
+
+-- Create index for querying by server
+CREATE INDEX IF NOT EXISTS idx_leases_allocated_by ON leases(allocated_by);
+
+-- Add comment
+COMMENT ON COLUMN leases.allocated_by IS 'Server ID that allocated this lease (for HA deployments)';
@@ -0,0 +1,5 @@
+-- Revert 010_deferrable_reservation_ip.sql
+
+ALTER TABLE reservations
+DROP CONSTRAINT IF EXISTS unique_reservation_ip,
+ADD CONSTRAINT unique_reservation_ip UNIQUE (ip, subnet);
@@ -0,0 +1,6 @@
+-- Let a GitOps sync swap the addresses of two reservations in one transaction
+-- The constraint is still checked per statement unless a transaction defers it.
+
+ALTER TABLE reservations
+DROP CONSTRAINT IF EXISTS unique_reservation_ip,
+ADD CONSTRAINT unique_reservation_ip UNIQUE (ip, subnet) DEFERRABLE INITIALLY IMMEDIATE;
@@ -0,0 +1,4 @@
+-- Revert 011_pinned_commit.sql
+
+ALTER TABLE active_config
+DROP COLUMN IF EXISTS pinned_commit;
@@ -0,0 +1,5 @@
+-- Keep the GitOps rollback pin next to the active config
+-- An empty string means the server follows the branch.
+
+ALTER TABLE active_config
+ADD COLUMN IF NOT EXISTS pinned_commit TEXT NOT NULL DEFAULT '';
@@ -3,6 +3,8 @@ package storage
 import (
 	"net"
 	"time"
+
+	"github.com/sashakarcz/irondhcp/internal/config"
 )
 
 // LeaseState represents the state of a DHCP lease
@@ -29,7 +31,11 @@ type Lease struct {
 	ClientID    string
 	VendorClass string
 	UserClass   string
-	AllocatedBy string // Server ID that allocated this lease (for HA)
+	AllocatedBy string     // Server ID that allocated this lease (for HA)
+	CircuitID   string     // Relay agent circuit-id (option 82 sub-option 1)
+	RemoteID    string     // Relay agent remote-id (option 82 sub-option 2)
+	DeclinedAt  *time.Time // When a conflict was reported; declined leases only
+	DeclinedBy  string     // MAC of the client that sent DHCPDECLINE, or "ping_check"
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
@@ -39,20 +45,126 @@ func (l *Lease) IsActive() bool {
 	return l.State == LeaseStateActive && l.ExpiresAt.After(time.Now())
 }
 
+// DeclinedAddress is an address held in quarantine after a conflict was reported
+type DeclinedAddress struct {
+	IP               net.IP
+	MAC              net.HardwareAddr // Client that held the lease, or the host that answered the ping check
+	Subnet           *net.IPNet
+	DeclinedBy       string // MAC of the client that sent DHCPDECLINE, or "ping_check"
+	DeclinedAt       time.Time
+	QuarantinedUntil time.Time
+	AllocatedBy      string // Server ID that recorded the decline (for HA)
+}
+
+// LeaseV6 represents a DHCPv6 IA_NA lease record
+// DHCPv6 clients are identified by DUID and IAID rather than by MAC address
+type LeaseV6 struct {
+	ID          int64
+	IP          net.IP
+	DUID        string           // Hex-encoded client DUID
+	IAID        uint32           // Identity Association ID
+	MAC         net.HardwareAddr // Optional, derived from DUID-LL/LLT or relay options
+	Hostname    string
+	Subnet      *net.IPNet
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+	LastSeen    time.Time
+	State       LeaseState
+	AllocatedBy string // Server ID that allocated this lease (for HA)
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// IsActive returns true if the lease is active and not expired
+func (l *LeaseV6) IsActive() bool {
+	return l.State == LeaseStateActive && l.ExpiresAt.After(time.Now())
+}
+
+// DelegatedPrefix represents a DHCPv6 IA_PD prefix delegation record
+type DelegatedPrefix struct {
+	ID          int64
+	Prefix      *net.IPNet
+	DUID        string // Hex-encoded client DUID
+	IAID        uint32 // Identity Association ID
+	Hostname    string
+	Subnet      *net.IPNet // Link the requesting router was found on
+	Pool        *net.IPNet // Prefix pool the delegation was carved from
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+	LastSeen    time.Time
+	State       LeaseState
+	AllocatedBy string // Server ID that allocated this prefix (for HA)
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// IsActive returns true if the delegation is active and not expired
+func (p *DelegatedPrefix) IsActive() bool {
+	return p.State == LeaseStateActive && p.ExpiresAt.After(time.Now())
+}
+
 // Reservation represents a static IP reservation
+// Clients are matched by MAC address, or by relay agent circuit-id/remote-id
 type Reservation struct {
 	ID           int64
-	MAC          net.HardwareAddr
+	MAC          net.HardwareAddr // Nil for reservations keyed on the relay agent
+	CircuitID    string           // Relay agent circuit-id (option 82 sub-option 1)
+	RemoteID     string           // Relay agent remote-id; empty matches any
 	IP           net.IP
 	Hostname     string
 	Subnet       *net.IPNet
 	Description  string
-	TFTPServer   string // DHCP option 66
-	BootFilename string // DHCP option 67
+	TFTPServer   string     // DHCP option 66
+	BootFilename string     // DHCP option 67
+	BootRules    []BootRule // Evaluated before TFTPServer/BootFilename
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
+// Key identifies the reservation for config sync
+func (r *Reservation) Key() string {
+	return ReservationKey(r.MAC, r.CircuitID, r.RemoteID)
+}
+
+// ReservationKey builds the sync key of a reservation from its match fields
+func ReservationKey(mac net.HardwareAddr, circuitID, remoteID string) string {
+	if len(mac) > 0 {
+		return mac.String()
+	}
+	return "relay:" + circuitID + "|" + remoteID
+}
+
+// ReservationChanges is a set of reservation writes applied together
+// Delete entries only need an ID; Update entries carry the ID of the row to change.
+type ReservationChanges struct {
+	Create []*Reservation
+	Update []*Reservation
+	Delete []*Reservation
+}
+
+// BootRule selects boot settings by client architecture or user class
+// Mirrors config.BootRuleConfig so config rules convert directly
+type BootRule struct {
+	Arch       []string `json:"arch,omitempty"`
+	UserClass  string   `json:"user_class,omitempty"`
+	HTTPBoot   bool     `json:"http_boot,omitempty"`
+	TFTPServer string   `json:"tftp_server,omitempty"`
+	Filename   string   `json:"filename"`
+}
+
+// BootRulesFromConfig converts configured boot rules into their stored form
+func BootRulesFromConfig(boot *config.BootConfig) []BootRule {
+	if boot == nil {
+		return nil
+	}
+
+	var rules []BootRule
+	for _, rule := range boot.Rules {
+		rules = append(rules, BootRule(rule))
+	}
+	return rules
+}
+
 // GitSyncStatus represents the status of a Git sync operation
 type GitSyncStatus string
 
@@ -66,9 +178,11 @@ const (
 type GitSyncTrigger string
 
 const (
-	GitSyncTriggerPoll    GitSyncTrigger = "poll"
-	GitSyncTriggerManual  GitSyncTrigger = "manual"
-	GitSyncTriggerStartup GitSyncTrigger = "startup"
+	GitSyncTriggerPoll     GitSyncTrigger = "poll"
+	GitSyncTriggerManual   GitSyncTrigger = "manual"
+	GitSyncTriggerStartup  GitSyncTrigger = "startup"
+	GitSyncTriggerWebhook  GitSyncTrigger = "webhook"
+	GitSyncTriggerRollback GitSyncTrigger = "rollback"
 )
 
 // GitSyncLog represents a Git synchronization event
@@ -8,7 +8,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// Store provides database operations for the DHCP server
+// Store provides PostgreSQL-backed database operations for the DHCP server
 type Store struct {
 	pool *pgxpool.Pool
 }
@@ -63,14 +63,23 @@ func (s *Store) Close() {
 	}
 }
 
+// Driver returns the database.driver name of the backend
+func (s *Store) Driver() string {
+	return DriverPostgres
+}
+
 // Health checks if the database connection is healthy
 func (s *Store) Health(ctx context.Context) error {
 	return s.pool.Ping(ctx)
 }
 
 // Stats returns connection pool statistics
-func (s *Store) Stats() *pgxpool.Stat {
-	return s.pool.Stat()
+func (s *Store) Stats() PoolStats {
+	stat := s.pool.Stat()
+	return PoolStats{
+		AcquiredConns: stat.AcquiredConns(),
+		MaxConns:      stat.MaxConns(),
+	}
 }
 
 // AcquireAdvisoryLock acquires a PostgreSQL advisory lock for the given key
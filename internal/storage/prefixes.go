@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// delegatedPrefixColumns is the column list shared by all prefix delegation queries
+const delegatedPrefixColumns = `id, prefix::text, duid, iaid, hostname, subnet::text, pool::text, issued_at,
+		       expires_at, last_seen, state, allocated_by, created_at, updated_at`
+
+// scanDelegatedPrefix scans a single prefix delegation row
+func scanDelegatedPrefix(row pgx.Row) (*DelegatedPrefix, error) {
+	var p DelegatedPrefix
+	var prefixStr, subnetStr, poolStr string
+	var iaid int64
+	var hostname, allocatedBy *string
+
+	err := row.Scan(
+		&p.ID, &prefixStr, &p.DUID, &iaid, &hostname, &subnetStr, &poolStr,
+		&p.IssuedAt, &p.ExpiresAt, &p.LastSeen, &p.State,
+		&allocatedBy, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, p.Prefix, _ = net.ParseCIDR(prefixStr)
+	_, p.Subnet, _ = net.ParseCIDR(subnetStr)
+	_, p.Pool, _ = net.ParseCIDR(poolStr)
+	p.IAID = uint32(iaid)
+
+	if hostname != nil {
+		p.Hostname = *hostname
+	}
+	if allocatedBy != nil {
+		p.AllocatedBy = *allocatedBy
+	}
+
+	return &p, nil
+}
+
+// queryDelegatedPrefixes runs a query returning a list of prefix delegations
+func (s *Store) queryDelegatedPrefixes(ctx context.Context, query string, args ...interface{}) ([]*DelegatedPrefix, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prefixes []*DelegatedPrefix
+	for rows.Next() {
+		p, err := scanDelegatedPrefix(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delegated prefix: %w", err)
+		}
+		prefixes = append(prefixes, p)
+	}
+
+	return prefixes, rows.Err()
+}
+
+// GetDelegatedPrefixByDUID retrieves the active delegation for a client DUID and IAID in a pool
+func (s *Store) GetDelegatedPrefixByDUID(ctx context.Context, duid string, iaid uint32, pool *net.IPNet) (*DelegatedPrefix, error) {
+	query := `
+		SELECT ` + delegatedPrefixColumns + `
+		FROM delegated_prefixes
+		WHERE duid = $1 AND iaid = $2 AND pool = $3 AND state = 'active'
+		ORDER BY expires_at DESC
+		LIMIT 1
+	`
+
+	p, err := scanDelegatedPrefix(s.pool.QueryRow(ctx, query, duid, int64(iaid), pool.String()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delegated prefix by DUID: %w", err)
+	}
+
+	return p, nil
+}
+
+// GetDelegatedPrefix retrieves the delegation record for a prefix
+func (s *Store) GetDelegatedPrefix(ctx context.Context, prefix *net.IPNet) (*DelegatedPrefix, error) {
+	query := `
+		SELECT ` + delegatedPrefixColumns + `
+		FROM delegated_prefixes
+		WHERE prefix = $1
+	`
+
+	p, err := scanDelegatedPrefix(s.pool.QueryRow(ctx, query, prefix.String()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delegated prefix: %w", err)
+	}
+
+	return p, nil
+}
+
+// CreateDelegatedPrefix creates a new prefix delegation record
+func (s *Store) CreateDelegatedPrefix(ctx context.Context, p *DelegatedPrefix) error {
+	query := `
+		INSERT INTO delegated_prefixes (prefix, duid, iaid, hostname, subnet, pool, issued_at, expires_at, last_seen, state, allocated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := s.pool.QueryRow(ctx, query,
+		p.Prefix.String(),
+		p.DUID,
+		int64(p.IAID),
+		p.Hostname,
+		p.Subnet.String(),
+		p.Pool.String(),
+		p.IssuedAt,
+		p.ExpiresAt,
+		p.LastSeen,
+		p.State,
+		p.AllocatedBy,
+	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create delegated prefix: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateDelegatedPrefix updates an existing prefix delegation record
+// Used to hand a previously expired or released prefix to a new client
+func (s *Store) UpdateDelegatedPrefix(ctx context.Context, p *DelegatedPrefix) error {
+	query := `
+		UPDATE delegated_prefixes
+		SET duid = $1, iaid = $2, hostname = $3, subnet = $4, issued_at = $5, expires_at = $6,
+		    last_seen = $7, state = $8, allocated_by = $9
+		WHERE id = $10
+		RETURNING updated_at
+	`
+
+	err := s.pool.QueryRow(ctx, query,
+		p.DUID,
+		int64(p.IAID),
+		p.Hostname,
+		p.Subnet.String(),
+		p.IssuedAt,
+		p.ExpiresAt,
+		p.LastSeen,
+		p.State,
+		p.AllocatedBy,
+		p.ID,
+	).Scan(&p.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to update delegated prefix: %w", err)
+	}
+
+	return nil
+}
+
+// RenewDelegatedPrefix renews an existing prefix delegation with a new expiration time
+func (s *Store) RenewDelegatedPrefix(ctx context.Context, id int64, expiresAt time.Time) error {
+	query := `
+		UPDATE delegated_prefixes
+		SET expires_at = $1, last_seen = $2, state = 'active'
+		WHERE id = $3
+	`
+
+	_, err := s.pool.Exec(ctx, query, expiresAt, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to renew delegated prefix: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseDelegatedPrefix marks a prefix delegation as released
+// The DUID is checked so a client can only release its own delegations; ErrNoBinding means it has none
+func (s *Store) ReleaseDelegatedPrefix(ctx context.Context, duid string, prefix *net.IPNet) error {
+	query := `
+		UPDATE delegated_prefixes
+		SET state = 'released', last_seen = $1
+		WHERE duid = $2 AND prefix = $3
+	`
+
+	tag, err := s.pool.Exec(ctx, query, time.Now(), duid, prefix.String())
+	if err != nil {
+		return fmt.Errorf("failed to release delegated prefix: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoBinding
+	}
+
+	return nil
+}
+
+// GetExpiredDelegatedPrefixes returns expired or released delegations carved from a pool
+func (s *Store) GetExpiredDelegatedPrefixes(ctx context.Context, pool *net.IPNet, limit int) ([]*DelegatedPrefix, error) {
+	query := `
+		SELECT ` + delegatedPrefixColumns + `
+		FROM delegated_prefixes
+		WHERE pool = $1
+		  AND state IN ('expired', 'released')
+		ORDER BY expires_at ASC
+		LIMIT $2
+	`
+
+	prefixes, err := s.queryDelegatedPrefixes(ctx, query, pool.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired delegated prefixes: %w", err)
+	}
+
+	return prefixes, nil
+}
+
+// ExpireDelegatedPrefixes marks all expired prefix delegations as expired
+func (s *Store) ExpireDelegatedPrefixes(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE delegated_prefixes
+		SET state = 'expired'
+		WHERE state = 'active' AND expires_at < $1
+	`
+
+	result, err := s.pool.Exec(ctx, query, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire delegated prefixes: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetAllDelegatedPrefixes retrieves all prefix delegations
+func (s *Store) GetAllDelegatedPrefixes(ctx context.Context) ([]*DelegatedPrefix, error) {
+	query := `
+		SELECT ` + delegatedPrefixColumns + `
+		FROM delegated_prefixes
+		ORDER BY expires_at DESC
+	`
+
+	prefixes, err := s.queryDelegatedPrefixes(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all delegated prefixes: %w", err)
+	}
+
+	return prefixes, nil
+}
@@ -2,37 +2,49 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 
 	"github.com/jackc/pgx/v5"
 )
 
-// GetReservationByMAC retrieves a reservation by MAC address
-func (s *Store) GetReservationByMAC(ctx context.Context, mac net.HardwareAddr) (*Reservation, error) {
-	query := `
-		SELECT id, mac::text, ip::text, hostname, subnet::text, description,
-		       tftp_server, boot_filename, created_at, updated_at
-		FROM reservations
-		WHERE mac = $1
-	`
+// reservationColumns is the column list shared by all reservation queries
+const reservationColumns = `id, mac::text, COALESCE(circuit_id, ''), COALESCE(remote_id, ''), host(ip), hostname,
+		       subnet::text, description, tftp_server, boot_filename, boot_rules, created_at, updated_at`
 
+// scanReservation scans a single reservation row
+func scanReservation(row pgx.Row) (*Reservation, error) {
 	var reservation Reservation
-	var macStr, ipStr, subnetStr string
-	var tftpServer, bootFilename *string
+	var ipStr, subnetStr string
+	var macStr, tftpServer, bootFilename *string
+	var bootRules []byte
 
-	err := s.pool.QueryRow(ctx, query, mac.String()).Scan(
+	err := row.Scan(
 		&reservation.ID,
 		&macStr,
+		&reservation.CircuitID,
+		&reservation.RemoteID,
 		&ipStr,
 		&reservation.Hostname,
 		&subnetStr,
 		&reservation.Description,
 		&tftpServer,
 		&bootFilename,
+		&bootRules,
 		&reservation.CreatedAt,
 		&reservation.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse MAC, IP and subnet
+	if macStr != nil {
+		reservation.MAC, _ = net.ParseMAC(*macStr)
+	}
+	reservation.IP = net.ParseIP(ipStr)
+	_, reservation.Subnet, _ = net.ParseCIDR(subnetStr)
 
 	if tftpServer != nil {
 		reservation.TFTPServer = *tftpServer
@@ -40,7 +52,64 @@ func (s *Store) GetReservationByMAC(ctx context.Context, mac net.HardwareAddr) (
 	if bootFilename != nil {
 		reservation.BootFilename = *bootFilename
 	}
+	if len(bootRules) > 0 {
+		if err := json.Unmarshal(bootRules, &reservation.BootRules); err != nil {
+			return nil, fmt.Errorf("failed to decode boot rules: %w", err)
+		}
+	}
+
+	return &reservation, nil
+}
+
+// bootRulesArg converts boot rules into a nullable JSONB query argument
+func bootRulesArg(rules []BootRule) (interface{}, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode boot rules: %w", err)
+	}
+	return string(data), nil
+}
+
+// textOrNil converts an optional string into a nullable query argument
+func textOrNil(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// queryReservations runs a query returning a list of reservations
+func (s *Store) queryReservations(ctx context.Context, query string, args ...interface{}) ([]*Reservation, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []*Reservation
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reservation: %w", err)
+		}
+		reservations = append(reservations, reservation)
+	}
 
+	return reservations, rows.Err()
+}
+
+// GetReservationByMAC retrieves a reservation by MAC address
+func (s *Store) GetReservationByMAC(ctx context.Context, mac net.HardwareAddr) (*Reservation, error) {
+	query := `
+		SELECT ` + reservationColumns + `
+		FROM reservations
+		WHERE mac = $1
+	`
+
+	reservation, err := scanReservation(s.pool.QueryRow(ctx, query, mac.String()))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -48,78 +117,85 @@ func (s *Store) GetReservationByMAC(ctx context.Context, mac net.HardwareAddr) (
 		return nil, fmt.Errorf("failed to get reservation by MAC: %w", err)
 	}
 
-	// Parse MAC, IP and subnet
-	reservation.MAC, _ = net.ParseMAC(macStr)
-	reservation.IP = net.ParseIP(ipStr)
-	_, reservation.Subnet, _ = net.ParseCIDR(subnetStr)
-
-	return &reservation, nil
+	return reservation, nil
 }
 
 // GetReservationByIP retrieves a reservation by IP address
 func (s *Store) GetReservationByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*Reservation, error) {
 	query := `
-		SELECT id, mac::text, ip::text, hostname, subnet::text, description,
-		       tftp_server, boot_filename, created_at, updated_at
+		SELECT ` + reservationColumns + `
 		FROM reservations
 		WHERE ip = $1 AND subnet = $2
 	`
 
-	var reservation Reservation
-	var macStr, ipStr, subnetStr string
-	var tftpServer, bootFilename *string
-
-	err := s.pool.QueryRow(ctx, query, ip.String(), subnet.String()).Scan(
-		&reservation.ID,
-		&macStr,
-		&ipStr,
-		&reservation.Hostname,
-		&subnetStr,
-		&reservation.Description,
-		&tftpServer,
-		&bootFilename,
-		&reservation.CreatedAt,
-		&reservation.UpdatedAt,
-	)
-
-	if tftpServer != nil {
-		reservation.TFTPServer = *tftpServer
+	reservation, err := scanReservation(s.pool.QueryRow(ctx, query, ip.String(), subnet.String()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
 	}
-	if bootFilename != nil {
-		reservation.BootFilename = *bootFilename
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reservation by IP: %w", err)
 	}
 
+	return reservation, nil
+}
+
+// GetReservationByRelayAgent retrieves a reservation keyed on relay agent information
+// A reservation with a remote-id only matches that remote-id; one without matches any
+func (s *Store) GetReservationByRelayAgent(ctx context.Context, circuitID, remoteID string, subnet *net.IPNet) (*Reservation, error) {
+	query := `
+		SELECT ` + reservationColumns + `
+		FROM reservations
+		WHERE circuit_id = $1
+		  AND (remote_id IS NULL OR remote_id = '' OR remote_id = $2)
+		  AND subnet = $3
+		ORDER BY COALESCE(remote_id, '') DESC
+		LIMIT 1
+	`
+
+	reservation, err := scanReservation(s.pool.QueryRow(ctx, query, circuitID, remoteID, subnet.String()))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get reservation by IP: %w", err)
+		return nil, fmt.Errorf("failed to get reservation by relay agent: %w", err)
 	}
 
-	// Parse MAC, IP and subnet
-	reservation.MAC, _ = net.ParseMAC(macStr)
-	reservation.IP = net.ParseIP(ipStr)
-	_, reservation.Subnet, _ = net.ParseCIDR(subnetStr)
+	return reservation, nil
+}
 
-	return &reservation, nil
+// reservationQuerier is the part of a pool or transaction reservation writes use
+type reservationQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
 }
 
 // CreateReservation creates a new reservation
 func (s *Store) CreateReservation(ctx context.Context, reservation *Reservation) error {
+	return createReservation(ctx, s.pool, reservation)
+}
+
+func createReservation(ctx context.Context, q reservationQuerier, reservation *Reservation) error {
 	query := `
-		INSERT INTO reservations (mac, ip, hostname, subnet, description, tftp_server, boot_filename)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO reservations (mac, circuit_id, remote_id, ip, hostname, subnet, description, tftp_server, boot_filename, boot_rules)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := s.pool.QueryRow(ctx, query,
-		reservation.MAC.String(),
+	bootRules, err := bootRulesArg(reservation.BootRules)
+	if err != nil {
+		return err
+	}
+
+	err = q.QueryRow(ctx, query,
+		macOrNil(reservation.MAC),
+		textOrNil(reservation.CircuitID),
+		textOrNil(reservation.RemoteID),
 		reservation.IP.String(),
 		reservation.Hostname,
 		reservation.Subnet.String(),
 		reservation.Description,
 		reservation.TFTPServer,
 		reservation.BootFilename,
+		bootRules,
 	).Scan(&reservation.ID, &reservation.CreatedAt, &reservation.UpdatedAt)
 
 	if err != nil {
@@ -131,20 +207,33 @@ func (s *Store) CreateReservation(ctx context.Context, reservation *Reservation)
 
 // UpdateReservation updates an existing reservation
 func (s *Store) UpdateReservation(ctx context.Context, reservation *Reservation) error {
+	return updateReservation(ctx, s.pool, reservation)
+}
+
+func updateReservation(ctx context.Context, q reservationQuerier, reservation *Reservation) error {
 	query := `
 		UPDATE reservations
-		SET ip = $1, hostname = $2, subnet = $3, description = $4, tftp_server = $5, boot_filename = $6
-		WHERE id = $7
+		SET ip = $1, hostname = $2, subnet = $3, description = $4, tftp_server = $5, boot_filename = $6,
+		    boot_rules = $7, circuit_id = $8, remote_id = $9
+		WHERE id = $10
 		RETURNING updated_at
 	`
 
-	err := s.pool.QueryRow(ctx, query,
+	bootRules, err := bootRulesArg(reservation.BootRules)
+	if err != nil {
+		return err
+	}
+
+	err = q.QueryRow(ctx, query,
 		reservation.IP.String(),
 		reservation.Hostname,
 		reservation.Subnet.String(),
 		reservation.Description,
 		reservation.TFTPServer,
 		reservation.BootFilename,
+		bootRules,
+		textOrNil(reservation.CircuitID),
+		textOrNil(reservation.RemoteID),
 		reservation.ID,
 	).Scan(&reservation.UpdatedAt)
 
@@ -179,111 +268,68 @@ func (s *Store) DeleteAllReservations(ctx context.Context) error {
 	return nil
 }
 
+// ApplyReservationChanges deletes, updates and creates reservations in one transaction
+// The unique address constraint is deferred to commit, so reservations may swap
+// addresses; any failure rolls back every change.
+func (s *Store) ApplyReservationChanges(ctx context.Context, changes *ReservationChanges) error {
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SET CONSTRAINTS unique_reservation_ip DEFERRED`); err != nil {
+			return fmt.Errorf("failed to defer reservation constraints: %w", err)
+		}
+
+		for _, reservation := range changes.Delete {
+			if _, err := tx.Exec(ctx, `DELETE FROM reservations WHERE id = $1`, reservation.ID); err != nil {
+				return fmt.Errorf("failed to delete reservation %s: %w", reservation.Key(), err)
+			}
+		}
+		for _, reservation := range changes.Update {
+			if err := updateReservation(ctx, tx, reservation); err != nil {
+				return fmt.Errorf("reservation %s: %w", reservation.Key(), err)
+			}
+		}
+		for _, reservation := range changes.Create {
+			if err := createReservation(ctx, tx, reservation); err != nil {
+				return fmt.Errorf("reservation %s: %w", reservation.Key(), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply reservation changes: %w", err)
+	}
+
+	return nil
+}
+
 // GetAllReservations retrieves all reservations
 func (s *Store) GetAllReservations(ctx context.Context) ([]*Reservation, error) {
 	query := `
-		SELECT id, mac::text, host(ip), hostname, subnet::text, description,
-		       tftp_server, boot_filename, created_at, updated_at
+		SELECT ` + reservationColumns + `
 		FROM reservations
 		ORDER BY subnet, ip
 	`
 
-	rows, err := s.pool.Query(ctx, query)
+	reservations, err := s.queryReservations(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all reservations: %w", err)
 	}
-	defer rows.Close()
-
-	var reservations []*Reservation
-	for rows.Next() {
-		var reservation Reservation
-		var macStr, ipStr, subnetStr string
-		var tftpServer, bootFilename *string
-
-		err := rows.Scan(
-			&reservation.ID,
-			&macStr,
-			&ipStr,
-			&reservation.Hostname,
-			&subnetStr,
-			&reservation.Description,
-			&tftpServer,
-			&bootFilename,
-			&reservation.CreatedAt,
-			&reservation.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan reservation: %w", err)
-		}
-
-		reservation.MAC, _ = net.ParseMAC(macStr)
-		reservation.IP = net.ParseIP(ipStr)
-		_, reservation.Subnet, _ = net.ParseCIDR(subnetStr)
-
-		if tftpServer != nil {
-			reservation.TFTPServer = *tftpServer
-		}
-		if bootFilename != nil {
-			reservation.BootFilename = *bootFilename
-		}
-
-		reservations = append(reservations, &reservation)
-	}
 
-	return reservations, rows.Err()
+	return reservations, nil
 }
 
 // GetReservationsBySubnet retrieves all reservations for a specific subnet
 func (s *Store) GetReservationsBySubnet(ctx context.Context, subnet *net.IPNet) ([]*Reservation, error) {
 	query := `
-		SELECT id, mac::text, ip::text, hostname, subnet::text, description,
-		       tftp_server, boot_filename, created_at, updated_at
+		SELECT ` + reservationColumns + `
 		FROM reservations
 		WHERE subnet = $1
 		ORDER BY ip
 	`
 
-	rows, err := s.pool.Query(ctx, query, subnet.String())
+	reservations, err := s.queryReservations(ctx, query, subnet.String())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get reservations by subnet: %w", err)
 	}
-	defer rows.Close()
 
-	var reservations []*Reservation
-	for rows.Next() {
-		var reservation Reservation
-		var macStr, ipStr, subnetStr string
-		var tftpServer, bootFilename *string
-
-		err := rows.Scan(
-			&reservation.ID,
-			&macStr,
-			&ipStr,
-			&reservation.Hostname,
-			&subnetStr,
-			&reservation.Description,
-			&tftpServer,
-			&bootFilename,
-			&reservation.CreatedAt,
-			&reservation.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan reservation: %w", err)
-		}
-
-		reservation.MAC, _ = net.ParseMAC(macStr)
-		reservation.IP = net.ParseIP(ipStr)
-		_, reservation.Subnet, _ = net.ParseCIDR(subnetStr)
-
-		if tftpServer != nil {
-			reservation.TFTPServer = *tftpServer
-		}
-		if bootFilename != nil {
-			reservation.BootFilename = *bootFilename
-		}
-
-		reservations = append(reservations, &reservation)
-	}
-
-	return reservations, rows.Err()
+	return reservations, nil
 }
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// Storage drivers selectable with database.driver
+const (
+	DriverPostgres = "postgres"
+	DriverBolt     = "bolt"
+	DriverMemory   = "memory"
+)
+
+// ErrLeaseHeldByOther is returned when a client declines an address actively leased to another client
+var ErrLeaseHeldByOther = errors.New("address is leased to another client")
+
+// ErrNoBinding is returned when a client releases or declines a DHCPv6 binding it does not hold
+var ErrNoBinding = errors.New("no binding for this client")
+
+// LeaseStore persists DHCPv4 leases, DHCPv6 leases and delegated prefixes
+type LeaseStore interface {
+	GetLeaseByMAC(ctx context.Context, mac net.HardwareAddr, subnet *net.IPNet) (*Lease, error)
+	GetLeaseByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*Lease, error)
+	CreateLease(ctx context.Context, lease *Lease) error
+	UpdateLease(ctx context.Context, lease *Lease) error
+	ApplyReplicatedLease(ctx context.Context, lease *Lease) error
+	RenewLease(ctx context.Context, leaseID int64, expiresAt time.Time) error
+	RenewLeases(ctx context.Context, renewals []LeaseRenewal) error
+	ReleaseLease(ctx context.Context, ip net.IP, subnet *net.IPNet) error
+	DeclineLease(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, until time.Time, allocatedBy string) error
+	QuarantineIP(ctx context.Context, ip net.IP, subnet *net.IPNet, mac net.HardwareAddr, until time.Time, allocatedBy string) error
+	ReclaimDeclinedLeases(ctx context.Context) (int64, error)
+	GetDeclinedAddresses(ctx context.Context) ([]*DeclinedAddress, error)
+	GetExpiredLeases(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP, limit int) ([]*Lease, error)
+	GetLeasedIPs(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP) ([]net.IP, error)
+	ExpireOldLeases(ctx context.Context) (int64, error)
+	DeleteOldLeases(ctx context.Context, olderThan time.Duration) (int64, error)
+	GetLeaseStatistics(ctx context.Context) ([]*LeaseStatistics, error)
+	GetActiveLeaseCount(ctx context.Context, subnet *net.IPNet) (int64, error)
+	ExpireLeases(ctx context.Context) (int64, error)
+	GetAllLeases(ctx context.Context) ([]*Lease, error)
+
+	GetLeaseV6ByDUID(ctx context.Context, duid string, iaid uint32, subnet *net.IPNet) (*LeaseV6, error)
+	GetLeaseV6ByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*LeaseV6, error)
+	CreateLeaseV6(ctx context.Context, lease *LeaseV6) error
+	UpdateLeaseV6(ctx context.Context, lease *LeaseV6) error
+	RenewLeaseV6(ctx context.Context, leaseID int64, expiresAt time.Time) error
+	ReleaseLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error
+	DeclineLeaseV6(ctx context.Context, duid string, ip net.IP, subnet *net.IPNet) error
+	GetExpiredLeasesV6(ctx context.Context, subnet *net.IPNet, rangeStart, rangeEnd net.IP, limit int) ([]*LeaseV6, error)
+	ExpireLeasesV6(ctx context.Context) (int64, error)
+	GetAllLeasesV6(ctx context.Context) ([]*LeaseV6, error)
+
+	GetDelegatedPrefixByDUID(ctx context.Context, duid string, iaid uint32, pool *net.IPNet) (*DelegatedPrefix, error)
+	GetDelegatedPrefix(ctx context.Context, prefix *net.IPNet) (*DelegatedPrefix, error)
+	CreateDelegatedPrefix(ctx context.Context, p *DelegatedPrefix) error
+	UpdateDelegatedPrefix(ctx context.Context, p *DelegatedPrefix) error
+	RenewDelegatedPrefix(ctx context.Context, id int64, expiresAt time.Time) error
+	ReleaseDelegatedPrefix(ctx context.Context, duid string, prefix *net.IPNet) error
+	GetExpiredDelegatedPrefixes(ctx context.Context, pool *net.IPNet, limit int) ([]*DelegatedPrefix, error)
+	ExpireDelegatedPrefixes(ctx context.Context) (int64, error)
+	GetAllDelegatedPrefixes(ctx context.Context) ([]*DelegatedPrefix, error)
+
+	// WithAdvisoryLock runs fn while holding an exclusive lock on key.
+	// PostgreSQL locks span every server sharing the database; the embedded
+	// backend only ever has one server, so an in-process lock is enough.
+	WithAdvisoryLock(ctx context.Context, key int64, fn func(context.Context) error) error
+}
+
+// ReservationStore persists static reservations
+type ReservationStore interface {
+	GetReservationByMAC(ctx context.Context, mac net.HardwareAddr) (*Reservation, error)
+	GetReservationByIP(ctx context.Context, ip net.IP, subnet *net.IPNet) (*Reservation, error)
+	GetReservationByRelayAgent(ctx context.Context, circuitID, remoteID string, subnet *net.IPNet) (*Reservation, error)
+	CreateReservation(ctx context.Context, reservation *Reservation) error
+	UpdateReservation(ctx context.Context, reservation *Reservation) error
+	DeleteReservation(ctx context.Context, id int64) error
+	DeleteAllReservations(ctx context.Context) error
+
+	// ApplyReservationChanges makes every change or none of them. Uniqueness is
+	// checked against the final state, so reservations may swap addresses.
+	ApplyReservationChanges(ctx context.Context, changes *ReservationChanges) error
+
+	GetAllReservations(ctx context.Context) ([]*Reservation, error)
+	GetReservationsBySubnet(ctx context.Context, subnet *net.IPNet) ([]*Reservation, error)
+}
+
+// GitSyncStore records GitOps sync attempts
+type GitSyncStore interface {
+	CreateGitSyncLog(ctx context.Context, log *GitSyncLog) error
+	UpdateGitSyncLog(ctx context.Context, log *GitSyncLog) error
+	GetGitSyncLog(ctx context.Context, id int64) (*GitSyncLog, error)
+	GetRecentGitSyncLogs(ctx context.Context, limit int) ([]*GitSyncLog, error)
+	GetLastSuccessfulSync(ctx context.Context) (*GitSyncLog, error)
+
+	// GetActiveConfig returns the last applied subnet configuration, or nil if none was recorded
+	GetActiveConfig(ctx context.Context) (*ActiveConfig, error)
+	SetActiveConfig(ctx context.Context, cfg *ActiveConfig) error
+
+	// GetPinnedCommit returns the commit a rollback pinned the config to, or "" if it follows the branch
+	GetPinnedCommit(ctx context.Context) (string, error)
+	SetPinnedCommit(ctx context.Context, hash string) error
+}
+
+// Backend is a complete storage driver
+type Backend interface {
+	LeaseStore
+	ReservationStore
+	GitSyncStore
+
+	// Driver returns the database.driver name of the backend
+	Driver() string
+	// Health checks that the backend can serve requests
+	Health(ctx context.Context) error
+	// Stats returns connection usage for health checks
+	Stats() PoolStats
+	// Close releases the backend's resources
+	Close()
+}
+
+// PoolStats summarises database connection usage
+// Backends without a connection pool report zero values
+type PoolStats struct {
+	AcquiredConns int32
+	MaxConns      int32
+}
+
+var (
+	_ Backend = (*Store)(nil)
+	_ Backend = (*EmbeddedStore)(nil)
+	_ Backend = (*BatchedStore)(nil)
+)
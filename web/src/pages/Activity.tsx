@@ -26,6 +26,7 @@ const eventConfig: Record<string, { icon: any; color: string; bgColor: string }>
   dhcp_nak: { icon: XCircle, color: 'text-red-600', bgColor: 'bg-red-50' },
   dhcp_release: { icon: WifiOff, color: 'text-orange-600', bgColor: 'bg-orange-50' },
   dhcp_decline: { icon: AlertCircle, color: 'text-red-600', bgColor: 'bg-red-50' },
+  ip_conflict: { icon: AlertCircle, color: 'text-red-600', bgColor: 'bg-red-50' },
   git_sync: { icon: ActivityIcon, color: 'text-purple-600', bgColor: 'bg-purple-50' },
   connection: { icon: CheckCircle, color: 'text-gray-600', bgColor: 'bg-gray-50' },
 };